@@ -1,24 +1,35 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 
+	"github.com/anras5/todo-app-backend/internal/auth"
 	"github.com/anras5/todo-app-backend/internal/config"
 	"github.com/anras5/todo-app-backend/internal/driver"
 	rpc "github.com/anras5/todo-app-backend/internal/grpc"
 	"github.com/anras5/todo-app-backend/internal/handlers"
 )
 
-const port = ":8080"
-
 var app config.Application
 var infoLog *log.Logger
 var errorLog *log.Logger
 
 func main() {
+	// -------------------------------------------------------------------------------------------- //
+	// Load the configuration, the flags override the environment, which overrides the file
+	cfg, args, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration! Dying...\n%v", err)
+	}
 
 	// -------------------------------------------------------------------------------------------- //
 	// Set up loggers
@@ -26,34 +37,81 @@ func main() {
 	app.InfoLog = infoLog
 	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 	app.ErrorLog = errorLog
+	app.Configure(cfg)
 
 	// -------------------------------------------------------------------------------------------- //
-	// Connect to database
-	app.InfoLog.Println("Connecting to database on port 5432")
-	db, err := driver.ConnectSQL(fmt.Sprintf("host=postgres-db port=5432 dbname=todos user=%s password=%s sslmode=%s",
-		os.Getenv("DB_USER"), os.Getenv("DB_PASSWD"), os.Getenv("SSL_MODE")))
-	if err != nil {
-		log.Fatal("Cannot connect to database! Dying...")
-	} else {
-		log.Println("Connected to database")
+	// Migrate the schema instead of serving with the migrate subcommand
+	if len(args) > 0 && args[0] == "migrate" {
+		runMigrate(cfg, args[1:])
+		return
+	}
+	if len(args) > 0 {
+		log.Fatalf("Unknown command %q, the only one is migrate! Dying...", args[0])
+	}
+
+	// -------------------------------------------------------------------------------------------- //
+	// Set up authentication
+	if cfg.JWTSecret == "" {
+		log.Fatal("JWT_SECRET is not set! Dying...")
+	}
+	app.Auth = &auth.Auth{
+		Secret:   []byte(cfg.JWTSecret),
+		Issuer:   "todo-app-backend",
+		TokenTTL: cfg.TokenTTL,
 	}
-	defer db.Close()
 
 	// -------------------------------------------------------------------------------------------- //
 	// set repo and handlers
-	repo := handlers.NewRepo(&app, db)
+	var repo *handlers.Repository
+	switch cfg.Store {
+	case "postgres":
+		app.InfoLog.Printf("Connecting to database on %s:%d", cfg.Database.Host, cfg.Database.Port)
+		db, err := driver.ConnectSQL(app.DSN, cfg.Pool())
+		if err != nil {
+			log.Fatal("Cannot connect to database! Dying...")
+		} else {
+			log.Println("Connected to database")
+		}
+		defer db.Close()
+		repo = handlers.NewRepo(&app, db)
+	case "sqlite":
+		app.InfoLog.Println("Opening database in", app.DSN)
+		db, err := driver.ConnectSQLite(app.DSN, cfg.Pool())
+		if err != nil {
+			log.Fatal("Cannot open database! Dying...")
+		}
+		defer db.Close()
+		repo = handlers.NewSQLiteRepo(&app, db)
+	case "memory":
+		app.InfoLog.Println("Keeping the data in memory, it is lost once the server stops")
+		repo = handlers.NewMemoryRepo(&app)
+	}
 	handlers.NewHandlers(repo)
 
+	// -------------------------------------------------------------------------------------------- //
+	// Purge the trash in the background
+	if app.Features.PurgeTrash {
+		go purgeTrash(context.Background(), repo.DB, app.TrashRetention)
+	}
+
+	// -------------------------------------------------------------------------------------------- //
+	// Deliver webhooks in the background
+	if app.Features.Webhooks {
+		go repo.Webhooks.Run(context.Background(), cfg.WebhookInterval)
+	}
+
 	// -------------------------------------------------------------------------------------------- //
 	// Start gRPC server
-	grpcServer := rpc.NewTodoServer(db)
-	go grpcServer.Run()
+	if app.Features.GRPC {
+		grpcServer := rpc.NewTodoServer(repo.DB, repo.Events, app.Auth)
+		go grpcServer.Run(fmt.Sprintf(":%d", cfg.GRPCPort))
+	}
 
 	srv := &http.Server{
-		Addr:    port,
+		Addr:    fmt.Sprintf(":%d", cfg.HTTPPort),
 		Handler: routes(),
 	}
-	app.InfoLog.Println("Listening on port 8080")
+	app.InfoLog.Println("Listening on port", cfg.HTTPPort)
 	err = srv.ListenAndServe()
 	log.Fatal(err)
 }
@@ -2,19 +2,42 @@ package main
 
 import (
 	"net/http"
+	"slices"
+
+	"github.com/anras5/todo-app-backend/internal/auth"
 )
 
+// EnableCORS allows the configured origins to call the APIs from a browser. The origin of the request
+// is sent back when it is allowed, so that credentials work with several origins, or with any of them.
 func EnableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		writer.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
+		origin := request.Header.Get("Origin")
+		writer.Header().Add("Vary", "Origin")
+		if origin != "" && (slices.Contains(app.CORSOrigins, origin) || slices.Contains(app.CORSOrigins, "*")) {
+			writer.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		writer.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 		if request.Method == "OPTIONS" {
 			writer.Header().Set("Access-Control-Allow-Credentials", "true")
 			writer.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
-			writer.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, X-CSRF-Token, Authorization")
+			writer.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, X-CSRF-Token, Authorization, If-Match, Last-Event-ID")
 			return
 		} else {
 			next.ServeHTTP(writer, request)
 		}
 	})
 }
+
+// Authenticate rejects requests without a valid bearer token and stores the user id in the request context
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		userID, err := app.Auth.ParseAuthorizationHeader(request.Header.Get("Authorization"))
+		if err != nil {
+			_ = app.ErrorJSON(writer, err, http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(writer, request.WithContext(auth.WithUserID(request.Context(), userID)))
+	})
+}
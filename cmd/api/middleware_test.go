@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var theCORSTests = []struct {
+	name     string
+	origins  []string
+	origin   string
+	expected string
+}{
+	{name: "allowed origin", origins: []string{"http://localhost:3000", "https://todo.example.com"}, origin: "https://todo.example.com", expected: "https://todo.example.com"},
+	{name: "other origin", origins: []string{"http://localhost:3000"}, origin: "https://evil.example.com", expected: ""},
+	{name: "any origin", origins: []string{"*"}, origin: "https://todo.example.com", expected: "https://todo.example.com"},
+	{name: "no origin", origins: []string{"*"}, origin: "", expected: ""},
+}
+
+func TestEnableCORS(t *testing.T) {
+	defer func(origins []string) { app.CORSOrigins = origins }(app.CORSOrigins)
+
+	for _, e := range theCORSTests {
+		app.CORSOrigins = e.origins
+		req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+		if e.origin != "" {
+			req.Header.Set("Origin", e.origin)
+		}
+		rr := httptest.NewRecorder()
+		EnableCORS(&MyHandler{}).ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != e.expected {
+			t.Errorf("%s allowed wrong origin: got %q, wanted %q", e.name, got, e.expected)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/anras5/todo-app-backend/internal/config"
+	"github.com/anras5/todo-app-backend/internal/driver"
+	"github.com/anras5/todo-app-backend/internal/migrate"
+	"github.com/anras5/todo-app-backend/migrations"
+)
+
+const migrateUsage = "usage: api migrate up | down | status | to <version>"
+
+// runMigrate runs the migrate subcommand with its arguments on the Postgres database
+func runMigrate(cfg *config.Config, args []string) {
+	valid := len(args) == 1 && (args[0] == "up" || args[0] == "down" || args[0] == "status") ||
+		len(args) == 2 && args[0] == "to"
+	if !valid {
+		log.Fatal(migrateUsage)
+	}
+
+	if cfg.Store != "postgres" {
+		log.Fatal("migrate works with -store=postgres, a SQLite database migrates itself when it is opened")
+	}
+
+	db, err := driver.ConnectSQL(cfg.PostgresDSN(), cfg.Pool())
+	if err != nil {
+		log.Fatal("Cannot connect to database! Dying...")
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, migrations.FS, infoLog)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		err = migrator.Down(ctx)
+	case "to":
+		err = migrator.To(ctx, args[1])
+	case "status":
+		err = printStatus(ctx, migrator)
+	}
+	if err != nil {
+		errorLog.Fatal("Cannot migrate: ", err)
+	}
+}
+
+// printStatus prints every migration and whether it is applied
+func printStatus(ctx context.Context, migrator *migrate.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+	for _, s := range statuses {
+		status, name := "pending", s.Name
+		if s.Applied {
+			status = "applied"
+		}
+		if name == "" {
+			name = "(no migration)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Version, name, status)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/repository"
+)
+
+// purgeInterval is how often the trash is checked for todos past their retention
+const purgeInterval = time.Hour
+
+// purgeTrash permanently deletes the todos that have been in the trash for longer than
+// the retention, once right away and then every purgeInterval until the context ends
+func purgeTrash(ctx context.Context, db repository.DatabaseRepo, retention time.Duration) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := db.PurgeTrash(ctx, time.Now().Add(-retention))
+		if err != nil {
+			app.ErrorLog.Println("Cannot purge the trash:", err)
+		} else if purged > 0 {
+			app.InfoLog.Printf("Purged %d todos from the trash", purged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
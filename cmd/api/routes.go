@@ -17,15 +17,57 @@ func routes() http.Handler {
 	mux.Use(EnableCORS)
 
 	mux.Get("/", handlers.Repo.Home)
-	mux.Get("/todos", handlers.Repo.AllTodos)
-	mux.Post("/todos", handlers.Repo.InsertTodo)
-	mux.Get("/todos/{id}", handlers.Repo.OneTodo)
-	mux.Put("/todos/{id}", handlers.Repo.UpdateTodo)
-	mux.Put("/todos/{id}/{complete}", handlers.Repo.UpdateTodoCompleted)
-	mux.Delete("/todos/{id}", handlers.Repo.DeleteTodo)
-
-	// GRAPHQL
-	mux.Post("/graphql", handlers.Repo.GraphQL)
+	mux.Post("/signup", handlers.Repo.Signup)
+	mux.Post("/login", handlers.Repo.Login)
+	if app.Features.GraphQL {
+		mux.Get("/graphql/ws", handlers.Repo.GraphQLWS)
+	}
+	mux.Get("/todos/events", handlers.Repo.TodoEvents)
+
+	mux.Group(func(mux chi.Router) {
+		mux.Use(Authenticate)
+
+		mux.Get("/todos", handlers.Repo.AllTodos)
+		mux.Post("/todos", handlers.Repo.InsertTodo)
+		mux.Get("/todos/search", handlers.Repo.SearchTodos)
+		mux.Post("/todos/batch", handlers.Repo.TodoBatch)
+		mux.Get("/todos/{id}", handlers.Repo.OneTodo)
+		mux.Get("/todos/{id}/children", handlers.Repo.ChildTodos)
+		mux.Get("/todos/{id}/history", handlers.Repo.TodoHistory)
+		mux.Put("/todos/{id}", handlers.Repo.UpdateTodo)
+		mux.Patch("/todos/{id}", handlers.Repo.PatchTodo)
+		mux.Put("/todos/{id}/{complete}", handlers.Repo.UpdateTodoCompleted)
+		mux.Delete("/todos/{id}", handlers.Repo.DeleteTodo)
+		mux.Post("/todos/{id}/tags", handlers.Repo.AddTodoTags)
+		mux.Delete("/todos/{id}/tags/{tag}", handlers.Repo.RemoveTodoTag)
+		mux.Post("/todos/{id}/restore", handlers.Repo.RestoreTodo)
+
+		mux.Post("/undo", handlers.Repo.Undo)
+		mux.Post("/redo", handlers.Repo.Redo)
+
+		mux.Get("/trash", handlers.Repo.Trash)
+		mux.Delete("/trash/{id}", handlers.Repo.PurgeTodo)
+
+		mux.Get("/webhooks", handlers.Repo.AllWebhooks)
+		mux.Post("/webhooks", handlers.Repo.InsertWebhook)
+		mux.Get("/webhooks/{id}", handlers.Repo.OneWebhook)
+		mux.Put("/webhooks/{id}", handlers.Repo.UpdateWebhook)
+		mux.Delete("/webhooks/{id}", handlers.Repo.DeleteWebhook)
+		mux.Get("/webhooks/{id}/deliveries", handlers.Repo.WebhookDeliveries)
+		mux.Post("/webhooks/{id}/test", handlers.Repo.TestWebhook)
+
+		mux.Get("/projects", handlers.Repo.AllProjects)
+		mux.Post("/projects", handlers.Repo.InsertProject)
+		mux.Get("/projects/{id}", handlers.Repo.OneProject)
+		mux.Put("/projects/{id}", handlers.Repo.UpdateProject)
+		mux.Delete("/projects/{id}", handlers.Repo.DeleteProject)
+		mux.Get("/projects/{id}/todos", handlers.Repo.ProjectTodos)
+
+		// GRAPHQL
+		if app.Features.GraphQL {
+			mux.Post("/graphql", handlers.Repo.GraphQL)
+		}
+	})
 
 	return mux
 }
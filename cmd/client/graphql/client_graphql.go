@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
@@ -16,6 +17,9 @@ const (
 	apiURL       = "http://localhost:8080/graphql"
 )
 
+// token is a JWT obtained from POST /login
+var token = os.Getenv("TODO_API_TOKEN")
+
 type graphQLResponse struct {
 	Data map[string]interface{} `json:"data"`
 }
@@ -109,6 +113,7 @@ func sendCreateRequest(todo models.Todo) (*graphQLResponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("Authorization", "Bearer "+token)
 	client := &http.Client{
 		Timeout: time.Second * 10,
 	}
@@ -150,6 +155,7 @@ func sendGetOneRequest(id int) (*models.Todo, error) {
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("Authorization", "Bearer "+token)
 	client := &http.Client{
 		Timeout: time.Second * 10,
 	}
@@ -197,6 +203,7 @@ func sendUpdateRequest(todo models.Todo) (*graphQLResponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("Authorization", "Bearer "+token)
 	client := &http.Client{
 		Timeout: time.Second * 10,
 	}
@@ -223,53 +230,79 @@ func sendUpdateRequest(todo models.Todo) (*graphQLResponse, error) {
 }
 
 func sendGetAllRequest() ([]models.Todo, error) {
-	getAllTodosQuery := `query {
-			getTodos {
-				id,
-				name,
-				description,
-				deadline,
-				completed
+	var todos []models.Todo
+	after := ""
+	for {
+		afterArg := ""
+		if after != "" {
+			afterArg = fmt.Sprintf(`, after: %q`, after)
+		}
+		getAllTodosQuery := fmt.Sprintf(`query {
+			getTodos(first: 100%s) {
+				edges {
+					node {
+						id,
+						name,
+						description,
+						deadline,
+						completed
+					}
+				}
+				pageInfo {
+					hasNextPage,
+					endCursor
+				}
 			}
-		}`
-	requestBody := fmt.Sprintf(`{"query": %q}`, getAllTodosQuery)
+		}`, afterArg)
+		requestBody := fmt.Sprintf(`{"query": %q}`, getAllTodosQuery)
 
-	req, err := http.NewRequest("POST", apiURL, strings.NewReader(requestBody))
-	if err != nil {
-		return nil, err
-	}
-	client := &http.Client{
-		Timeout: time.Second * 10,
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+		req, err := http.NewRequest("POST", apiURL, strings.NewReader(requestBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		client := &http.Client{
+			Timeout: time.Second * 10,
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	var jsonResp graphQLResponse
-	err = json.Unmarshal(body, &jsonResp)
-	if err != nil {
-		return nil, err
-	}
-	var todos []models.Todo
-	for _, todo := range jsonResp.Data["getTodos"].([]interface{}) {
-		parsedTime, _ := time.Parse(time.RFC3339, todo.(map[string]interface{})["deadline"].(string))
-		todos = append(todos, models.Todo{
-			ID:          int(todo.(map[string]interface{})["id"].(float64)),
-			Name:        todo.(map[string]interface{})["name"].(string),
-			Description: todo.(map[string]interface{})["description"].(string),
-			Deadline:    parsedTime,
-			Completed:   todo.(map[string]interface{})["completed"].(bool),
-		})
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		var jsonResp graphQLResponse
+		err = json.Unmarshal(body, &jsonResp)
+		if err != nil {
+			return nil, err
+		}
+
+		connection := jsonResp.Data["getTodos"].(map[string]interface{})
+		for _, edge := range connection["edges"].([]interface{}) {
+			todo := edge.(map[string]interface{})["node"]
+			parsedTime, _ := time.Parse(time.RFC3339, todo.(map[string]interface{})["deadline"].(string))
+			todos = append(todos, models.Todo{
+				ID:          int(todo.(map[string]interface{})["id"].(float64)),
+				Name:        todo.(map[string]interface{})["name"].(string),
+				Description: todo.(map[string]interface{})["description"].(string),
+				Deadline:    parsedTime,
+				Completed:   todo.(map[string]interface{})["completed"].(bool),
+			})
+		}
+
+		pageInfo := connection["pageInfo"].(map[string]interface{})
+		if !pageInfo["hasNextPage"].(bool) {
+			break
+		}
+		after = pageInfo["endCursor"].(string)
 	}
 	return todos, nil
 }
@@ -286,6 +319,7 @@ func sendDeleteRequest(id int) (*graphQLResponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("Authorization", "Bearer "+token)
 	client := &http.Client{
 		Timeout: time.Second * 10,
 	}
@@ -4,12 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/anras5/todo-app-backend/internal/grpc/pb"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -28,11 +29,15 @@ func main() {
 
 	client := pb.NewTodoServiceClient(conn)
 
+	// every call is authenticated with a JWT obtained from POST /login
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+os.Getenv("TODO_API_TOKEN"))
+
 	// Create
 	startTime := time.Now()
 	ids := []int{}
+	versions := []int32{}
 	for i := 0; i < requestCount; i++ {
-		createdTodo, err := client.Create(context.Background(), &pb.Todo{
+		createdTodo, err := client.Create(ctx, &pb.Todo{
 			Name:        fmt.Sprintf("Todo number %d", i),
 			Description: "This is a todo",
 			Deadline:    timestamppb.New(time.Now().Add(24 * time.Hour)),
@@ -43,6 +48,7 @@ func main() {
 		}
 		id := int(createdTodo.Id)
 		ids = append(ids, id)
+		versions = append(versions, createdTodo.Version)
 	}
 	duration := time.Since(startTime)
 	fmt.Printf("Create %v.\n", duration)
@@ -50,7 +56,7 @@ func main() {
 	// Get by one
 	startTime = time.Now()
 	for _, id := range ids {
-		_, err := client.Get(context.Background(), &pb.Id{Id: int32(id)})
+		_, err := client.Get(ctx, &pb.Id{Id: int32(id)})
 		if err != nil {
 			fmt.Printf("Error sending request for Todo #%d: %v\n", id, err)
 		}
@@ -61,12 +67,15 @@ func main() {
 	// Update
 	startTime = time.Now()
 	for i, id := range ids {
-		_, err := client.Update(context.Background(), &pb.Todo{
-			Id:          int32(id),
-			Name:        fmt.Sprintf("Todo number %d", i),
-			Description: "This is an updated todo",
-			Deadline:    timestamppb.New(time.Now().Add(24 * time.Hour)),
-			Completed:   false,
+		_, err := client.Update(ctx, &pb.UpdateTodoRequest{
+			Todo: &pb.Todo{
+				Id:          int32(id),
+				Name:        fmt.Sprintf("Todo number %d", i),
+				Description: "This is an updated todo",
+				Deadline:    timestamppb.New(time.Now().Add(24 * time.Hour)),
+				Completed:   false,
+			},
+			ExpectedVersion: versions[i],
 		})
 		if err != nil {
 			fmt.Printf("Error sending request for Todo #%d: %v\n", id, err)
@@ -77,13 +86,15 @@ func main() {
 
 	// List
 	startTime = time.Now()
-	stream, err := client.List(context.Background(), &emptypb.Empty{})
-	if err != nil {
-		fmt.Printf("Error sending request for Todo list: %v\n", err)
-	}
+	pageToken := ""
 	for {
-		_, err := stream.Recv()
+		page, err := client.List(ctx, &pb.ListRequest{PageSize: 100, PageToken: pageToken})
 		if err != nil {
+			fmt.Printf("Error sending request for Todo list: %v\n", err)
+			break
+		}
+		pageToken = page.GetNextPageToken()
+		if pageToken == "" {
 			break
 		}
 	}
@@ -93,7 +104,7 @@ func main() {
 	// Delete
 	startTime = time.Now()
 	for _, id := range ids {
-		_, err := client.Delete(context.Background(), &pb.Id{Id: int32(id)})
+		_, err := client.Delete(ctx, &pb.Id{Id: int32(id)})
 		if err != nil {
 			fmt.Printf("Error sending request for Todo #%d: %v\n", id, err)
 		}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/anras5/todo-app-backend/internal/config"
@@ -17,6 +18,9 @@ const (
 	apiURL       = "http://localhost:8080"
 )
 
+// token is a JWT obtained from POST /login
+var token = os.Getenv("TODO_API_TOKEN")
+
 func main() {
 
 	// REST POST
@@ -96,6 +100,7 @@ func sendGetOneRequest(id int) (*models.Todo, error) {
 		return nil, fmt.Errorf("failed to create request: %w\n", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	client := &http.Client{
 		Timeout: 10 * time.Second,
@@ -135,6 +140,7 @@ func sendCreateRequest(todo models.Todo) (*config.JSONResponse, error) {
 		return nil, fmt.Errorf("failed to create request: %w\n", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	client := &http.Client{
 		Timeout: 10 * time.Second,
@@ -174,6 +180,7 @@ func sendUpdateRequest(todo models.Todo) (*config.JSONResponse, error) {
 		return nil, fmt.Errorf("failed to create request: %w\n", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	client := &http.Client{
 		Timeout: 10 * time.Second,
@@ -208,6 +215,7 @@ func sendGetAllRequest() ([]models.Todo, error) {
 		return nil, fmt.Errorf("failed to create request: %w\n", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	client := &http.Client{
 		Timeout: 10 * time.Second,
@@ -241,6 +249,7 @@ func sendDeleteRequest(id int) (*config.JSONResponse, error) {
 		return nil, fmt.Errorf("failed to create request: %w\n", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	client := &http.Client{
 		Timeout: 10 * time.Second,
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrNoToken = errors.New("no authorization token provided")
+var ErrInvalidToken = errors.New("invalid authorization token")
+var ErrNoUser = errors.New("request is not authenticated")
+
+type contextKey string
+
+const userIDKey contextKey = "userID"
+
+// Auth issues and verifies HS256 signed JWTs
+type Auth struct {
+	Secret   []byte
+	Issuer   string
+	TokenTTL time.Duration
+}
+
+// Claims are the claims stored in the tokens issued by Auth
+type Claims struct {
+	jwt.RegisteredClaims
+}
+
+// GenerateToken issues a signed token for the user with the given id
+func (a *Auth) GenerateToken(userID int) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userID),
+			Issuer:    a.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(a.TokenTTL)),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(a.Secret)
+}
+
+// ParseToken verifies the token and returns the id of its user
+func (a *Auth) ParseToken(tokenString string) (int, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (any, error) {
+		return a.Secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(a.Issuer))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	return userID, nil
+}
+
+// ParseAuthorizationHeader verifies a "Bearer <token>" header value
+func (a *Auth) ParseAuthorizationHeader(header string) (int, error) {
+	if header == "" {
+		return 0, ErrNoToken
+	}
+
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return 0, ErrInvalidToken
+	}
+	return a.ParseToken(token)
+}
+
+// HashPassword returns the bcrypt hash of the password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether the password matches the bcrypt hash
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// WithUserID returns a copy of ctx carrying the id of the authenticated user
+func WithUserID(ctx context.Context, userID int) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserIDFromContext returns the id of the authenticated user stored in ctx
+func UserIDFromContext(ctx context.Context) (int, error) {
+	userID, ok := ctx.Value(userIDKey).(int)
+	if !ok {
+		return 0, ErrNoUser
+	}
+	return userID, nil
+}
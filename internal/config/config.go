@@ -1,11 +1,29 @@
 package config
 
-import "log"
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/auth"
+)
 
 // Application holds the application config
 type Application struct {
 	Domain   string
 	DSN      string
+	Auth     *auth.Auth
 	InfoLog  *log.Logger
 	ErrorLog *log.Logger
+	// TrashRetention is how long deleted todos stay in the trash before they are purged
+	TrashRetention time.Duration
+	// QueryTimeout is how long a database call may take, repository.DefaultQueryTimeout if it is 0
+	QueryTimeout time.Duration
+	// TxIsolation is the isolation level of the transactions spanning several steps of a request,
+	// the default of the repo if it is sql.LevelDefault
+	TxIsolation sql.IsolationLevel
+	// CORSOrigins are the origins browsers may call the APIs from, "*" allows any
+	CORSOrigins []string
+	// Features are the parts of the server that are turned on
+	Features Features
 }
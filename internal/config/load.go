@@ -0,0 +1,368 @@
+package config
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/anras5/todo-app-backend/internal/driver"
+	"github.com/anras5/todo-app-backend/internal/repository"
+)
+
+// Config is the configuration of the API server. Load fills it from the defaults, a YAML or TOML file,
+// the environment and the command-line flags, each overriding the ones before it.
+type Config struct {
+	// Store is where the data is kept, postgres, sqlite or memory
+	Store  string `yaml:"store" toml:"store"`
+	Domain string `yaml:"domain" toml:"domain"`
+
+	HTTPPort int `yaml:"http_port" toml:"http_port"`
+	GRPCPort int `yaml:"grpc_port" toml:"grpc_port"`
+	// CORSOrigins are the origins browsers may call the REST and GraphQL APIs from, "*" allows any
+	CORSOrigins []string `yaml:"cors_origins" toml:"cors_origins"`
+
+	JWTSecret string        `yaml:"jwt_secret" toml:"jwt_secret"`
+	TokenTTL  time.Duration `yaml:"token_ttl" toml:"token_ttl"`
+
+	QueryTimeout time.Duration `yaml:"query_timeout" toml:"query_timeout"`
+	// TxIsolation is read-committed, repeatable-read or serializable, the default of the repo if it is empty
+	TxIsolation     string        `yaml:"tx_isolation" toml:"tx_isolation"`
+	TrashRetention  time.Duration `yaml:"trash_retention" toml:"trash_retention"`
+	WebhookInterval time.Duration `yaml:"webhook_interval" toml:"webhook_interval"`
+
+	Database   Database `yaml:"database" toml:"database"`
+	SQLitePath string   `yaml:"sqlite_path" toml:"sqlite_path"`
+	Features   Features `yaml:"features" toml:"features"`
+}
+
+// Database is the configuration of the Postgres database
+type Database struct {
+	// DSN is used as it is if set, otherwise it is built from the other fields
+	DSN             string        `yaml:"dsn" toml:"dsn"`
+	Host            string        `yaml:"host" toml:"host"`
+	Port            int           `yaml:"port" toml:"port"`
+	Name            string        `yaml:"name" toml:"name"`
+	User            string        `yaml:"user" toml:"user"`
+	Password        string        `yaml:"password" toml:"password"`
+	SSLMode         string        `yaml:"sslmode" toml:"sslmode"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+}
+
+// Features turns parts of the server on and off
+type Features struct {
+	GraphQL bool `yaml:"graphql" toml:"graphql"`
+	GRPC    bool `yaml:"grpc" toml:"grpc"`
+	// Webhooks sends the queued webhook deliveries, they are still queued when it is off
+	Webhooks   bool `yaml:"webhooks" toml:"webhooks"`
+	PurgeTrash bool `yaml:"purge_trash" toml:"purge_trash"`
+}
+
+// Default returns the configuration used for everything the file, the environment and the flags leave out
+func Default() *Config {
+	return &Config{
+		Store:           "postgres",
+		Domain:          "localhost",
+		HTTPPort:        8080,
+		GRPCPort:        9000,
+		CORSOrigins:     []string{"http://localhost:3000"},
+		TokenTTL:        24 * time.Hour,
+		QueryTimeout:    repository.DefaultQueryTimeout,
+		TrashRetention:  30 * 24 * time.Hour,
+		WebhookInterval: 2 * time.Second,
+		Database: Database{
+			Host:            "localhost",
+			Port:            5432,
+			Name:            "todos",
+			MaxOpenConns:    driver.DefaultPool.MaxOpenConns,
+			MaxIdleConns:    driver.DefaultPool.MaxIdleConns,
+			ConnMaxLifetime: driver.DefaultPool.ConnMaxLifetime,
+		},
+		SQLitePath: "todos.db",
+		Features:   Features{GraphQL: true, GRPC: true, Webhooks: true, PurgeTrash: true},
+	}
+}
+
+// setting is a value that can be set with a flag and an environment variable. Secrets have no flag,
+// so that they do not show up in the list of processes.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	field func(c *Config) any
+}
+
+var settings = []setting{
+	{"store", "STORE", "where the data is kept, postgres, sqlite or memory", func(c *Config) any { return &c.Store }},
+	{"domain", "DOMAIN", "domain the server is reached at", func(c *Config) any { return &c.Domain }},
+	{"http-port", "HTTP_PORT", "port of the REST and GraphQL APIs", func(c *Config) any { return &c.HTTPPort }},
+	{"grpc-port", "GRPC_PORT", "port of the gRPC API", func(c *Config) any { return &c.GRPCPort }},
+	{"cors-origins", "CORS_ORIGINS", "comma separated origins browsers may call the APIs from, * allows any", func(c *Config) any { return &c.CORSOrigins }},
+	{"", "JWT_SECRET", "", func(c *Config) any { return &c.JWTSecret }},
+	{"token-ttl", "TOKEN_TTL", "how long a token is valid", func(c *Config) any { return &c.TokenTTL }},
+	{"query-timeout", "QUERY_TIMEOUT", "how long a database call may take", func(c *Config) any { return &c.QueryTimeout }},
+	{"tx-isolation", "TX_ISOLATION", "isolation of the transactions, read-committed, repeatable-read or serializable", func(c *Config) any { return &c.TxIsolation }},
+	{"trash-retention", "TRASH_RETENTION", "how long deleted todos stay in the trash", func(c *Config) any { return &c.TrashRetention }},
+	{"webhook-interval", "WEBHOOK_INTERVAL", "how often the pending webhook deliveries are sent", func(c *Config) any { return &c.WebhookInterval }},
+	{"db-dsn", "DB_DSN", "Postgres connection string, overrides the other db settings", func(c *Config) any { return &c.Database.DSN }},
+	{"db-host", "DB_HOST", "Postgres host", func(c *Config) any { return &c.Database.Host }},
+	{"db-port", "DB_PORT", "Postgres port", func(c *Config) any { return &c.Database.Port }},
+	{"db-name", "DB_NAME", "Postgres database", func(c *Config) any { return &c.Database.Name }},
+	{"db-user", "DB_USER", "Postgres user", func(c *Config) any { return &c.Database.User }},
+	{"", "DB_PASSWD", "", func(c *Config) any { return &c.Database.Password }},
+	{"db-sslmode", "SSL_MODE", "Postgres sslmode", func(c *Config) any { return &c.Database.SSLMode }},
+	{"db-max-open-conns", "DB_MAX_OPEN_CONNS", "most open connections to the database", func(c *Config) any { return &c.Database.MaxOpenConns }},
+	{"db-max-idle-conns", "DB_MAX_IDLE_CONNS", "most idle connections to the database", func(c *Config) any { return &c.Database.MaxIdleConns }},
+	{"db-conn-max-lifetime", "DB_CONN_MAX_LIFETIME", "how long a connection to the database is reused", func(c *Config) any { return &c.Database.ConnMaxLifetime }},
+	{"sqlite-path", "SQLITE_PATH", "file of the database with -store=sqlite", func(c *Config) any { return &c.SQLitePath }},
+	{"graphql", "GRAPHQL_ENABLED", "serve the GraphQL API", func(c *Config) any { return &c.Features.GraphQL }},
+	{"grpc", "GRPC_ENABLED", "serve the gRPC API", func(c *Config) any { return &c.Features.GRPC }},
+	{"webhooks", "WEBHOOKS_ENABLED", "send webhook deliveries", func(c *Config) any { return &c.Features.Webhooks }},
+	{"purge-trash", "PURGE_TRASH_ENABLED", "purge the trash in the background", func(c *Config) any { return &c.Features.PurgeTrash }},
+}
+
+// rawFlag keeps the value of a flag as it is given, it is parsed once the file and the environment are read
+type rawFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *rawFlag) String() string     { return f.value }
+func (f *rawFlag) Set(s string) error { f.value = s; return nil }
+func (f *rawFlag) IsBoolFlag() bool   { return f.isBool }
+
+// Load reads the configuration from the file named by -config or CONFIG_FILE, the environment read with
+// getenv and the flags in args, in that order of precedence from the lowest, and validates it. It returns
+// the arguments left after the flags.
+func Load(args []string, getenv func(string) string) (*Config, []string, error) {
+	flags := flag.NewFlagSet("api", flag.ContinueOnError)
+	configFile := flags.String("config", "", "YAML or TOML file to read the configuration from, CONFIG_FILE by default")
+	raw := make(map[string]*rawFlag)
+	byFlag := make(map[string]setting)
+	for _, s := range settings {
+		if s.flag == "" {
+			continue
+		}
+		_, isBool := s.field(&Config{}).(*bool)
+		raw[s.flag] = &rawFlag{isBool: isBool}
+		byFlag[s.flag] = s
+		flags.Var(raw[s.flag], s.flag, s.usage+" ("+s.env+")")
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	c := Default()
+	path := *configFile
+	if path == "" {
+		path = getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := c.readFile(path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if value := getenv(s.env); value != "" {
+			if err := setField(s.field(c), value); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		if s, ok := byFlag[f.Name]; ok && err == nil {
+			if setErr := setField(s.field(c), raw[f.Name].value); setErr != nil {
+				err = fmt.Errorf("-%s: %w", f.Name, setErr)
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = c.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return c, flags.Args(), nil
+}
+
+// readFile reads the file over the configuration, its format is told by its extension. Keys that are
+// not a part of the configuration are an error, so that a typo is not silently ignored.
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		// an empty file has no document
+		if err = decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("%s should be a .yaml, .yml or .toml file", path)
+	}
+	return nil
+}
+
+// setField parses the value of a flag or an environment variable into the field
+func setField(field any, value string) error {
+	var err error
+	switch field := field.(type) {
+	case *string:
+		*field = value
+	case *int:
+		*field, err = strconv.Atoi(value)
+	case *bool:
+		*field, err = strconv.ParseBool(value)
+	case *time.Duration:
+		*field, err = time.ParseDuration(value)
+	case *[]string:
+		*field = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*field = append(*field, item)
+			}
+		}
+	default:
+		panic(fmt.Sprintf("config: cannot set a %T", field))
+	}
+	return err
+}
+
+// Validate reports every value that is out of range. The JWT secret is not checked, it is only
+// needed to serve.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(slices.Contains([]string{"postgres", "sqlite", "memory"}, c.Store), "store should be postgres, sqlite or memory, not %q", c.Store)
+	check(validPort(c.HTTPPort), "http port %d should be between 1 and 65535", c.HTTPPort)
+	check(validPort(c.GRPCPort), "grpc port %d should be between 1 and 65535", c.GRPCPort)
+	check(c.HTTPPort != c.GRPCPort || !c.Features.GRPC, "http and grpc should listen on different ports")
+	for _, origin := range c.CORSOrigins {
+		u, err := url.Parse(origin)
+		check(origin == "*" || err == nil && u.Scheme != "" && u.Host != "" && u.Path == "",
+			"cors origin %q should be * or a scheme and a host, like http://localhost:3000", origin)
+	}
+
+	check(c.TokenTTL > 0, "token ttl should be positive")
+	check(c.QueryTimeout > 0, "query timeout should be positive")
+	_, err := c.Isolation()
+	check(err == nil, "tx isolation should be read-committed, repeatable-read or serializable, not %q", c.TxIsolation)
+	check(c.TrashRetention > 0, "trash retention should be positive")
+	check(c.WebhookInterval > 0, "webhook interval should be positive")
+
+	if c.Store == "postgres" && c.Database.DSN == "" {
+		check(c.Database.Host != "", "db host should be set")
+		check(validPort(c.Database.Port), "db port %d should be between 1 and 65535", c.Database.Port)
+		check(c.Database.Name != "", "db name should be set")
+	}
+	check(c.Database.MaxOpenConns > 0, "db max open conns should be positive")
+	check(c.Database.MaxIdleConns >= 0, "db max idle conns should not be negative")
+	check(c.Database.ConnMaxLifetime >= 0, "db conn max lifetime should not be negative")
+	if c.Store == "sqlite" {
+		check(c.SQLitePath != "", "sqlite path should be set")
+	}
+
+	return errors.Join(errs...)
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// Isolation parses TxIsolation, sql.LevelDefault if it is empty
+func (c *Config) Isolation() (sql.IsolationLevel, error) {
+	switch c.TxIsolation {
+	case "":
+		return sql.LevelDefault, nil
+	case "read-committed":
+		return sql.LevelReadCommitted, nil
+	case "repeatable-read":
+		return sql.LevelRepeatableRead, nil
+	case "serializable":
+		return sql.LevelSerializable, nil
+	}
+	return sql.LevelDefault, fmt.Errorf("unknown isolation level %q", c.TxIsolation)
+}
+
+// PostgresDSN returns the DSN of the database, built from its parts unless it is set
+func (c *Config) PostgresDSN() string {
+	d := c.Database
+	if d.DSN != "" {
+		return d.DSN
+	}
+	dsn := fmt.Sprintf("host=%s port=%d dbname=%s", dsnValue(d.Host), d.Port, dsnValue(d.Name))
+	for _, part := range []struct{ key, value string }{{"user", d.User}, {"password", d.Password}, {"sslmode", d.SSLMode}} {
+		if part.value != "" {
+			dsn += " " + part.key + "=" + dsnValue(part.value)
+		}
+	}
+	return dsn
+}
+
+// dsnValue quotes a value of a key/value DSN if it has spaces or quotes in it
+func dsnValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// Pool returns the size of the connection pool of the database
+func (c *Config) Pool() driver.Pool {
+	return driver.Pool{
+		MaxOpenConns:    c.Database.MaxOpenConns,
+		MaxIdleConns:    c.Database.MaxIdleConns,
+		ConnMaxLifetime: c.Database.ConnMaxLifetime,
+	}
+}
+
+// Configure sets the values the handlers use from the configuration
+func (app *Application) Configure(c *Config) {
+	app.Domain = c.Domain
+	switch c.Store {
+	case "postgres":
+		app.DSN = c.PostgresDSN()
+	case "sqlite":
+		app.DSN = c.SQLitePath
+	}
+	app.CORSOrigins = c.CORSOrigins
+	app.Features = c.Features
+	app.QueryTimeout = c.QueryTimeout
+	app.TxIsolation, _ = c.Isolation()
+	app.TrashRetention = c.TrashRetention
+}
@@ -0,0 +1,224 @@
+package config
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes a config file into a temporary directory and returns its path
+func writeFile(t *testing.T, name string, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, "api.yaml", `
+http_port: 8081
+grpc_port: 9001
+query_timeout: 5s
+cors_origins: [https://todo.example.com]
+database:
+  host: db.example.com
+  max_open_conns: 20
+features:
+  graphql: false
+`)
+	vars := map[string]string{
+		"CONFIG_FILE":   path,
+		"GRPC_PORT":     "9002",
+		"QUERY_TIMEOUT": "7s",
+	}
+
+	c, args, err := Load([]string{"-query-timeout=9s", "-grpc=false", "migrate", "up"}, env(vars))
+	if err != nil {
+		t.Fatalf("Load returned an error: %v", err)
+	}
+
+	if c.HTTPPort != 8081 {
+		t.Errorf("http port from the file: got %d, wanted 8081", c.HTTPPort)
+	}
+	if c.GRPCPort != 9002 {
+		t.Errorf("grpc port from the environment: got %d, wanted 9002", c.GRPCPort)
+	}
+	if c.QueryTimeout != 9*time.Second {
+		t.Errorf("query timeout from the flags: got %v, wanted 9s", c.QueryTimeout)
+	}
+	if !slices.Equal(c.CORSOrigins, []string{"https://todo.example.com"}) {
+		t.Errorf("cors origins from the file: got %v, wanted [https://todo.example.com]", c.CORSOrigins)
+	}
+	if c.Database.Host != "db.example.com" || c.Database.Port != 5432 || c.Database.MaxOpenConns != 20 {
+		t.Errorf("database merged from the file and the defaults: got %+v", c.Database)
+	}
+	if c.Features.GraphQL || c.Features.GRPC || !c.Features.Webhooks {
+		t.Errorf("features: got %+v, wanted graphql and grpc off", c.Features)
+	}
+	if !slices.Equal(args, []string{"migrate", "up"}) {
+		t.Errorf("arguments left: got %v, wanted [migrate up]", args)
+	}
+}
+
+func TestLoad_TOML(t *testing.T) {
+	path := writeFile(t, "api.toml", `
+store = "sqlite"
+sqlite_path = "/var/lib/todos.db"
+trash_retention = "48h"
+
+[features]
+purge_trash = false
+`)
+
+	c, _, err := Load([]string{"-config", path}, env(nil))
+	if err != nil {
+		t.Fatalf("Load returned an error: %v", err)
+	}
+	if c.Store != "sqlite" || c.SQLitePath != "/var/lib/todos.db" {
+		t.Errorf("store: got %s %s, wanted sqlite /var/lib/todos.db", c.Store, c.SQLitePath)
+	}
+	if c.TrashRetention != 48*time.Hour {
+		t.Errorf("trash retention: got %v, wanted 48h", c.TrashRetention)
+	}
+	if c.Features.PurgeTrash {
+		t.Errorf("purge trash is still on")
+	}
+}
+
+var theLoadErrorTests = []struct {
+	name     string
+	file     string
+	contents string
+	vars     map[string]string
+	args     []string
+	expected string
+}{
+	{
+		name:     "unknown store",
+		args:     []string{"-store=mysql"},
+		expected: "store should be postgres, sqlite or memory",
+	},
+	{
+		name:     "port out of range",
+		vars:     map[string]string{"HTTP_PORT": "80800"},
+		expected: "http port 80800",
+	},
+	{
+		name:     "same ports",
+		args:     []string{"-http-port=9000"},
+		expected: "different ports",
+	},
+	{
+		name:     "negative timeout",
+		vars:     map[string]string{"QUERY_TIMEOUT": "-1s"},
+		expected: "query timeout should be positive",
+	},
+	{
+		name:     "not a duration",
+		vars:     map[string]string{"TRASH_RETENTION": "a month"},
+		expected: "TRASH_RETENTION",
+	},
+	{
+		name:     "unknown isolation",
+		args:     []string{"-tx-isolation=snapshot"},
+		expected: "tx isolation",
+	},
+	{
+		name:     "origin with a path",
+		vars:     map[string]string{"CORS_ORIGINS": "http://localhost:3000, http://localhost:3000/app"},
+		expected: `cors origin "http://localhost:3000/app"`,
+	},
+	{
+		name:     "unknown key",
+		file:     "api.yaml",
+		contents: "http_prot: 8081\n",
+		expected: "http_prot",
+	},
+	{
+		name:     "unknown TOML key",
+		file:     "api.toml",
+		contents: "[database]\nhots = \"db\"\n",
+		expected: "database.hots",
+	},
+	{
+		name:     "unknown format",
+		file:     "api.json",
+		contents: "{}",
+		expected: ".yaml, .yml or .toml",
+	},
+}
+
+func TestLoad_Errors(t *testing.T) {
+	for _, e := range theLoadErrorTests {
+		vars := map[string]string{}
+		for key, value := range e.vars {
+			vars[key] = value
+		}
+		if e.file != "" {
+			vars["CONFIG_FILE"] = writeFile(t, e.file, e.contents)
+		}
+
+		_, _, err := Load(e.args, env(vars))
+		if err == nil || !strings.Contains(err.Error(), e.expected) {
+			t.Errorf("%s returned wrong error: got %v, wanted one with %q", e.name, err, e.expected)
+		}
+	}
+}
+
+var thePostgresDSNTests = []struct {
+	name     string
+	database Database
+	expected string
+}{
+	{
+		name:     "parts",
+		database: Database{Host: "postgres-db", Port: 5432, Name: "todos", User: "postgres", Password: "secret", SSLMode: "disable"},
+		expected: "host=postgres-db port=5432 dbname=todos user=postgres password=secret sslmode=disable",
+	},
+	{
+		name:     "quoted password",
+		database: Database{Host: "localhost", Port: 5432, Name: "todos", Password: `it's a secret`},
+		expected: `host=localhost port=5432 dbname=todos password='it\'s a secret'`,
+	},
+	{
+		name:     "dsn",
+		database: Database{DSN: "postgres://postgres@localhost/todos", Host: "localhost"},
+		expected: "postgres://postgres@localhost/todos",
+	},
+}
+
+func TestConfig_PostgresDSN(t *testing.T) {
+	for _, e := range thePostgresDSNTests {
+		c := Config{Database: e.database}
+		if dsn := c.PostgresDSN(); dsn != e.expected {
+			t.Errorf("%s built wrong dsn: got %s, wanted %s", e.name, dsn, e.expected)
+		}
+	}
+}
+
+func TestApplication_Configure(t *testing.T) {
+	c := Default()
+	c.TxIsolation = "repeatable-read"
+	c.Database.User = "postgres"
+
+	var app Application
+	app.Configure(c)
+	if app.DSN != "host=localhost port=5432 dbname=todos user=postgres" {
+		t.Errorf("wrong dsn: got %s", app.DSN)
+	}
+	if app.TxIsolation != sql.LevelRepeatableRead {
+		t.Errorf("wrong isolation: got %v, wanted %v", app.TxIsolation, sql.LevelRepeatableRead)
+	}
+	if app.Domain != "localhost" || app.QueryTimeout != c.QueryTimeout || !app.Features.GraphQL {
+		t.Errorf("values not configured: got %+v", app)
+	}
+}
@@ -7,20 +7,35 @@ import (
 	"time"
 )
 
-const maxOpenDbConn = 10
-const maxIdleDbConn = 5
-const maxDbLifetime = 5 * time.Minute
+// Pool sizes the connection pool of a database
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// DefaultPool is the pool used unless it is configured otherwise
+var DefaultPool = Pool{
+	MaxOpenConns:    10,
+	MaxIdleConns:    5,
+	ConnMaxLifetime: 5 * time.Minute,
+}
+
+// apply sizes the pool of the database
+func (p Pool) apply(d *sql.DB) {
+	d.SetMaxOpenConns(p.MaxOpenConns)
+	d.SetMaxIdleConns(p.MaxIdleConns)
+	d.SetConnMaxLifetime(p.ConnMaxLifetime)
+}
 
 // ConnectSQL creates database pool for Postgres
-func ConnectSQL(dsn string) (*sql.DB, error) {
+func ConnectSQL(dsn string, pool Pool) (*sql.DB, error) {
 	d, err := NewDatabase(dsn)
 	if err != nil {
 		panic(err)
 	}
 
-	d.SetMaxOpenConns(maxOpenDbConn)
-	d.SetMaxIdleConns(maxIdleDbConn)
-	d.SetConnMaxLifetime(maxDbLifetime)
+	pool.apply(d)
 
 	err = testDB(d)
 	if err != nil {
@@ -0,0 +1,101 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrations is the schema of the SQLite database, applied in the order of the file names
+//
+//go:embed sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// sqliteParams are the connection parameters of every SQLite database: foreign keys on, a write-ahead
+// log so that reads do not wait for writes, waiting for the lock instead of failing right away,
+// times written in a format that sorts, and transactions taking the write lock when they begin,
+// so that two of them cannot deadlock upgrading their locks
+var sqliteParams = url.Values{
+	"_pragma":      {"foreign_keys(1)", "journal_mode(WAL)", "busy_timeout(5000)"},
+	"_time_format": {"sqlite"},
+	"_txlock":      {"immediate"},
+}
+
+// ConnectSQLite opens the SQLite database in the file at path, creating it if it does not exist,
+// and brings its schema up to date
+func ConnectSQLite(path string, pool Pool) (*sql.DB, error) {
+	d, err := sql.Open("sqlite", "file:"+path+"?"+sqliteParams.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	pool.apply(d)
+
+	if err = testDB(d); err != nil {
+		_ = d.Close()
+		return nil, err
+	}
+	if err = migrateSQLite(context.Background(), d); err != nil {
+		_ = d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// migrateSQLite applies the migrations not yet recorded in the schema_migration table, each in
+// a transaction of its own. The version of a migration is the timestamp its file name starts with.
+func migrateSQLite(ctx context.Context, d *sql.DB) error {
+	_, err := d.ExecContext(ctx, `create table if not exists schema_migration (version varchar(14) primary key)`)
+	if err != nil {
+		return err
+	}
+
+	files, err := fs.Glob(sqliteMigrations, "sqlite/*.sql")
+	if err != nil {
+		return err
+	}
+	slices.Sort(files)
+
+	for _, file := range files {
+		version, _, _ := strings.Cut(path.Base(file), "_")
+		if err := applySQLiteMigration(ctx, d, file, version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applySQLiteMigration applies the migration in the file unless its version is recorded already
+func applySQLiteMigration(ctx context.Context, d *sql.DB, file string, version string) error {
+	stmts, err := sqliteMigrations.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var applied bool
+	err = tx.QueryRowContext(ctx, `select exists(select 1 from schema_migration where version = $1)`, version).Scan(&applied)
+	if err != nil || applied {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, string(stmts)); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `insert into schema_migration (version) values ($1)`, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
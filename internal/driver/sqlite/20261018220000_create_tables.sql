@@ -0,0 +1,109 @@
+-- The tables of the Postgres schema, with JSON in place of arrays and without the search column,
+-- SQLite repos search the todos themselves
+
+CREATE TABLE users (
+    id integer PRIMARY KEY,
+    email varchar(255) NOT NULL,
+    password_hash varchar(60) NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+CREATE UNIQUE INDEX users_email_idx ON users (email);
+
+CREATE TABLE project (
+    id integer PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name varchar(100) NOT NULL CHECK (length(name) <= 100),
+    description text NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+CREATE INDEX project_user_id_idx ON project (user_id);
+
+CREATE TABLE todo (
+    id integer PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    project_id integer REFERENCES project (id) ON DELETE SET NULL,
+    parent_id integer REFERENCES todo (id) ON DELETE CASCADE,
+    name varchar(100) NOT NULL CHECK (length(name) <= 100),
+    description text NOT NULL DEFAULT '',
+    deadline timestamp NOT NULL,
+    completed boolean NOT NULL DEFAULT false,
+    rrule varchar(255) NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1,
+    deleted_at timestamp,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+CREATE INDEX todo_user_id_idx ON todo (user_id);
+CREATE INDEX todo_project_id_idx ON todo (project_id);
+CREATE INDEX todo_parent_id_idx ON todo (parent_id);
+CREATE INDEX todo_deadline_id_idx ON todo (deadline, id);
+CREATE INDEX todo_deleted_at_idx ON todo (deleted_at);
+
+CREATE TABLE tag (
+    id integer PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name varchar(100) NOT NULL CHECK (length(name) <= 100),
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+CREATE UNIQUE INDEX tag_user_id_name_idx ON tag (user_id, name);
+
+CREATE TABLE todo_tag (
+    todo_id integer NOT NULL REFERENCES todo (id) ON DELETE CASCADE,
+    tag_id integer NOT NULL REFERENCES tag (id) ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, tag_id)
+);
+CREATE INDEX todo_tag_tag_id_idx ON todo_tag (tag_id);
+
+CREATE TABLE todo_operation (
+    id integer PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    undone boolean NOT NULL DEFAULT false,
+    created_at timestamp NOT NULL
+);
+CREATE INDEX todo_operation_user_id_id_idx ON todo_operation (user_id, id);
+
+CREATE TABLE todo_history (
+    id integer PRIMARY KEY,
+    todo_id integer NOT NULL REFERENCES todo (id) ON DELETE CASCADE,
+    actor_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    action varchar(20) NOT NULL,
+    before text,
+    after text,
+    request_id varchar(255) NOT NULL DEFAULT '',
+    transport varchar(20) NOT NULL DEFAULT '',
+    operation_id integer REFERENCES todo_operation (id) ON DELETE SET NULL,
+    created_at timestamp NOT NULL
+);
+CREATE INDEX todo_history_todo_id_id_idx ON todo_history (todo_id, id);
+CREATE INDEX todo_history_operation_id_idx ON todo_history (operation_id);
+
+CREATE TABLE webhook (
+    id integer PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    url varchar(2048) NOT NULL,
+    secret varchar(255) NOT NULL,
+    events text NOT NULL DEFAULT '[]',
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+CREATE INDEX webhook_user_id_idx ON webhook (user_id);
+
+CREATE TABLE webhook_delivery (
+    id integer PRIMARY KEY,
+    webhook_id integer NOT NULL REFERENCES webhook (id) ON DELETE CASCADE,
+    event varchar(50) NOT NULL,
+    payload text NOT NULL,
+    status varchar(20) NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    response_status integer NOT NULL DEFAULT 0,
+    error text NOT NULL DEFAULT '',
+    next_attempt_at timestamp,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+CREATE INDEX webhook_delivery_webhook_id_id_idx ON webhook_delivery (webhook_id, id);
+CREATE INDEX webhook_delivery_next_attempt_at_idx ON webhook_delivery (next_attempt_at);
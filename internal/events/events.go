@@ -0,0 +1,137 @@
+// Package events is an in-memory bus of the changes of todos. Every change committed by the
+// repository is published to it and streamed to the subscribed clients of the user. The last
+// events are kept in a ring buffer, so that a client reconnecting with the id of the last
+// event it got does not miss the events published in the meantime.
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// The types of the events
+const (
+	Created   = "created"
+	Updated   = "updated"
+	Completed = "completed"
+	Deleted   = "deleted"
+)
+
+// DefaultBufferSize is how many of the last events are kept for resuming subscriptions
+const DefaultBufferSize = 1024
+
+// subscriptionBuffer is how many events a subscriber can fall behind before it is dropped
+const subscriptionBuffer = 64
+
+// Event is a change of a todo, Todo is the todo after the change as JSON
+type Event struct {
+	ID        uint64          `json:"id"`
+	UserID    int             `json:"-"`
+	Type      string          `json:"type"`
+	Todo      json.RawMessage `json:"todo"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Bus delivers the published events to the subscriptions of their users
+type Bus struct {
+	mu sync.Mutex
+	// ring holds the last events, the oldest one at start
+	ring          []Event
+	start         int
+	lastID        uint64
+	subscriptions map[*Subscription]struct{}
+}
+
+// Subscription receives the events of a user until it is closed. A subscription that falls
+// too far behind is dropped and C is closed, it can be resumed from the last event it got.
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	userID int
+	bus    *Bus
+}
+
+// NewBus returns a bus keeping the last size events
+func NewBus(size int) *Bus {
+	return &Bus{
+		ring:          make([]Event, 0, size),
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the event the next id and delivers it to the subscriptions of its user
+func (b *Bus) Publish(event Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event.ID = b.lastID
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	if len(b.ring) < cap(b.ring) {
+		b.ring = append(b.ring, event)
+	} else if cap(b.ring) > 0 {
+		b.ring[b.start] = event
+		b.start = (b.start + 1) % cap(b.ring)
+	}
+
+	for s := range b.subscriptions {
+		if s.userID != event.UserID {
+			continue
+		}
+		select {
+		case s.c <- event:
+		default:
+			// the subscriber cannot keep up, it has to resume from the buffer
+			b.drop(s)
+		}
+	}
+	return event
+}
+
+// Subscribe subscribes to the events of the user. With a lastEventID other than 0 it also
+// returns the buffered events of the user published after that event. complete is false if
+// some of them are no longer buffered, or the id is unknown, and the client should reload
+// its todos instead.
+func (b *Bus) Subscribe(userID int, lastEventID uint64) (s *Subscription, missed []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := make(chan Event, subscriptionBuffer)
+	s = &Subscription{C: c, c: c, userID: userID, bus: b}
+	b.subscriptions[s] = struct{}{}
+
+	if lastEventID == 0 {
+		return s, nil, true
+	}
+
+	complete = lastEventID <= b.lastID
+	if len(b.ring) > 0 && lastEventID+1 < b.ring[b.start].ID {
+		complete = false
+	}
+	for i := range b.ring {
+		event := b.ring[(b.start+i)%len(b.ring)]
+		if event.ID > lastEventID && event.UserID == userID {
+			missed = append(missed, event)
+		}
+	}
+	return s, missed, complete
+}
+
+// Close unsubscribes, C is closed unless the subscription was already dropped
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.drop(s)
+}
+
+// drop removes the subscription and closes its channel, b.mu must be held
+func (b *Bus) drop(s *Subscription) {
+	if _, ok := b.subscriptions[s]; ok {
+		delete(b.subscriptions, s)
+		close(s.c)
+	}
+}
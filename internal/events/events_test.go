@@ -0,0 +1,117 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func publish(b *Bus, userID int, typ string) Event {
+	return b.Publish(Event{UserID: userID, Type: typ, Todo: json.RawMessage(`{}`)})
+}
+
+func TestBus_Publish(t *testing.T) {
+	b := NewBus(8)
+	s, missed, complete := b.Subscribe(1, 0)
+	defer s.Close()
+	if len(missed) != 0 || !complete {
+		t.Fatalf("a new subscription got %d missed events, complete %v", len(missed), complete)
+	}
+
+	first := publish(b, 1, Created)
+	publish(b, 2, Created)
+	second := publish(b, 1, Completed)
+
+	for _, expected := range []Event{first, second} {
+		select {
+		case event := <-s.C:
+			if event.ID != expected.ID || event.Type != expected.Type {
+				t.Errorf("wrong event: got %d %s, wanted %d %s", event.ID, event.Type, expected.ID, expected.Type)
+			}
+		default:
+			t.Fatalf("event %d was not delivered", expected.ID)
+		}
+	}
+	select {
+	case event := <-s.C:
+		t.Errorf("got event %d of another user", event.ID)
+	default:
+	}
+	if second.ID != 3 {
+		t.Errorf("ids are not sequential: got %d, wanted 3", second.ID)
+	}
+}
+
+func TestBus_Resume(t *testing.T) {
+	b := NewBus(4)
+	for i := 0; i < 3; i++ {
+		publish(b, 1, Updated)
+		publish(b, 2, Updated)
+	}
+
+	// events 3 to 6 are buffered
+	var tests = []struct {
+		name        string
+		lastEventID uint64
+		missed      []uint64
+		complete    bool
+	}{
+		{"last event", 5, nil, true},
+		{"buffered", 2, []uint64{3, 5}, true},
+		{"oldest buffered", 3, []uint64{5}, true},
+		{"evicted", 1, []uint64{3, 5}, false},
+		{"unknown", 7, nil, false},
+	}
+
+	for _, e := range tests {
+		s, missed, complete := b.Subscribe(1, e.lastEventID)
+		s.Close()
+
+		var ids []uint64
+		for _, event := range missed {
+			ids = append(ids, event.ID)
+		}
+		if len(ids) != len(e.missed) {
+			t.Errorf("for %s: got missed events %v, wanted %v", e.name, ids, e.missed)
+		} else {
+			for i := range ids {
+				if ids[i] != e.missed[i] {
+					t.Errorf("for %s: got missed events %v, wanted %v", e.name, ids, e.missed)
+					break
+				}
+			}
+		}
+		if complete != e.complete {
+			t.Errorf("for %s: got complete %v, wanted %v", e.name, complete, e.complete)
+		}
+	}
+}
+
+func TestBus_SlowSubscriber(t *testing.T) {
+	b := NewBus(DefaultBufferSize)
+	s, _, _ := b.Subscribe(1, 0)
+
+	for i := 0; i <= subscriptionBuffer; i++ {
+		publish(b, 1, Updated)
+	}
+
+	received := 0
+	for range s.C {
+		received++
+	}
+	if received != subscriptionBuffer {
+		t.Errorf("wrong number of events before the drop: got %d, wanted %d", received, subscriptionBuffer)
+	}
+	// closing a dropped subscription does nothing
+	s.Close()
+}
+
+func TestSubscription_Close(t *testing.T) {
+	b := NewBus(8)
+	s, _, _ := b.Subscribe(1, 0)
+	s.Close()
+
+	publish(b, 1, Deleted)
+	if _, ok := <-s.C; ok {
+		t.Error("a closed subscription got an event")
+	}
+}
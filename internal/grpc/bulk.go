@@ -0,0 +1,116 @@
+package rpc
+
+import (
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/auth"
+	"github.com/anras5/todo-app-backend/internal/grpc/pb"
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// bulkFlushDelay is how long a batch that is not full waits for more todos before it is
+// inserted, so that a client waiting for the results of the todos it sent gets them
+const bulkFlushDelay = 100 * time.Millisecond
+
+// BulkCreate creates the todos of the stream in batches of up to repository.MaxInsertBatch,
+// each in its own transaction, and sends the result of every todo in the order they came in.
+// A todo that cannot be created does not stop the others, if a whole batch fails all of its
+// todos get the error.
+func (s *TodoServer) BulkCreate(stream grpc.BidiStreamingServer[pb.Todo, pb.BulkCreateResult]) error {
+	ctx := stream.Context()
+	userID, err := auth.UserIDFromContext(ctx)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	// the todos are received in the background, so that a batch can be flushed while waiting for more
+	received := make(chan *pb.Todo)
+	recvErr := make(chan error, 1)
+	go func() {
+		defer close(received)
+		for {
+			message, err := stream.Recv()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					recvErr <- err
+				}
+				return
+			}
+			select {
+			case received <- message:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	db := s.audited(ctx)
+	var batch []models.Todo
+	next := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		results, err := db.InsertTodos(ctx, userID, batch)
+		if err != nil {
+			log.Println("bulk create failed:", err)
+		}
+
+		for i := range batch {
+			result := &pb.BulkCreateResult{Index: int32(next + i)}
+			switch {
+			case err != nil:
+				result.Result = &pb.BulkCreateResult_Error{Error: "internal error"}
+			case results[i].Err != nil:
+				result.Result = &pb.BulkCreateResult_Error{Error: results[i].Err.Error()}
+			default:
+				result.Result = &pb.BulkCreateResult_Id{Id: int32(results[i].ID)}
+			}
+			if err := stream.Send(result); err != nil {
+				return status.Error(codes.Internal, "internal error")
+			}
+		}
+
+		next += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	var flushAfter <-chan time.Time
+	for {
+		select {
+		case message, ok := <-received:
+			if !ok {
+				select {
+				case err := <-recvErr:
+					return err
+				default:
+				}
+				return flush()
+			}
+
+			batch = append(batch, todoFromPb(message))
+			switch {
+			case len(batch) >= repository.MaxInsertBatch:
+				flushAfter = nil
+				if err := flush(); err != nil {
+					return err
+				}
+			case len(batch) == 1:
+				flushAfter = time.After(bulkFlushDelay)
+			}
+		case <-flushAfter:
+			flushAfter = nil
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package rpc
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/events"
+	"github.com/anras5/todo-app-backend/internal/grpc/pb"
+	"github.com/anras5/todo-app-backend/internal/models"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// todoToPb converts a todo into its protobuf message
+func todoToPb(todo *models.Todo) *pb.Todo {
+	message := &pb.Todo{
+		Id:          int32(todo.ID),
+		Name:        todo.Name,
+		Description: todo.Description,
+		Deadline:    timestamppb.New(todo.Deadline),
+		Completed:   todo.Completed,
+		Progress:    int32(todo.Progress),
+		Tags:        todo.Tags,
+		Rrule:       todo.RRule,
+		Version:     int32(todo.Version),
+	}
+	if todo.ProjectID != nil {
+		projectID := int32(*todo.ProjectID)
+		message.ProjectId = &projectID
+	}
+	if todo.ParentID != nil {
+		parentID := int32(*todo.ParentID)
+		message.ParentId = &parentID
+	}
+	if todo.DeletedAt != nil {
+		message.DeletedAt = timestamppb.New(*todo.DeletedAt)
+	}
+	return message
+}
+
+// todoFromPb converts a protobuf message into a todo
+func todoFromPb(message *pb.Todo) models.Todo {
+	todo := models.Todo{
+		ID:          int(message.GetId()),
+		Name:        message.GetName(),
+		Description: message.GetDescription(),
+		Deadline:    message.GetDeadline().AsTime(),
+		Completed:   message.GetCompleted(),
+		RRule:       message.GetRrule(),
+	}
+	if message.ProjectId != nil {
+		projectID := int(message.GetProjectId())
+		todo.ProjectID = &projectID
+	}
+	if message.ParentId != nil {
+		parentID := int(message.GetParentId())
+		todo.ParentID = &parentID
+	}
+	if len(message.GetTags()) > 0 {
+		todo.Tags = message.GetTags()
+	}
+	return todo
+}
+
+// historyToPb converts a change of a todo into its protobuf message
+func historyToPb(entry *models.TodoHistory) *pb.TodoHistory {
+	return &pb.TodoHistory{
+		Id:        int32(entry.ID),
+		TodoId:    int32(entry.TodoID),
+		ActorId:   int32(entry.ActorID),
+		Action:    entry.Action,
+		Before:    string(entry.Before),
+		After:     string(entry.After),
+		RequestId: entry.RequestID,
+		Transport: entry.Transport,
+		CreatedAt: timestamppb.New(entry.CreatedAt),
+	}
+}
+
+// eventTypes maps the types of the events to their protobuf enum
+var eventTypes = map[string]pb.TodoEventType{
+	events.Created:   pb.TodoEventType_TODO_EVENT_TYPE_CREATED,
+	events.Updated:   pb.TodoEventType_TODO_EVENT_TYPE_UPDATED,
+	events.Completed: pb.TodoEventType_TODO_EVENT_TYPE_COMPLETED,
+	events.Deleted:   pb.TodoEventType_TODO_EVENT_TYPE_DELETED,
+}
+
+// eventToPb converts an event of the bus into its protobuf message
+func eventToPb(event events.Event) (*pb.TodoEvent, error) {
+	var todo models.Todo
+	if err := json.Unmarshal(event.Todo, &todo); err != nil {
+		return nil, err
+	}
+	return &pb.TodoEvent{
+		Revision:  event.ID,
+		Type:      eventTypes[event.Type],
+		Todo:      todoToPb(&todo),
+		CreatedAt: timestamppb.New(event.CreatedAt),
+	}, nil
+}
+
+// todoFilterFromPb reads the filter and sort of a list request
+func todoFilterFromPb(req *pb.ListRequest) (models.TodoFilter, error) {
+	filter := models.TodoFilter{
+		Tags:           req.GetTags(),
+		MatchAllTags:   req.GetMatchAllTags(),
+		DeadlineAfter:  timeFromPb(req.GetDeadlineAfter()),
+		DeadlineBefore: timeFromPb(req.GetDeadlineBefore()),
+		CreatedAfter:   timeFromPb(req.GetCreatedAfter()),
+		CreatedBefore:  timeFromPb(req.GetCreatedBefore()),
+		UpdatedAfter:   timeFromPb(req.GetUpdatedAfter()),
+		UpdatedBefore:  timeFromPb(req.GetUpdatedBefore()),
+		Overdue:        req.GetOverdue(),
+		NameContains:   req.GetNameContains(),
+	}
+	if req.Completed != nil {
+		completed := req.GetCompleted()
+		filter.Completed = &completed
+	}
+	for _, field := range req.GetSort() {
+		sortField, err := models.NewSortField(field.GetField(), field.GetDesc())
+		if err != nil {
+			return filter, err
+		}
+		filter.Sort = append(filter.Sort, sortField)
+	}
+	return filter, nil
+}
+
+// timeFromPb converts an optional timestamp, nil stays nil
+func timeFromPb(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+// projectToPb converts a project into its protobuf message
+func projectToPb(project *models.Project) *pb.Project {
+	return &pb.Project{
+		Id:          int32(project.ID),
+		Name:        project.Name,
+		Description: project.Description,
+	}
+}
@@ -0,0 +1,72 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anras5/todo-app-backend/internal/auth"
+	"github.com/go-chi/chi/v5/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// authenticate reads the bearer token from the "authorization" metadata and stores its user,
+// together with the request id, in the context
+func (s *TodoServer) authenticate(ctx context.Context) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, auth.ErrNoToken.Error())
+	}
+
+	var header string
+	if values := md.Get("authorization"); len(values) > 0 {
+		header = values[0]
+	}
+
+	userID, err := s.Auth.ParseAuthorizationHeader(header)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return withRequestID(auth.WithUserID(ctx, userID), md), nil
+}
+
+// withRequestID stores the "x-request-id" metadata in the context the same way chi's
+// middleware.RequestID does for HTTP requests, generating an id if there is none
+func withRequestID(ctx context.Context, md metadata.MD) context.Context {
+	var requestID string
+	if values := md.Get("x-request-id"); len(values) > 0 {
+		requestID = values[0]
+	}
+	if requestID == "" {
+		requestID = fmt.Sprintf("grpc-%06d", middleware.NextRequestID())
+	}
+	return context.WithValue(ctx, middleware.RequestIDKey, requestID)
+}
+
+func (s *TodoServer) unaryAuthInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *TodoServer) streamAuthInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticatedStream is a grpc.ServerStream whose context carries the authenticated user
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -20,11 +20,18 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	TodoService_Create_FullMethodName = "/pb.TodoService/Create"
-	TodoService_Get_FullMethodName    = "/pb.TodoService/Get"
-	TodoService_Update_FullMethodName = "/pb.TodoService/Update"
-	TodoService_Delete_FullMethodName = "/pb.TodoService/Delete"
-	TodoService_List_FullMethodName   = "/pb.TodoService/List"
+	TodoService_Create_FullMethodName       = "/pb.TodoService/Create"
+	TodoService_Get_FullMethodName          = "/pb.TodoService/Get"
+	TodoService_Update_FullMethodName       = "/pb.TodoService/Update"
+	TodoService_Delete_FullMethodName       = "/pb.TodoService/Delete"
+	TodoService_List_FullMethodName         = "/pb.TodoService/List"
+	TodoService_ListChildren_FullMethodName = "/pb.TodoService/ListChildren"
+	TodoService_Search_FullMethodName       = "/pb.TodoService/Search"
+	TodoService_Restore_FullMethodName      = "/pb.TodoService/Restore"
+	TodoService_ListTrash_FullMethodName    = "/pb.TodoService/ListTrash"
+	TodoService_History_FullMethodName      = "/pb.TodoService/History"
+	TodoService_BulkCreate_FullMethodName   = "/pb.TodoService/BulkCreate"
+	TodoService_Watch_FullMethodName        = "/pb.TodoService/Watch"
 )
 
 // TodoServiceClient is the client API for TodoService service.
@@ -33,9 +40,18 @@ const (
 type TodoServiceClient interface {
 	Create(ctx context.Context, in *Todo, opts ...grpc.CallOption) (*Todo, error)
 	Get(ctx context.Context, in *Id, opts ...grpc.CallOption) (*Todo, error)
-	Update(ctx context.Context, in *Todo, opts ...grpc.CallOption) (*Todo, error)
+	Update(ctx context.Context, in *UpdateTodoRequest, opts ...grpc.CallOption) (*Todo, error)
 	Delete(ctx context.Context, in *Id, opts ...grpc.CallOption) (*Todo, error)
-	List(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Todo], error)
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	ListChildren(ctx context.Context, in *Id, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Todo], error)
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	Restore(ctx context.Context, in *Id, opts ...grpc.CallOption) (*Todo, error)
+	ListTrash(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Todo], error)
+	History(ctx context.Context, in *Id, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TodoHistory], error)
+	// creates the todos of the stream in batches, the results of a batch are sent once it is inserted
+	BulkCreate(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Todo, BulkCreateResult], error)
+	// streams the changes of the todos of the user, a client falling too far behind is disconnected with RESOURCE_EXHAUSTED
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TodoEvent], error)
 }
 
 type todoServiceClient struct {
@@ -66,7 +82,7 @@ func (c *todoServiceClient) Get(ctx context.Context, in *Id, opts ...grpc.CallOp
 	return out, nil
 }
 
-func (c *todoServiceClient) Update(ctx context.Context, in *Todo, opts ...grpc.CallOption) (*Todo, error) {
+func (c *todoServiceClient) Update(ctx context.Context, in *UpdateTodoRequest, opts ...grpc.CallOption) (*Todo, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(Todo)
 	err := c.cc.Invoke(ctx, TodoService_Update_FullMethodName, in, out, cOpts...)
@@ -86,9 +102,58 @@ func (c *todoServiceClient) Delete(ctx context.Context, in *Id, opts ...grpc.Cal
 	return out, nil
 }
 
-func (c *todoServiceClient) List(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Todo], error) {
+func (c *todoServiceClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &TodoService_ServiceDesc.Streams[0], TodoService_List_FullMethodName, cOpts...)
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, TodoService_List_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoServiceClient) ListChildren(ctx context.Context, in *Id, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Todo], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TodoService_ServiceDesc.Streams[0], TodoService_ListChildren_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Id, Todo]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TodoService_ListChildrenClient = grpc.ServerStreamingClient[Todo]
+
+func (c *todoServiceClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, TodoService_Search_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoServiceClient) Restore(ctx context.Context, in *Id, opts ...grpc.CallOption) (*Todo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Todo)
+	err := c.cc.Invoke(ctx, TodoService_Restore_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoServiceClient) ListTrash(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Todo], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TodoService_ServiceDesc.Streams[1], TodoService_ListTrash_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -103,7 +168,58 @@ func (c *todoServiceClient) List(ctx context.Context, in *emptypb.Empty, opts ..
 }
 
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
-type TodoService_ListClient = grpc.ServerStreamingClient[Todo]
+type TodoService_ListTrashClient = grpc.ServerStreamingClient[Todo]
+
+func (c *todoServiceClient) History(ctx context.Context, in *Id, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TodoHistory], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TodoService_ServiceDesc.Streams[2], TodoService_History_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Id, TodoHistory]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TodoService_HistoryClient = grpc.ServerStreamingClient[TodoHistory]
+
+func (c *todoServiceClient) BulkCreate(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Todo, BulkCreateResult], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TodoService_ServiceDesc.Streams[3], TodoService_BulkCreate_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Todo, BulkCreateResult]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TodoService_BulkCreateClient = grpc.BidiStreamingClient[Todo, BulkCreateResult]
+
+func (c *todoServiceClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TodoEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TodoService_ServiceDesc.Streams[4], TodoService_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, TodoEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TodoService_WatchClient = grpc.ServerStreamingClient[TodoEvent]
 
 // TodoServiceServer is the server API for TodoService service.
 // All implementations should embed UnimplementedTodoServiceServer
@@ -111,9 +227,18 @@ type TodoService_ListClient = grpc.ServerStreamingClient[Todo]
 type TodoServiceServer interface {
 	Create(context.Context, *Todo) (*Todo, error)
 	Get(context.Context, *Id) (*Todo, error)
-	Update(context.Context, *Todo) (*Todo, error)
+	Update(context.Context, *UpdateTodoRequest) (*Todo, error)
 	Delete(context.Context, *Id) (*Todo, error)
-	List(*emptypb.Empty, grpc.ServerStreamingServer[Todo]) error
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	ListChildren(*Id, grpc.ServerStreamingServer[Todo]) error
+	Search(context.Context, *SearchRequest) (*SearchResponse, error)
+	Restore(context.Context, *Id) (*Todo, error)
+	ListTrash(*emptypb.Empty, grpc.ServerStreamingServer[Todo]) error
+	History(*Id, grpc.ServerStreamingServer[TodoHistory]) error
+	// creates the todos of the stream in batches, the results of a batch are sent once it is inserted
+	BulkCreate(grpc.BidiStreamingServer[Todo, BulkCreateResult]) error
+	// streams the changes of the todos of the user, a client falling too far behind is disconnected with RESOURCE_EXHAUSTED
+	Watch(*WatchRequest, grpc.ServerStreamingServer[TodoEvent]) error
 }
 
 // UnimplementedTodoServiceServer should be embedded to have
@@ -129,14 +254,35 @@ func (UnimplementedTodoServiceServer) Create(context.Context, *Todo) (*Todo, err
 func (UnimplementedTodoServiceServer) Get(context.Context, *Id) (*Todo, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
 }
-func (UnimplementedTodoServiceServer) Update(context.Context, *Todo) (*Todo, error) {
+func (UnimplementedTodoServiceServer) Update(context.Context, *UpdateTodoRequest) (*Todo, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
 }
 func (UnimplementedTodoServiceServer) Delete(context.Context, *Id) (*Todo, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
 }
-func (UnimplementedTodoServiceServer) List(*emptypb.Empty, grpc.ServerStreamingServer[Todo]) error {
-	return status.Errorf(codes.Unimplemented, "method List not implemented")
+func (UnimplementedTodoServiceServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedTodoServiceServer) ListChildren(*Id, grpc.ServerStreamingServer[Todo]) error {
+	return status.Errorf(codes.Unimplemented, "method ListChildren not implemented")
+}
+func (UnimplementedTodoServiceServer) Search(context.Context, *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedTodoServiceServer) Restore(context.Context, *Id) (*Todo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Restore not implemented")
+}
+func (UnimplementedTodoServiceServer) ListTrash(*emptypb.Empty, grpc.ServerStreamingServer[Todo]) error {
+	return status.Errorf(codes.Unimplemented, "method ListTrash not implemented")
+}
+func (UnimplementedTodoServiceServer) History(*Id, grpc.ServerStreamingServer[TodoHistory]) error {
+	return status.Errorf(codes.Unimplemented, "method History not implemented")
+}
+func (UnimplementedTodoServiceServer) BulkCreate(grpc.BidiStreamingServer[Todo, BulkCreateResult]) error {
+	return status.Errorf(codes.Unimplemented, "method BulkCreate not implemented")
+}
+func (UnimplementedTodoServiceServer) Watch(*WatchRequest, grpc.ServerStreamingServer[TodoEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
 }
 func (UnimplementedTodoServiceServer) testEmbeddedByValue() {}
 
@@ -195,7 +341,7 @@ func _TodoService_Get_Handler(srv interface{}, ctx context.Context, dec func(int
 }
 
 func _TodoService_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Todo)
+	in := new(UpdateTodoRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
@@ -207,7 +353,7 @@ func _TodoService_Update_Handler(srv interface{}, ctx context.Context, dec func(
 		FullMethod: TodoService_Update_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(TodoServiceServer).Update(ctx, req.(*Todo))
+		return srv.(TodoServiceServer).Update(ctx, req.(*UpdateTodoRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -230,16 +376,110 @@ func _TodoService_Delete_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
-func _TodoService_List_Handler(srv interface{}, stream grpc.ServerStream) error {
+func _TodoService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServiceServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TodoService_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServiceServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TodoService_ListChildren_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Id)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TodoServiceServer).ListChildren(m, &grpc.GenericServerStream[Id, Todo]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TodoService_ListChildrenServer = grpc.ServerStreamingServer[Todo]
+
+func _TodoService_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServiceServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TodoService_Search_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServiceServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TodoService_Restore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Id)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServiceServer).Restore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TodoService_Restore_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServiceServer).Restore(ctx, req.(*Id))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TodoService_ListTrash_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(emptypb.Empty)
 	if err := stream.RecvMsg(m); err != nil {
 		return err
 	}
-	return srv.(TodoServiceServer).List(m, &grpc.GenericServerStream[emptypb.Empty, Todo]{ServerStream: stream})
+	return srv.(TodoServiceServer).ListTrash(m, &grpc.GenericServerStream[emptypb.Empty, Todo]{ServerStream: stream})
 }
 
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
-type TodoService_ListServer = grpc.ServerStreamingServer[Todo]
+type TodoService_ListTrashServer = grpc.ServerStreamingServer[Todo]
+
+func _TodoService_History_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Id)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TodoServiceServer).History(m, &grpc.GenericServerStream[Id, TodoHistory]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TodoService_HistoryServer = grpc.ServerStreamingServer[TodoHistory]
+
+func _TodoService_BulkCreate_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TodoServiceServer).BulkCreate(&grpc.GenericServerStream[Todo, BulkCreateResult]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TodoService_BulkCreateServer = grpc.BidiStreamingServer[Todo, BulkCreateResult]
+
+func _TodoService_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TodoServiceServer).Watch(m, &grpc.GenericServerStream[WatchRequest, TodoEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TodoService_WatchServer = grpc.ServerStreamingServer[TodoEvent]
 
 // TodoService_ServiceDesc is the grpc.ServiceDesc for TodoService service.
 // It's only intended for direct use with grpc.RegisterService,
@@ -264,11 +504,341 @@ var TodoService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Delete",
 			Handler:    _TodoService_Delete_Handler,
 		},
+		{
+			MethodName: "List",
+			Handler:    _TodoService_List_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _TodoService_Search_Handler,
+		},
+		{
+			MethodName: "Restore",
+			Handler:    _TodoService_Restore_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListChildren",
+			Handler:       _TodoService_ListChildren_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListTrash",
+			Handler:       _TodoService_ListTrash_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "History",
+			Handler:       _TodoService_History_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "BulkCreate",
+			Handler:       _TodoService_BulkCreate_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _TodoService_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/todo.proto",
+}
+
+const (
+	ProjectService_Create_FullMethodName    = "/pb.ProjectService/Create"
+	ProjectService_Get_FullMethodName       = "/pb.ProjectService/Get"
+	ProjectService_Update_FullMethodName    = "/pb.ProjectService/Update"
+	ProjectService_Delete_FullMethodName    = "/pb.ProjectService/Delete"
+	ProjectService_List_FullMethodName      = "/pb.ProjectService/List"
+	ProjectService_ListTodos_FullMethodName = "/pb.ProjectService/ListTodos"
+)
+
+// ProjectServiceClient is the client API for ProjectService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ProjectServiceClient interface {
+	Create(ctx context.Context, in *Project, opts ...grpc.CallOption) (*Project, error)
+	Get(ctx context.Context, in *Id, opts ...grpc.CallOption) (*Project, error)
+	Update(ctx context.Context, in *Project, opts ...grpc.CallOption) (*Project, error)
+	Delete(ctx context.Context, in *DeleteProjectRequest, opts ...grpc.CallOption) (*Project, error)
+	List(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Project], error)
+	ListTodos(ctx context.Context, in *Id, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Todo], error)
+}
+
+type projectServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewProjectServiceClient(cc grpc.ClientConnInterface) ProjectServiceClient {
+	return &projectServiceClient{cc}
+}
+
+func (c *projectServiceClient) Create(ctx context.Context, in *Project, opts ...grpc.CallOption) (*Project, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Project)
+	err := c.cc.Invoke(ctx, ProjectService_Create_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *projectServiceClient) Get(ctx context.Context, in *Id, opts ...grpc.CallOption) (*Project, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Project)
+	err := c.cc.Invoke(ctx, ProjectService_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *projectServiceClient) Update(ctx context.Context, in *Project, opts ...grpc.CallOption) (*Project, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Project)
+	err := c.cc.Invoke(ctx, ProjectService_Update_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *projectServiceClient) Delete(ctx context.Context, in *DeleteProjectRequest, opts ...grpc.CallOption) (*Project, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Project)
+	err := c.cc.Invoke(ctx, ProjectService_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *projectServiceClient) List(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Project], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ProjectService_ServiceDesc.Streams[0], ProjectService_List_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[emptypb.Empty, Project]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ProjectService_ListClient = grpc.ServerStreamingClient[Project]
+
+func (c *projectServiceClient) ListTodos(ctx context.Context, in *Id, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Todo], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ProjectService_ServiceDesc.Streams[1], ProjectService_ListTodos_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Id, Todo]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ProjectService_ListTodosClient = grpc.ServerStreamingClient[Todo]
+
+// ProjectServiceServer is the server API for ProjectService service.
+// All implementations should embed UnimplementedProjectServiceServer
+// for forward compatibility.
+type ProjectServiceServer interface {
+	Create(context.Context, *Project) (*Project, error)
+	Get(context.Context, *Id) (*Project, error)
+	Update(context.Context, *Project) (*Project, error)
+	Delete(context.Context, *DeleteProjectRequest) (*Project, error)
+	List(*emptypb.Empty, grpc.ServerStreamingServer[Project]) error
+	ListTodos(*Id, grpc.ServerStreamingServer[Todo]) error
+}
+
+// UnimplementedProjectServiceServer should be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedProjectServiceServer struct{}
+
+func (UnimplementedProjectServiceServer) Create(context.Context, *Project) (*Project, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
+}
+func (UnimplementedProjectServiceServer) Get(context.Context, *Id) (*Project, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedProjectServiceServer) Update(context.Context, *Project) (*Project, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
+}
+func (UnimplementedProjectServiceServer) Delete(context.Context, *DeleteProjectRequest) (*Project, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedProjectServiceServer) List(*emptypb.Empty, grpc.ServerStreamingServer[Project]) error {
+	return status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedProjectServiceServer) ListTodos(*Id, grpc.ServerStreamingServer[Todo]) error {
+	return status.Errorf(codes.Unimplemented, "method ListTodos not implemented")
+}
+func (UnimplementedProjectServiceServer) testEmbeddedByValue() {}
+
+// UnsafeProjectServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ProjectServiceServer will
+// result in compilation errors.
+type UnsafeProjectServiceServer interface {
+	mustEmbedUnimplementedProjectServiceServer()
+}
+
+func RegisterProjectServiceServer(s grpc.ServiceRegistrar, srv ProjectServiceServer) {
+	// If the following call pancis, it indicates UnimplementedProjectServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ProjectService_ServiceDesc, srv)
+}
+
+func _ProjectService_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Project)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProjectServiceServer).Create(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProjectService_Create_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProjectServiceServer).Create(ctx, req.(*Project))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProjectService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Id)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProjectServiceServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProjectService_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProjectServiceServer).Get(ctx, req.(*Id))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProjectService_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Project)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProjectServiceServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProjectService_Update_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProjectServiceServer).Update(ctx, req.(*Project))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProjectService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteProjectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProjectServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProjectService_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProjectServiceServer).Delete(ctx, req.(*DeleteProjectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProjectService_List_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(emptypb.Empty)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ProjectServiceServer).List(m, &grpc.GenericServerStream[emptypb.Empty, Project]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ProjectService_ListServer = grpc.ServerStreamingServer[Project]
+
+func _ProjectService_ListTodos_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Id)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ProjectServiceServer).ListTodos(m, &grpc.GenericServerStream[Id, Todo]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ProjectService_ListTodosServer = grpc.ServerStreamingServer[Todo]
+
+// ProjectService_ServiceDesc is the grpc.ServiceDesc for ProjectService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ProjectService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pb.ProjectService",
+	HandlerType: (*ProjectServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Create",
+			Handler:    _ProjectService_Create_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _ProjectService_Get_Handler,
+		},
+		{
+			MethodName: "Update",
+			Handler:    _ProjectService_Update_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _ProjectService_Delete_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "List",
-			Handler:       _TodoService_List_Handler,
+			Handler:       _ProjectService_List_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListTodos",
+			Handler:       _ProjectService_ListTodos_Handler,
 			ServerStreams: true,
 		},
 	},
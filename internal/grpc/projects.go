@@ -0,0 +1,184 @@
+package rpc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/anras5/todo-app-backend/internal/auth"
+	"github.com/anras5/todo-app-backend/internal/grpc/pb"
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/go-chi/chi/v5/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type ProjectServer struct {
+	DB repository.DatabaseRepo
+}
+
+// audited returns the repo recording the call in the history of the todos it changes
+func (s *ProjectServer) audited(ctx context.Context) repository.DatabaseRepo {
+	return s.DB.WithAudit(models.Audit{
+		RequestID: middleware.GetReqID(ctx),
+		Transport: models.TransportGRPC,
+	})
+}
+
+// projectError converts a repository error into a gRPC status error
+func projectError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, repository.ErrProjectNotFound) {
+		return status.Error(codes.NotFound, "project not found")
+	}
+	return status.Error(codes.Internal, "internal error")
+}
+
+func (s *ProjectServer) Create(ctx context.Context, req *pb.Project) (*pb.Project, error) {
+	userID, err := auth.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	project := models.Project{
+		UserID:      userID,
+		Name:        req.GetName(),
+		Description: req.GetDescription(),
+	}
+	if project.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "project name should not be empty")
+	}
+
+	id, err := s.DB.InsertProject(ctx, project)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	project.ID = id
+
+	return projectToPb(&project), nil
+}
+
+func (s *ProjectServer) Get(ctx context.Context, req *pb.Id) (*pb.Project, error) {
+	userID, err := auth.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	project, err := s.DB.SelectProject(ctx, userID, int(req.GetId()))
+	if err != nil {
+		return nil, projectError(err)
+	}
+
+	return projectToPb(project), nil
+}
+
+func (s *ProjectServer) Update(ctx context.Context, req *pb.Project) (*pb.Project, error) {
+	userID, err := auth.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	project := models.Project{
+		ID:          int(req.GetId()),
+		UserID:      userID,
+		Name:        req.GetName(),
+		Description: req.GetDescription(),
+	}
+	if project.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "project name should not be empty")
+	}
+
+	err = s.DB.UpdateProject(ctx, project)
+	if err != nil {
+		return nil, projectError(err)
+	}
+
+	return projectToPb(&project), nil
+}
+
+func (s *ProjectServer) Delete(ctx context.Context, req *pb.DeleteProjectRequest) (*pb.Project, error) {
+	userID, err := auth.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	id := int(req.GetId())
+
+	deletion := models.ProjectDeletion{DeleteTodos: req.GetDeleteTodos()}
+	if req.ReassignTo != nil {
+		if deletion.DeleteTodos {
+			return nil, status.Error(codes.InvalidArgument, "cannot both delete and reassign todos")
+		}
+		reassignTo := int(req.GetReassignTo())
+		deletion.ReassignTo = &reassignTo
+	}
+
+	// the project is returned as it was before it was deleted
+	var project *models.Project
+	err = s.audited(ctx).WithTx(ctx, func(db repository.DatabaseRepo) error {
+		var err error
+		project, err = db.SelectProject(ctx, userID, id)
+		if err != nil {
+			return err
+		}
+		return db.DeleteProject(ctx, userID, id, deletion)
+	})
+	if err != nil {
+		return nil, projectError(err)
+	}
+
+	return projectToPb(project), nil
+}
+
+func (s *ProjectServer) List(_ *emptypb.Empty, stream grpc.ServerStreamingServer[pb.Project]) error {
+	userID, err := auth.UserIDFromContext(stream.Context())
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	projects, err := s.DB.SelectProjects(stream.Context(), userID)
+	if err != nil {
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	for _, project := range projects {
+		err := stream.Send(projectToPb(project))
+		if err != nil {
+			return status.Error(codes.Internal, "internal error")
+		}
+	}
+
+	return nil
+}
+
+func (s *ProjectServer) ListTodos(req *pb.Id, stream grpc.ServerStreamingServer[pb.Todo]) error {
+	userID, err := auth.UserIDFromContext(stream.Context())
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	projectID := int(req.GetId())
+	var todos []*models.Todo
+	err = s.DB.WithIsolation(sql.LevelRepeatableRead).WithTx(stream.Context(), func(db repository.DatabaseRepo) error {
+		if _, err := db.SelectProject(stream.Context(), userID, projectID); err != nil {
+			return err
+		}
+		var err error
+		todos, err = db.SelectProjectTodos(stream.Context(), userID, projectID)
+		return err
+	})
+	if err != nil {
+		return projectError(err)
+	}
+
+	for _, todo := range todos {
+		err := stream.Send(todoToPb(todo))
+		if err != nil {
+			return status.Error(codes.Internal, "internal error")
+		}
+	}
+
+	return nil
+}
@@ -6,69 +6,98 @@ import (
 	"errors"
 	"log"
 	"net"
+	"strings"
 
+	"github.com/anras5/todo-app-backend/internal/auth"
+	"github.com/anras5/todo-app-backend/internal/events"
 	"github.com/anras5/todo-app-backend/internal/grpc/pb"
 	"github.com/anras5/todo-app-backend/internal/models"
 	"github.com/anras5/todo-app-backend/internal/repository"
-	"github.com/anras5/todo-app-backend/internal/repository/dbrepo"
+	"github.com/anras5/todo-app-backend/internal/rrule"
+	"github.com/go-chi/chi/v5/middleware"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
-	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type TodoServer struct {
-	DB repository.DatabaseRepo
+	DB     repository.DatabaseRepo
+	Events *events.Bus
+	Auth   *auth.Auth
 }
 
-func NewTodoServer(db *sql.DB) *TodoServer {
+// NewTodoServer returns a server using the repo of the REST handlers and the bus it publishes to
+func NewTodoServer(db repository.DatabaseRepo, bus *events.Bus, a *auth.Auth) *TodoServer {
 	return &TodoServer{
-		DB: dbrepo.NewPostgresRepo(db),
+		DB:     db,
+		Events: bus,
+		Auth:   a,
 	}
 }
 
-func (s *TodoServer) Run() {
-	listen, err := net.Listen("tcp", ":9000")
+// Run serves the gRPC API on the address, like :9000
+func (s *TodoServer) Run(addr string) {
+	listen, err := net.Listen("tcp", addr)
 	if err != nil {
-		log.Fatalf("failed to listen on port 9000: %v", err)
+		log.Fatalf("failed to listen on %s: %v", addr, err)
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(s.unaryAuthInterceptor),
+		grpc.StreamInterceptor(s.streamAuthInterceptor),
+	)
 	pb.RegisterTodoServiceServer(grpcServer, s)
+	pb.RegisterProjectServiceServer(grpcServer, &ProjectServer{DB: s.DB})
 
-	log.Println("starting grpc server on :9000")
+	log.Println("starting grpc server on", addr)
 	if err := grpcServer.Serve(listen); err != nil {
-		log.Fatalf("failed to serve grpc server over 9000: %v", err)
+		log.Fatalf("failed to serve grpc server over %s: %v", addr, err)
 	}
 }
 
+// audited returns the repo recording the call in the history of the todos it changes
+func (s *TodoServer) audited(ctx context.Context) repository.DatabaseRepo {
+	return s.DB.WithAudit(models.Audit{
+		RequestID: middleware.GetReqID(ctx),
+		Transport: models.TransportGRPC,
+	})
+}
+
 func (s *TodoServer) Create(ctx context.Context, req *pb.Todo) (*pb.Todo, error) {
-	todo := models.Todo{
-		Name:        req.GetName(),
-		Description: req.GetDescription(),
-		Deadline:    req.GetDeadline().AsTime(),
-		Completed:   req.GetCompleted(),
+	userID, err := auth.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
 	}
 
-	id, err := s.DB.InsertTodo(todo)
+	todo := todoFromPb(req)
+	todo.UserID = userID
+
+	var inserted *models.Todo
+	err = s.audited(ctx).WithTx(ctx, func(db repository.DatabaseRepo) error {
+		id, err := db.InsertTodo(ctx, todo)
+		if err != nil {
+			return err
+		}
+		// read the todo back to get the fields set by the repository, like its tags and timestamps
+		inserted, err = db.SelectTodo(ctx, userID, id)
+		return err
+	})
 	if err != nil {
-		return nil, status.Error(codes.Internal, "internal error")
+		return nil, todoWriteError(err)
 	}
-
-	return &pb.Todo{
-		Id:          int32(id),
-		Name:        todo.Name,
-		Description: todo.Description,
-		Deadline:    timestamppb.New(todo.Deadline),
-		Completed:   todo.Completed,
-	}, nil
+	return todoToPb(inserted), nil
 }
 
 func (s *TodoServer) Get(ctx context.Context, req *pb.Id) (*pb.Todo, error) {
+	userID, err := auth.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
 	id := int(req.GetId())
 
-	todo, err := s.DB.SelectTodo(id)
+	todo, err := s.DB.SelectTodo(ctx, userID, id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, status.Error(codes.NotFound, "todo not found")
@@ -76,79 +105,233 @@ func (s *TodoServer) Get(ctx context.Context, req *pb.Id) (*pb.Todo, error) {
 		return nil, status.Error(codes.Internal, "internal error")
 	}
 
-	return &pb.Todo{
-		Id:          int32(todo.ID),
-		Name:        todo.Name,
-		Description: todo.Description,
-		Deadline:    timestamppb.New(todo.Deadline),
-		Completed:   todo.Completed,
-	}, nil
+	return todoToPb(todo), nil
 }
 
-func (s *TodoServer) Update(ctx context.Context, req *pb.Todo) (*pb.Todo, error) {
-	todo := models.Todo{
-		ID:          int(req.GetId()),
-		Name:        req.GetName(),
-		Description: req.GetDescription(),
-		Deadline:    req.GetDeadline().AsTime(),
-		Completed:   req.GetCompleted(),
+func (s *TodoServer) Update(ctx context.Context, req *pb.UpdateTodoRequest) (*pb.Todo, error) {
+	userID, err := auth.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
 	}
 
-	err := s.DB.UpdateTodo(todo)
-	if err != nil {
-		return nil, status.Error(codes.Internal, "internal error")
+	if req.GetTodo() == nil {
+		return nil, status.Error(codes.InvalidArgument, "todo is required")
+	}
+	if req.GetExpectedVersion() < 1 {
+		return nil, status.Error(codes.InvalidArgument, "expected_version is required")
+	}
+
+	todo := todoFromPb(req.GetTodo())
+	todo.UserID = userID
+	todo.Version = int(req.GetExpectedVersion())
+
+	// the paths of the mask are the names of the fields of pb.Todo, which match models.TodoUpdateFields
+	fields := req.GetUpdateMask().GetPaths()
+	if _, err := models.NewTodoFieldMask(fields...); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	return &pb.Todo{
-		Id:          int32(todo.ID),
-		Name:        todo.Name,
-		Description: todo.Description,
-		Deadline:    timestamppb.New(todo.Deadline),
-		Completed:   todo.Completed,
-	}, nil
+	var updated *models.Todo
+	err = s.audited(ctx).WithTx(ctx, func(db repository.DatabaseRepo) error {
+		if err := db.UpdateTodo(ctx, todo, fields...); err != nil {
+			return err
+		}
+		// read the todo back to get its new version
+		var err error
+		updated, err = db.SelectTodo(ctx, userID, todo.ID)
+		return err
+	})
+	if err != nil {
+		return nil, todoWriteError(err)
+	}
+	return todoToPb(updated), nil
 }
 
 func (s *TodoServer) Delete(ctx context.Context, req *pb.Id) (*pb.Todo, error) {
+	userID, err := auth.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
 	id := int(req.GetId())
 
-	todo, err := s.DB.SelectTodo(id)
+	// the todo is returned as it was before it was deleted
+	var todo *models.Todo
+	err = s.audited(ctx).WithTx(ctx, func(db repository.DatabaseRepo) error {
+		var err error
+		todo, err = db.SelectTodo(ctx, userID, id)
+		if err != nil {
+			return err
+		}
+		return db.DeleteTodo(ctx, userID, id, 0)
+	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, status.Error(codes.NotFound, "todo not found")
 		}
 		return nil, status.Error(codes.Internal, "internal error")
 	}
-	err = s.DB.DeleteTodo(id)
+
+	return todoToPb(todo), nil
+}
+
+func (s *TodoServer) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	userID, err := auth.UserIDFromContext(ctx)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, status.Error(codes.NotFound, "todo not found")
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	limit := int(req.GetPageSize())
+	if limit == 0 {
+		limit = repository.DefaultPageSize
+	}
+	if limit < 0 || limit > repository.MaxPageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "page size should be between 1 and %d", repository.MaxPageSize)
+	}
+
+	var after *models.TodoCursor
+	if req.GetPageToken() != "" {
+		after, err = models.DecodeTodoCursor(req.GetPageToken())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
 		}
+	}
+
+	filter, err := todoFilterFromPb(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	page, err := s.DB.SelectTodosPage(ctx, userID, limit, after, filter)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	response := &pb.ListResponse{
+		Todos:         make([]*pb.Todo, 0, len(page.Todos)),
+		NextPageToken: page.NextCursor,
+	}
+	for _, todo := range page.Todos {
+		response.Todos = append(response.Todos, todoToPb(todo))
+	}
+
+	return response, nil
+}
+
+func (s *TodoServer) Search(ctx context.Context, req *pb.SearchRequest) (*pb.SearchResponse, error) {
+	userID, err := auth.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	query := strings.TrimSpace(req.GetQuery())
+	if query == "" {
+		return nil, status.Error(codes.InvalidArgument, "query is required")
+	}
+
+	limit := int(req.GetPageSize())
+	if limit == 0 {
+		limit = repository.DefaultPageSize
+	}
+	if limit < 0 || limit > repository.MaxPageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "page size should be between 1 and %d", repository.MaxPageSize)
+	}
+
+	results, err := s.DB.SearchTodos(ctx, userID, query, limit)
+	if err != nil {
 		return nil, status.Error(codes.Internal, "internal error")
 	}
 
-	return &pb.Todo{
-		Id:          int32(todo.ID),
-		Name:        todo.Name,
-		Description: todo.Description,
-		Deadline:    timestamppb.New(todo.Deadline),
-		Completed:   todo.Completed,
-	}, nil
+	response := &pb.SearchResponse{
+		Results: make([]*pb.SearchResult, 0, len(results)),
+	}
+	for _, result := range results {
+		response.Results = append(response.Results, &pb.SearchResult{
+			Todo:    todoToPb(result.Todo),
+			Rank:    float32(result.Rank),
+			Snippet: result.Snippet,
+		})
+	}
+
+	return response, nil
+}
+
+func (s *TodoServer) ListChildren(req *pb.Id, stream grpc.ServerStreamingServer[pb.Todo]) error {
+	userID, err := auth.UserIDFromContext(stream.Context())
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	id := int(req.GetId())
+	var todos []*models.Todo
+	err = s.DB.WithIsolation(sql.LevelRepeatableRead).WithTx(stream.Context(), func(db repository.DatabaseRepo) error {
+		if _, err := db.SelectTodo(stream.Context(), userID, id); err != nil {
+			return err
+		}
+		var err error
+		todos, err = db.SelectTodoChildren(stream.Context(), userID, id)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return status.Error(codes.NotFound, "todo not found")
+		}
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	for _, todo := range todos {
+		err := stream.Send(todoToPb(todo))
+		if err != nil {
+			return status.Error(codes.Internal, "internal error")
+		}
+	}
+
+	return nil
 }
 
-func (s *TodoServer) List(t *emptypb.Empty, stream grpc.ServerStreamingServer[pb.Todo]) error {
-	todos, err := s.DB.SelectTodos()
+func (s *TodoServer) Restore(ctx context.Context, req *pb.Id) (*pb.Todo, error) {
+	userID, err := auth.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	id := int(req.GetId())
+	var todo *models.Todo
+	err = s.audited(ctx).WithTx(ctx, func(db repository.DatabaseRepo) error {
+		if err := db.RestoreTodo(ctx, userID, id); err != nil {
+			return err
+		}
+		var err error
+		todo, err = db.SelectTodo(ctx, userID, id)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, status.Error(codes.NotFound, "todo not found in the trash")
+		case errors.Is(err, repository.ErrParentNotFound):
+			return nil, status.Error(codes.FailedPrecondition, "parent todo is in the trash, restore it first")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return todoToPb(todo), nil
+}
+
+func (s *TodoServer) ListTrash(_ *emptypb.Empty, stream grpc.ServerStreamingServer[pb.Todo]) error {
+	userID, err := auth.UserIDFromContext(stream.Context())
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	todos, err := s.DB.SelectTrash(stream.Context(), userID)
 	if err != nil {
 		return status.Error(codes.Internal, "internal error")
 	}
 
 	for _, todo := range todos {
-		err := stream.Send(&pb.Todo{
-			Id:          int32(todo.ID),
-			Name:        todo.Name,
-			Description: todo.Description,
-			Deadline:    timestamppb.New(todo.Deadline),
-			Completed:   todo.Completed,
-		})
+		err := stream.Send(todoToPb(todo))
 		if err != nil {
 			return status.Error(codes.Internal, "internal error")
 		}
@@ -156,3 +339,89 @@ func (s *TodoServer) List(t *emptypb.Empty, stream grpc.ServerStreamingServer[pb
 
 	return nil
 }
+
+func (s *TodoServer) History(req *pb.Id, stream grpc.ServerStreamingServer[pb.TodoHistory]) error {
+	userID, err := auth.UserIDFromContext(stream.Context())
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	history, err := s.DB.SelectTodoHistory(stream.Context(), userID, int(req.GetId()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return status.Error(codes.NotFound, "todo not found")
+		}
+		return status.Error(codes.Internal, "internal error")
+	}
+
+	for _, entry := range history {
+		err := stream.Send(historyToPb(entry))
+		if err != nil {
+			return status.Error(codes.Internal, "internal error")
+		}
+	}
+
+	return nil
+}
+
+// Watch streams the changes of the todos of the user, starting with the ones after the start revision.
+// The bus drops a subscription falling too far behind instead of waiting for it, the call then ends
+// with ResourceExhausted and the client can watch again from the last revision it got.
+func (s *TodoServer) Watch(req *pb.WatchRequest, stream grpc.ServerStreamingServer[pb.TodoEvent]) error {
+	userID, err := auth.UserIDFromContext(stream.Context())
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	subscription, missed, complete := s.Events.Subscribe(userID, req.GetStartRevision())
+	defer subscription.Close()
+	if !complete {
+		return status.Error(codes.OutOfRange, "the events after start_revision are no longer available, list the todos again")
+	}
+
+	send := func(event events.Event) error {
+		message, err := eventToPb(event)
+		if err != nil {
+			return status.Error(codes.Internal, "internal error")
+		}
+		if err := stream.Send(message); err != nil {
+			return status.Error(codes.Internal, "internal error")
+		}
+		return nil
+	}
+
+	for _, event := range missed {
+		if err := send(event); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case event, ok := <-subscription.C:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "too far behind the events, watch again from the last revision")
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// todoWriteError converts an error from inserting or updating a todo into a gRPC status error
+func todoWriteError(err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return status.Error(codes.NotFound, "todo not found")
+	case errors.Is(err, repository.ErrProjectNotFound), errors.Is(err, repository.ErrParentNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, repository.ErrTodoCycle), errors.Is(err, rrule.ErrInvalid), errors.Is(err, rrule.ErrUnsupported):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, repository.ErrVersionConflict):
+		return status.Error(codes.Aborted, err.Error())
+	}
+	return status.Error(codes.Internal, "internal error")
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/anras5/todo-app-backend/internal/config"
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+)
+
+// batchOperation is an operation of a batch as sent by the client. Update, delete and complete
+// work on the todo with the id, a version other than 0 must match its current version like
+// If-Match does. Complete marks the todo as completed unless completed is false.
+type batchOperation struct {
+	Op        string       `json:"op"`
+	ID        int          `json:"id"`
+	Version   int          `json:"version"`
+	Completed *bool        `json:"completed"`
+	Fields    []string     `json:"fields"`
+	Todo      *models.Todo `json:"todo"`
+}
+
+// batchResult is the outcome of an operation of a batch with the status it would have on its own
+type batchResult struct {
+	Status int    `json:"status"`
+	ID     int    `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// readBatchOperation checks an operation sent by the client and converts it for the repo
+func readBatchOperation(op batchOperation) (models.BatchOperation, error) {
+	batchOp := models.BatchOperation{Op: op.Op, Fields: op.Fields}
+	if op.Todo != nil {
+		batchOp.Todo = *op.Todo
+	}
+
+	switch op.Op {
+	case models.BatchCreate:
+		if op.Todo == nil {
+			return batchOp, errors.New("todo is required")
+		}
+		return batchOp, nil
+	case models.BatchUpdate:
+		if op.Todo == nil {
+			return batchOp, errors.New("todo is required")
+		}
+		if _, err := models.NewTodoFieldMask(op.Fields...); err != nil {
+			return batchOp, err
+		}
+	case models.BatchDelete, models.BatchComplete:
+	default:
+		return batchOp, fmt.Errorf("op should be one of %s, %s, %s or %s",
+			models.BatchCreate, models.BatchUpdate, models.BatchDelete, models.BatchComplete)
+	}
+
+	if op.ID < 1 {
+		return batchOp, errors.New("id is required")
+	}
+	if op.Version < 0 {
+		return batchOp, errors.New("version should not be negative")
+	}
+	batchOp.Todo.ID = op.ID
+	batchOp.Todo.Version = op.Version
+	if op.Op == models.BatchComplete {
+		batchOp.Todo.Completed = op.Completed == nil || *op.Completed
+	}
+	return batchOp, nil
+}
+
+// batchStatus returns the status of an operation of a batch
+func batchStatus(op string, err error) int {
+	switch {
+	case err == nil && op == models.BatchCreate:
+		return http.StatusCreated
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, repository.ErrBatchAborted):
+		return http.StatusFailedDependency
+	case errors.Is(err, repository.ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// TodoBatch applies an array of create, update, delete and complete operations in a single
+// transaction and responds with 207 and the status of every operation. With atomic=true, the
+// default, nothing is kept once an operation fails and the others get 424, with atomic=false
+// only the failing operations are left out.
+func (m *Repository) TodoBatch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	atomic := true
+	if a := r.URL.Query().Get("atomic"); a != "" {
+		var err error
+		atomic, err = strconv.ParseBool(a)
+		if err != nil {
+			_ = m.App.ErrorJSON(w, errors.New("atomic should be true or false"))
+			return
+		}
+	}
+
+	var requested []batchOperation
+	err := m.App.ReadJSON(w, r, &requested)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+	if len(requested) == 0 || len(requested) > repository.MaxBatchOperations {
+		_ = m.App.ErrorJSON(w, fmt.Errorf("a batch should have between 1 and %d operations", repository.MaxBatchOperations))
+		return
+	}
+
+	// a malformed operation rejects the whole batch before anything is applied
+	ops := make([]models.BatchOperation, len(requested))
+	for i, op := range requested {
+		if ops[i], err = readBatchOperation(op); err != nil {
+			_ = m.App.ErrorJSON(w, fmt.Errorf("operation %d: %w", i, err))
+			return
+		}
+	}
+
+	results, err := m.audited(r).ApplyTodoBatch(r.Context(), userID, ops, atomic)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	statuses := make([]batchResult, len(results))
+	for i, result := range results {
+		statuses[i] = batchResult{Status: batchStatus(ops[i].Op, result.Err), ID: result.ID}
+		switch {
+		case errors.Is(result.Err, sql.ErrNoRows):
+			statuses[i].Error = "todo not found"
+		case result.Err != nil:
+			statuses[i].Error = result.Err.Error()
+		}
+	}
+
+	response := config.JSONResponse{
+		Error:   false,
+		Message: "batch applied",
+		Data:    statuses,
+	}
+	m.App.WriteJSON(w, http.StatusMultiStatus, response)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/events"
+)
+
+// keepAliveInterval is how often an idle event stream gets a comment, so that proxies do not close it
+const keepAliveInterval = 15 * time.Second
+
+// TodoEvents streams the changes of the todos of the user as server-sent events. A client
+// reconnecting with the Last-Event-ID header gets the events it missed first, or a reset
+// event if they are no longer buffered, after which it should reload its todos.
+func (m *Repository) TodoEvents(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.eventsUser(r)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		_ = m.App.ErrorJSON(w, errors.New("streaming is not supported"), http.StatusInternalServerError)
+		return
+	}
+
+	var lastEventID uint64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		lastEventID, err = strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			_ = m.App.ErrorJSON(w, errors.New("Last-Event-ID should be the id of an event"))
+			return
+		}
+	}
+
+	subscription, missed, complete := m.Events.Subscribe(userID, lastEventID)
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if !complete {
+		_, _ = fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range missed {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-subscription.C:
+			if !ok {
+				// dropped for falling behind, the client resumes from its last event
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// eventsUser authenticates the user of an event stream with the Authorization header, or with
+// the token query parameter, since an EventSource in a browser cannot set headers
+func (m *Repository) eventsUser(r *http.Request) (int, error) {
+	header := r.Header.Get("Authorization")
+	if token := r.URL.Query().Get("token"); header == "" && token != "" {
+		return m.App.Auth.ParseToken(token)
+	}
+	return m.App.Auth.ParseAuthorizationHeader(header)
+}
+
+// writeEvent writes the event in the server-sent events format, the data being the todo
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Todo)
+	return err
+}
@@ -1,10 +1,16 @@
 package handlers
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/anras5/todo-app-backend/internal/auth"
 	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/graphql-go/graphql"
 )
 
@@ -17,29 +23,307 @@ var TodoType = graphql.NewObject(
 			"description": &graphql.Field{Type: graphql.String},
 			"deadline":    &graphql.Field{Type: graphql.DateTime},
 			"completed":   &graphql.Field{Type: graphql.Boolean},
+			"progress":    &graphql.Field{Type: graphql.Int},
+			"tags":        &graphql.Field{Type: graphql.NewList(graphql.String)},
+			"rrule":       &graphql.Field{Type: graphql.String},
+			"version":     &graphql.Field{Type: graphql.Int},
+			"projectId": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if todo, ok := p.Source.(*models.Todo); ok && todo.ProjectID != nil {
+						return *todo.ProjectID, nil
+					}
+					return nil, nil
+				},
+			},
+			"parentId": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if todo, ok := p.Source.(*models.Todo); ok && todo.ParentID != nil {
+						return *todo.ParentID, nil
+					}
+					return nil, nil
+				},
+			},
+			"deletedAt": &graphql.Field{
+				Type:        graphql.DateTime,
+				Description: "When the todo was moved to the trash, null for todos outside of it",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if todo, ok := p.Source.(*models.Todo); ok && todo.DeletedAt != nil {
+						return *todo.DeletedAt, nil
+					}
+					return nil, nil
+				},
+			},
 		},
 	},
 )
 
+// historyField resolves a field of a history entry whose name differs from its JSON name
+func historyField(value func(entry *models.TodoHistory) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		if entry, ok := p.Source.(*models.TodoHistory); ok {
+			return value(entry), nil
+		}
+		return nil, nil
+	}
+}
+
+// snapshotJSON returns a snapshot of a todo as a JSON string, nil if there is none
+func snapshotJSON(snapshot []byte) any {
+	if snapshot == nil {
+		return nil
+	}
+	return string(snapshot)
+}
+
+var TodoHistoryType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "TodoHistory",
+		Fields: graphql.Fields{
+			"id":        &graphql.Field{Type: graphql.Int},
+			"action":    &graphql.Field{Type: graphql.String},
+			"transport": &graphql.Field{Type: graphql.String},
+			"todoId": &graphql.Field{
+				Type:    graphql.Int,
+				Resolve: historyField(func(entry *models.TodoHistory) any { return entry.TodoID }),
+			},
+			"actorId": &graphql.Field{
+				Type:    graphql.Int,
+				Resolve: historyField(func(entry *models.TodoHistory) any { return entry.ActorID }),
+			},
+			"requestId": &graphql.Field{
+				Type:    graphql.String,
+				Resolve: historyField(func(entry *models.TodoHistory) any { return entry.RequestID }),
+			},
+			"createdAt": &graphql.Field{
+				Type:    graphql.DateTime,
+				Resolve: historyField(func(entry *models.TodoHistory) any { return entry.CreatedAt }),
+			},
+			"before": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The todo before the change as JSON, null for inserts",
+				Resolve:     historyField(func(entry *models.TodoHistory) any { return snapshotJSON(entry.Before) }),
+			},
+			"after": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The todo after the change as JSON",
+				Resolve:     historyField(func(entry *models.TodoHistory) any { return snapshotJSON(entry.After) }),
+			},
+		},
+	},
+)
+
+func init() {
+	// subtasks refers to TodoType itself, so it can only be added once TodoType exists
+	TodoType.AddFieldConfig("subtasks", &graphql.Field{
+		Type:        graphql.NewList(TodoType),
+		Description: "Subtasks of the todo ordered by deadline",
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			userID, err := auth.UserIDFromContext(p.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			todo, ok := p.Source.(*models.Todo)
+			if !ok {
+				return nil, errors.New("subtasks can only be resolved on a todo")
+			}
+			return Repo.DB.SelectTodoChildren(p.Context, userID, todo.ID)
+		},
+	})
+	TodoType.AddFieldConfig("history", &graphql.Field{
+		Type:        graphql.NewList(TodoHistoryType),
+		Description: "Changes of the todo, oldest first",
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			userID, err := auth.UserIDFromContext(p.Context)
+			if err != nil {
+				return nil, err
+			}
+
+			todo, ok := p.Source.(*models.Todo)
+			if !ok {
+				return nil, errors.New("history can only be resolved on a todo")
+			}
+			return Repo.DB.SelectTodoHistory(p.Context, userID, todo.ID)
+		},
+	})
+}
+
+var PageInfoType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"endCursor":   &graphql.Field{Type: graphql.String},
+		},
+	},
+)
+
+var TodoEdgeType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "TodoEdge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"node":   &graphql.Field{Type: TodoType},
+		},
+	},
+)
+
+var TodoConnectionType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "TodoConnection",
+		Fields: graphql.Fields{
+			"edges":    &graphql.Field{Type: graphql.NewList(TodoEdgeType)},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(PageInfoType)},
+		},
+	},
+)
+
+var SearchResultType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "SearchResult",
+		Fields: graphql.Fields{
+			"todo":    &graphql.Field{Type: TodoType},
+			"rank":    &graphql.Field{Type: graphql.Float},
+			"snippet": &graphql.Field{Type: graphql.String},
+		},
+	},
+)
+
+// auditedRepo returns the repo recording the GraphQL request in the history of the todos it changes
+func auditedRepo(ctx context.Context) repository.DatabaseRepo {
+	return Repo.DB.WithAudit(models.Audit{
+		RequestID: middleware.GetReqID(ctx),
+		Transport: models.TransportGraphQL,
+		Undoable:  true,
+	})
+}
+
+// replayOperations undoes or redoes the number of operations given by the count argument
+func replayOperations(p graphql.ResolveParams, replay func(db repository.DatabaseRepo, ctx context.Context, userID int, count int) (int, error)) (any, error) {
+	userID, err := auth.UserIDFromContext(p.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	count, _ := p.Args["count"].(int)
+	if count < 1 || count > repository.MaxUndoCount {
+		return nil, fmt.Errorf("count should be a number between 1 and %d", repository.MaxUndoCount)
+	}
+	return replay(auditedRepo(p.Context), p.Context, userID, count)
+}
+
 type Graph struct {
-	QueryString    string
-	Variables      map[string]interface{}
-	Config         graphql.SchemaConfig
-	queryFields    graphql.Fields
-	mutationFields graphql.Fields
+	QueryString        string
+	Variables          map[string]interface{}
+	OperationName      string
+	Context            context.Context
+	Config             graphql.SchemaConfig
+	queryFields        graphql.Fields
+	mutationFields     graphql.Fields
+	subscriptionFields graphql.Fields
 }
 
 func NewGraph() *Graph {
 	var queryFields = graphql.Fields{
 		"getTodos": &graphql.Field{
-			Type:        graphql.NewList(TodoType),
-			Description: "Get all todos",
+			Type:        TodoConnectionType,
+			Description: "Get a page of todos ordered by deadline",
+			Args: graphql.FieldConfigArgument{
+				"first": &graphql.ArgumentConfig{
+					Type:         graphql.Int,
+					DefaultValue: repository.DefaultPageSize,
+				},
+				"after": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"completed": &graphql.ArgumentConfig{
+					Type: graphql.Boolean,
+				},
+				"tags": &graphql.ArgumentConfig{
+					Type:        graphql.NewList(graphql.String),
+					Description: "Keep the todos with any of the tags",
+				},
+				"matchAllTags": &graphql.ArgumentConfig{
+					Type:         graphql.Boolean,
+					DefaultValue: false,
+					Description:  "Keep the todos with all of the tags instead",
+				},
+				"filter": &graphql.ArgumentConfig{
+					Type:        TodoFilterInput,
+					Description: "Replaces completed, tags and matchAllTags when given",
+				},
+				"sort": &graphql.ArgumentConfig{
+					Type:        graphql.NewList(graphql.NewNonNull(TodoSortInput)),
+					Description: "Sort by deadline when not given",
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				userID, err := auth.UserIDFromContext(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
+				first, _ := p.Args["first"].(int)
+				if first < 1 || first > repository.MaxPageSize {
+					return nil, fmt.Errorf("first should be a number between 1 and %d", repository.MaxPageSize)
+				}
+
+				var after *models.TodoCursor
+				if cursor, ok := p.Args["after"].(string); ok {
+					after, err = models.DecodeTodoCursor(cursor)
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				filter, err := todoFilterFromArgs(p.Args)
+				if err != nil {
+					return nil, err
+				}
+				if _, ok := p.Args["filter"]; !ok {
+					if completed, ok := p.Args["completed"].(bool); ok {
+						filter.Completed = &completed
+					}
+					filter.Tags = stringList(p.Args["tags"])
+					filter.MatchAllTags, _ = p.Args["matchAllTags"].(bool)
+				}
+
+				page, err := Repo.DB.SelectTodosPage(p.Context, userID, first, after, filter)
+				if err != nil {
+					return nil, err
+				}
+				return todoConnection(page, filter.Sort), nil
+			},
+		},
+		"searchTodos": &graphql.Field{
+			Type:        graphql.NewList(SearchResultType),
+			Description: "Search todos by name and description, best matches first",
+			Args: graphql.FieldConfigArgument{
+				"query": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"first": &graphql.ArgumentConfig{
+					Type:         graphql.Int,
+					DefaultValue: repository.DefaultPageSize,
+				},
+			},
 			Resolve: func(p graphql.ResolveParams) (any, error) {
-				todos, err := Repo.DB.SelectTodos()
+				userID, err := auth.UserIDFromContext(p.Context)
 				if err != nil {
 					return nil, err
 				}
-				return todos, nil
+
+				query := strings.TrimSpace(p.Args["query"].(string))
+				if query == "" {
+					return nil, errors.New("query is required")
+				}
+				first, _ := p.Args["first"].(int)
+				if first < 1 || first > repository.MaxPageSize {
+					return nil, fmt.Errorf("first should be a number between 1 and %d", repository.MaxPageSize)
+				}
+				return Repo.DB.SearchTodos(p.Context, userID, query, first)
 			},
 		},
 		"getTodo": &graphql.Field{
@@ -51,9 +335,14 @@ func NewGraph() *Graph {
 				},
 			},
 			Resolve: func(p graphql.ResolveParams) (any, error) {
+				userID, err := auth.UserIDFromContext(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
 				id, ok := p.Args["id"].(int)
 				if ok {
-					todo, err := Repo.DB.SelectTodo(id)
+					todo, err := Repo.DB.SelectTodo(p.Context, userID, id)
 					if err != nil {
 						return nil, err
 					}
@@ -62,6 +351,17 @@ func NewGraph() *Graph {
 				return nil, errors.New("did not provide id")
 			},
 		},
+		"trashedTodos": &graphql.Field{
+			Type:        graphql.NewList(TodoType),
+			Description: "Todos in the trash, most recently deleted first",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				userID, err := auth.UserIDFromContext(p.Context)
+				if err != nil {
+					return nil, err
+				}
+				return Repo.DB.SelectTrash(p.Context, userID)
+			},
+		},
 	}
 
 	var mutationFields = graphql.Fields{
@@ -81,20 +381,55 @@ func NewGraph() *Graph {
 				"completed": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.Boolean),
 				},
+				"projectId": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"parentId": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+				"tags": &graphql.ArgumentConfig{
+					Type: graphql.NewList(graphql.String),
+				},
+				"rrule": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "RFC 5545 recurrence rule like FREQ=WEEKLY;BYDAY=MO",
+				},
 			},
 			Resolve: func(p graphql.ResolveParams) (any, error) {
+				userID, err := auth.UserIDFromContext(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
 				todo := &models.Todo{
+					UserID:      userID,
 					Name:        p.Args["name"].(string),
 					Description: p.Args["description"].(string),
 					Deadline:    p.Args["deadline"].(time.Time),
 					Completed:   p.Args["completed"].(bool),
 				}
-				id, err := Repo.DB.InsertTodo(*todo)
+				if projectID, ok := p.Args["projectId"].(int); ok {
+					todo.ProjectID = &projectID
+				}
+				if parentID, ok := p.Args["parentId"].(int); ok {
+					todo.ParentID = &parentID
+				}
+				todo.Tags = stringList(p.Args["tags"])
+				todo.RRule, _ = p.Args["rrule"].(string)
+				var created *models.Todo
+				err = auditedRepo(p.Context).WithTx(p.Context, func(db repository.DatabaseRepo) error {
+					id, err := db.InsertTodo(p.Context, *todo)
+					if err != nil {
+						return err
+					}
+					// read the todo back to get its computed fields
+					created, err = db.SelectTodo(p.Context, userID, id)
+					return err
+				})
 				if err != nil {
 					return nil, err
 				}
-				todo.ID = id
-				return todo, nil
+				return created, nil
 			},
 		},
 		"updateTodo": &graphql.Field{
@@ -104,6 +439,10 @@ func NewGraph() *Graph {
 				"id": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.Int),
 				},
+				"expectedVersion": &graphql.ArgumentConfig{
+					Type:        graphql.NewNonNull(graphql.Int),
+					Description: "The version the changes are based on, the update fails if the todo has changed since",
+				},
 				"name": &graphql.ArgumentConfig{
 					Type: graphql.String,
 				},
@@ -116,62 +455,235 @@ func NewGraph() *Graph {
 				"completed": &graphql.ArgumentConfig{
 					Type: graphql.Boolean,
 				},
+				"projectId": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "0 removes the todo from its project",
+				},
+				"parentId": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "0 makes the todo a top level todo",
+				},
+				"tags": &graphql.ArgumentConfig{
+					Type:        graphql.NewList(graphql.String),
+					Description: "Replaces the tags of the todo",
+				},
+				"rrule": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "Empty string stops the recurrence",
+				},
 			},
 			Resolve: func(p graphql.ResolveParams) (any, error) {
-				id, _ := p.Args["id"].(int)
-				todo, err := Repo.DB.SelectTodo(id)
+				userID, err := auth.UserIDFromContext(p.Context)
 				if err != nil {
 					return nil, err
 				}
-				if name, nameOk := p.Args["name"].(string); nameOk {
-					todo.Name = name
-				}
-				if description, descriptionOk := p.Args["description"].(string); descriptionOk {
-					todo.Description = description
+
+				id, _ := p.Args["id"].(int)
+				version, _ := p.Args["expectedVersion"].(int)
+				if version < 1 {
+					return nil, errors.New("expectedVersion should be the version of the todo")
 				}
-				if deadline, deadlineOk := p.Args["deadline"].(time.Time); deadlineOk {
-					todo.Deadline = deadline
+
+				var updated *models.Todo
+				err = auditedRepo(p.Context).WithTx(p.Context, func(db repository.DatabaseRepo) error {
+					todo, err := db.SelectTodo(p.Context, userID, id)
+					if err != nil {
+						return err
+					}
+					todo.Version = version
+					if name, nameOk := p.Args["name"].(string); nameOk {
+						todo.Name = name
+					}
+					if description, descriptionOk := p.Args["description"].(string); descriptionOk {
+						todo.Description = description
+					}
+					if deadline, deadlineOk := p.Args["deadline"].(time.Time); deadlineOk {
+						todo.Deadline = deadline
+					}
+					if completed, completedOk := p.Args["completed"].(bool); completedOk {
+						todo.Completed = completed
+					}
+					if projectID, projectIDOk := p.Args["projectId"].(int); projectIDOk {
+						if projectID == 0 {
+							todo.ProjectID = nil
+						} else {
+							todo.ProjectID = &projectID
+						}
+					}
+					if parentID, parentIDOk := p.Args["parentId"].(int); parentIDOk {
+						if parentID == 0 {
+							todo.ParentID = nil
+						} else {
+							todo.ParentID = &parentID
+						}
+					}
+					if rule, ruleOk := p.Args["rrule"].(string); ruleOk {
+						todo.RRule = rule
+					}
+					if tags, tagsOk := p.Args["tags"]; tagsOk {
+						// an empty list removes all the tags
+						todo.Tags = stringList(tags)
+					} else {
+						todo.Tags = nil
+					}
+					if err = db.UpdateTodo(p.Context, *todo); err != nil {
+						return err
+					}
+					// read the todo back to get its computed fields
+					updated, err = db.SelectTodo(p.Context, userID, id)
+					return err
+				})
+				if err != nil {
+					return nil, err
 				}
-				if completed, completedOk := p.Args["completed"].(bool); completedOk {
-					todo.Completed = completed
+				return updated, nil
+			},
+		},
+		"deleteTodo": &graphql.Field{
+			Type:        TodoType,
+			Description: "move todo to the trash by id, together with its subtasks",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"expectedVersion": &graphql.ArgumentConfig{
+					Type:        graphql.Int,
+					Description: "The delete fails if the todo is not at this version",
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				userID, err := auth.UserIDFromContext(p.Context)
+				if err != nil {
+					return nil, err
 				}
-				err = Repo.DB.UpdateTodo(*todo)
+
+				id, _ := p.Args["id"].(int)
+				version, _ := p.Args["expectedVersion"].(int)
+
+				// the todo is returned as it was before it was deleted
+				var todo *models.Todo
+				err = auditedRepo(p.Context).WithTx(p.Context, func(db repository.DatabaseRepo) error {
+					var err error
+					todo, err = db.SelectTodo(p.Context, userID, id)
+					if err != nil {
+						return err
+					}
+					return db.DeleteTodo(p.Context, userID, id, version)
+				})
 				if err != nil {
 					return nil, err
 				}
 				return todo, nil
 			},
 		},
-		"deleteTodo": &graphql.Field{
+		"restoreTodo": &graphql.Field{
 			Type:        TodoType,
-			Description: "delete todo by id",
+			Description: "restore todo from the trash by id, together with the subtasks deleted with it",
 			Args: graphql.FieldConfigArgument{
 				"id": &graphql.ArgumentConfig{
 					Type: graphql.NewNonNull(graphql.Int),
 				},
 			},
 			Resolve: func(p graphql.ResolveParams) (any, error) {
-				id, _ := p.Args["id"].(int)
-				todo, err := Repo.DB.SelectTodo(id)
+				userID, err := auth.UserIDFromContext(p.Context)
 				if err != nil {
 					return nil, err
 				}
-				err = Repo.DB.DeleteTodo(id)
+
+				id, _ := p.Args["id"].(int)
+				var restored *models.Todo
+				err = auditedRepo(p.Context).WithTx(p.Context, func(db repository.DatabaseRepo) error {
+					if err := db.RestoreTodo(p.Context, userID, id); err != nil {
+						return err
+					}
+					var err error
+					restored, err = db.SelectTodo(p.Context, userID, id)
+					return err
+				})
 				if err != nil {
 					return nil, err
 				}
-				return todo, nil
+				return restored, nil
+			},
+		},
+		"undo": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "revert the last operations, returns how many were undone",
+			Args: graphql.FieldConfigArgument{
+				"count": &graphql.ArgumentConfig{
+					Type:         graphql.Int,
+					DefaultValue: 1,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return replayOperations(p, repository.DatabaseRepo.UndoOperations)
+			},
+		},
+		"redo": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "reapply the last undone operations, returns how many were redone",
+			Args: graphql.FieldConfigArgument{
+				"count": &graphql.ArgumentConfig{
+					Type:         graphql.Int,
+					DefaultValue: 1,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return replayOperations(p, repository.DatabaseRepo.RedoOperations)
 			},
 		},
 	}
 
+	for name, field := range projectQueryFields() {
+		queryFields[name] = field
+	}
+	for name, field := range projectMutationFields() {
+		mutationFields[name] = field
+	}
+
 	return &Graph{
-		queryFields:    queryFields,
-		mutationFields: mutationFields,
+		queryFields:        queryFields,
+		mutationFields:     mutationFields,
+		subscriptionFields: todoSubscriptionFields(),
 	}
 }
 
-func (g *Graph) Query() (*graphql.Result, error) {
+// stringList converts a [String] argument into a slice of strings
+func stringList(arg any) []string {
+	values, _ := arg.([]any)
+	list := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// todoConnection converts a page of todos listed in the sort order into a TodoConnection
+func todoConnection(page *models.TodoPage, sort []models.SortField) map[string]any {
+	edges := make([]map[string]any, 0, len(page.Todos))
+	var endCursor any
+	for _, todo := range page.Todos {
+		cursor := todo.Cursor(sort)
+		edges = append(edges, map[string]any{
+			"cursor": cursor,
+			"node":   todo,
+		})
+		endCursor = cursor
+	}
+
+	return map[string]any{
+		"edges": edges,
+		"pageInfo": map[string]any{
+			"hasNextPage": page.HasMore,
+			"endCursor":   endCursor,
+		},
+	}
+}
+
+// schema builds the schema from the fields of the graph
+func (g *Graph) schema() (graphql.Schema, error) {
 	queryType := graphql.NewObject(graphql.ObjectConfig{
 		Name:   "Query",
 		Fields: g.queryFields,
@@ -180,12 +692,21 @@ func (g *Graph) Query() (*graphql.Result, error) {
 		Name:   "Mutation",
 		Fields: g.mutationFields,
 	})
+	subscriptionType := graphql.NewObject(graphql.ObjectConfig{
+		Name:   "Subscription",
+		Fields: g.subscriptionFields,
+	})
 
 	schemaConfig := graphql.SchemaConfig{
-		Query:    queryType,
-		Mutation: mutationType,
+		Query:        queryType,
+		Mutation:     mutationType,
+		Subscription: subscriptionType,
 	}
-	schema, err := graphql.NewSchema(schemaConfig)
+	return graphql.NewSchema(schemaConfig)
+}
+
+func (g *Graph) Query() (*graphql.Result, error) {
+	schema, err := g.schema()
 	if err != nil {
 		return nil, err
 	}
@@ -193,6 +714,7 @@ func (g *Graph) Query() (*graphql.Result, error) {
 		Schema:         schema,
 		RequestString:  g.QueryString,
 		VariableValues: g.Variables,
+		Context:        g.Context,
 	}
 	response := graphql.Do(params)
 	if len(response.Errors) > 0 {
@@ -200,3 +722,21 @@ func (g *Graph) Query() (*graphql.Result, error) {
 	}
 	return response, nil
 }
+
+// Subscribe runs a subscription and returns the channel of its results, which is closed
+// once the subscription ends, at the latest when the context of the graph is done.
+// The channel has to be read until then.
+func (g *Graph) Subscribe() (chan *graphql.Result, error) {
+	schema, err := g.schema()
+	if err != nil {
+		return nil, err
+	}
+	params := graphql.Params{
+		Schema:         schema,
+		RequestString:  g.QueryString,
+		VariableValues: g.Variables,
+		OperationName:  g.OperationName,
+		Context:        g.Context,
+	}
+	return graphql.Subscribe(params), nil
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/graphql-go/graphql"
+)
+
+var TodoFilterInput = graphql.NewInputObject(
+	graphql.InputObjectConfig{
+		Name:        "TodoFilter",
+		Description: "Time ranges keep the todos with the time in [after, before)",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"completed":      &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+			"tags":           &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.String)},
+			"matchAllTags":   &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+			"deadlineAfter":  &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+			"deadlineBefore": &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+			"createdAfter":   &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+			"createdBefore":  &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+			"updatedAfter":   &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+			"updatedBefore":  &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+			"overdue": &graphql.InputObjectFieldConfig{
+				Type:        graphql.Boolean,
+				Description: "Keep only the todos that are not completed and past their deadline",
+			},
+			"nameContains": &graphql.InputObjectFieldConfig{
+				Type:        graphql.String,
+				Description: "Keep only the todos with the text in their name, ignoring case",
+			},
+		},
+	},
+)
+
+var TodoSortFieldEnum = graphql.NewEnum(
+	graphql.EnumConfig{
+		Name: "TodoSortField",
+		Values: graphql.EnumValueConfigMap{
+			"DEADLINE":   &graphql.EnumValueConfig{Value: "deadline"},
+			"CREATED_AT": &graphql.EnumValueConfig{Value: "created_at"},
+			"UPDATED_AT": &graphql.EnumValueConfig{Value: "updated_at"},
+			"NAME":       &graphql.EnumValueConfig{Value: "name"},
+			"COMPLETED":  &graphql.EnumValueConfig{Value: "completed"},
+			"ID":         &graphql.EnumValueConfig{Value: "id"},
+		},
+	},
+)
+
+var SortDirectionEnum = graphql.NewEnum(
+	graphql.EnumConfig{
+		Name: "SortDirection",
+		Values: graphql.EnumValueConfigMap{
+			"ASC":  &graphql.EnumValueConfig{Value: false},
+			"DESC": &graphql.EnumValueConfig{Value: true},
+		},
+	},
+)
+
+var TodoSortInput = graphql.NewInputObject(
+	graphql.InputObjectConfig{
+		Name: "TodoSort",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"field": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(TodoSortFieldEnum)},
+			"direction": &graphql.InputObjectFieldConfig{
+				Type:         SortDirectionEnum,
+				DefaultValue: false,
+			},
+		},
+	},
+)
+
+// todoFilterFromArgs reads the filter and sort arguments of a todo listing
+func todoFilterFromArgs(args map[string]any) (models.TodoFilter, error) {
+	var filter models.TodoFilter
+
+	input, _ := args["filter"].(map[string]any)
+	if completed, ok := input["completed"].(bool); ok {
+		filter.Completed = &completed
+	}
+	filter.Tags = stringList(input["tags"])
+	filter.MatchAllTags, _ = input["matchAllTags"].(bool)
+	filter.DeadlineAfter = timeArg(input["deadlineAfter"])
+	filter.DeadlineBefore = timeArg(input["deadlineBefore"])
+	filter.CreatedAfter = timeArg(input["createdAfter"])
+	filter.CreatedBefore = timeArg(input["createdBefore"])
+	filter.UpdatedAfter = timeArg(input["updatedAfter"])
+	filter.UpdatedBefore = timeArg(input["updatedBefore"])
+	filter.Overdue, _ = input["overdue"].(bool)
+	filter.NameContains, _ = input["nameContains"].(string)
+
+	sort, _ := args["sort"].([]any)
+	for _, s := range sort {
+		s, _ := s.(map[string]any)
+		field, _ := s["field"].(string)
+		desc, _ := s["direction"].(bool)
+		sortField, err := models.NewSortField(field, desc)
+		if err != nil {
+			return filter, err
+		}
+		filter.Sort = append(filter.Sort, sortField)
+	}
+
+	return filter, nil
+}
+
+// timeArg returns a pointer to a DateTime argument, or nil if it is not set
+func timeArg(arg any) *time.Time {
+	if t, ok := arg.(time.Time); ok {
+		return &t
+	}
+	return nil
+}
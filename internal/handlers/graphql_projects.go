@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/anras5/todo-app-backend/internal/auth"
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/graphql-go/graphql"
+)
+
+var ProjectType = graphql.NewObject(
+	graphql.ObjectConfig{
+		Name: "Project",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: graphql.Int},
+			"name":        &graphql.Field{Type: graphql.String},
+			"description": &graphql.Field{Type: graphql.String},
+			"todos": &graphql.Field{
+				Type:        graphql.NewList(TodoType),
+				Description: "Todos of the project ordered by deadline",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					userID, err := auth.UserIDFromContext(p.Context)
+					if err != nil {
+						return nil, err
+					}
+
+					project, ok := p.Source.(*models.Project)
+					if !ok {
+						return nil, errors.New("todos can only be resolved on a project")
+					}
+					return Repo.DB.SelectProjectTodos(p.Context, userID, project.ID)
+				},
+			},
+		},
+	},
+)
+
+// projectQueryFields are the queries on projects added to the Query type
+func projectQueryFields() graphql.Fields {
+	return graphql.Fields{
+		"getProjects": &graphql.Field{
+			Type:        graphql.NewList(ProjectType),
+			Description: "Get all projects",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				userID, err := auth.UserIDFromContext(p.Context)
+				if err != nil {
+					return nil, err
+				}
+				return Repo.DB.SelectProjects(p.Context, userID)
+			},
+		},
+		"getProject": &graphql.Field{
+			Type:        ProjectType,
+			Description: "Get project by id",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				userID, err := auth.UserIDFromContext(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
+				id, _ := p.Args["id"].(int)
+				return Repo.DB.SelectProject(p.Context, userID, id)
+			},
+		},
+	}
+}
+
+// projectMutationFields are the mutations on projects added to the Mutation type
+func projectMutationFields() graphql.Fields {
+	return graphql.Fields{
+		"createProject": &graphql.Field{
+			Type:        ProjectType,
+			Description: "create a new project",
+			Args: graphql.FieldConfigArgument{
+				"name": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"description": &graphql.ArgumentConfig{
+					Type:         graphql.String,
+					DefaultValue: "",
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				userID, err := auth.UserIDFromContext(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
+				project := &models.Project{
+					UserID:      userID,
+					Name:        p.Args["name"].(string),
+					Description: p.Args["description"].(string),
+				}
+				if project.Name == "" {
+					return nil, errors.New("project name should not be empty")
+				}
+				id, err := Repo.DB.InsertProject(p.Context, *project)
+				if err != nil {
+					return nil, err
+				}
+				project.ID = id
+				return project, nil
+			},
+		},
+		"updateProject": &graphql.Field{
+			Type:        ProjectType,
+			Description: "update project by id",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"name": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+				"description": &graphql.ArgumentConfig{
+					Type: graphql.String,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				userID, err := auth.UserIDFromContext(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
+				id, _ := p.Args["id"].(int)
+				var project *models.Project
+				err = Repo.DB.WithTx(p.Context, func(db repository.DatabaseRepo) error {
+					var err error
+					project, err = db.SelectProject(p.Context, userID, id)
+					if err != nil {
+						return err
+					}
+					if name, nameOk := p.Args["name"].(string); nameOk {
+						project.Name = name
+					}
+					if description, descriptionOk := p.Args["description"].(string); descriptionOk {
+						project.Description = description
+					}
+					if project.Name == "" {
+						return errors.New("project name should not be empty")
+					}
+					return db.UpdateProject(p.Context, *project)
+				})
+				if err != nil {
+					return nil, err
+				}
+				return project, nil
+			},
+		},
+		"deleteProject": &graphql.Field{
+			Type:        ProjectType,
+			Description: "delete project by id, keeping its todos without a project unless deleteTodos or reassignTo is given",
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{
+					Type: graphql.NewNonNull(graphql.Int),
+				},
+				"deleteTodos": &graphql.ArgumentConfig{
+					Type:         graphql.Boolean,
+					DefaultValue: false,
+				},
+				"reassignTo": &graphql.ArgumentConfig{
+					Type: graphql.Int,
+				},
+			},
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				userID, err := auth.UserIDFromContext(p.Context)
+				if err != nil {
+					return nil, err
+				}
+
+				id, _ := p.Args["id"].(int)
+				var deletion models.ProjectDeletion
+				deletion.DeleteTodos, _ = p.Args["deleteTodos"].(bool)
+				if reassignTo, ok := p.Args["reassignTo"].(int); ok {
+					if deletion.DeleteTodos {
+						return nil, errors.New("cannot both delete and reassign todos")
+					}
+					deletion.ReassignTo = &reassignTo
+				}
+
+				// the project is returned as it was before it was deleted
+				var project *models.Project
+				err = auditedRepo(p.Context).WithTx(p.Context, func(db repository.DatabaseRepo) error {
+					var err error
+					project, err = db.SelectProject(p.Context, userID, id)
+					if err != nil {
+						return err
+					}
+					return db.DeleteProject(p.Context, userID, id, deletion)
+				})
+				if err != nil {
+					return nil, err
+				}
+				return project, nil
+			},
+		},
+	}
+}
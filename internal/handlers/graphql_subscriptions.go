@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/anras5/todo-app-backend/internal/auth"
+	"github.com/anras5/todo-app-backend/internal/events"
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/graphql-go/graphql"
+)
+
+// todoSubscriptionArgs are the filters every todo subscription accepts, a todo has to match all of them
+var todoSubscriptionArgs = graphql.FieldConfigArgument{
+	"id": &graphql.ArgumentConfig{
+		Type:        graphql.Int,
+		Description: "only the todo with the id",
+	},
+	"completed": &graphql.ArgumentConfig{
+		Type:        graphql.Boolean,
+		Description: "only the todos in the state after the change",
+	},
+	"projectId": &graphql.ArgumentConfig{
+		Type:        graphql.Int,
+		Description: "only the todos of the project",
+	},
+}
+
+// todoSubscriptionFilter is the filter set with todoSubscriptionArgs
+type todoSubscriptionFilter struct {
+	id        *int
+	completed *bool
+	projectID *int
+}
+
+func readTodoSubscriptionFilter(args map[string]any) todoSubscriptionFilter {
+	var filter todoSubscriptionFilter
+	if id, ok := args["id"].(int); ok {
+		filter.id = &id
+	}
+	if completed, ok := args["completed"].(bool); ok {
+		filter.completed = &completed
+	}
+	if projectID, ok := args["projectId"].(int); ok {
+		filter.projectID = &projectID
+	}
+	return filter
+}
+
+func (f todoSubscriptionFilter) matches(todo *models.Todo) bool {
+	switch {
+	case f.id != nil && todo.ID != *f.id:
+		return false
+	case f.completed != nil && todo.Completed != *f.completed:
+		return false
+	case f.projectID != nil && (todo.ProjectID == nil || *todo.ProjectID != *f.projectID):
+		return false
+	}
+	return true
+}
+
+// subscribeTodos subscribes to the events of the given type on the bus of the repo and sends
+// the todos matching the filter arguments. The subscription ends with the context.
+func subscribeTodos(eventType string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		userID, err := auth.UserIDFromContext(p.Context)
+		if err != nil {
+			return nil, err
+		}
+		filter := readTodoSubscriptionFilter(p.Args)
+
+		subscription, _, _ := Repo.Events.Subscribe(userID, 0)
+		todos := make(chan any)
+		go func() {
+			defer close(todos)
+			defer subscription.Close()
+
+			for {
+				select {
+				case <-p.Context.Done():
+					return
+				case event, ok := <-subscription.C:
+					if !ok {
+						return
+					}
+					if event.Type != eventType {
+						continue
+					}
+
+					var todo models.Todo
+					if err := json.Unmarshal(event.Todo, &todo); err != nil {
+						Repo.App.ErrorLog.Println("Cannot decode the todo of event", event.ID, err)
+						continue
+					}
+					todo.UserID = event.UserID
+					if !filter.matches(&todo) {
+						continue
+					}
+
+					select {
+					case todos <- &todo:
+					case <-p.Context.Done():
+						return
+					}
+				}
+			}
+		}()
+		return todos, nil
+	}
+}
+
+// todoSubscriptionField returns a subscription to the todos changed by the events of the given type
+func todoSubscriptionField(eventType string, description string) *graphql.Field {
+	return &graphql.Field{
+		Type:        TodoType,
+		Description: description,
+		Args:        todoSubscriptionArgs,
+		Subscribe:   subscribeTodos(eventType),
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			// the source is the todo sent by the subscription
+			return p.Source, nil
+		},
+	}
+}
+
+// todoSubscriptionFields returns the fields of the subscription type
+func todoSubscriptionFields() graphql.Fields {
+	return graphql.Fields{
+		"todoCreated":   todoSubscriptionField(events.Created, "todos created or restored from the trash"),
+		"todoUpdated":   todoSubscriptionField(events.Updated, "todos changed other than by completing or deleting them"),
+		"todoCompleted": todoSubscriptionField(events.Completed, "todos completed"),
+		"todoDeleted":   todoSubscriptionField(events.Deleted, "todos moved to the trash"),
+	}
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/auth"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"golang.org/x/net/websocket"
+)
+
+// graphqlWSProtocol is the WebSocket subprotocol of GraphQL subscriptions, see
+// https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+const graphqlWSProtocol = "graphql-transport-ws"
+
+const (
+	// graphqlWSInitTimeout is how long a client has to send connection_init after connecting
+	graphqlWSInitTimeout = 10 * time.Second
+	// graphqlWSMaxMessage is the largest message a client can send
+	graphqlWSMaxMessage = 64 << 10
+)
+
+// The close codes of the protocol
+const (
+	wsCloseBadRequest       = 4400
+	wsCloseUnauthorized     = 4401
+	wsCloseForbidden        = 4403
+	wsCloseInitTimeout      = 4408
+	wsCloseSubscriberExists = 4409
+	wsCloseTooManyInits     = 4429
+)
+
+// The types of the messages of the protocol
+const (
+	wsConnectionInit = "connection_init"
+	wsConnectionAck  = "connection_ack"
+	wsPing           = "ping"
+	wsPong           = "pong"
+	wsSubscribe      = "subscribe"
+	wsNext           = "next"
+	wsError          = "error"
+	wsComplete       = "complete"
+)
+
+// wsMessage is a message of the protocol in either direction
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsSubscribePayload is the payload of a subscribe message
+type wsSubscribePayload struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables"`
+	OperationName string         `json:"operationName"`
+}
+
+// GraphQLWS serves GraphQL subscriptions over WebSocket with the graphql-transport-ws protocol.
+// Browsers cannot set headers on WebSocket connections, so the token is sent in the payload of
+// connection_init as {"Authorization": "Bearer <token>"}, the Authorization header works as well.
+func (m *Repository) GraphQLWS(w http.ResponseWriter, r *http.Request) {
+	websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			if !slices.Contains(config.Protocol, graphqlWSProtocol) {
+				return errors.New("the " + graphqlWSProtocol + " subprotocol is required")
+			}
+			config.Protocol = []string{graphqlWSProtocol}
+			return nil
+		},
+		Handler: m.serveGraphQLWS,
+	}.ServeHTTP(w, r)
+}
+
+// graphQLWSUser authenticates the user of a connection with the payload of connection_init,
+// falling back to the Authorization header of the request
+func (m *Repository) graphQLWSUser(r *http.Request, payload json.RawMessage) (int, error) {
+	header := r.Header.Get("Authorization")
+
+	var params map[string]any
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &params); err != nil {
+			return 0, err
+		}
+	}
+	for key, value := range params {
+		if s, ok := value.(string); ok && strings.EqualFold(key, "Authorization") {
+			header = s
+		}
+	}
+	return m.App.Auth.ParseAuthorizationHeader(header)
+}
+
+// graphqlWSConn is a connection serving subscriptions
+type graphqlWSConn struct {
+	ws     *websocket.Conn
+	userID int
+
+	// writeMu serializes the messages of the subscriptions, no message is sent once closed
+	writeMu sync.Mutex
+	closed  bool
+
+	mu            sync.Mutex
+	subscriptions map[string]context.CancelFunc
+	wg            sync.WaitGroup
+}
+
+func (m *Repository) serveGraphQLWS(ws *websocket.Conn) {
+	ws.MaxPayloadBytes = graphqlWSMaxMessage
+	c := &graphqlWSConn{
+		ws:            ws,
+		subscriptions: make(map[string]context.CancelFunc),
+	}
+
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer func() {
+		cancel()
+		c.wg.Wait()
+	}()
+
+	acknowledged := false
+	_ = ws.SetReadDeadline(time.Now().Add(graphqlWSInitTimeout))
+	for {
+		var msg wsMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			switch {
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				c.close(wsCloseInitTimeout, "Connection initialisation timeout")
+			case errors.Is(err, io.EOF) || errors.Is(err, websocket.ErrFrameTooLarge):
+				// the client is gone or broke the limit, either way there is no one to tell
+			default:
+				var syntaxErr *json.SyntaxError
+				var typeErr *json.UnmarshalTypeError
+				if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+					c.close(wsCloseBadRequest, "Invalid message")
+				}
+			}
+			return
+		}
+
+		switch msg.Type {
+		case wsConnectionInit:
+			if acknowledged {
+				c.close(wsCloseTooManyInits, "Too many initialisation requests")
+				return
+			}
+			userID, err := m.graphQLWSUser(ws.Request(), msg.Payload)
+			if err != nil {
+				c.close(wsCloseForbidden, "Forbidden")
+				return
+			}
+			c.userID = userID
+			acknowledged = true
+			_ = ws.SetReadDeadline(time.Time{})
+			c.send(wsMessage{Type: wsConnectionAck})
+		case wsPing:
+			c.send(wsMessage{Type: wsPong})
+		case wsPong:
+		case wsSubscribe:
+			if !acknowledged {
+				c.close(wsCloseUnauthorized, "Unauthorized")
+				return
+			}
+			var payload wsSubscribePayload
+			if msg.ID == "" || json.Unmarshal(msg.Payload, &payload) != nil || payload.Query == "" {
+				c.close(wsCloseBadRequest, "Invalid subscribe message")
+				return
+			}
+			if !c.subscribe(ctx, msg.ID, payload) {
+				c.close(wsCloseSubscriberExists, "Subscriber for "+msg.ID+" already exists")
+				return
+			}
+		case wsComplete:
+			c.unsubscribe(msg.ID)
+		default:
+			c.close(wsCloseBadRequest, "Unknown message type "+msg.Type)
+			return
+		}
+	}
+}
+
+// subscribe runs the subscription until it ends, the client completes it or the connection closes.
+// It reports false if the client already has a subscription with the id.
+func (c *graphqlWSConn) subscribe(ctx context.Context, id string, payload wsSubscribePayload) bool {
+	c.mu.Lock()
+	if _, ok := c.subscriptions[id]; ok {
+		c.mu.Unlock()
+		return false
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c.subscriptions[id] = cancel
+	c.mu.Unlock()
+
+	g := NewGraph()
+	g.QueryString = payload.Query
+	g.Variables = payload.Variables
+	g.OperationName = payload.OperationName
+	g.Context = auth.WithUserID(ctx, c.userID)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer c.unsubscribe(id)
+
+		results, err := g.Subscribe()
+		if err != nil {
+			c.sendPayload(id, wsError, gqlerrors.FormatErrors(err))
+			return
+		}
+
+		failed := false
+		for result := range results {
+			// the results have to be read until the channel closes, even if no one listens anymore
+			if failed || ctx.Err() != nil {
+				continue
+			}
+			if result.Data == nil && len(result.Errors) > 0 {
+				// the subscription could not start, e.g. the query is invalid
+				c.sendPayload(id, wsError, result.Errors)
+				failed = true
+				cancel()
+				continue
+			}
+			c.sendPayload(id, wsNext, result)
+		}
+		if !failed && ctx.Err() == nil {
+			c.send(wsMessage{ID: id, Type: wsComplete})
+		}
+	}()
+	return true
+}
+
+// unsubscribe stops the subscription with the id, if there is one
+func (c *graphqlWSConn) unsubscribe(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cancel, ok := c.subscriptions[id]; ok {
+		cancel()
+		delete(c.subscriptions, id)
+	}
+}
+
+// sendPayload sends a message of the subscription with the id carrying the payload
+func (c *graphqlWSConn) sendPayload(id string, typ string, payload any) {
+	p, err := json.Marshal(payload)
+	if err != nil {
+		p, _ = json.Marshal(gqlerrors.FormatErrors(err))
+		typ = wsError
+	}
+	c.send(wsMessage{ID: id, Type: typ, Payload: p})
+}
+
+func (c *graphqlWSConn) send(msg wsMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if !c.closed {
+		_ = websocket.JSON.Send(c.ws, msg)
+	}
+}
+
+// close sends the close frame of the connection with the code and reason. websocket.Conn.Close
+// would send a second one, so nothing is written after it and the server closes the connection
+// without another frame once the handler returns.
+func (c *graphqlWSConn) close(code int, reason string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+
+	frame := binary.BigEndian.AppendUint16(nil, uint16(code))
+	c.ws.PayloadType = websocket.CloseFrame
+	_, _ = c.ws.Write(append(frame, reason...))
+	// also stops the frames the websocket package writes by itself, like pongs
+	_ = c.ws.SetWriteDeadline(time.Now())
+}
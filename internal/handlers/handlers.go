@@ -7,12 +7,18 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/anras5/todo-app-backend/internal/auth"
 	"github.com/anras5/todo-app-backend/internal/config"
+	"github.com/anras5/todo-app-backend/internal/events"
 	"github.com/anras5/todo-app-backend/internal/models"
 	"github.com/anras5/todo-app-backend/internal/repository"
 	"github.com/anras5/todo-app-backend/internal/repository/dbrepo"
+	"github.com/anras5/todo-app-backend/internal/webhook"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 )
 
 // Repo the repository used by the handlers
@@ -20,22 +26,51 @@ var Repo *Repository
 
 // Repository is the repository type
 type Repository struct {
-	App *config.Application
-	DB  repository.DatabaseRepo
+	App      *config.Application
+	DB       repository.DatabaseRepo
+	Webhooks *webhook.Dispatcher
+	Events   *events.Bus
 }
 
 // NewRepo creates a new repository
 func NewRepo(a *config.Application, db *sql.DB) *Repository {
+	bus := events.NewBus(events.DefaultBufferSize)
+	repo := dbrepo.NewPostgresRepo(db, bus, a.QueryTimeout)
+	if a.TxIsolation != sql.LevelDefault {
+		repo = repo.WithIsolation(a.TxIsolation)
+	}
+	return newRepository(a, repo, bus)
+}
+
+// NewSQLiteRepo creates a new repository keeping its data in a SQLite database opened by driver.ConnectSQLite
+func NewSQLiteRepo(a *config.Application, db *sql.DB) *Repository {
+	bus := events.NewBus(events.DefaultBufferSize)
+	return newRepository(a, dbrepo.NewSQLiteRepo(db, bus, a.QueryTimeout), bus)
+}
+
+// NewMemoryRepo creates a new repository keeping its data in memory instead of the database
+func NewMemoryRepo(a *config.Application) *Repository {
+	bus := events.NewBus(events.DefaultBufferSize)
+	return newRepository(a, dbrepo.NewMemoryRepo(bus), bus)
+}
+
+// newRepository creates a repository using the repo, which publishes the changes of todos to the bus
+func newRepository(a *config.Application, repo repository.DatabaseRepo, bus *events.Bus) *Repository {
 	return &Repository{
-		App: a,
-		DB:  dbrepo.NewPostgresRepo(db),
+		App:      a,
+		DB:       repo,
+		Webhooks: webhook.NewDispatcher(repo, a.ErrorLog),
+		Events:   bus,
 	}
 }
 
 func NewTestRepo(a *config.Application) *Repository {
+	repo := dbrepo.NewTestingRepo()
 	return &Repository{
-		App: a,
-		DB:  dbrepo.NewTestingRepo(),
+		App:      a,
+		DB:       repo,
+		Webhooks: webhook.NewDispatcher(repo, a.ErrorLog),
+		Events:   events.NewBus(events.DefaultBufferSize),
 	}
 }
 
@@ -58,26 +93,165 @@ func (m *Repository) Home(w http.ResponseWriter, r *http.Request) {
 	_ = m.App.WriteJSON(w, http.StatusOK, payload)
 }
 
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// maxPasswordLength is the length in bytes of the longest password bcrypt can hash
+const maxPasswordLength = 72
+
+// normalize trims and lowercases the email, so that it is stored and looked up the same way
+// however the user types it, and rejects a password bcrypt cannot hash
+func (c *credentials) normalize() error {
+	c.Email = strings.ToLower(strings.TrimSpace(c.Email))
+	if len(c.Password) > maxPasswordLength {
+		return fmt.Errorf("password should have at most %d bytes", maxPasswordLength)
+	}
+	return nil
+}
+
+func (m *Repository) Signup(w http.ResponseWriter, r *http.Request) {
+	var creds credentials
+
+	err := m.App.ReadJSON(w, r, &creds)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+	if err = creds.normalize(); err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	if !strings.Contains(creds.Email, "@") {
+		_ = m.App.ErrorJSON(w, errors.New("email is invalid"))
+		return
+	}
+	if len(creds.Password) < 8 {
+		_ = m.App.ErrorJSON(w, errors.New("password should have at least 8 characters"))
+		return
+	}
+
+	hash, err := auth.HashPassword(creds.Password)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	id, err := m.DB.InsertUser(r.Context(), models.User{Email: creds.Email, PasswordHash: hash})
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicateEmail) {
+			_ = m.App.ErrorJSON(w, err, http.StatusConflict)
+			return
+		}
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	m.writeToken(w, id, http.StatusCreated, "user created")
+}
+
+func (m *Repository) Login(w http.ResponseWriter, r *http.Request) {
+	var creds credentials
+
+	err := m.App.ReadJSON(w, r, &creds)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+	if err = creds.normalize(); err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	// do not tell the client whether it was the email or the password that was wrong
+	invalidCredentials := errors.New("invalid email or password")
+	user, err := m.DB.SelectUserByEmail(r.Context(), creds.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = m.App.ErrorJSON(w, invalidCredentials, http.StatusUnauthorized)
+			return
+		}
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+	if !auth.CheckPassword(user.PasswordHash, creds.Password) {
+		_ = m.App.ErrorJSON(w, invalidCredentials, http.StatusUnauthorized)
+		return
+	}
+
+	m.writeToken(w, user.ID, http.StatusOK, "logged in")
+}
+
+// writeToken issues a token for the user and writes it to the response
+func (m *Repository) writeToken(w http.ResponseWriter, userID int, status int, message string) {
+	token, err := m.App.Auth.GenerateToken(userID)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := config.JSONResponse{
+		Error:   false,
+		Message: message,
+		Data: map[string]string{
+			"token": token,
+		},
+	}
+	_ = m.App.WriteJSON(w, status, response)
+}
+
+// userID returns the id of the authenticated user, writing an error response if there is none
+func (m *Repository) userID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := auth.UserIDFromContext(r.Context())
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err, http.StatusUnauthorized)
+		return 0, false
+	}
+	return userID, true
+}
+
+// audited returns the repo recording the request in the history of the todos it changes
+func (m *Repository) audited(r *http.Request) repository.DatabaseRepo {
+	return m.DB.WithAudit(models.Audit{
+		RequestID: middleware.GetReqID(r.Context()),
+		Transport: models.TransportREST,
+		Undoable:  true,
+	})
+}
+
 func (m *Repository) AllTodos(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
 
-	var todos []*models.Todo
-	var err error
-	var searchCompleted bool
+	filter, err := readTodoFilter(r)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
 
-	completed := r.URL.Query().Get("completed")
-	if completed != "" {
-		// we get a completed query params
-		searchCompleted, err = strconv.ParseBool(completed)
+	if r.URL.Query().Has("limit") || r.URL.Query().Has("cursor") {
+		// the client asked for a single page
+		limit, after, err := readPageParams(r)
 		if err != nil {
-			_ = m.App.ErrorJSON(w, errors.New("completed should be true or false"))
+			_ = m.App.ErrorJSON(w, err)
 			return
 		}
-		todos, err = m.DB.SelectTodos(searchCompleted)
-	} else {
-		// we do not get any query params
-		todos, err = m.DB.SelectTodos()
+
+		page, err := m.DB.SelectTodosPage(r.Context(), userID, limit, after, filter)
+		if err != nil {
+			_ = m.App.ErrorJSON(w, err)
+			return
+		}
+
+		_ = m.App.WriteJSON(w, http.StatusOK, page)
+		return
 	}
 
+	todos, err := m.DB.SelectTodos(r.Context(), userID, filter)
 	if err != nil {
 		_ = m.App.ErrorJSON(w, err)
 		return
@@ -86,7 +260,144 @@ func (m *Repository) AllTodos(w http.ResponseWriter, r *http.Request) {
 	_ = m.App.WriteJSON(w, http.StatusOK, todos)
 }
 
+// readTodoFilter reads the filter and sort query params of a todo listing
+func readTodoFilter(r *http.Request) (models.TodoFilter, error) {
+	var filter models.TodoFilter
+	query := r.URL.Query()
+
+	if completed := query.Get("completed"); completed != "" {
+		// we get a completed query params
+		searchCompleted, err := strconv.ParseBool(completed)
+		if err != nil {
+			return filter, errors.New("completed should be true or false")
+		}
+		filter.Completed = &searchCompleted
+	}
+
+	// ?tag=a&tag=b keeps the todos with any of the tags, or all of them with tag_mode=all
+	filter.Tags = query["tag"]
+	switch query.Get("tag_mode") {
+	case "", "any":
+	case "all":
+		filter.MatchAllTags = true
+	default:
+		return filter, errors.New("tag_mode should be any or all")
+	}
+
+	ranges := []struct {
+		param string
+		value **time.Time
+	}{
+		{"deadline_after", &filter.DeadlineAfter},
+		{"deadline_before", &filter.DeadlineBefore},
+		{"created_after", &filter.CreatedAfter},
+		{"created_before", &filter.CreatedBefore},
+		{"updated_after", &filter.UpdatedAfter},
+		{"updated_before", &filter.UpdatedBefore},
+	}
+	for _, rng := range ranges {
+		if value := query.Get(rng.param); value != "" {
+			t, err := parseTimeParam(value)
+			if err != nil {
+				return filter, fmt.Errorf("%s should be a date like 2024-01-31 or 2024-01-31T09:00:00Z", rng.param)
+			}
+			*rng.value = &t
+		}
+	}
+
+	if overdue := query.Get("overdue"); overdue != "" {
+		var err error
+		filter.Overdue, err = strconv.ParseBool(overdue)
+		if err != nil {
+			return filter, errors.New("overdue should be true or false")
+		}
+	}
+
+	filter.NameContains = query.Get("name")
+
+	if sort := query.Get("sort"); sort != "" {
+		var err error
+		filter.Sort, err = models.ParseTodoSort(sort)
+		if err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, nil
+}
+
+// parseTimeParam parses an RFC 3339 time or a plain date
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// readLimit reads the limit query param, using the default page size if it is not set
+func readLimit(r *http.Request) (int, error) {
+	limit := repository.DefaultPageSize
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > repository.MaxPageSize {
+			return 0, fmt.Errorf("limit should be a number between 1 and %d", repository.MaxPageSize)
+		}
+	}
+	return limit, nil
+}
+
+// readPageParams reads the limit and cursor query params of a paginated request
+func readPageParams(r *http.Request) (int, *models.TodoCursor, error) {
+	limit, err := readLimit(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var after *models.TodoCursor
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		after, err = models.DecodeTodoCursor(c)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return limit, after, nil
+}
+
+// SearchTodos finds the todos matching the q query param, best matches first
+func (m *Repository) SearchTodos(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		_ = m.App.ErrorJSON(w, errors.New("q is required"))
+		return
+	}
+
+	limit, err := readLimit(r)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	results, err := m.DB.SearchTodos(r.Context(), userID, query, limit)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+	_ = m.App.WriteJSON(w, http.StatusOK, results)
+}
+
 func (m *Repository) OneTodo(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
 	id := chi.URLParam(r, "id")
 	todoID, err := strconv.Atoi(id)
 	if err != nil {
@@ -94,15 +405,80 @@ func (m *Repository) OneTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	todo, err := m.DB.SelectTodo(todoID)
+	todo, err := m.DB.SelectTodo(r.Context(), userID, todoID)
 	if err != nil {
 		_ = m.App.ErrorJSON(w, err)
 		return
 	}
-	_ = m.App.WriteJSON(w, http.StatusOK, todo)
+
+	headers := http.Header{}
+	headers.Set("ETag", etag(todo.Version))
+	_ = m.App.WriteJSON(w, http.StatusOK, todo, headers)
+}
+
+// etag returns the entity tag of a todo version
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// readIfMatch returns the todo version from the If-Match header, 0 if any version matches
+func readIfMatch(r *http.Request) (int, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(strings.Trim(ifMatch, `"`))
+	if err != nil || version < 1 || ifMatch != etag(version) {
+		return 0, errors.New(`If-Match should be an ETag like "1"`)
+	}
+	return version, nil
+}
+
+// todoWriteError writes err as a response, using 412 if the todo has changed
+func (m *Repository) todoWriteError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrVersionConflict) {
+		_ = m.App.ErrorJSON(w, err, http.StatusPreconditionFailed)
+		return
+	}
+	_ = m.App.ErrorJSON(w, err)
+}
+
+func (m *Repository) ChildTodos(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	todoID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	var todos []*models.Todo
+	err = m.DB.WithIsolation(sql.LevelRepeatableRead).WithTx(r.Context(), func(db repository.DatabaseRepo) error {
+		// make sure the todo exists, so that an unknown todo is not reported as one without subtasks
+		if _, err := db.SelectTodo(r.Context(), userID, todoID); err != nil {
+			return err
+		}
+		var err error
+		todos, err = db.SelectTodoChildren(r.Context(), userID, todoID)
+		return err
+	})
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+	_ = m.App.WriteJSON(w, http.StatusOK, todos)
 }
 
 func (m *Repository) InsertTodo(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
 	var todo models.Todo
 
 	err := m.App.ReadJSON(w, r, &todo)
@@ -111,7 +487,8 @@ func (m *Repository) InsertTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := m.DB.InsertTodo(todo)
+	todo.UserID = userID
+	id, err := m.audited(r).InsertTodo(r.Context(), todo)
 	if err != nil {
 		_ = m.App.ErrorJSON(w, err)
 		return
@@ -127,20 +504,45 @@ func (m *Repository) InsertTodo(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Repository) UpdateTodo(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	todoID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
 	var todo models.Todo
 
-	err := m.App.ReadJSON(w, r, &todo)
+	err = m.App.ReadJSON(w, r, &todo)
 	if err != nil {
 		_ = m.App.ErrorJSON(w, err)
 		return
 	}
 
-	err = m.DB.UpdateTodo(todo)
+	// the todo to update is the one of the URL, the body may leave its id out
+	if todo.ID != 0 && todo.ID != todoID {
+		_ = m.App.ErrorJSON(w, errors.New("id of the body does not match the URL"))
+		return
+	}
+	todo.ID = todoID
+	todo.UserID = userID
+	// the version to update comes from If-Match only, the one in the body is ignored
+	todo.Version, err = readIfMatch(r)
 	if err != nil {
 		_ = m.App.ErrorJSON(w, err)
 		return
 	}
 
+	err = m.audited(r).UpdateTodo(r.Context(), todo)
+	if err != nil {
+		m.todoWriteError(w, err)
+		return
+	}
+
 	response := config.JSONResponse{
 		Error:   false,
 		Message: "todo updated",
@@ -149,6 +551,11 @@ func (m *Repository) UpdateTodo(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *Repository) UpdateTodoCompleted(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
 	todoID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
 		_ = m.App.ErrorJSON(w, err)
@@ -158,13 +565,13 @@ func (m *Repository) UpdateTodoCompleted(w http.ResponseWriter, r *http.Request)
 
 	switch isCompleted {
 	case "complete":
-		err = m.DB.UpdateTodoCompleted(todoID, true)
+		err = m.audited(r).UpdateTodoCompleted(r.Context(), userID, todoID, true)
 		if err != nil {
 			_ = m.App.ErrorJSON(w, err)
 			return
 		}
 	case "incomplete":
-		err = m.DB.UpdateTodoCompleted(todoID, false)
+		err = m.audited(r).UpdateTodoCompleted(r.Context(), userID, todoID, false)
 		if err != nil {
 			_ = m.App.ErrorJSON(w, err)
 			return
@@ -183,6 +590,11 @@ func (m *Repository) UpdateTodoCompleted(w http.ResponseWriter, r *http.Request)
 }
 
 func (m *Repository) DeleteTodo(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
 	id := chi.URLParam(r, "id")
 	todoID, err := strconv.Atoi(id)
 	if err != nil {
@@ -190,12 +602,18 @@ func (m *Repository) DeleteTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = m.DB.DeleteTodo(todoID)
+	version, err := readIfMatch(r)
 	if err != nil {
 		_ = m.App.ErrorJSON(w, err)
 		return
 	}
 
+	err = m.audited(r).DeleteTodo(r.Context(), userID, todoID, version)
+	if err != nil {
+		m.todoWriteError(w, err)
+		return
+	}
+
 	response := config.JSONResponse{
 		Error:   false,
 		Message: "todo deleted",
@@ -211,6 +629,7 @@ func (m *Repository) GraphQL(w http.ResponseWriter, r *http.Request) {
 	g := NewGraph()
 	g.QueryString = req.Query
 	g.Variables = req.Variables
+	g.Context = r.Context()
 
 	resp, err := g.Query()
 	if err != nil {
@@ -1,14 +1,22 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"github.com/anras5/todo-app-backend/internal/events"
 	"github.com/anras5/todo-app-backend/internal/models"
 	"github.com/go-chi/chi/v5"
+	"golang.org/x/net/websocket"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -20,13 +28,42 @@ var theGetTests = []struct {
 	expectedStatusCode int
 }{
 	{"home", "/", "GET", http.StatusOK},
+	{"all-todos-unauthenticated", "/todos", "GET", http.StatusUnauthorized},
+	{"one-todo-unauthenticated", "/todos/1", "GET", http.StatusUnauthorized},
 	{"all-todos", "/todos", "GET", http.StatusOK},
 	{"all-todos-completed", "/todos?completed=true", "GET", http.StatusOK},
 	{"all-todos-incompleted", "/todos?completed=false", "GET", http.StatusBadRequest},
 	{"all-todos-completed-wrong", "/todos?completed=one", "GET", http.StatusBadRequest},
+	{"all-todos-page", "/todos?limit=10", "GET", http.StatusOK},
+	{"all-todos-page-cursor", "/todos?cursor=MjAyNC0wMS0wMlQwMDowMDowMFp8MQ", "GET", http.StatusOK},
+	{"all-todos-page-incompleted", "/todos?limit=10&completed=false", "GET", http.StatusBadRequest},
+	{"all-todos-page-limit-wrong", "/todos?limit=ten", "GET", http.StatusBadRequest},
+	{"all-todos-page-limit-too-big", "/todos?limit=1000", "GET", http.StatusBadRequest},
+	{"all-todos-page-cursor-wrong", "/todos?cursor=abc", "GET", http.StatusBadRequest},
+	{"all-todos-tag", "/todos?tag=home", "GET", http.StatusOK},
+	{"all-todos-tags-all", "/todos?tag=home&tag=urgent&tag_mode=all", "GET", http.StatusOK},
+	{"all-todos-tags-page", "/todos?limit=10&tag=home&tag_mode=any", "GET", http.StatusOK},
+	{"all-todos-tag-mode-wrong", "/todos?tag=home&tag_mode=some", "GET", http.StatusBadRequest},
+	{"all-todos-deadline-range", "/todos?deadline_after=2024-01-01&deadline_before=2024-02-01T00:00:00Z", "GET", http.StatusOK},
+	{"all-todos-deadline-wrong", "/todos?deadline_before=tomorrow", "GET", http.StatusBadRequest},
+	{"all-todos-created-updated", "/todos?created_after=2024-01-01&updated_before=2024-02-01", "GET", http.StatusOK},
+	{"all-todos-overdue", "/todos?overdue=true", "GET", http.StatusOK},
+	{"all-todos-overdue-wrong", "/todos?overdue=maybe", "GET", http.StatusBadRequest},
+	{"all-todos-name", "/todos?name=milk", "GET", http.StatusOK},
+	{"all-todos-sort", "/todos?sort=-deadline,name", "GET", http.StatusOK},
+	{"all-todos-sort-page", "/todos?sort=completed,-updated_at&limit=5", "GET", http.StatusOK},
+	{"all-todos-sort-wrong", "/todos?sort=user_id", "GET", http.StatusBadRequest},
+	{"search-todos", "/todos/search?q=groceries", "GET", http.StatusOK},
+	{"search-todos-limit", "/todos/search?q=%22buy+milk%22+-bread&limit=5", "GET", http.StatusOK},
+	{"search-todos-no-query", "/todos/search", "GET", http.StatusBadRequest},
+	{"search-todos-blank-query", "/todos/search?q=+", "GET", http.StatusBadRequest},
+	{"search-todos-limit-wrong", "/todos/search?q=groceries&limit=0", "GET", http.StatusBadRequest},
 	{"one-todo-1", "/todos/1", "GET", http.StatusOK},
 	{"one-todo-2", "/todos/2", "GET", http.StatusBadRequest},
 	{"one-todo-invalid-parameter", "/todos/one", "GET", http.StatusBadRequest},
+	{"child-todos", "/todos/1/children", "GET", http.StatusOK},
+	{"child-todos-2", "/todos/2/children", "GET", http.StatusBadRequest},
+	{"child-todos-invalid-parameter", "/todos/one/children", "GET", http.StatusBadRequest},
 }
 
 // TestHandlers tests all routes that don't require extra tests (GET handlers)
@@ -36,8 +73,17 @@ func TestHandlers(t *testing.T) {
 	ts := httptest.NewTLSServer(routes)
 	defer ts.Close()
 
+	token, err := app.Auth.GenerateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	for _, e := range theGetTests {
-		response, err := ts.Client().Get(ts.URL + e.url)
+		req, _ := http.NewRequest(e.method, ts.URL+e.url, nil)
+		if !strings.HasSuffix(e.name, "-unauthenticated") {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		response, err := ts.Client().Do(req)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -91,13 +137,46 @@ var theInsertTests = []struct {
 		method:             "POST",
 		expectedStatusCode: http.StatusBadRequest,
 	},
+	{
+		name: "unknown parent todo",
+		todo: models.Todo{
+			Name:        "subtask",
+			Description: "todo made for the purposes of testing",
+			ParentID:    &testParentID,
+		},
+		method:             "POST",
+		expectedStatusCode: http.StatusBadRequest,
+	},
+	{
+		name: "recurring todo",
+		todo: models.Todo{
+			Name:        "take out the trash",
+			Description: "todo made for the purposes of testing",
+			RRule:       "FREQ=WEEKLY;BYDAY=MO,TH",
+		},
+		method:             "POST",
+		expectedStatusCode: http.StatusAccepted,
+	},
+	{
+		name: "unsupported rrule todo",
+		todo: models.Todo{
+			Name:        "every hour",
+			Description: "todo made for the purposes of testing",
+			RRule:       "FREQ=HOURLY",
+		},
+		method:             "POST",
+		expectedStatusCode: http.StatusBadRequest,
+	},
 }
 
+var testParentID = 2
+
 func TestRepository_InsertTodo(t *testing.T) {
 	for _, e := range theInsertTests {
 		var req *http.Request
 		jsonTestTodo, _ := json.Marshal(e.todo)
 		req, _ = http.NewRequest(e.method, "/todos", bytes.NewBuffer(jsonTestTodo))
+		req = withTestUser(req)
 
 		rr := httptest.NewRecorder()
 		handler := http.HandlerFunc(Repo.InsertTodo)
@@ -157,13 +236,53 @@ var theUpdateTests = []struct {
 		method:             "PUT",
 		expectedStatusCode: http.StatusBadRequest,
 	},
+	{
+		name:               "id from the url update",
+		todo:               models.Todo{Name: "milk"},
+		id:                 1,
+		method:             "PUT",
+		expectedStatusCode: http.StatusAccepted,
+	},
+	{
+		name:               "mismatched id update",
+		todo:               models.Todo{ID: 2, Name: "milk"},
+		id:                 1,
+		method:             "PUT",
+		expectedStatusCode: http.StatusBadRequest,
+	},
+	{
+		name: "cycle update",
+		todo: models.Todo{
+			ID:       1,
+			Name:     "subtask of itself",
+			ParentID: &testCycleParentID,
+		},
+		id:                 1,
+		method:             "PUT",
+		expectedStatusCode: http.StatusBadRequest,
+	},
+	{
+		name: "invalid rrule update",
+		todo: models.Todo{
+			ID:    1,
+			Name:  "every other day",
+			RRule: "FREQ=DAILY;INTERVAL=0",
+		},
+		id:                 1,
+		method:             "PUT",
+		expectedStatusCode: http.StatusBadRequest,
+	},
 }
 
+var testCycleParentID = 1
+
 func TestRepository_UpdateTodo(t *testing.T) {
 	for _, e := range theUpdateTests {
 		var req *http.Request
 		jsonTestTodo, _ := json.Marshal(e.todo)
 		req, _ = http.NewRequest(e.method, fmt.Sprintf("/todos/%d", e.id), bytes.NewBuffer(jsonTestTodo))
+		ctx := addChiContext(req.Context(), map[string]string{"id": fmt.Sprint(e.id)})
+		req = withTestUser(req.WithContext(ctx))
 
 		rr := httptest.NewRecorder()
 		handler := http.HandlerFunc(Repo.UpdateTodo)
@@ -224,7 +343,7 @@ func TestRepository_UpdateTodoCompleted(t *testing.T) {
 		pathVariables["id"] = e.id
 		pathVariables["complete"] = e.completed
 		ctx = addChiContext(ctx, pathVariables)
-		req = req.WithContext(ctx)
+		req = withTestUser(req.WithContext(ctx))
 
 		rr := httptest.NewRecorder()
 		handler := http.HandlerFunc(Repo.UpdateTodoCompleted)
@@ -268,7 +387,7 @@ func TestRepository_DeleteTodo(t *testing.T) {
 		pathVariables := make(map[string]string)
 		pathVariables["id"] = e.id
 		ctx = addChiContext(ctx, pathVariables)
-		req = req.WithContext(ctx)
+		req = withTestUser(req.WithContext(ctx))
 
 		rr := httptest.NewRecorder()
 		handler := http.HandlerFunc(Repo.DeleteTodo)
@@ -280,6 +399,89 @@ func TestRepository_DeleteTodo(t *testing.T) {
 	}
 }
 
+var theAuthTests = []struct {
+	name               string
+	url                string
+	body               string
+	expectedStatusCode int
+}{
+	{"signup", "/signup", `{"email": "new@example.com", "password": "password"}`, http.StatusCreated},
+	{"signup-taken-email", "/signup", `{"email": "taken@example.com", "password": "password"}`, http.StatusConflict},
+	{"signup-invalid-email", "/signup", `{"email": "example.com", "password": "password"}`, http.StatusBadRequest},
+	{"signup-short-password", "/signup", `{"email": "new@example.com", "password": "pass"}`, http.StatusBadRequest},
+	{"signup-long-password", "/signup", `{"email": "new@example.com", "password": "` + strings.Repeat("p", 73) + `"}`, http.StatusBadRequest},
+	{"signup-taken-email-case", "/signup", `{"email": " Taken@Example.com ", "password": "password"}`, http.StatusConflict},
+	{"signup-invalid-body", "/signup", `{"username": "user"}`, http.StatusBadRequest},
+	{"login", "/login", `{"email": "user@example.com", "password": "password"}`, http.StatusOK},
+	{"login-wrong-password", "/login", `{"email": "user@example.com", "password": "wrong password"}`, http.StatusUnauthorized},
+	{"login-unknown-email", "/login", `{"email": "unknown@example.com", "password": "password"}`, http.StatusUnauthorized},
+	{"login-email-case", "/login", `{"email": " User@Example.com", "password": "password"}`, http.StatusOK},
+	{"login-long-password", "/login", `{"email": "user@example.com", "password": "` + strings.Repeat("p", 73) + `"}`, http.StatusBadRequest},
+}
+
+func TestRepository_Auth(t *testing.T) {
+	routes := getRoutes()
+
+	for _, e := range theAuthTests {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(e.body))
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+var theProjectTests = []struct {
+	name               string
+	method             string
+	url                string
+	body               string
+	expectedStatusCode int
+}{
+	{"all-projects", "GET", "/projects", "", http.StatusOK},
+	{"one-project", "GET", "/projects/1", "", http.StatusOK},
+	{"one-project-not-found", "GET", "/projects/2", "", http.StatusNotFound},
+	{"one-project-invalid-parameter", "GET", "/projects/one", "", http.StatusBadRequest},
+	{"project-todos", "GET", "/projects/1/todos", "", http.StatusOK},
+	{"project-todos-not-found", "GET", "/projects/2/todos", "", http.StatusNotFound},
+	{"insert-project", "POST", "/projects", `{"name": "home", "description": "chores"}`, http.StatusAccepted},
+	{"insert-project-empty-name", "POST", "/projects", `{"name": ""}`, http.StatusBadRequest},
+	{"insert-project-invalid-body", "POST", "/projects", `{"title": "home"}`, http.StatusBadRequest},
+	{"update-project", "PUT", "/projects/1", `{"name": "work"}`, http.StatusAccepted},
+	{"update-project-not-found", "PUT", "/projects/2", `{"name": "work"}`, http.StatusNotFound},
+	{"delete-project", "DELETE", "/projects/1", "", http.StatusAccepted},
+	{"delete-project-with-todos", "DELETE", "/projects/1?todos=delete", "", http.StatusAccepted},
+	{"delete-project-reassign", "DELETE", "/projects/1?reassign_to=3", "", http.StatusAccepted},
+	{"delete-project-reassign-not-found", "DELETE", "/projects/1?reassign_to=2", "", http.StatusNotFound},
+	{"delete-project-delete-and-reassign", "DELETE", "/projects/1?todos=delete&reassign_to=3", "", http.StatusBadRequest},
+	{"delete-project-invalid-todos", "DELETE", "/projects/1?todos=move", "", http.StatusBadRequest},
+	{"delete-project-not-found", "DELETE", "/projects/2", "", http.StatusNotFound},
+}
+
+func TestRepository_Projects(t *testing.T) {
+	routes := getRoutes()
+
+	token, err := app.Auth.GenerateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range theProjectTests {
+		req, _ := http.NewRequest(e.method, e.url, strings.NewReader(e.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
 func addChiContext(parentCtx context.Context, pathVariables map[string]string) context.Context {
 	chiCtx := chi.NewRouteContext()
 	for k, v := range pathVariables {
@@ -287,3 +489,648 @@ func addChiContext(parentCtx context.Context, pathVariables map[string]string) c
 	}
 	return context.WithValue(parentCtx, chi.RouteCtxKey, chiCtx)
 }
+
+var theTagTests = []struct {
+	name               string
+	method             string
+	url                string
+	body               string
+	expectedStatusCode int
+}{
+	{"add-tags", "POST", "/todos/1/tags", `{"tags": ["home", "urgent"]}`, http.StatusAccepted},
+	{"add-tags-empty", "POST", "/todos/1/tags", `{"tags": [" ", ""]}`, http.StatusBadRequest},
+	{"add-tags-invalid-body", "POST", "/todos/1/tags", `{"tags": "home"}`, http.StatusBadRequest},
+	{"add-tags-not-found", "POST", "/todos/2/tags", `{"tags": ["home"]}`, http.StatusNotFound},
+	{"add-tags-invalid-parameter", "POST", "/todos/one/tags", `{"tags": ["home"]}`, http.StatusBadRequest},
+	{"remove-tag", "DELETE", "/todos/1/tags/home", "", http.StatusAccepted},
+	{"remove-tag-not-found", "DELETE", "/todos/2/tags/home", "", http.StatusNotFound},
+	{"remove-tag-invalid-parameter", "DELETE", "/todos/one/tags/home", "", http.StatusBadRequest},
+}
+
+func TestRepository_Tags(t *testing.T) {
+	routes := getRoutes()
+
+	token, err := app.Auth.GenerateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range theTagTests {
+		req, _ := http.NewRequest(e.method, e.url, strings.NewReader(e.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+var theTrashTests = []struct {
+	name               string
+	method             string
+	url                string
+	expectedStatusCode int
+}{
+	{"trash", "GET", "/trash", http.StatusOK},
+	{"restore", "POST", "/todos/1/restore", http.StatusAccepted},
+	{"restore-not-trashed", "POST", "/todos/2/restore", http.StatusNotFound},
+	{"restore-parent-trashed", "POST", "/todos/3/restore", http.StatusConflict},
+	{"restore-invalid-parameter", "POST", "/todos/one/restore", http.StatusBadRequest},
+	{"purge", "DELETE", "/trash/1", http.StatusAccepted},
+	{"purge-not-trashed", "DELETE", "/trash/2", http.StatusNotFound},
+	{"purge-invalid-parameter", "DELETE", "/trash/one", http.StatusBadRequest},
+}
+
+func TestRepository_Trash(t *testing.T) {
+	routes := getRoutes()
+
+	token, err := app.Auth.GenerateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range theTrashTests {
+		req, _ := http.NewRequest(e.method, e.url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+var theHistoryTests = []struct {
+	name               string
+	url                string
+	expectedStatusCode int
+}{
+	{"history", "/todos/1/history", http.StatusOK},
+	{"history-not-found", "/todos/2/history", http.StatusNotFound},
+	{"history-invalid-parameter", "/todos/one/history", http.StatusBadRequest},
+}
+
+func TestRepository_TodoHistory(t *testing.T) {
+	routes := getRoutes()
+
+	token, err := app.Auth.GenerateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range theHistoryTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+var theUndoTests = []struct {
+	name               string
+	url                string
+	expectedStatusCode int
+}{
+	{"undo", "/undo", http.StatusAccepted},
+	{"undo-count", "/undo?count=3", http.StatusAccepted},
+	{"undo-conflict", "/undo?count=2", http.StatusConflict},
+	{"undo-invalid-count", "/undo?count=0", http.StatusBadRequest},
+	{"undo-count-too-large", "/undo?count=1000", http.StatusBadRequest},
+	{"redo", "/redo", http.StatusAccepted},
+	{"redo-nothing", "/redo?count=2", http.StatusConflict},
+	{"redo-invalid-count", "/redo?count=one", http.StatusBadRequest},
+}
+
+func TestRepository_Undo(t *testing.T) {
+	routes := getRoutes()
+
+	token, err := app.Auth.GenerateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range theUndoTests {
+		req, _ := http.NewRequest("POST", e.url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+var theIfMatchTests = []struct {
+	name               string
+	method             string
+	url                string
+	body               string
+	ifMatch            string
+	expectedStatusCode int
+}{
+	{"update-if-match", "PUT", "/todos/1", `{"id": 1, "name": "milk"}`, `"1"`, http.StatusAccepted},
+	{"update-if-match-any", "PUT", "/todos/1", `{"id": 1, "name": "milk"}`, "*", http.StatusAccepted},
+	{"update-if-match-stale", "PUT", "/todos/1", `{"id": 1, "name": "milk"}`, `"2"`, http.StatusPreconditionFailed},
+	{"update-if-match-weak", "PUT", "/todos/1", `{"id": 1, "name": "milk"}`, `W/"1"`, http.StatusBadRequest},
+	{"update-if-match-body-version", "PUT", "/todos/1", `{"id": 1, "name": "milk", "version": 5}`, "", http.StatusAccepted},
+	{"delete-if-match", "DELETE", "/todos/1", "", `"1"`, http.StatusAccepted},
+	{"delete-if-match-stale", "DELETE", "/todos/1", "", `"3"`, http.StatusPreconditionFailed},
+	{"delete-if-match-invalid", "DELETE", "/todos/1", "", "one", http.StatusBadRequest},
+}
+
+func TestRepository_IfMatch(t *testing.T) {
+	routes := getRoutes()
+
+	token, err := app.Auth.GenerateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range theIfMatchTests {
+		req, _ := http.NewRequest(e.method, e.url, strings.NewReader(e.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if e.ifMatch != "" {
+			req.Header.Set("If-Match", e.ifMatch)
+		}
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+func TestRepository_OneTodoETag(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/todos/1", nil)
+	req = withTestUser(req.WithContext(addChiContext(req.Context(), map[string]string{"id": "1"})))
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.OneTodo).ServeHTTP(rr, req)
+
+	if etag := rr.Header().Get("ETag"); etag != `"1"` {
+		t.Errorf("wrong ETag: got %s, wanted %s", etag, `"1"`)
+	}
+}
+
+var thePatchTests = []struct {
+	name               string
+	contentType        string
+	body               string
+	ifMatch            string
+	expectedStatusCode int
+}{
+	{"merge-patch", "application/merge-patch+json", `{"name": "milk", "project_id": null}`, "", http.StatusAccepted},
+	{"merge-patch-plain-json", "application/json", `{"completed": true}`, "", http.StatusAccepted},
+	{"merge-patch-no-content-type", "", `{"tags": ["home"]}`, "", http.StatusAccepted},
+	{"merge-patch-empty", "application/merge-patch+json", `{}`, "", http.StatusAccepted},
+	{"merge-patch-if-match", "application/merge-patch+json", `{"name": "milk"}`, `"1"`, http.StatusAccepted},
+	{"merge-patch-if-match-stale", "application/merge-patch+json", `{"name": "milk"}`, `"2"`, http.StatusPreconditionFailed},
+	{"merge-patch-read-only", "application/merge-patch+json", `{"id": 5}`, "", http.StatusBadRequest},
+	{"merge-patch-unknown-field", "application/merge-patch+json", `{"color": "red"}`, "", http.StatusBadRequest},
+	{"merge-patch-remove-required", "application/merge-patch+json", `{"deadline": null}`, "", http.StatusBadRequest},
+	{"merge-patch-wrong-type", "application/merge-patch+json", `{"name": 5}`, "", http.StatusBadRequest},
+	{"merge-patch-invalid-rrule", "application/merge-patch+json", `{"rrule": "FREQ=HOURLY"}`, "", http.StatusBadRequest},
+	{"merge-patch-not-object", "application/merge-patch+json", `["name"]`, "", http.StatusBadRequest},
+	{"json-patch", "application/json-patch+json", `[{"op": "replace", "path": "/name", "value": "milk"}, {"op": "add", "path": "/tags/-", "value": "home"}]`, "", http.StatusAccepted},
+	{"json-patch-test", "application/json-patch+json", `[{"op": "test", "path": "/version", "value": 1}, {"op": "replace", "path": "/completed", "value": true}]`, "", http.StatusAccepted},
+	{"json-patch-test-failed", "application/json-patch+json", `[{"op": "test", "path": "/name", "value": "bread"}]`, "", http.StatusConflict},
+	{"json-patch-read-only", "application/json-patch+json", `[{"op": "replace", "path": "/version", "value": 7}]`, "", http.StatusBadRequest},
+	{"json-patch-remove-required", "application/json-patch+json", `[{"op": "remove", "path": "/name"}]`, "", http.StatusBadRequest},
+	{"json-patch-invalid", "application/json-patch+json", `{"op": "remove"}`, "", http.StatusBadRequest},
+	{"unsupported-media-type", "text/plain", `name=milk`, "", http.StatusUnsupportedMediaType},
+}
+
+func TestRepository_PatchTodo(t *testing.T) {
+	routes := getRoutes()
+
+	token, err := app.Auth.GenerateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range thePatchTests {
+		req, _ := http.NewRequest("PATCH", "/todos/1", strings.NewReader(e.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if e.contentType != "" {
+			req.Header.Set("Content-Type", e.contentType)
+		}
+		if e.ifMatch != "" {
+			req.Header.Set("If-Match", e.ifMatch)
+		}
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		if rr.Code == http.StatusAccepted && rr.Header().Get("ETag") == "" {
+			t.Errorf("%s did not return an ETag", e.name)
+		}
+	}
+}
+
+var theWebhookTests = []struct {
+	name               string
+	method             string
+	url                string
+	body               string
+	expectedStatusCode int
+}{
+	{"all-webhooks", "GET", "/webhooks", "", http.StatusOK},
+	{"one-webhook", "GET", "/webhooks/1", "", http.StatusOK},
+	{"one-webhook-not-found", "GET", "/webhooks/2", "", http.StatusNotFound},
+	{"one-webhook-invalid-parameter", "GET", "/webhooks/one", "", http.StatusBadRequest},
+	{"insert-webhook", "POST", "/webhooks", `{"url": "https://example.com/hook", "events": ["todo.created"]}`, http.StatusAccepted},
+	{"insert-webhook-all-events", "POST", "/webhooks", `{"url": "https://example.com/hook", "secret": "s3cret"}`, http.StatusAccepted},
+	{"insert-webhook-unknown-event", "POST", "/webhooks", `{"url": "https://example.com/hook", "events": ["todo.eaten"]}`, http.StatusBadRequest},
+	{"insert-webhook-relative-url", "POST", "/webhooks", `{"url": "/hook"}`, http.StatusBadRequest},
+	{"insert-webhook-invalid-scheme", "POST", "/webhooks", `{"url": "ftp://example.com/hook"}`, http.StatusBadRequest},
+	{"insert-webhook-localhost", "POST", "/webhooks", `{"url": "http://localhost:8080/hook"}`, http.StatusBadRequest},
+	{"insert-webhook-metadata-address", "POST", "/webhooks", `{"url": "http://169.254.169.254/latest/meta-data"}`, http.StatusBadRequest},
+	{"update-webhook", "PUT", "/webhooks/1", `{"url": "https://example.com/hook", "active": false}`, http.StatusAccepted},
+	{"update-webhook-not-found", "PUT", "/webhooks/2", `{"url": "https://example.com/hook"}`, http.StatusNotFound},
+	{"delete-webhook", "DELETE", "/webhooks/1", "", http.StatusAccepted},
+	{"delete-webhook-not-found", "DELETE", "/webhooks/2", "", http.StatusNotFound},
+	{"webhook-deliveries", "GET", "/webhooks/1/deliveries", "", http.StatusOK},
+	{"webhook-deliveries-not-found", "GET", "/webhooks/2/deliveries", "", http.StatusNotFound},
+	{"test-webhook", "POST", "/webhooks/1/test", "", http.StatusOK},
+	{"test-webhook-not-found", "POST", "/webhooks/2/test", "", http.StatusNotFound},
+}
+
+func TestRepository_Webhooks(t *testing.T) {
+	routes := getRoutes()
+
+	token, err := app.Auth.GenerateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range theWebhookTests {
+		req, _ := http.NewRequest(e.method, e.url, strings.NewReader(e.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+var theBatchTests = []struct {
+	name               string
+	url                string
+	body               string
+	expectedStatusCode int
+	expectedStatuses   []int
+}{
+	{"batch", "/todos/batch", `[
+		{"op": "create", "todo": {"name": "batched"}},
+		{"op": "update", "id": 1, "version": 1, "todo": {"name": "renamed"}, "fields": ["name"]},
+		{"op": "complete", "id": 1},
+		{"op": "delete", "id": 1}
+	]`, http.StatusMultiStatus, []int{http.StatusCreated, http.StatusOK, http.StatusOK, http.StatusOK}},
+	{"batch-atomic-failure", "/todos/batch", `[
+		{"op": "create", "todo": {"name": "batched"}},
+		{"op": "delete", "id": 1, "version": 2},
+		{"op": "complete", "id": 1, "completed": false}
+	]`, http.StatusMultiStatus, []int{http.StatusFailedDependency, http.StatusPreconditionFailed, http.StatusFailedDependency}},
+	{"batch-not-atomic", "/todos/batch?atomic=false", `[
+		{"op": "create", "todo": {"name": "batched"}},
+		{"op": "create", "todo": {"name": ""}},
+		{"op": "complete", "id": 2}
+	]`, http.StatusMultiStatus, []int{http.StatusCreated, http.StatusBadRequest, http.StatusBadRequest}},
+	{"batch-empty", "/todos/batch", `[]`, http.StatusBadRequest, nil},
+	{"batch-unknown-op", "/todos/batch", `[{"op": "archive", "id": 1}]`, http.StatusBadRequest, nil},
+	{"batch-missing-id", "/todos/batch", `[{"op": "delete"}]`, http.StatusBadRequest, nil},
+	{"batch-missing-todo", "/todos/batch", `[{"op": "update", "id": 1}]`, http.StatusBadRequest, nil},
+	{"batch-unknown-field", "/todos/batch", `[{"op": "update", "id": 1, "todo": {}, "fields": ["owner"]}]`, http.StatusBadRequest, nil},
+	{"batch-invalid-atomic", "/todos/batch?atomic=maybe", `[{"op": "delete", "id": 1}]`, http.StatusBadRequest, nil},
+	{"batch-not-an-array", "/todos/batch", `{"op": "delete", "id": 1}`, http.StatusBadRequest, nil},
+}
+
+func TestRepository_TodoBatch(t *testing.T) {
+	routes := getRoutes()
+
+	token, err := app.Auth.GenerateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range theBatchTests {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(e.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+			continue
+		}
+		if e.expectedStatuses == nil {
+			continue
+		}
+
+		var response struct {
+			Data []struct {
+				Status int `json:"status"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		var statuses []int
+		for _, result := range response.Data {
+			statuses = append(statuses, result.Status)
+		}
+		if !slices.Equal(statuses, e.expectedStatuses) {
+			t.Errorf("%s returned wrong operation statuses: got %v, wanted %v", e.name, statuses, e.expectedStatuses)
+		}
+	}
+}
+
+func TestRepository_TodoEvents(t *testing.T) {
+	srv := httptest.NewServer(getRoutes())
+	defer srv.Close()
+
+	token, err := app.Auth.GenerateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an invalid Last-Event-ID is rejected
+	req, _ := http.NewRequest("GET", "/todos/events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Last-Event-ID", "abc")
+	rr := httptest.NewRecorder()
+	getRoutes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid Last-Event-ID returned wrong response code: got %d, wanted %d", rr.Code, http.StatusBadRequest)
+	}
+
+	seen := Repo.Events.Publish(events.Event{UserID: 1, Type: events.Updated, Todo: json.RawMessage(`{"id":1}`)})
+	missed := Repo.Events.Publish(events.Event{UserID: 1, Type: events.Created, Todo: json.RawMessage(`{"id":1}`)})
+	Repo.Events.Publish(events.Event{UserID: 3, Type: events.Created, Todo: json.RawMessage(`{"id":3}`)})
+
+	// resume after the seen event
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, "GET", srv.URL+"/todos/events", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Last-Event-ID", fmt.Sprint(seen.ID))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("wrong response code: got %d, wanted %d", resp.StatusCode, http.StatusOK)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("wrong content type: got %s", contentType)
+	}
+
+	// the subscription exists once the missed events are sent
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	expected := fmt.Sprintf("id: %d\nevent: created\ndata: {\"id\":1}\n", missed.ID)
+	if event := readEvent(); event != expected {
+		t.Errorf("wrong missed event: got %q, wanted %q", event, expected)
+	}
+
+	Repo.Events.Publish(events.Event{UserID: 3, Type: events.Deleted, Todo: json.RawMessage(`{"id":3}`)})
+	live := Repo.Events.Publish(events.Event{UserID: 1, Type: events.Completed, Todo: json.RawMessage(`{"id":1}`)})
+	expected = fmt.Sprintf("id: %d\nevent: completed\ndata: {\"id\":1}\n", live.ID)
+	if event := readEvent(); event != expected {
+		t.Errorf("wrong live event: got %q, wanted %q", event, expected)
+	}
+}
+
+var theTodoEventsTokenTests = []struct {
+	name               string
+	header             string
+	query              string
+	expectedStatusCode int
+}{
+	{name: "header", header: "Bearer valid", expectedStatusCode: http.StatusOK},
+	{name: "query", query: "?token=valid", expectedStatusCode: http.StatusOK},
+	{name: "invalid query", query: "?token=abc", expectedStatusCode: http.StatusUnauthorized},
+	{name: "header before query", header: "Bearer abc", query: "?token=valid", expectedStatusCode: http.StatusUnauthorized},
+	{name: "no token", expectedStatusCode: http.StatusUnauthorized},
+}
+
+func TestRepository_TodoEventsToken(t *testing.T) {
+	token, err := app.Auth.GenerateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range theTodoEventsTokenTests {
+		// a cancelled request returns as soon as the stream is open
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", "/todos/events"+strings.ReplaceAll(e.query, "valid", token), nil)
+		if e.header != "" {
+			req.Header.Set("Authorization", strings.ReplaceAll(e.header, "valid", token))
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.TodoEvents).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+// dialGraphQLWS connects to the GraphQL subscriptions of the test server
+func dialGraphQLWS(t *testing.T, srv *httptest.Server) *websocket.Conn {
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(srv.URL, "http")+"/graphql/ws", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Protocol = []string{graphqlWSProtocol}
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = ws.SetDeadline(time.Now().Add(5 * time.Second))
+	return ws
+}
+
+func TestRepository_GraphQLWS(t *testing.T) {
+	srv := httptest.NewServer(getRoutes())
+	defer srv.Close()
+
+	token, err := app.Auth.GenerateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the subprotocol is required
+	config, _ := websocket.NewConfig("ws"+strings.TrimPrefix(srv.URL, "http")+"/graphql/ws", srv.URL)
+	if _, err := websocket.DialConfig(config); err == nil {
+		t.Error("connected without the subprotocol")
+	}
+
+	// subscribing before connection_init closes the connection
+	ws := dialGraphQLWS(t, srv)
+	_ = websocket.JSON.Send(ws, wsMessage{ID: "1", Type: wsSubscribe, Payload: json.RawMessage(`{"query":"subscription { todoCreated { id } }"}`)})
+	var msg wsMessage
+	if err := websocket.JSON.Receive(ws, &msg); err == nil {
+		t.Errorf("subscribed before connection_init, got %s", msg.Type)
+	}
+	ws.Close()
+
+	// a wrong token is rejected
+	ws = dialGraphQLWS(t, srv)
+	_ = websocket.JSON.Send(ws, wsMessage{Type: wsConnectionInit, Payload: json.RawMessage(`{"Authorization":"Bearer wrong"}`)})
+	if err := websocket.JSON.Receive(ws, &msg); err == nil {
+		t.Errorf("connected with a wrong token, got %s", msg.Type)
+	}
+	ws.Close()
+
+	ws = dialGraphQLWS(t, srv)
+	defer ws.Close()
+
+	_ = websocket.JSON.Send(ws, wsMessage{Type: wsConnectionInit, Payload: json.RawMessage(`{"Authorization":"Bearer ` + token + `"}`)})
+	if err := websocket.JSON.Receive(ws, &msg); err != nil || msg.Type != wsConnectionAck {
+		t.Fatalf("connection was not acknowledged: got %s, %v", msg.Type, err)
+	}
+
+	_ = websocket.JSON.Send(ws, wsMessage{Type: wsPing})
+	if err := websocket.JSON.Receive(ws, &msg); err != nil || msg.Type != wsPong {
+		t.Fatalf("ping was not answered: got %s, %v", msg.Type, err)
+	}
+
+	// an invalid subscription fails with an error message
+	_ = websocket.JSON.Send(ws, wsMessage{ID: "invalid", Type: wsSubscribe, Payload: json.RawMessage(`{"query":"subscription { todoRenamed { id } }"}`)})
+	if err := websocket.JSON.Receive(ws, &msg); err != nil || msg.Type != wsError || msg.ID != "invalid" {
+		t.Fatalf("invalid subscription did not fail: got %s %s, %v", msg.Type, msg.ID, err)
+	}
+
+	query := `{"query":"subscription { todoCompleted(id: 1) { id name completed } }"}`
+	_ = websocket.JSON.Send(ws, wsMessage{ID: "completed", Type: wsSubscribe, Payload: json.RawMessage(query)})
+
+	// the subscription starts in the background, so publish until it gets an event
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			// only the completed todo 1 of the user matches
+			Repo.Events.Publish(events.Event{UserID: 1, Type: events.Updated, Todo: json.RawMessage(`{"id":1,"name":"updated"}`)})
+			Repo.Events.Publish(events.Event{UserID: 1, Type: events.Completed, Todo: json.RawMessage(`{"id":5,"name":"other"}`)})
+			Repo.Events.Publish(events.Event{UserID: 3, Type: events.Completed, Todo: json.RawMessage(`{"id":1,"name":"another user"}`)})
+			Repo.Events.Publish(events.Event{UserID: 1, Type: events.Completed, Todo: json.RawMessage(`{"id":1,"name":"completed","completed":true}`)})
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	if err := websocket.JSON.Receive(ws, &msg); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"data":{"todoCompleted":{"completed":true,"id":1,"name":"completed"}}}`
+	if msg.Type != wsNext || msg.ID != "completed" || string(msg.Payload) != expected {
+		t.Errorf("wrong message: got %s %s %s, wanted next completed %s", msg.Type, msg.ID, msg.Payload, expected)
+	}
+
+	// subscribing twice with the same id closes the connection
+	_ = websocket.JSON.Send(ws, wsMessage{ID: "completed", Type: wsSubscribe, Payload: json.RawMessage(query)})
+	for {
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			break
+		}
+		if msg.Type != wsNext {
+			t.Fatalf("got %s after a duplicate subscription", msg.Type)
+		}
+	}
+}
+
+// recordingConn keeps everything read from the connection
+type recordingConn struct {
+	net.Conn
+	read bytes.Buffer
+}
+
+func (c *recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Write(b[:n])
+	return n, err
+}
+
+func TestRepository_GraphQLWSCloseFrame(t *testing.T) {
+	srv := httptest.NewServer(getRoutes())
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	rec := &recordingConn{Conn: conn}
+
+	config, _ := websocket.NewConfig("ws"+strings.TrimPrefix(srv.URL, "http")+"/graphql/ws", srv.URL)
+	config.Protocol = []string{graphqlWSProtocol}
+	ws, err := websocket.NewClient(config, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// subscribing before connection_init closes the connection, read until the server is done
+	_ = websocket.JSON.Send(ws, wsMessage{ID: "1", Type: wsSubscribe, Payload: json.RawMessage(`{"query":"subscription { todoCreated { id } }"}`)})
+	var msg wsMessage
+	_ = websocket.JSON.Receive(ws, &msg)
+	_, _ = io.Copy(io.Discard, rec)
+
+	// the frames of the server follow the handshake, they are short and not masked
+	frames := rec.read.Bytes()
+	frames = frames[bytes.Index(frames, []byte("\r\n\r\n"))+4:]
+	var closes [][]byte
+	for len(frames) >= 2 && len(frames) >= 2+int(frames[1]&0x7f) {
+		opcode, length := frames[0]&0x0f, int(frames[1]&0x7f)
+		if opcode == websocket.CloseFrame {
+			closes = append(closes, frames[2:2+length])
+		}
+		frames = frames[2+length:]
+	}
+	if len(closes) != 1 || len(closes[0]) < 2 || binary.BigEndian.Uint16(closes[0]) != wsCloseUnauthorized {
+		t.Errorf("wrong close frames: got %q, wanted a single one with %d", closes, wsCloseUnauthorized)
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TodoHistory returns the changes of a todo oldest first, including those of a trashed todo
+func (m *Repository) TodoHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	todoID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	history, err := m.DB.SelectTodoHistory(r.Context(), userID, todoID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = m.App.ErrorJSON(w, errors.New("todo not found"), http.StatusNotFound)
+			return
+		}
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	_ = m.App.WriteJSON(w, http.StatusOK, history)
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/anras5/todo-app-backend/internal/config"
+	"github.com/anras5/todo-app-backend/internal/jsonpatch"
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// requiredTodoFields cannot be removed from a todo by a patch
+var requiredTodoFields = []string{"name", "deadline", "completed"}
+
+// PatchTodo changes the fields of a todo present in a JSON Merge Patch (RFC 7396), or
+// touched by a JSON Patch (RFC 6902) when sent as application/json-patch+json.
+// The other fields are left as they are.
+func (m *Repository) PatchTodo(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	todoID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	version, err := readIfMatch(r)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	patchType := mergePatchType
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		patchType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			_ = m.App.ErrorJSON(w, err, http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+	if patchType == "application/json" {
+		patchType = mergePatchType
+	}
+	if patchType != mergePatchType && patchType != jsonPatchType {
+		err = fmt.Errorf("patch should be sent as %s or %s", mergePatchType, jsonPatchType)
+		_ = m.App.ErrorJSON(w, err, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1024*1024))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	// the todo is read, patched and updated in one transaction, so that it cannot change in between
+	var todo *models.Todo
+	err = m.audited(r).WithTx(r.Context(), func(db repository.DatabaseRepo) error {
+		var err error
+		todo, err = db.SelectTodo(r.Context(), userID, todoID)
+		if err != nil {
+			return err
+		}
+		// without If-Match the update still only succeeds on the version the patch was applied to
+		expected := version
+		if expected == 0 {
+			expected = todo.Version
+		}
+
+		patched, fields, err := applyTodoPatch(todo, patchType, patch)
+		if err != nil || len(fields) == 0 {
+			return err
+		}
+
+		patched.ID = todoID
+		patched.UserID = userID
+		patched.Version = expected
+		if err = db.UpdateTodo(r.Context(), *patched, fields...); err != nil {
+			return err
+		}
+		todo, err = db.SelectTodo(r.Context(), userID, todoID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			_ = m.App.ErrorJSON(w, err, http.StatusConflict)
+			return
+		}
+		m.todoWriteError(w, err)
+		return
+	}
+
+	response := config.JSONResponse{
+		Error:   false,
+		Message: "todo updated",
+		Data:    todo,
+	}
+	headers := http.Header{}
+	headers.Set("ETag", etag(todo.Version))
+	_ = m.App.WriteJSON(w, http.StatusAccepted, response, headers)
+}
+
+// applyTodoPatch applies the patch to the JSON representation of the todo and returns
+// the patched todo together with the fields the patch changes
+func applyTodoPatch(todo *models.Todo, patchType string, patch []byte) (*models.Todo, []string, error) {
+	// patches can add to the tags of a todo without any
+	base := *todo
+	if base.Tags == nil {
+		base.Tags = []string{}
+	}
+	doc, err := json.Marshal(base)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var fields []string
+	if patchType == jsonPatchType {
+		ops, err := jsonpatch.ParsePatch(patch)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, op := range ops {
+			fields = append(fields, op.Fields()...)
+		}
+		if doc, err = jsonpatch.Apply(doc, ops); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(patch, &members); err != nil {
+			return nil, nil, fmt.Errorf("%w: merge patch should be a JSON object", jsonpatch.ErrInvalidPatch)
+		}
+		for field := range members {
+			fields = append(fields, field)
+		}
+		if doc, err = jsonpatch.MergePatch(doc, patch); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	mask, err := models.NewTodoFieldMask(fields...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &members); err != nil {
+		return nil, nil, fmt.Errorf("%w: the todo should stay a JSON object", jsonpatch.ErrInvalidPatch)
+	}
+	for _, field := range requiredTodoFields {
+		if value, ok := members[field]; mask[field] && (!ok || string(value) == "null") {
+			return nil, nil, fmt.Errorf("%s cannot be removed", field)
+		}
+	}
+
+	var patched models.Todo
+	if err := json.Unmarshal(doc, &patched); err != nil {
+		return nil, nil, err
+	}
+	return &patched, mask.Fields(), nil
+}
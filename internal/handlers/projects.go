@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/anras5/todo-app-backend/internal/config"
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// projectError writes err as a response, using 404 if the project does not exist
+func (m *Repository) projectError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, repository.ErrProjectNotFound) {
+		_ = m.App.ErrorJSON(w, repository.ErrProjectNotFound, http.StatusNotFound)
+		return
+	}
+	_ = m.App.ErrorJSON(w, err)
+}
+
+func (m *Repository) AllProjects(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	projects, err := m.DB.SelectProjects(r.Context(), userID)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	_ = m.App.WriteJSON(w, http.StatusOK, projects)
+}
+
+func (m *Repository) OneProject(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	projectID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	project, err := m.DB.SelectProject(r.Context(), userID, projectID)
+	if err != nil {
+		m.projectError(w, err)
+		return
+	}
+	_ = m.App.WriteJSON(w, http.StatusOK, project)
+}
+
+func (m *Repository) ProjectTodos(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	projectID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	var todos []*models.Todo
+	err = m.DB.WithIsolation(sql.LevelRepeatableRead).WithTx(r.Context(), func(db repository.DatabaseRepo) error {
+		// make sure the project exists, so that an unknown project is not reported as an empty one
+		if _, err := db.SelectProject(r.Context(), userID, projectID); err != nil {
+			return err
+		}
+		var err error
+		todos, err = db.SelectProjectTodos(r.Context(), userID, projectID)
+		return err
+	})
+	if err != nil {
+		m.projectError(w, err)
+		return
+	}
+	_ = m.App.WriteJSON(w, http.StatusOK, todos)
+}
+
+func (m *Repository) InsertProject(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	var project models.Project
+
+	err := m.App.ReadJSON(w, r, &project)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+	if project.Name == "" {
+		_ = m.App.ErrorJSON(w, errors.New("project name should not be empty"))
+		return
+	}
+
+	project.UserID = userID
+	id, err := m.DB.InsertProject(r.Context(), project)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	response := config.JSONResponse{
+		Error:   false,
+		Message: "project inserted",
+		Data:    id,
+	}
+	_ = m.App.WriteJSON(w, http.StatusAccepted, response)
+}
+
+func (m *Repository) UpdateProject(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	projectID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	var project models.Project
+
+	err = m.App.ReadJSON(w, r, &project)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+	if project.Name == "" {
+		_ = m.App.ErrorJSON(w, errors.New("project name should not be empty"))
+		return
+	}
+
+	project.ID = projectID
+	project.UserID = userID
+	err = m.DB.UpdateProject(r.Context(), project)
+	if err != nil {
+		m.projectError(w, err)
+		return
+	}
+
+	response := config.JSONResponse{
+		Error:   false,
+		Message: "project updated",
+	}
+	_ = m.App.WriteJSON(w, http.StatusAccepted, response)
+}
+
+// DeleteProject deletes a project. Its todos are kept without a project unless
+// ?todos=delete moves them to the trash, or they are moved to another project with ?reassign_to={id}.
+func (m *Repository) DeleteProject(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	projectID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	var deletion models.ProjectDeletion
+	switch r.URL.Query().Get("todos") {
+	case "", "keep":
+	case "delete":
+		deletion.DeleteTodos = true
+	default:
+		_ = m.App.ErrorJSON(w, errors.New("todos should be 'keep' or 'delete'"))
+		return
+	}
+	if reassignTo := r.URL.Query().Get("reassign_to"); reassignTo != "" {
+		if deletion.DeleteTodos {
+			_ = m.App.ErrorJSON(w, errors.New("cannot both delete and reassign todos"))
+			return
+		}
+		id, err := strconv.Atoi(reassignTo)
+		if err != nil {
+			_ = m.App.ErrorJSON(w, errors.New("reassign_to should be a project id"))
+			return
+		}
+		deletion.ReassignTo = &id
+	}
+
+	err = m.audited(r).DeleteProject(r.Context(), userID, projectID, deletion)
+	if err != nil {
+		m.projectError(w, err)
+		return
+	}
+
+	response := config.JSONResponse{
+		Error:   false,
+		Message: "project deleted",
+	}
+	_ = m.App.WriteJSON(w, http.StatusAccepted, response)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"github.com/anras5/todo-app-backend/internal/auth"
 	"github.com/anras5/todo-app-backend/internal/config"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -8,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"testing"
+	"time"
 )
 
 var app config.Application
@@ -21,6 +23,14 @@ func TestMain(m *testing.M) {
 	errorLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 	app.ErrorLog = errorLog
 
+	// -------------------------------------------------------------------------------------------- //
+	// Set up authentication
+	app.Auth = &auth.Auth{
+		Secret:   []byte("test-secret"),
+		Issuer:   "todo-app-backend-test",
+		TokenTTL: time.Hour,
+	}
+
 	// -------------------------------------------------------------------------------------------- //
 	// set repo and handlers
 	repo := NewTestRepo(&app)
@@ -35,14 +45,65 @@ func getRoutes() http.Handler {
 	mux.Use(middleware.RequestID)
 	mux.Use(middleware.Logger)
 	mux.Use(middleware.Recoverer)
+	mux.Use(testAuthenticate)
 
 	mux.Get("/", Repo.Home)
+	mux.Post("/signup", Repo.Signup)
+	mux.Post("/login", Repo.Login)
+	mux.Get("/graphql/ws", Repo.GraphQLWS)
+
 	mux.Get("/todos", Repo.AllTodos)
 	mux.Post("/todos", Repo.InsertTodo)
+	mux.Get("/todos/search", Repo.SearchTodos)
+	mux.Get("/todos/events", Repo.TodoEvents)
+	mux.Post("/todos/batch", Repo.TodoBatch)
 	mux.Get("/todos/{id}", Repo.OneTodo)
+	mux.Get("/todos/{id}/children", Repo.ChildTodos)
+	mux.Get("/todos/{id}/history", Repo.TodoHistory)
 	mux.Put("/todos/{id}", Repo.UpdateTodo)
+	mux.Patch("/todos/{id}", Repo.PatchTodo)
 	mux.Put("/todos/{id}/{complete}", Repo.UpdateTodoCompleted)
 	mux.Delete("/todos/{id}", Repo.DeleteTodo)
+	mux.Post("/todos/{id}/tags", Repo.AddTodoTags)
+	mux.Delete("/todos/{id}/tags/{tag}", Repo.RemoveTodoTag)
+	mux.Post("/todos/{id}/restore", Repo.RestoreTodo)
+
+	mux.Post("/undo", Repo.Undo)
+	mux.Post("/redo", Repo.Redo)
+
+	mux.Get("/trash", Repo.Trash)
+	mux.Delete("/trash/{id}", Repo.PurgeTodo)
+
+	mux.Get("/webhooks", Repo.AllWebhooks)
+	mux.Post("/webhooks", Repo.InsertWebhook)
+	mux.Get("/webhooks/{id}", Repo.OneWebhook)
+	mux.Put("/webhooks/{id}", Repo.UpdateWebhook)
+	mux.Delete("/webhooks/{id}", Repo.DeleteWebhook)
+	mux.Get("/webhooks/{id}/deliveries", Repo.WebhookDeliveries)
+	mux.Post("/webhooks/{id}/test", Repo.TestWebhook)
+
+	mux.Get("/projects", Repo.AllProjects)
+	mux.Post("/projects", Repo.InsertProject)
+	mux.Get("/projects/{id}", Repo.OneProject)
+	mux.Put("/projects/{id}", Repo.UpdateProject)
+	mux.Delete("/projects/{id}", Repo.DeleteProject)
+	mux.Get("/projects/{id}/todos", Repo.ProjectTodos)
 
 	return mux
 }
+
+// testAuthenticate authenticates requests carrying a valid token as the user from the token
+func testAuthenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := app.Auth.ParseAuthorizationHeader(r.Header.Get("Authorization"))
+		if err == nil {
+			r = r.WithContext(auth.WithUserID(r.Context(), userID))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withTestUser returns a copy of the request authenticated as the test user
+func withTestUser(r *http.Request) *http.Request {
+	return r.WithContext(auth.WithUserID(r.Context(), 1))
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/anras5/todo-app-backend/internal/config"
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// tagError writes err as a response, using 404 if the todo or its tag does not exist
+func (m *Repository) tagError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = m.App.ErrorJSON(w, err, http.StatusNotFound)
+		return
+	}
+	_ = m.App.ErrorJSON(w, err)
+}
+
+func (m *Repository) AddTodoTags(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	todoID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	var payload struct {
+		Tags []string `json:"tags"`
+	}
+	err = m.App.ReadJSON(w, r, &payload)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	tags := models.NormalizeTags(payload.Tags)
+	if len(tags) == 0 {
+		_ = m.App.ErrorJSON(w, errors.New("tags are required"))
+		return
+	}
+
+	err = m.audited(r).AddTodoTags(r.Context(), userID, todoID, tags)
+	if err != nil {
+		m.tagError(w, err)
+		return
+	}
+
+	response := config.JSONResponse{
+		Error:   false,
+		Message: "tags added",
+		Data:    tags,
+	}
+	_ = m.App.WriteJSON(w, http.StatusAccepted, response)
+}
+
+func (m *Repository) RemoveTodoTag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	todoID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	err = m.audited(r).RemoveTodoTag(r.Context(), userID, todoID, chi.URLParam(r, "tag"))
+	if err != nil {
+		m.tagError(w, err)
+		return
+	}
+
+	response := config.JSONResponse{
+		Error:   false,
+		Message: "tag removed",
+	}
+	_ = m.App.WriteJSON(w, http.StatusAccepted, response)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/anras5/todo-app-backend/internal/config"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// trashError writes err as a response, using 404 if the todo is not in the trash
+// and 409 if it cannot be restored because its parent is
+func (m *Repository) trashError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		_ = m.App.ErrorJSON(w, errors.New("todo not found in the trash"), http.StatusNotFound)
+	case errors.Is(err, repository.ErrParentNotFound):
+		_ = m.App.ErrorJSON(w, errors.New("parent todo is in the trash, restore it first"), http.StatusConflict)
+	default:
+		_ = m.App.ErrorJSON(w, err)
+	}
+}
+
+func (m *Repository) Trash(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	todos, err := m.DB.SelectTrash(r.Context(), userID)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	_ = m.App.WriteJSON(w, http.StatusOK, todos)
+}
+
+func (m *Repository) RestoreTodo(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	todoID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	err = m.audited(r).RestoreTodo(r.Context(), userID, todoID)
+	if err != nil {
+		m.trashError(w, err)
+		return
+	}
+
+	response := config.JSONResponse{
+		Error:   false,
+		Message: "todo restored",
+	}
+	m.App.WriteJSON(w, http.StatusAccepted, response)
+}
+
+func (m *Repository) PurgeTodo(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	todoID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	err = m.DB.PurgeTodo(r.Context(), userID, todoID)
+	if err != nil {
+		m.trashError(w, err)
+		return
+	}
+
+	response := config.JSONResponse{
+		Error:   false,
+		Message: "todo deleted permanently",
+	}
+	m.App.WriteJSON(w, http.StatusAccepted, response)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/anras5/todo-app-backend/internal/config"
+	"github.com/anras5/todo-app-backend/internal/repository"
+)
+
+// readUndoCount reads the count query param, how many operations to undo or redo, 1 if it is not set
+func readUndoCount(r *http.Request) (int, error) {
+	count := 1
+	if c := r.URL.Query().Get("count"); c != "" {
+		var err error
+		count, err = strconv.Atoi(c)
+		if err != nil || count < 1 || count > repository.MaxUndoCount {
+			return 0, fmt.Errorf("count should be a number between 1 and %d", repository.MaxUndoCount)
+		}
+	}
+	return count, nil
+}
+
+// Undo reverts the last operations of the user, see replayOperations
+func (m *Repository) Undo(w http.ResponseWriter, r *http.Request) {
+	m.replayOperations(w, r, repository.DatabaseRepo.UndoOperations, "undo", "undone")
+}
+
+// Redo reapplies the last undone operations of the user, see replayOperations
+func (m *Repository) Redo(w http.ResponseWriter, r *http.Request) {
+	m.replayOperations(w, r, repository.DatabaseRepo.RedoOperations, "redo", "redone")
+}
+
+// replayOperations undoes or redoes the number of operations given by the count query param.
+// It responds with 409 if there is nothing to replay or if a todo of the operations has been
+// changed by someone else since, in which case none of them is replayed.
+func (m *Repository) replayOperations(w http.ResponseWriter, r *http.Request,
+	replay func(db repository.DatabaseRepo, ctx context.Context, userID int, count int) (int, error), verb string, done string) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := readUndoCount(r)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	replayed, err := replay(m.audited(r), r.Context(), userID, count)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrUndoConflict),
+			errors.Is(err, repository.ErrProjectNotFound),
+			errors.Is(err, repository.ErrParentNotFound),
+			errors.Is(err, repository.ErrTodoCycle):
+			_ = m.App.ErrorJSON(w, err, http.StatusConflict)
+		default:
+			_ = m.App.ErrorJSON(w, err)
+		}
+		return
+	}
+	if replayed == 0 {
+		_ = m.App.ErrorJSON(w, fmt.Errorf("nothing to %s", verb), http.StatusConflict)
+		return
+	}
+
+	response := config.JSONResponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d operations %s", replayed, done),
+		Data:    replayed,
+	}
+	m.App.WriteJSON(w, http.StatusAccepted, response)
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/config"
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/anras5/todo-app-backend/internal/webhook"
+	"github.com/go-chi/chi/v5"
+)
+
+// webhookError writes err as a response, using 404 if the webhook does not exist
+func (m *Repository) webhookError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = m.App.ErrorJSON(w, errors.New("webhook not found"), http.StatusNotFound)
+		return
+	}
+	_ = m.App.ErrorJSON(w, err)
+}
+
+// webhookRequest is the body of a request creating or updating a webhook
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// readWebhook reads and validates a webhook from the body of the request. A webhook without
+// events gets all of them and a webhook without active set is active.
+func (m *Repository) readWebhook(w http.ResponseWriter, r *http.Request) (models.Webhook, error) {
+	var req webhookRequest
+	if err := m.App.ReadJSON(w, r, &req); err != nil {
+		return models.Webhook{}, err
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return models.Webhook{}, errors.New("url should be an absolute http or https URL")
+	}
+	if err := webhook.CheckHost(u.Hostname()); err != nil {
+		return models.Webhook{}, err
+	}
+
+	events := []string{}
+	for _, event := range req.Events {
+		if !slices.Contains(models.WebhookEvents, event) {
+			return models.Webhook{}, fmt.Errorf("unknown event %q", event)
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		events = models.WebhookEvents
+	}
+
+	return models.Webhook{
+		URL:    req.URL,
+		Secret: req.Secret,
+		Events: events,
+		Active: req.Active == nil || *req.Active,
+	}, nil
+}
+
+func (m *Repository) AllWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	webhooks, err := m.DB.SelectWebhooks(r.Context(), userID)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	_ = m.App.WriteJSON(w, http.StatusOK, webhooks)
+}
+
+func (m *Repository) OneWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	webhookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	hook, err := m.DB.SelectWebhook(r.Context(), userID, webhookID)
+	if err != nil {
+		m.webhookError(w, err)
+		return
+	}
+	_ = m.App.WriteJSON(w, http.StatusOK, hook)
+}
+
+// InsertWebhook creates a webhook and responds with its id and secret, which is generated
+// if the request has none. The secret is not sent back later.
+func (m *Repository) InsertWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	hook, err := m.readWebhook(w, r)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+	if hook.Secret == "" {
+		hook.Secret, err = webhook.NewSecret()
+		if err != nil {
+			_ = m.App.ErrorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	hook.UserID = userID
+	id, err := m.DB.InsertWebhook(r.Context(), hook)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	response := config.JSONResponse{
+		Error:   false,
+		Message: "webhook inserted",
+		Data: struct {
+			ID     int    `json:"id"`
+			Secret string `json:"secret"`
+		}{id, hook.Secret},
+	}
+	_ = m.App.WriteJSON(w, http.StatusAccepted, response)
+}
+
+// UpdateWebhook replaces a webhook, its secret is only changed if the request has one
+func (m *Repository) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	webhookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	hook, err := m.readWebhook(w, r)
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	hook.ID = webhookID
+	hook.UserID = userID
+	err = m.DB.UpdateWebhook(r.Context(), hook)
+	if err != nil {
+		m.webhookError(w, err)
+		return
+	}
+
+	response := config.JSONResponse{
+		Error:   false,
+		Message: "webhook updated",
+	}
+	_ = m.App.WriteJSON(w, http.StatusAccepted, response)
+}
+
+func (m *Repository) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	webhookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	err = m.DB.DeleteWebhook(r.Context(), userID, webhookID)
+	if err != nil {
+		m.webhookError(w, err)
+		return
+	}
+
+	response := config.JSONResponse{
+		Error:   false,
+		Message: "webhook deleted",
+	}
+	_ = m.App.WriteJSON(w, http.StatusAccepted, response)
+}
+
+// WebhookDeliveries returns the delivery log of a webhook, newest first
+func (m *Repository) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	webhookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	deliveries, err := m.DB.SelectWebhookDeliveries(r.Context(), userID, webhookID)
+	if err != nil {
+		m.webhookError(w, err)
+		return
+	}
+	_ = m.App.WriteJSON(w, http.StatusOK, deliveries)
+}
+
+// TestWebhook sends a webhook.test event with a sample todo to a webhook right away and
+// responds with the delivery. A failed delivery is retried like any other.
+func (m *Repository) TestWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.userID(w, r)
+	if !ok {
+		return
+	}
+
+	webhookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	now := time.Now()
+	todo, err := json.Marshal(models.Todo{
+		Name:        "Sample todo",
+		Description: "Sent by the webhook test endpoint",
+		Deadline:    now.Add(24 * time.Hour),
+		Tags:        []string{},
+	})
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	payload, err := json.Marshal(models.WebhookEvent{
+		Event:     models.EventWebhookTest,
+		CreatedAt: now,
+		Todo:      todo,
+	})
+	if err != nil {
+		_ = m.App.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	delivery := models.WebhookDelivery{
+		Event:     models.EventWebhookTest,
+		Payload:   payload,
+		Status:    models.DeliveryPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	// the delivery is only logged if the webhook still exists
+	err = m.DB.WithTx(r.Context(), func(db repository.DatabaseRepo) error {
+		hook, err := db.SelectWebhook(r.Context(), userID, webhookID)
+		if err != nil {
+			return err
+		}
+		delivery.WebhookID = hook.ID
+		delivery.URL = hook.URL
+		delivery.Secret = hook.Secret
+		delivery.ID, err = db.InsertWebhookDelivery(r.Context(), delivery)
+		return err
+	})
+	if err != nil {
+		m.webhookError(w, err)
+		return
+	}
+	if err = m.Webhooks.Deliver(r.Context(), &delivery); err != nil {
+		_ = m.App.ErrorJSON(w, err)
+		return
+	}
+
+	_ = m.App.WriteJSON(w, http.StatusOK, delivery)
+}
@@ -0,0 +1,128 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// equalJSON compares two JSON documents ignoring the order of object members
+func equalJSON(t *testing.T, a []byte, b string) bool {
+	var x, y any
+	if err := json.Unmarshal(a, &x); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(b), &y); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+var theMergePatchTests = []struct {
+	name     string
+	doc      string
+	patch    string
+	expected string
+}{
+	{"replace", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+	{"add", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+	{"remove", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+	{"array-replaced", `{"a":["b"]}`, `{"a":["c","d"]}`, `{"a":["c","d"]}`},
+	{"nested", `{"a":{"b":"c","d":"e"}}`, `{"a":{"d":null,"f":"g"}}`, `{"a":{"b":"c","f":"g"}}`},
+	{"object-into-value", `{"a":"b"}`, `{"a":{"c":null,"d":"e"}}`, `{"a":{"d":"e"}}`},
+	{"not-an-object", `{"a":"b"}`, `["c"]`, `["c"]`},
+}
+
+func TestMergePatch(t *testing.T) {
+	for _, e := range theMergePatchTests {
+		result, err := MergePatch([]byte(e.doc), []byte(e.patch))
+		if err != nil {
+			t.Errorf("%s returned an error: %v", e.name, err)
+			continue
+		}
+		if !equalJSON(t, result, e.expected) {
+			t.Errorf("%s returned wrong document: got %s, wanted %s", e.name, result, e.expected)
+		}
+	}
+
+	if _, err := MergePatch([]byte(`{}`), []byte(`{`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("invalid merge patch returned wrong error: got %v, wanted %v", err, ErrInvalidPatch)
+	}
+}
+
+var theApplyTests = []struct {
+	name        string
+	doc         string
+	patch       string
+	expected    string
+	expectedErr error
+}{
+	{"add-member", `{"a":"b"}`, `[{"op":"add","path":"/c","value":1}]`, `{"a":"b","c":1}`, nil},
+	{"add-array-index", `{"a":["b","d"]}`, `[{"op":"add","path":"/a/1","value":"c"}]`, `{"a":["b","c","d"]}`, nil},
+	{"add-array-end", `{"a":["b"]}`, `[{"op":"add","path":"/a/-","value":"c"}]`, `{"a":["b","c"]}`, nil},
+	{"add-null", `{"a":"b"}`, `[{"op":"add","path":"/a","value":null}]`, `{"a":null}`, nil},
+	{"remove-member", `{"a":"b","c":"d"}`, `[{"op":"remove","path":"/a"}]`, `{"c":"d"}`, nil},
+	{"remove-array-index", `{"a":["b","c","d"]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":["b","d"]}`, nil},
+	{"replace", `{"a":"b"}`, `[{"op":"replace","path":"/a","value":"c"}]`, `{"a":"c"}`, nil},
+	{"move", `{"a":{"b":"c"}}`, `[{"op":"move","from":"/a/b","path":"/d"}]`, `{"a":{},"d":"c"}`, nil},
+	{"copy", `{"a":["b"]}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/-","value":"d"}]`, `{"a":["b"],"c":["b","d"]}`, nil},
+	{"test", `{"a":[1,"b"]}`, `[{"op":"test","path":"/a","value":[1,"b"]}]`, `{"a":[1,"b"]}`, nil},
+	{"escaped-pointer", `{"a/b":1,"c~d":2}`, `[{"op":"remove","path":"/a~1b"},{"op":"remove","path":"/c~0d"}]`, `{}`, nil},
+	{"test-failed", `{"a":"b"}`, `[{"op":"test","path":"/a","value":"c"}]`, "", ErrTestFailed},
+	{"remove-missing", `{"a":"b"}`, `[{"op":"remove","path":"/c"}]`, "", ErrInvalidPatch},
+	{"replace-missing", `{"a":"b"}`, `[{"op":"replace","path":"/c","value":1}]`, "", ErrInvalidPatch},
+	{"add-missing-parent", `{"a":"b"}`, `[{"op":"add","path":"/c/d","value":1}]`, "", ErrInvalidPatch},
+	{"index-out-of-range", `{"a":["b"]}`, `[{"op":"add","path":"/a/2","value":1}]`, "", ErrInvalidPatch},
+	{"leading-zero-index", `{"a":["b","c"]}`, `[{"op":"remove","path":"/a/01"}]`, "", ErrInvalidPatch},
+	{"move-into-itself", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`, "", ErrInvalidPatch},
+	{"missing-value", `{"a":"b"}`, `[{"op":"add","path":"/a"}]`, "", ErrInvalidPatch},
+	{"bad-path", `{"a":"b"}`, `[{"op":"remove","path":"a"}]`, "", ErrInvalidPatch},
+	{"unknown-op", `{"a":"b"}`, `[{"op":"merge","path":"/a","value":1}]`, "", ErrInvalidPatch},
+}
+
+func TestApply(t *testing.T) {
+	for _, e := range theApplyTests {
+		ops, err := ParsePatch([]byte(e.patch))
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+
+		result, err := Apply([]byte(e.doc), ops)
+		if e.expectedErr != nil {
+			if !errors.Is(err, e.expectedErr) {
+				t.Errorf("%s returned wrong error: got %v, wanted %v", e.name, err, e.expectedErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s returned an error: %v", e.name, err)
+			continue
+		}
+		if !equalJSON(t, result, e.expected) {
+			t.Errorf("%s returned wrong document: got %s, wanted %s", e.name, result, e.expected)
+		}
+	}
+}
+
+func TestOperation_Fields(t *testing.T) {
+	ops, err := ParsePatch([]byte(`[
+		{"op":"replace","path":"/name","value":"a"},
+		{"op":"add","path":"/tags/-","value":"b"},
+		{"op":"test","path":"/completed","value":false},
+		{"op":"move","from":"/description","path":"/rrule"},
+		{"op":"copy","from":"/name","path":"/description"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields []string
+	for _, op := range ops {
+		fields = append(fields, op.Fields()...)
+	}
+	expected := []string{"name", "tags", "rrule", "description", "description"}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("wrong fields: got %v, wanted %v", fields, expected)
+	}
+}
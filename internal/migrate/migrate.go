@@ -0,0 +1,320 @@
+// Package migrate applies and rolls back versioned SQL migrations of a Postgres database. The applied
+// versions are recorded in the schema_migration table, the one the fizz migrations were tracked in,
+// so a database migrated before keeps its history.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// lockKey is the key of the advisory lock held while migrating, so that instances starting at the
+// same time apply every migration once
+const lockKey = 7_265_187_304_112
+
+// noVersion is the version before the first migration, migrating to it rolls back every migration
+const noVersion = "0"
+
+// baselineVersion is the first migration, the schema of a database created from the schema.sql
+// dump kept before there were migrations
+const baselineVersion = "20230406130116"
+
+// ErrUnknownVersion is returned when migrating to a version there is no migration for
+var ErrUnknownVersion = errors.New("unknown version")
+
+// ErrMissingMigration is returned when rolling back a version that is applied, but has no migration,
+// because it was applied by a newer build
+var ErrMissingMigration = errors.New("there is no migration to roll back version")
+
+// fileName matches the name of a migration file, <version>_<name>.up.sql or <version>_<name>.down.sql
+var fileName = regexp.MustCompile(`^(\d{14})_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a version of the schema with the statements to migrate to it and back
+type Migration struct {
+	Version string
+	Name    string
+	Up      string
+	Down    string
+}
+
+// String returns the version and the name, like the file names of the migration
+func (m Migration) String() string {
+	return m.Version + "_" + m.Name
+}
+
+// Status tells whether a version is applied. A version applied without a migration has no name.
+type Status struct {
+	Version string
+	Name    string
+	Applied bool
+}
+
+// Load reads the migrations in the root of fsys, oldest first. Every version needs both an up
+// and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[string]*Migration)
+	for _, file := range files {
+		match := fileName.FindStringSubmatch(file)
+		if match == nil {
+			return nil, fmt.Errorf("%s is not named <version>_<name>.up.sql or <version>_<name>.down.sql", file)
+		}
+		version, name, direction := match[1], match[2], match[3]
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("version %s is used by %s and %s", version, migration.Name, name)
+		}
+
+		stmts, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		if direction == "up" {
+			migration.Up = string(stmts)
+		} else {
+			migration.Down = string(stmts)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if strings.TrimSpace(migration.Up) == "" || strings.TrimSpace(migration.Down) == "" {
+			return nil, fmt.Errorf("%s needs both an up and a down file that are not empty", migration)
+		}
+		migrations = append(migrations, *migration)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return strings.Compare(a.Version, b.Version) })
+	return migrations, nil
+}
+
+// plan returns the migrations to apply, oldest first, and the ones to roll back, newest first, to
+// migrate from the applied versions to target. Migrations older than the target that were skipped
+// are applied as well.
+func plan(migrations []Migration, applied map[string]bool, target string) (up []Migration, down []Migration, err error) {
+	known := target == noVersion
+	for _, migration := range migrations {
+		if migration.Version == target {
+			known = true
+		}
+	}
+	if !known {
+		return nil, nil, fmt.Errorf("%w %s", ErrUnknownVersion, target)
+	}
+
+	for _, migration := range migrations {
+		if migration.Version <= target && !applied[migration.Version] {
+			up = append(up, migration)
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if migrations[i].Version > target && applied[migrations[i].Version] {
+			down = append(down, migrations[i])
+		}
+	}
+
+	// a version newer than the target without a migration cannot be rolled back
+	for version := range applied {
+		if version > target && !slices.ContainsFunc(migrations, func(m Migration) bool { return m.Version == version }) {
+			return nil, nil, fmt.Errorf("%w %s", ErrMissingMigration, version)
+		}
+	}
+	return up, down, nil
+}
+
+// Migrator migrates a Postgres database
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	log        *log.Logger
+}
+
+// New returns a Migrator applying the migrations in fsys, logging every migration it applies or rolls back
+func New(db *sql.DB, fsys fs.FS, log *log.Logger) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations, log: log}, nil
+}
+
+// Up applies every migration that is not applied yet
+func (m *Migrator) Up(ctx context.Context) error {
+	if len(m.migrations) == 0 {
+		return nil
+	}
+	return m.To(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down rolls back the newest applied migration
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.locked(ctx, func(conn *sql.Conn, applied map[string]bool) error {
+		if len(applied) == 0 {
+			m.log.Println("No migration to roll back")
+			return nil
+		}
+		newest := ""
+		for version := range applied {
+			newest = max(newest, version)
+		}
+		i := slices.IndexFunc(m.migrations, func(migration Migration) bool { return migration.Version == newest })
+		if i < 0 {
+			return fmt.Errorf("%w %s", ErrMissingMigration, newest)
+		}
+		return m.apply(ctx, conn, m.migrations[i], false)
+	})
+}
+
+// To applies or rolls back migrations until the schema is at the version, "0" rolls back every migration
+func (m *Migrator) To(ctx context.Context, version string) error {
+	return m.locked(ctx, func(conn *sql.Conn, applied map[string]bool) error {
+		up, down, err := plan(m.migrations, applied, version)
+		if err != nil {
+			return err
+		}
+		if len(up) == 0 && len(down) == 0 {
+			m.log.Println("The schema is up to date")
+			return nil
+		}
+		for _, migration := range down {
+			if err := m.apply(ctx, conn, migration, false); err != nil {
+				return err
+			}
+		}
+		for _, migration := range up {
+			if err := m.apply(ctx, conn, migration, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Status returns every migration, oldest first, and whether it is applied, followed by the applied
+// versions there is no migration for
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[string]bool) error {
+		for _, migration := range m.migrations {
+			statuses = append(statuses, Status{Version: migration.Version, Name: migration.Name, Applied: applied[migration.Version]})
+			delete(applied, migration.Version)
+		}
+		for version := range applied {
+			statuses = append(statuses, Status{Version: version, Applied: true})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(statuses[len(m.migrations):], func(a, b Status) int { return strings.Compare(a.Version, b.Version) })
+	return statuses, nil
+}
+
+// locked runs f on a connection holding the advisory lock, with the versions applied so far. The
+// schema_migration table is created if it does not exist yet.
+func (m *Migrator) locked(ctx context.Context, f func(conn *sql.Conn, applied map[string]bool) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// the lock belongs to the session, so it is taken and released on the same connection
+	if _, err = conn.ExecContext(ctx, `select pg_advisory_lock($1)`, lockKey); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), `select pg_advisory_unlock($1)`, lockKey)
+	}()
+
+	_, err = conn.ExecContext(ctx, `create table if not exists schema_migration (version varchar(14) primary key)`)
+	if err != nil {
+		return err
+	}
+
+	rows, err := conn.QueryContext(ctx, `select version from schema_migration`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return err
+		}
+		applied[version] = true
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	var hasTodo bool
+	if err = conn.QueryRowContext(ctx, `select to_regclass('todo') is not null`).Scan(&hasTodo); err != nil {
+		return err
+	}
+	for _, version := range baseline(applied, hasTodo) {
+		if _, err = conn.ExecContext(ctx, `insert into schema_migration (version) values ($1)`, version); err != nil {
+			return err
+		}
+		applied[version] = true
+		m.log.Println("Recorded the schema of the database as", version)
+	}
+
+	return f(conn, applied)
+}
+
+// baseline returns the versions to record as applied before migrating. A database with the todo
+// table and no recorded version was created from the old schema.sql dump, which only has the schema
+// of the first migration, so only that one is recorded and the others are applied.
+func baseline(applied map[string]bool, hasTodo bool) []string {
+	if !hasTodo || len(applied) > 0 {
+		return nil
+	}
+	return []string{baselineVersion}
+}
+
+// apply applies or rolls back a migration and records it in a single transaction, so that a failing
+// migration leaves neither the schema nor schema_migration changed
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmts, record, done := migration.Up, `insert into schema_migration (version) values ($1)`, "Applied"
+	if !up {
+		stmts, record, done = migration.Down, `delete from schema_migration where version = $1`, "Rolled back"
+	}
+
+	// without arguments the statements are sent in a single simple query, so a file can hold several
+	if _, err = tx.ExecContext(ctx, stmts); err != nil {
+		return fmt.Errorf("%s: %w", migration, err)
+	}
+	if _, err = tx.ExecContext(ctx, record, migration.Version); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	m.log.Println(done, migration)
+	return nil
+}
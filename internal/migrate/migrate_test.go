@@ -0,0 +1,223 @@
+package migrate
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/anras5/todo-app-backend/migrations"
+)
+
+func file(stmts string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(stmts)}
+}
+
+var theLoadTests = []struct {
+	name          string
+	fsys          fstest.MapFS
+	expected      []string
+	expectedError bool
+}{
+	{
+		name: "sorted by version",
+		fsys: fstest.MapFS{
+			"20261018110000_create_table_users.up.sql":   file("CREATE TABLE users ();"),
+			"20261018110000_create_table_users.down.sql": file("DROP TABLE users;"),
+			"20230406130116_create_table_todo.up.sql":    file("CREATE TABLE todo ();"),
+			"20230406130116_create_table_todo.down.sql":  file("DROP TABLE todo;"),
+			"migrations.go": file("package migrations"),
+		},
+		expected: []string{"20230406130116_create_table_todo", "20261018110000_create_table_users"},
+	},
+	{
+		name: "missing down file",
+		fsys: fstest.MapFS{
+			"20230406130116_create_table_todo.up.sql": file("CREATE TABLE todo ();"),
+		},
+		expectedError: true,
+	},
+	{
+		name: "empty up file",
+		fsys: fstest.MapFS{
+			"20230406130116_create_table_todo.up.sql":   file("\n"),
+			"20230406130116_create_table_todo.down.sql": file("DROP TABLE todo;"),
+		},
+		expectedError: true,
+	},
+	{
+		name: "version used twice",
+		fsys: fstest.MapFS{
+			"20230406130116_create_table_todo.up.sql":   file("CREATE TABLE todo ();"),
+			"20230406130116_create_table_user.up.sql":   file("CREATE TABLE users ();"),
+			"20230406130116_create_table_user.down.sql": file("DROP TABLE users;"),
+		},
+		expectedError: true,
+	},
+	{
+		name: "version without a timestamp",
+		fsys: fstest.MapFS{
+			"1_create_table_todo.up.sql":   file("CREATE TABLE todo ();"),
+			"1_create_table_todo.down.sql": file("DROP TABLE todo;"),
+		},
+		expectedError: true,
+	},
+}
+
+func TestLoad(t *testing.T) {
+	for _, e := range theLoadTests {
+		loaded, err := Load(e.fsys)
+		if e.expectedError {
+			if err == nil {
+				t.Errorf("%s did not return an error", e.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s returned an error: %v", e.name, err)
+			continue
+		}
+
+		var names []string
+		for _, migration := range loaded {
+			names = append(names, migration.String())
+		}
+		if !slices.Equal(names, e.expected) {
+			t.Errorf("%s loaded wrong migrations: got %v, wanted %v", e.name, names, e.expected)
+		}
+	}
+}
+
+func TestLoad_Migrations(t *testing.T) {
+	loaded, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("the migrations do not load: %v", err)
+	}
+	if len(loaded) == 0 || loaded[0].Version != "20230406130116" {
+		t.Errorf("the first migration is wrong: got %v, wanted 20230406130116_create_table_todo", loaded)
+	}
+}
+
+var testMigrations = []Migration{
+	{Version: "20230406130116", Name: "create_table_todo"},
+	{Version: "20261018100000", Name: "add_todo_deadline_id_index"},
+	{Version: "20261018110000", Name: "create_table_users"},
+}
+
+func versions(migrations []Migration) []string {
+	var versions []string
+	for _, migration := range migrations {
+		versions = append(versions, migration.Version)
+	}
+	return versions
+}
+
+var thePlanTests = []struct {
+	name          string
+	applied       []string
+	target        string
+	expectedUp    []string
+	expectedDown  []string
+	expectedError error
+}{
+	{
+		name:       "empty database",
+		target:     "20261018110000",
+		expectedUp: []string{"20230406130116", "20261018100000", "20261018110000"},
+	},
+	{
+		name:    "up to date",
+		applied: []string{"20230406130116", "20261018100000", "20261018110000"},
+		target:  "20261018110000",
+	},
+	{
+		name:       "skipped migration",
+		applied:    []string{"20230406130116", "20261018110000"},
+		target:     "20261018110000",
+		expectedUp: []string{"20261018100000"},
+	},
+	{
+		name:         "back to a version",
+		applied:      []string{"20230406130116", "20261018100000", "20261018110000"},
+		target:       "20230406130116",
+		expectedDown: []string{"20261018110000", "20261018100000"},
+	},
+	{
+		name:         "back to nothing",
+		applied:      []string{"20230406130116", "20261018100000"},
+		target:       "0",
+		expectedDown: []string{"20261018100000", "20230406130116"},
+	},
+	{
+		name:          "unknown target",
+		target:        "20261018100001",
+		expectedError: ErrUnknownVersion,
+	},
+	{
+		name:    "applied version without a migration",
+		applied: []string{"20220101000000", "20230406130116", "20261018100000", "20261018110000"},
+		target:  "20261018110000",
+	},
+	{
+		name:          "rolling back a version without a migration",
+		applied:       []string{"20230406130116", "20261018120000"},
+		target:        "20230406130116",
+		expectedError: ErrMissingMigration,
+	},
+}
+
+func TestPlan(t *testing.T) {
+	for _, e := range thePlanTests {
+		applied := make(map[string]bool)
+		for _, version := range e.applied {
+			applied[version] = true
+		}
+
+		up, down, err := plan(testMigrations, applied, e.target)
+		if e.expectedError != nil {
+			if !errors.Is(err, e.expectedError) {
+				t.Errorf("%s returned wrong error: got %v, wanted %v", e.name, err, e.expectedError)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s returned an error: %v", e.name, err)
+			continue
+		}
+
+		if !slices.Equal(versions(up), e.expectedUp) {
+			t.Errorf("%s applies wrong migrations: got %v, wanted %v", e.name, versions(up), e.expectedUp)
+		}
+		if !slices.Equal(versions(down), e.expectedDown) {
+			t.Errorf("%s rolls back wrong migrations: got %v, wanted %v", e.name, versions(down), e.expectedDown)
+		}
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	loaded, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := loaded[len(loaded)-1].Version
+
+	// the old schema.sql dump has the todo table and an empty schema_migration table
+	applied := make(map[string]bool)
+	for _, version := range baseline(applied, true) {
+		applied[version] = true
+	}
+	up, down, err := plan(loaded, applied, latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(down) != 0 || len(up) != len(loaded)-1 || up[0].Version == baselineVersion {
+		t.Errorf("migrating the old dump: got up %v and down %v, wanted every migration after %s", versions(up), versions(down), baselineVersion)
+	}
+
+	if recorded := baseline(map[string]bool{}, false); len(recorded) != 0 {
+		t.Errorf("empty database: got %v recorded, wanted none", recorded)
+	}
+	if recorded := baseline(map[string]bool{baselineVersion: true}, true); len(recorded) != 0 {
+		t.Errorf("migrated database: got %v recorded, wanted none", recorded)
+	}
+}
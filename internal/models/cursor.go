@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// TodoCursor is the position of a todo in a sorted listing: the values of its
+// sort fields in sort order, followed by its id which breaks the ties
+type TodoCursor struct {
+	Values []string
+	ID     int
+}
+
+// TodoPage is a single page of todos returned by a keyset paginated query
+type TodoPage struct {
+	Todos      []*Todo `json:"todos"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	HasMore    bool    `json:"has_more"`
+}
+
+// Encode returns the opaque string representation of the cursor
+func (c TodoCursor) Encode() string {
+	parts := make([]string, 0, len(c.Values)+1)
+	for _, value := range c.Values {
+		parts = append(parts, url.PathEscape(value))
+	}
+	parts = append(parts, strconv.Itoa(c.ID))
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(parts, "|")))
+}
+
+// DecodeTodoCursor parses a cursor previously returned by Encode
+func DecodeTodoCursor(s string) (*TodoCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), "|")
+	var cursor TodoCursor
+	cursor.ID, err = strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	for _, part := range parts[:len(parts)-1] {
+		value, err := url.PathUnescape(part)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		cursor.Values = append(cursor.Values, value)
+	}
+	return &cursor, nil
+}
+
+// Cursor returns the cursor pointing at the todo in a listing sorted by sort
+func (t *Todo) Cursor(sort []SortField) string {
+	sort = NormalizeTodoSort(sort)
+
+	// the last field is always the id
+	cursor := TodoCursor{ID: t.ID}
+	for _, field := range sort[:len(sort)-1] {
+		cursor.Values = append(cursor.Values, t.sortValue(field.Field))
+	}
+	return cursor.Encode()
+}
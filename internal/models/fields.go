@@ -0,0 +1,49 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidField = errors.New("invalid field")
+
+// TodoUpdateFields are the fields of a todo that can be updated, named like their JSON
+// members. A field mask is a subset of them.
+var TodoUpdateFields = []string{"project_id", "parent_id", "name", "description", "deadline", "completed", "rrule", "tags"}
+
+// TodoFieldMask is a set of todo fields to update
+type TodoFieldMask map[string]bool
+
+// NewTodoFieldMask returns the mask of the fields, or ErrInvalidField if any of them cannot be updated
+func NewTodoFieldMask(fields ...string) (TodoFieldMask, error) {
+	mask := make(TodoFieldMask, len(fields))
+	for _, field := range fields {
+		if !isUpdateField(field) {
+			return nil, fmt.Errorf("%w: %q cannot be updated, use one of %s",
+				ErrInvalidField, field, strings.Join(TodoUpdateFields, ", "))
+		}
+		mask[field] = true
+	}
+	return mask, nil
+}
+
+// Fields returns the fields of the mask in the order of TodoUpdateFields
+func (m TodoFieldMask) Fields() []string {
+	fields := make([]string, 0, len(m))
+	for _, field := range TodoUpdateFields {
+		if m[field] {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func isUpdateField(field string) bool {
+	for _, f := range TodoUpdateFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
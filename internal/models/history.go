@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The actions recorded in the history of a todo
+const (
+	ActionInsert     = "insert"
+	ActionUpdate     = "update"
+	ActionComplete   = "complete"
+	ActionIncomplete = "incomplete"
+	ActionDelete     = "delete"
+	ActionRestore    = "restore"
+	ActionUndo       = "undo"
+	ActionRedo       = "redo"
+)
+
+// The transports a change of a todo can come through
+const (
+	TransportREST    = "rest"
+	TransportGraphQL = "graphql"
+	TransportGRPC    = "grpc"
+)
+
+// Audit describes the request changing a todo, it is recorded in the history of the todo
+type Audit struct {
+	RequestID string
+	Transport string
+	// Undoable adds the changes to the operation log of the user, so that they can be undone
+	Undoable bool
+}
+
+// TodoHistory is a single change of a todo with the todo before and after it,
+// Before is null for inserts
+type TodoHistory struct {
+	ID        int             `json:"id"`
+	TodoID    int             `json:"todo_id"`
+	ActorID   int             `json:"actor_id"`
+	Action    string          `json:"action"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	RequestID string          `json:"request_id"`
+	Transport string          `json:"transport"`
+	CreatedAt time.Time       `json:"created_at"`
+}
@@ -1,13 +1,126 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type Todo struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"-"`
+	ProjectID   *int       `json:"project_id"`
+	ParentID    *int       `json:"parent_id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Deadline    time.Time  `json:"deadline"`
+	Completed   bool       `json:"completed"`
+	RRule       string     `json:"rrule"`
+	Version     int        `json:"version"`
+	Progress    int        `json:"progress"`
+	Tags        []string   `json:"tags"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	CreatedAt   time.Time  `json:"-"`
+	UpdatedAt   time.Time  `json:"-"`
+}
+
+// TodoInsertResult is the outcome of inserting one of several todos, its id or why it was not inserted
+type TodoInsertResult struct {
+	ID  int
+	Err error
+}
+
+// The operations of a batch
+const (
+	BatchCreate   = "create"
+	BatchUpdate   = "update"
+	BatchDelete   = "delete"
+	BatchComplete = "complete"
+)
+
+// BatchOperation is one of the writes of a batch. Create inserts the todo, update writes the
+// fields of the todo with its id (all of them if none are given), delete moves it to the trash
+// and complete sets it to its completion state. A version other than 0 must match the current
+// version of the todo.
+type BatchOperation struct {
+	Op     string
+	Todo   Todo
+	Fields []string
+}
+
+// BatchResult is the outcome of one operation of a batch, the id of its todo or why it failed
+type BatchResult struct {
+	ID  int
+	Err error
+}
+
+// TodoFilter narrows down the todos returned by a query
+type TodoFilter struct {
+	// Completed keeps only the todos in the given state
+	Completed *bool
+	// Tags keeps only the todos with any of the tags, or all of them if MatchAllTags is set
+	Tags         []string
+	MatchAllTags bool
+	// DeadlineAfter and DeadlineBefore keep only the todos with a deadline in [after, before),
+	// the created and updated ranges work the same way
+	DeadlineAfter  *time.Time
+	DeadlineBefore *time.Time
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+	UpdatedAfter   *time.Time
+	UpdatedBefore  *time.Time
+	// Overdue keeps only the todos that are not completed and past their deadline
+	Overdue bool
+	// NameContains keeps only the todos with the text in their name, ignoring case
+	NameContains string
+	// Sort orders the todos, by deadline if it is empty
+	Sort []SortField
+}
+
+// NormalizeTags trims the tags and drops empty and duplicated ones
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+type User struct {
+	ID           int       `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"-"`
+	UpdatedAt    time.Time `json:"-"`
+}
+
+type Project struct {
 	ID          int       `json:"id"`
+	UserID      int       `json:"-"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
-	Deadline    time.Time `json:"deadline"`
-	Completed   bool      `json:"completed"`
 	CreatedAt   time.Time `json:"-"`
 	UpdatedAt   time.Time `json:"-"`
 }
+
+// ProjectDeletion decides what happens to the todos of a deleted project.
+// By default the todos are kept and left without a project.
+type ProjectDeletion struct {
+	// DeleteTodos moves the todos to the trash together with their subtasks
+	DeleteTodos bool
+	// ReassignTo moves the todos to another project of the same user
+	ReassignTo *int
+}
+
+// SearchResult is a todo matching a full-text search
+type SearchResult struct {
+	Todo *Todo   `json:"todo"`
+	Rank float64 `json:"rank"`
+	// Snippet is the matching part of the name and description with the matches wrapped in <mark> tags
+	Snippet string `json:"snippet"`
+}
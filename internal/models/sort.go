@@ -0,0 +1,82 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSort = errors.New("invalid sort")
+
+// TodoSortFields are the fields todos can be sorted by
+var TodoSortFields = []string{"deadline", "created_at", "updated_at", "name", "completed", "id"}
+
+// SortField is a field to sort by and its direction
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// NewSortField returns the sort field, or ErrInvalidSort if todos cannot be sorted by it
+func NewSortField(field string, desc bool) (SortField, error) {
+	for _, f := range TodoSortFields {
+		if f == field {
+			return SortField{Field: field, Desc: desc}, nil
+		}
+	}
+	return SortField{}, fmt.Errorf("%w: todos cannot be sorted by %q, use one of %s",
+		ErrInvalidSort, field, strings.Join(TodoSortFields, ", "))
+}
+
+// ParseTodoSort parses a comma separated list of fields like "-deadline,name",
+// a field prefixed with - is sorted in descending order
+func ParseTodoSort(s string) ([]SortField, error) {
+	var sort []SortField
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		desc := strings.HasPrefix(field, "-")
+		sortField, err := NewSortField(strings.TrimPrefix(field, "-"), desc)
+		if err != nil {
+			return nil, err
+		}
+		sort = append(sort, sortField)
+	}
+	return sort, nil
+}
+
+// NormalizeTodoSort returns the sort with the id as the last field, so that the order is stable.
+// An empty sort orders by deadline.
+func NormalizeTodoSort(sort []SortField) []SortField {
+	if len(sort) == 0 {
+		sort = []SortField{{Field: "deadline"}}
+	}
+
+	normalized := make([]SortField, 0, len(sort)+1)
+	for _, field := range sort {
+		normalized = append(normalized, field)
+		if field.Field == "id" {
+			// ids are unique, the fields after it never matter
+			return normalized
+		}
+	}
+	return append(normalized, SortField{Field: "id"})
+}
+
+// sortValue returns the value of the sort field as stored in a cursor
+func (t *Todo) sortValue(field string) string {
+	switch field {
+	case "deadline":
+		return t.Deadline.UTC().Format(time.RFC3339Nano)
+	case "created_at":
+		return t.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "updated_at":
+		return t.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case "name":
+		return t.Name
+	case "completed":
+		return strconv.FormatBool(t.Completed)
+	}
+	return strconv.Itoa(t.ID)
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The events a webhook can subscribe to
+const (
+	EventTodoCreated     = "todo.created"
+	EventTodoUpdated     = "todo.updated"
+	EventTodoCompleted   = "todo.completed"
+	EventTodoUncompleted = "todo.uncompleted"
+	EventTodoDeleted     = "todo.deleted"
+	EventTodoRestored    = "todo.restored"
+	// EventWebhookTest is sent by the test endpoint regardless of the events of the webhook
+	EventWebhookTest = "webhook.test"
+)
+
+// WebhookEvents are the events a webhook can subscribe to, a webhook without events gets all of them
+var WebhookEvents = []string{
+	EventTodoCreated,
+	EventTodoUpdated,
+	EventTodoCompleted,
+	EventTodoUncompleted,
+	EventTodoDeleted,
+	EventTodoRestored,
+}
+
+// The states of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is a URL the events of the todos of a user are posted to. The bodies are signed
+// with the secret, which is never sent back to the client after the webhook is created.
+type Webhook struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"-"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// WebhookEvent is the JSON body posted to a webhook
+type WebhookEvent struct {
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Todo      json.RawMessage `json:"todo"`
+}
+
+// WebhookDelivery is an event posted, or to be posted, to a webhook. A pending delivery is
+// attempted again at NextAttemptAt until it succeeds or runs out of attempts.
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status"`
+	Error          string          `json:"error"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	// URL and Secret of the webhook, read together with the delivery to send it
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
@@ -2,21 +2,41 @@ package dbrepo
 
 import (
 	"database/sql"
+	"time"
 
+	"github.com/anras5/todo-app-backend/internal/events"
+	"github.com/anras5/todo-app-backend/internal/models"
 	"github.com/anras5/todo-app-backend/internal/repository"
 )
 
 type postgresDBRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	events *events.Bus
+	audit  models.Audit
+	// timeout is how long a method may take, the ones doing more work take longer
+	timeout time.Duration
+	// isolation is the isolation level of the transactions of WithTx
+	isolation sql.IsolationLevel
+	// tx is the transaction of WithTx the repo runs its queries in, nil outside of it
+	tx *todoTx
 }
 
 type testDBRepo struct {
 	DB *sql.DB
 }
 
-func NewPostgresRepo(conn *sql.DB) repository.DatabaseRepo {
+// NewPostgresRepo returns a repo publishing the changes of todos to the bus, its methods time out
+// after the timeout, repository.DefaultQueryTimeout if it is 0, and its transactions from WithTx
+// are serializable
+func NewPostgresRepo(conn *sql.DB, bus *events.Bus, timeout time.Duration) repository.DatabaseRepo {
+	if timeout == 0 {
+		timeout = repository.DefaultQueryTimeout
+	}
 	return &postgresDBRepo{
-		DB: conn,
+		DB:        conn,
+		events:    bus,
+		timeout:   timeout,
+		isolation: sql.LevelSerializable,
 	}
 }
 
@@ -0,0 +1,223 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"sync"
+
+	"github.com/anras5/todo-app-backend/internal/events"
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+)
+
+// memoryState is the data of an in-memory repo, laid out like the tables of the database.
+// The values of the maps are never changed in place, a change stores a new value, so a
+// shallow clone of the state is enough to roll back to it.
+type memoryState struct {
+	users      map[int]models.User
+	projects   map[int]models.Project
+	todos      map[int]models.Todo
+	history    []memoryHistory
+	operations map[int]memoryOperation
+	webhooks   map[int]models.Webhook
+	deliveries map[int]models.WebhookDelivery
+}
+
+// memoryHistory is a change of a todo, operationID is 0 if it cannot be undone
+type memoryHistory struct {
+	models.TodoHistory
+	operationID int
+}
+
+// memoryOperation is an operation in the operation log of a user
+type memoryOperation struct {
+	userID int
+	undone bool
+}
+
+func (s *memoryState) clone() memoryState {
+	return memoryState{
+		users:      maps.Clone(s.users),
+		projects:   maps.Clone(s.projects),
+		todos:      maps.Clone(s.todos),
+		history:    s.history,
+		operations: maps.Clone(s.operations),
+		webhooks:   maps.Clone(s.webhooks),
+		deliveries: maps.Clone(s.deliveries),
+	}
+}
+
+// memoryStore is the state shared by an in-memory repo and the repos derived from it
+type memoryStore struct {
+	mu    sync.RWMutex
+	state memoryState
+	// lastIDs are the sequences of the tables, like the ones of the database they are not rolled back
+	lastIDs map[string]int
+}
+
+// nextID takes the next id from the sequence of the table, the store must be locked
+func (s *memoryStore) nextID(table string) int {
+	s.lastIDs[table]++
+	return s.lastIDs[table]
+}
+
+type memoryDBRepo struct {
+	store  *memoryStore
+	events *events.Bus
+	audit  models.Audit
+	// tx is the transaction of WithTx the repo runs in, nil outside of it
+	tx *memoryTx
+}
+
+// NewMemoryRepo returns a repo keeping its data in memory and publishing the changes of todos to the
+// bus. It behaves like the Postgres repo, but the data is lost once the process exits. Reads run
+// concurrently, while writes and the transactions of WithTx hold the whole store until they end.
+func NewMemoryRepo(bus *events.Bus) repository.DatabaseRepo {
+	return &memoryDBRepo{
+		store: &memoryStore{
+			state: memoryState{
+				users:      make(map[int]models.User),
+				projects:   make(map[int]models.Project),
+				todos:      make(map[int]models.Todo),
+				operations: make(map[int]memoryOperation),
+				webhooks:   make(map[int]models.Webhook),
+				deliveries: make(map[int]models.WebhookDelivery),
+			},
+			lastIDs: make(map[string]int),
+		},
+		events: bus,
+	}
+}
+
+// memoryTx is a transaction of an in-memory repo, it holds the lock of the store until it ends
+// and publishes the events of the changes made in it once it commits. Inside of WithTx it is a
+// savepoint of the transaction of WithTx, which publishes its events.
+type memoryTx struct {
+	store *memoryStore
+	bus   *events.Bus
+	// saved is the state the transaction rolls back to
+	saved   memoryState
+	pending []events.Event
+	// operationID is the operation of the undoable changes of the transaction, see logOperation
+	operationID int
+
+	// parent is the transaction the savepoint is in, nil if it is not a savepoint
+	parent *memoryTx
+	done   bool
+}
+
+// begin starts a transaction publishing its events to the bus of the repo
+func (m *memoryDBRepo) begin(ctx context.Context) (*memoryTx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if m.tx != nil {
+		return m.tx.savepoint(), nil
+	}
+	m.store.mu.Lock()
+	return &memoryTx{store: m.store, bus: m.events, saved: m.store.state.clone()}, nil
+}
+
+// view returns the state the reads of the repo see and a func to call once they are done
+func (m *memoryDBRepo) view(ctx context.Context) (*memoryState, func(), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	if m.tx != nil {
+		return m.tx.state(), func() {}, nil
+	}
+	m.store.mu.RLock()
+	return &m.store.state, m.store.mu.RUnlock, nil
+}
+
+// savepoint starts a savepoint of the transaction, which is committed and rolled back like
+// a transaction of its own
+func (tx *memoryTx) savepoint() *memoryTx {
+	return &memoryTx{store: tx.store, saved: tx.store.state.clone(), parent: tx}
+}
+
+// state returns the state changed by the transaction
+func (tx *memoryTx) state() *memoryState {
+	return &tx.store.state
+}
+
+// root returns the outermost transaction of a savepoint
+func (tx *memoryTx) root() *memoryTx {
+	for tx.parent != nil {
+		tx = tx.parent
+	}
+	return tx
+}
+
+// commit keeps the changes of the transaction and publishes its events
+func (tx *memoryTx) commit() error {
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	if tx.parent != nil {
+		tx.parent.pending = append(tx.parent.pending, tx.pending...)
+		return nil
+	}
+
+	tx.store.mu.Unlock()
+	if tx.bus != nil {
+		for _, event := range tx.pending {
+			tx.bus.Publish(event)
+		}
+	}
+	tx.pending = nil
+	return nil
+}
+
+// rollback undoes the changes made since the transaction or the savepoint started
+func (tx *memoryTx) rollback() {
+	if tx.done {
+		return
+	}
+	tx.done = true
+	tx.store.state = tx.saved
+	if tx.parent == nil {
+		tx.store.mu.Unlock()
+	}
+}
+
+// publish queues the event of a change of a todo until the transaction commits
+func (tx *memoryTx) publish(userID int, webhookEvent string, todo []byte) {
+	tx.pending = append(tx.pending, events.Event{
+		UserID: userID,
+		Type:   streamEvent(webhookEvent),
+		Todo:   todo,
+	})
+}
+
+// WithAudit returns a repo recording the audit in the history of the todos it changes
+func (m *memoryDBRepo) WithAudit(audit models.Audit) repository.DatabaseRepo {
+	repo := *m
+	repo.audit = audit
+	return &repo
+}
+
+// WithIsolation returns the repo itself, its transactions never overlap so they are always serializable
+func (m *memoryDBRepo) WithIsolation(level sql.IsolationLevel) repository.DatabaseRepo {
+	return m
+}
+
+// WithTx runs fn with a repo running all of its methods in one transaction, kept once fn returns
+// without an error. The transaction holds the store, so it never fails to serialize and fn runs
+// only once. Inside of WithTx, fn runs in a savepoint instead.
+func (m *memoryDBRepo) WithTx(ctx context.Context, fn func(repo repository.DatabaseRepo) error) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.rollback()
+
+	repo := *m
+	repo.tx = tx
+	if err = fn(&repo); err != nil {
+		return err
+	}
+	return tx.commit()
+}
@@ -0,0 +1,136 @@
+package dbrepo
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/anras5/todo-app-backend/internal/rrule"
+)
+
+// InsertTodos inserts the todos with the checks of InsertTodo. Like the COPY of the Postgres repo,
+// the projects and parents are checked before any todo is inserted, so a todo cannot be the
+// parent of another one of the same call.
+func (m *memoryDBRepo) InsertTodos(ctx context.Context, userID int, todos []models.Todo) ([]models.TodoInsertResult, error) {
+	if len(todos) > repository.MaxInsertBatch {
+		return nil, fmt.Errorf("at most %d todos can be inserted at once", repository.MaxInsertBatch)
+	}
+	results := make([]models.TodoInsertResult, len(todos))
+	todos = slices.Clone(todos)
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.rollback()
+
+	s := tx.state()
+	var valid []int
+	for i := range todos {
+		todo := &todos[i]
+		todo.ID = 0
+		todo.UserID = userID
+
+		switch {
+		case utf8.RuneCountInString(todo.Name) > maxTodoName:
+			results[i].Err = fmt.Errorf("name should be at most %d characters", maxTodoName)
+		case s.checkProject(userID, todo.ProjectID) != nil:
+			results[i].Err = repository.ErrProjectNotFound
+		case s.checkParent(userID, 0, todo.ParentID) != nil:
+			results[i].Err = repository.ErrParentNotFound
+		}
+		if results[i].Err != nil {
+			continue
+		}
+		if todo.RRule, results[i].Err = rrule.Normalize(todo.RRule); results[i].Err != nil {
+			continue
+		}
+		valid = append(valid, i)
+	}
+
+	rolledUp := make(map[int]bool)
+	for _, i := range valid {
+		todo := todos[i]
+		if results[i].ID, err = s.insertTodo(tx.store.nextID("todo"), todo); err != nil {
+			return nil, err
+		}
+		if err = m.recordHistory(tx, userID, results[i].ID, models.ActionInsert, nil); err != nil {
+			return nil, err
+		}
+		if todo.ParentID != nil && !rolledUp[*todo.ParentID] {
+			rolledUp[*todo.ParentID] = true
+			if err = m.rollUpCompleted(tx, todo.ParentID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = tx.commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ApplyTodoBatch applies the operations with the same checks as the methods writing a single todo.
+// Without atomic every operation runs in its own savepoint, so that a failing one leaves the
+// transaction usable for the rest.
+func (m *memoryDBRepo) ApplyTodoBatch(ctx context.Context, userID int, ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	if len(ops) > repository.MaxBatchOperations {
+		return nil, fmt.Errorf("at most %d operations can be applied at once", repository.MaxBatchOperations)
+	}
+	results := make([]models.BatchResult, len(ops))
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.rollback()
+
+	for i, op := range ops {
+		result := &results[i]
+		if atomic {
+			result.ID, result.Err = m.applyBatchOperation(tx, userID, op)
+			if result.Err != nil {
+				// nothing is kept, the transaction rolls back once it returns
+				abortBatch(results, i)
+				return results, nil
+			}
+			continue
+		}
+
+		savepoint := tx.savepoint()
+		result.ID, result.Err = m.applyBatchOperation(savepoint, userID, op)
+		if result.Err != nil {
+			result.ID = 0
+			savepoint.rollback()
+		} else if err = savepoint.commit(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// applyBatchOperation applies one operation of a batch as a part of the transaction
+func (m *memoryDBRepo) applyBatchOperation(tx *memoryTx, userID int, op models.BatchOperation) (int, error) {
+	todo := op.Todo
+	todo.UserID = userID
+
+	switch op.Op {
+	case models.BatchCreate:
+		return m.createTodo(tx, todo)
+	case models.BatchUpdate:
+		return todo.ID, m.updateTodo(tx, todo, op.Fields...)
+	case models.BatchDelete:
+		return todo.ID, m.deleteTodo(tx, userID, todo.ID, todo.Version)
+	case models.BatchComplete:
+		return todo.ID, m.completeTodo(tx, userID, todo.ID, todo.Completed)
+	}
+	return 0, fmt.Errorf("unknown operation %q", op.Op)
+}
@@ -0,0 +1,271 @@
+package dbrepo
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+)
+
+// logOperation returns the operation of the transaction in the operation log of the user,
+// every undoable change made by the transaction is a part of it
+func (m *memoryDBRepo) logOperation(tx *memoryTx, userID int) int {
+	root := tx.root()
+	// the operation is gone if the savepoint that logged it was rolled back
+	if _, ok := tx.state().operations[root.operationID]; !ok {
+		root.operationID = tx.store.nextID("todo_operation")
+		tx.state().operations[root.operationID] = memoryOperation{userID: userID}
+	}
+	return root.operationID
+}
+
+// recordHistory records a change of a todo made in the transaction by the user. before is
+// the todo as it was before the change, nil if it was inserted, the todo after is read back.
+// Undoable changes are added to the operation of the transaction.
+func (m *memoryDBRepo) recordHistory(tx *memoryTx, userID int, id int, action string, before *models.Todo) error {
+	operationID := 0
+	if m.audit.Undoable {
+		operationID = m.logOperation(tx, userID)
+	}
+	return m.insertHistory(tx, userID, id, action, before, operationID)
+}
+
+// insertHistory inserts a change of a todo into its history, see recordHistory,
+// queues its event for the webhooks of the user and publishes it once the transaction commits
+func (m *memoryDBRepo) insertHistory(tx *memoryTx, userID int, id int, action string, before *models.Todo, operationID int) error {
+	s := tx.state()
+	after, err := s.snapshotTodo(userID, id)
+	if err != nil {
+		return err
+	}
+
+	var beforeJSON []byte
+	if before != nil {
+		if beforeJSON, err = json.Marshal(before); err != nil {
+			return err
+		}
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	s.history = append(s.history, memoryHistory{
+		TodoHistory: models.TodoHistory{
+			ID:        tx.store.nextID("todo_history"),
+			TodoID:    id,
+			ActorID:   userID,
+			Action:    action,
+			Before:    beforeJSON,
+			After:     afterJSON,
+			RequestID: m.audit.RequestID,
+			Transport: m.audit.Transport,
+			CreatedAt: time.Now(),
+		},
+		operationID: operationID,
+	})
+	event := todoEvent(before, after)
+	tx.publish(userID, event, afterJSON)
+	return s.enqueueWebhooks(tx.store, userID, event, afterJSON)
+}
+
+// SelectTodoHistory returns the changes of a todo of the user, trashed or not, oldest first
+func (m *memoryDBRepo) SelectTodoHistory(ctx context.Context, userID int, id int) ([]*models.TodoHistory, error) {
+	s, done, err := m.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if _, err := s.snapshotTodo(userID, id); err != nil {
+		return nil, err
+	}
+
+	// the history is appended to in the order of the ids
+	history := []*models.TodoHistory{}
+	for _, entry := range s.history {
+		if entry.TodoID == id {
+			change := entry.TodoHistory
+			history = append(history, &change)
+		}
+	}
+	return history, nil
+}
+
+// UndoOperations reverts the last count operations of the user, newest first, and returns how
+// many were undone. Either all of them are undone or none is.
+func (m *memoryDBRepo) UndoOperations(ctx context.Context, userID int, count int) (int, error) {
+	return m.replayOperations(ctx, userID, count, true)
+}
+
+// RedoOperations reapplies the last count undone operations of the user, oldest first, and
+// returns how many were redone. Operations undone before the last new operation cannot be redone.
+func (m *memoryDBRepo) RedoOperations(ctx context.Context, userID int, count int) (int, error) {
+	return m.replayOperations(ctx, userID, count, false)
+}
+
+// replayOperations undoes or redoes the last count operations of the user in a single transaction
+func (m *memoryDBRepo) replayOperations(ctx context.Context, userID int, count int, undo bool) (int, error) {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.rollback()
+
+	s := tx.state()
+	var ids []int
+	lastDone := 0
+	for id, operation := range s.operations {
+		if operation.userID != userID {
+			continue
+		}
+		ids = append(ids, id)
+		if !operation.undone {
+			lastDone = max(lastDone, id)
+		}
+	}
+	slices.Sort(ids)
+
+	var operations []int
+	if undo {
+		for i := len(ids) - 1; i >= 0 && len(operations) < count; i-- {
+			if !s.operations[ids[i]].undone {
+				operations = append(operations, ids[i])
+			}
+		}
+	} else {
+		for _, id := range ids {
+			if len(operations) < count && id > lastDone && s.operations[id].undone {
+				operations = append(operations, id)
+			}
+		}
+	}
+
+	for _, id := range operations {
+		if err = m.replayOperation(tx, userID, id, undo); err != nil {
+			return 0, err
+		}
+	}
+	return len(operations), tx.commit()
+}
+
+// replayOperation undoes an operation by writing back the todos as they were before each of
+// its changes, newest change first, or redoes it by writing back the todos as they were after.
+// It fails with repository.ErrUndoConflict if a todo has been changed outside of the operation log since.
+func (m *memoryDBRepo) replayOperation(tx *memoryTx, userID int, id int, undo bool) error {
+	s := tx.state()
+	var changes []operationChange
+	for _, entry := range s.history {
+		if entry.operationID != id || entry.Action == models.ActionUndo || entry.Action == models.ActionRedo {
+			continue
+		}
+		change := operationChange{historyID: entry.ID, todoID: entry.TodoID}
+		var err error
+		if change.before, err = unmarshalSnapshot(entry.Before); err != nil {
+			return err
+		}
+		if change.after, err = unmarshalSnapshot(entry.After); err != nil {
+			return err
+		}
+		changes = append(changes, change)
+	}
+	if undo {
+		slices.Reverse(changes)
+	}
+
+	action, undone := models.ActionRedo, false
+	if undo {
+		action, undone = models.ActionUndo, true
+	}
+	// ancestors completed or reopened by the replay are recorded as part of it
+	replayed := func(userID int, todoID int, _ string, before *models.Todo) error {
+		return m.insertHistory(tx, userID, todoID, action, before, id)
+	}
+	for _, change := range changes {
+		for _, entry := range s.history {
+			if entry.TodoID == change.todoID && entry.ID > change.historyID && entry.operationID == 0 {
+				return repository.ErrUndoConflict
+			}
+		}
+
+		target := change.after
+		if undo {
+			target = change.before
+		}
+		current, err := s.writeSnapshot(userID, change.todoID, target, replayed)
+		if err != nil {
+			return err
+		}
+		if err = m.insertHistory(tx, userID, change.todoID, action, current, id); err != nil {
+			return err
+		}
+	}
+
+	operation := s.operations[id]
+	operation.undone = undone
+	s.operations[id] = operation
+	return nil
+}
+
+// writeSnapshot writes a todo from the history back, a nil snapshot moves the todo to the
+// trash. Ancestors whose completion flips are passed to record. It returns the todo as it was before.
+func (s *memoryState) writeSnapshot(userID int, id int, snapshot *models.Todo, record recordFunc) (*models.Todo, error) {
+	current, err := s.snapshotTodo(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	parentID := current.ParentID
+	deletedAt := current.DeletedAt
+	if snapshot == nil {
+		now := time.Now()
+		if deletedAt == nil {
+			deletedAt = &now
+		}
+	} else {
+		parentID = snapshot.ParentID
+		deletedAt = snapshot.DeletedAt
+
+		if err := s.checkProject(userID, snapshot.ProjectID); err != nil {
+			return nil, err
+		}
+		if deletedAt == nil {
+			if err := s.checkParent(userID, id, parentID); err != nil {
+				return nil, err
+			}
+		}
+
+		todo := s.todos[id]
+		todo.ProjectID = snapshot.ProjectID
+		todo.ParentID = parentID
+		todo.Name = snapshot.Name
+		todo.Description = snapshot.Description
+		todo.Deadline = storedTime(snapshot.Deadline)
+		todo.Completed = snapshot.Completed
+		todo.RRule = snapshot.RRule
+		todo.Tags = sortedTags(snapshot.Tags)
+		todo.Version++
+		todo.UpdatedAt = time.Now()
+		s.todos[id] = todo
+	}
+
+	switch {
+	case current.DeletedAt == nil && deletedAt != nil:
+		s.trashSubtree(id, *deletedAt)
+	case current.DeletedAt != nil && deletedAt == nil:
+		s.restoreSubtree(id, *current.DeletedAt)
+	}
+
+	if err = s.rollUp(parentID, record); err != nil {
+		return nil, err
+	}
+	if current.ParentID != nil && (parentID == nil || *current.ParentID != *parentID) {
+		if err = s.rollUp(current.ParentID, record); err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
@@ -0,0 +1,217 @@
+package dbrepo
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+)
+
+// maxProjectName is the length of the name column of the project table
+const maxProjectName = 100
+
+func (m *memoryDBRepo) SelectProjects(ctx context.Context, userID int) ([]*models.Project, error) {
+	s, done, err := m.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	projects := []*models.Project{}
+	for _, stored := range s.projects {
+		if stored.UserID == userID {
+			project := stored
+			projects = append(projects, &project)
+		}
+	}
+	slices.SortFunc(projects, func(a, b *models.Project) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return projects, nil
+}
+
+func (m *memoryDBRepo) SelectProject(ctx context.Context, userID int, id int) (*models.Project, error) {
+	s, done, err := m.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	project, ok := s.projects[id]
+	if !ok || project.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return &project, nil
+}
+
+func (m *memoryDBRepo) SelectProjectTodos(ctx context.Context, userID int, projectID int) ([]*models.Todo, error) {
+	s, done, err := m.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return s.selectTodos(func(todo *models.Todo) bool {
+		return todo.ProjectID != nil && *todo.ProjectID == projectID && todo.UserID == userID && todo.DeletedAt == nil
+	}, nil), nil
+}
+
+func (m *memoryDBRepo) InsertProject(ctx context.Context, project models.Project) (int, error) {
+	if utf8.RuneCountInString(project.Name) > maxProjectName {
+		return 0, fmt.Errorf("name should be at most %d characters", maxProjectName)
+	}
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.rollback()
+
+	now := time.Now()
+	project.ID = tx.store.nextID("project")
+	project.CreatedAt = now
+	project.UpdatedAt = now
+	tx.state().projects[project.ID] = project
+	return project.ID, tx.commit()
+}
+
+func (m *memoryDBRepo) UpdateProject(ctx context.Context, project models.Project) error {
+	if utf8.RuneCountInString(project.Name) > maxProjectName {
+		return fmt.Errorf("name should be at most %d characters", maxProjectName)
+	}
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.rollback()
+
+	s := tx.state()
+	stored, ok := s.projects[project.ID]
+	if !ok || stored.UserID != project.UserID {
+		return sql.ErrNoRows
+	}
+	stored.Name = project.Name
+	stored.Description = project.Description
+	stored.UpdatedAt = time.Now()
+	s.projects[project.ID] = stored
+	return tx.commit()
+}
+
+func (m *memoryDBRepo) DeleteProject(ctx context.Context, userID int, id int, deletion models.ProjectDeletion) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.rollback()
+
+	s := tx.state()
+	if deletion.ReassignTo != nil {
+		if *deletion.ReassignTo == id {
+			return errors.New("cannot reassign todos to the deleted project")
+		}
+		if err := s.checkProject(userID, deletion.ReassignTo); err != nil {
+			return err
+		}
+	}
+	if project, ok := s.projects[id]; !ok || project.UserID != userID {
+		return sql.ErrNoRows
+	}
+
+	var todos []int
+	for todoID, todo := range s.todos {
+		if todo.ProjectID != nil && *todo.ProjectID == id && todo.UserID == userID {
+			todos = append(todos, todoID)
+		}
+	}
+	if err = m.moveProjectTodos(tx, userID, todos, deletion); err != nil {
+		return err
+	}
+
+	delete(s.projects, id)
+	return tx.commit()
+}
+
+func (m *memoryDBRepo) InsertUser(ctx context.Context, user models.User) (int, error) {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.rollback()
+
+	s := tx.state()
+	for _, existing := range s.users {
+		if existing.Email == user.Email {
+			return 0, repository.ErrDuplicateEmail
+		}
+	}
+
+	now := time.Now()
+	user.ID = tx.store.nextID("users")
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	s.users[user.ID] = user
+	return user.ID, tx.commit()
+}
+
+func (m *memoryDBRepo) SelectUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	s, done, err := m.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// moveProjectTodos moves the todos of the deleted project to the project they are reassigned
+// to, or out of any project. With DeleteTodos the live ones go to the trash together with their
+// subtasks, like in DeleteTodo. Every todo is recorded in its history.
+func (m *memoryDBRepo) moveProjectTodos(tx *memoryTx, userID int, ids []int, deletion models.ProjectDeletion) error {
+	s := tx.state()
+	slices.Sort(ids)
+	now := time.Now()
+	for _, todoID := range ids {
+		before, err := s.snapshotTodo(userID, todoID)
+		if err != nil {
+			return err
+		}
+		todo := s.todos[todoID]
+		todo.ProjectID = deletion.ReassignTo
+		todo.Version++
+		todo.UpdatedAt = now
+		s.todos[todoID] = todo
+
+		// a todo trashed before, or with the subtree of an earlier one, only leaves the project
+		action := models.ActionUpdate
+		if deletion.DeleteTodos && before.DeletedAt == nil {
+			s.trashSubtree(todoID, now)
+			action = models.ActionDelete
+		}
+		if err = m.recordHistory(tx, userID, todoID, action, before); err != nil {
+			return err
+		}
+		if action == models.ActionDelete {
+			if err = m.rollUpCompleted(tx, before.ParentID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package dbrepo
+
+import (
+	"cmp"
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+)
+
+// searchQuery is a web search query, a todo matches it if it matches a term of every group
+// and none of the excluded terms
+type searchQuery struct {
+	groups   [][]*regexp.Regexp
+	excluded []*regexp.Regexp
+	// terms are the quoted terms of the groups, marked in the snippets
+	terms []string
+}
+
+// parseSearchQuery parses the web search syntax of websearch_to_tsquery: quoted phrases,
+// "or" between terms and -excluded terms. The terms match case-insensitively.
+func parseSearchQuery(query string) searchQuery {
+	var q searchQuery
+	or := false
+	for query = strings.TrimSpace(query); query != ""; query = strings.TrimSpace(query) {
+		excluded := strings.HasPrefix(query, "-")
+		if excluded {
+			query = query[1:]
+		}
+
+		var term string
+		if rest, ok := strings.CutPrefix(query, `"`); ok {
+			term, query, _ = strings.Cut(rest, `"`)
+		} else {
+			end := strings.IndexFunc(query, unicode.IsSpace)
+			if end < 0 {
+				end = len(query)
+			}
+			term, query = query[:end], query[end:]
+		}
+		term = strings.Join(strings.Fields(term), " ")
+		if term == "" {
+			continue
+		}
+		if !excluded && strings.EqualFold(term, "or") {
+			or = len(q.groups) > 0
+			continue
+		}
+
+		re := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(term))
+		if !excluded {
+			q.terms = append(q.terms, regexp.QuoteMeta(term))
+		}
+		switch {
+		case excluded:
+			q.excluded = append(q.excluded, re)
+		case or:
+			last := len(q.groups) - 1
+			q.groups[last] = append(q.groups[last], re)
+		default:
+			q.groups = append(q.groups, []*regexp.Regexp{re})
+		}
+		or = false
+	}
+	return q
+}
+
+// rank returns how well the todo matches the query, 0 if it does not. Like the weights of the
+// search column, matches in the name count more than in the description.
+func (q searchQuery) rank(todo *models.Todo) float64 {
+	if len(q.groups) == 0 {
+		return 0
+	}
+	for _, re := range q.excluded {
+		if re.MatchString(todo.Name) || re.MatchString(todo.Description) {
+			return 0
+		}
+	}
+
+	var rank float64
+	for _, group := range q.groups {
+		var matches float64
+		for _, re := range group {
+			matches += float64(len(re.FindAllStringIndex(todo.Name, -1)))
+			matches += 0.4 * float64(len(re.FindAllStringIndex(todo.Description, -1)))
+		}
+		if matches == 0 {
+			return 0
+		}
+		rank += matches
+	}
+	return rank
+}
+
+// snippet returns the name and the description of the todo with the matches of the terms
+// wrapped in <mark> tags
+func (q searchQuery) snippet(todo *models.Todo) string {
+	text := todo.Name + ". " + todo.Description
+	patterns := slices.Clone(q.terms)
+	// the longest terms first, so that they win over the terms they contain
+	slices.SortFunc(patterns, func(a, b string) int { return cmp.Compare(len(b), len(a)) })
+	re := regexp.MustCompile(`(?i)` + strings.Join(patterns, "|"))
+	return re.ReplaceAllString(text, "<mark>$0</mark>")
+}
+
+// SearchTodos finds the todos whose name or description contain the terms of the query, best matches
+// first. The query uses the web search syntax like the Postgres repo, but the terms are matched
+// as they are written, without stemming.
+func (m *memoryDBRepo) SearchTodos(ctx context.Context, userID int, query string, limit int) ([]*models.SearchResult, error) {
+	q := parseSearchQuery(query)
+
+	s, done, err := m.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	todos := s.selectTodos(func(todo *models.Todo) bool {
+		return todo.UserID == userID && todo.DeletedAt == nil
+	}, nil)
+
+	results := []*models.SearchResult{}
+	for _, todo := range todos {
+		if rank := q.rank(todo); rank > 0 {
+			results = append(results, &models.SearchResult{Todo: todo, Rank: rank, Snippet: q.snippet(todo)})
+		}
+	}
+	// the todos are sorted by deadline already, which breaks the ties
+	slices.SortStableFunc(results, func(a, b *models.SearchResult) int { return cmp.Compare(b.Rank, a.Rank) })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
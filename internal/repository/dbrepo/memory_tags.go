@@ -0,0 +1,69 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+)
+
+// AddTodoTags attaches the tags to the todo, keeping the tags it already has
+func (m *memoryDBRepo) AddTodoTags(ctx context.Context, userID int, id int, tags []string) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.rollback()
+
+	s := tx.state()
+	before, err := s.snapshotTodo(userID, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	// the tags are part of the todo, so changing them is a new version of it
+	todo := s.todos[id]
+	todo.Tags = sortedTags(append(slices.Clone(todo.Tags), tags...))
+	todo.Version++
+	todo.UpdatedAt = time.Now()
+	s.todos[id] = todo
+
+	if err = m.recordHistory(tx, userID, id, models.ActionUpdate, before); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// RemoveTodoTag detaches the tag from the todo
+func (m *memoryDBRepo) RemoveTodoTag(ctx context.Context, userID int, id int, tag string) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.rollback()
+
+	s := tx.state()
+	before, err := s.snapshotTodo(userID, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil || !slices.Contains(before.Tags, tag) {
+		return sql.ErrNoRows
+	}
+
+	todo := s.todos[id]
+	todo.Tags = slices.DeleteFunc(slices.Clone(todo.Tags), func(t string) bool { return t == tag })
+	todo.Version++
+	todo.UpdatedAt = time.Now()
+	s.todos[id] = todo
+
+	if err = m.recordHistory(tx, userID, id, models.ActionUpdate, before); err != nil {
+		return err
+	}
+	return tx.commit()
+}
@@ -0,0 +1,534 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/events"
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+)
+
+// insertTestTodos inserts todos of user 1 with the names, each deadline a day after the previous one
+func insertTestTodos(t *testing.T, repo repository.DatabaseRepo, names ...string) []int {
+	t.Helper()
+	var ids []int
+	for i, name := range names {
+		id, err := repo.InsertTodo(context.Background(), models.Todo{
+			UserID:   1,
+			Name:     name,
+			Deadline: testDeadline.AddDate(0, 0, len(names)-i),
+		})
+		if err != nil {
+			t.Fatalf("inserting %q: %v", name, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func todoNames(todos []*models.Todo) []string {
+	names := make([]string, 0, len(todos))
+	for _, todo := range todos {
+		names = append(names, todo.Name)
+	}
+	return names
+}
+
+func TestMemoryRepo_SelectTodos(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+	ids := insertTestTodos(t, repo, "c", "b", "a")
+	if err := repo.UpdateTodoCompleted(ctx, 1, ids[1], true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.InsertTodo(ctx, models.Todo{UserID: 2, Name: "other"}); err != nil {
+		t.Fatal(err)
+	}
+
+	todos, err := repo.SelectTodos(ctx, 1, models.TodoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := todoNames(todos); !slices.Equal(names, []string{"a", "b", "c"}) {
+		t.Errorf("ordered by deadline: got %v, wanted [a b c]", names)
+	}
+
+	completed := false
+	todos, err = repo.SelectTodos(ctx, 1, models.TodoFilter{Completed: &completed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := todoNames(todos); !slices.Equal(names, []string{"a", "c"}) {
+		t.Errorf("not completed: got %v, wanted [a c]", names)
+	}
+
+	if _, err = repo.SelectTodo(ctx, 2, ids[0]); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("todo of another user: got %v, wanted %v", err, sql.ErrNoRows)
+	}
+	if _, err = repo.SelectTodo(ctx, 1, 100); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown todo: got %v, wanted %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestMemoryRepo_SelectTodosPage(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+	insertTestTodos(t, repo, "e", "d", "c", "b", "a")
+	filter := models.TodoFilter{Sort: []models.SortField{{Field: "name", Desc: true}}}
+
+	var names []string
+	var after *models.TodoCursor
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("too many pages")
+		}
+		page, err := repo.SelectTodosPage(ctx, 1, 2, after, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, todoNames(page.Todos)...)
+		if !page.HasMore {
+			break
+		}
+		if after, err = models.DecodeTodoCursor(page.NextCursor); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(names, []string{"e", "d", "c", "b", "a"}) {
+		t.Errorf("got %v, wanted [e d c b a]", names)
+	}
+
+	_, err := repo.SelectTodosPage(ctx, 1, 2, &models.TodoCursor{ID: 1}, filter)
+	if !errors.Is(err, models.ErrInvalidCursor) {
+		t.Errorf("cursor of another sort: got %v, wanted %v", err, models.ErrInvalidCursor)
+	}
+}
+
+func TestMemoryRepo_Subtasks(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+	ids := insertTestTodos(t, repo, "parent")
+	parentID := ids[0]
+	for _, name := range []string{"first", "second"} {
+		if _, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: name, ParentID: &parentID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	children, err := repo.SelectTodoChildren(ctx, 1, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.UpdateTodoCompleted(ctx, 1, children[0].ID, true); err != nil {
+		t.Fatal(err)
+	}
+	parent, err := repo.SelectTodo(ctx, 1, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent.Completed || parent.Progress != 50 {
+		t.Errorf("one of two subtasks completed: got completed %v and progress %d, wanted false and 50", parent.Completed, parent.Progress)
+	}
+
+	if err = repo.DeleteTodo(ctx, 1, children[1].ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	parent, err = repo.SelectTodo(ctx, 1, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parent.Completed || parent.Progress != 100 {
+		t.Errorf("the other subtask trashed: got completed %v and progress %d, wanted true and 100", parent.Completed, parent.Progress)
+	}
+
+	child := *children[0]
+	child.ParentID = &child.ID
+	if err = repo.UpdateTodo(ctx, child); !errors.Is(err, repository.ErrTodoCycle) {
+		t.Errorf("own parent: got %v, wanted %v", err, repository.ErrTodoCycle)
+	}
+}
+
+func TestMemoryRepo_DeleteLastIncompleteSubtask(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+	ids := insertTestTodos(t, repo, "parent")
+	parentID := ids[0]
+	childID, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: "child", ParentID: &parentID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := repo.SelectTodo(ctx, 1, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = repo.DeleteTodo(ctx, 1, childID, 0); err != nil {
+		t.Fatal(err)
+	}
+	parent, err := repo.SelectTodo(ctx, 1, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent.Completed || parent.Version != before.Version {
+		t.Errorf("last subtask trashed: got completed %v and version %d, wanted false and %d", parent.Completed, parent.Version, before.Version)
+	}
+
+	if err = repo.UpdateTodoCompleted(ctx, 1, parentID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.RestoreTodo(ctx, 1, childID); err != nil {
+		t.Fatal(err)
+	}
+	history, err := repo.SelectTodoHistory(ctx, 1, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := history[len(history)-1]; last.Action != models.ActionIncomplete {
+		t.Errorf("incomplete subtask restored: got %s as the last change of the parent, wanted %s", last.Action, models.ActionIncomplete)
+	}
+}
+
+func TestMemoryRepo_UpdateTodoVersion(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+	ids := insertTestTodos(t, repo, "milk")
+
+	err := repo.UpdateTodo(ctx, models.Todo{ID: ids[0], UserID: 1, Name: "bread", Version: 1}, "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.UpdateTodo(ctx, models.Todo{ID: ids[0], UserID: 1, Name: "eggs", Version: 1}, "name")
+	if !errors.Is(err, repository.ErrVersionConflict) {
+		t.Errorf("stale version: got %v, wanted %v", err, repository.ErrVersionConflict)
+	}
+
+	todo, err := repo.SelectTodo(ctx, 1, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if todo.Name != "bread" || todo.Version != 2 {
+		t.Errorf("got %q at version %d, wanted \"bread\" at version 2", todo.Name, todo.Version)
+	}
+}
+
+func TestMemoryRepo_UpdateTodoRecurring(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+	id, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: "milk", Deadline: testDeadline, RRule: "FREQ=DAILY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo, err := repo.SelectTodo(ctx, 1, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// completing the todo with PUT, twice
+	todo.Completed = true
+	for i := 0; i < 2; i++ {
+		if err = repo.UpdateTodo(ctx, *todo); err != nil {
+			t.Fatal(err)
+		}
+		todo.RRule = ""
+		todo.Version = 0
+	}
+
+	todos, err := repo.SelectTodos(ctx, 1, models.TodoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 2 {
+		t.Fatalf("got %d todos, wanted the todo and its next occurrence", len(todos))
+	}
+	for _, got := range todos {
+		if got.ID == id {
+			if !got.Completed || got.RRule != "" {
+				t.Errorf("completed todo: got completed %v and rule %q, wanted true and no rule", got.Completed, got.RRule)
+			}
+			continue
+		}
+		if got.Completed || got.RRule != "FREQ=DAILY" || !got.Deadline.Equal(testDeadline.AddDate(0, 0, 1)) {
+			t.Errorf("next occurrence: got completed %v, rule %q and deadline %v, wanted false, \"FREQ=DAILY\" and %v",
+				got.Completed, got.RRule, got.Deadline, testDeadline.AddDate(0, 0, 1))
+		}
+	}
+}
+
+func TestMemoryRepo_Trash(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+	ids := insertTestTodos(t, repo, "milk")
+
+	if err := repo.DeleteTodo(ctx, 1, ids[0], 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SelectTodo(ctx, 1, ids[0]); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("trashed todo: got %v, wanted %v", err, sql.ErrNoRows)
+	}
+	if err := repo.DeleteTodo(ctx, 1, ids[0], 0); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("deleting a trashed todo: got %v, wanted %v", err, sql.ErrNoRows)
+	}
+
+	if err := repo.RestoreTodo(ctx, 1, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SelectTodo(ctx, 1, ids[0]); err != nil {
+		t.Errorf("restored todo: got %v", err)
+	}
+
+	if err := repo.DeleteTodo(ctx, 1, ids[0], 0); err != nil {
+		t.Fatal(err)
+	}
+	purged, err := repo.PurgeTrash(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Errorf("purged %d todos, wanted 1", purged)
+	}
+	if _, err = repo.SelectTodoHistory(ctx, 1, ids[0]); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("history of a purged todo: got %v, wanted %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestMemoryRepo_DeleteProjectTrashesTodos(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+	projectID, err := repo.InsertProject(ctx, models.Project{UserID: 1, Name: "groceries"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: "milk", ProjectID: &projectID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = repo.DeleteProject(ctx, 1, projectID, models.ProjectDeletion{DeleteTodos: true}); err != nil {
+		t.Fatal(err)
+	}
+	trash, err := repo.SelectTrash(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].ID != id || trash[0].ProjectID != nil {
+		t.Errorf("trash after deleting the project: got %v, wanted todo %d without a project", todoNames(trash), id)
+	}
+	history, err := repo.SelectTodoHistory(ctx, 1, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := history[len(history)-1]; last.Action != models.ActionDelete {
+		t.Errorf("last change of the todo: got %s, wanted %s", last.Action, models.ActionDelete)
+	}
+
+	if err = repo.RestoreTodo(ctx, 1, id); err != nil {
+		t.Errorf("restoring the todo: got %v", err)
+	}
+}
+
+func TestMemoryRepo_DeleteProjectReassignsTodos(t *testing.T) {
+	ctx := context.Background()
+	bus := events.NewBus(events.DefaultBufferSize)
+	repo := NewMemoryRepo(bus)
+	var projectIDs []int
+	for _, name := range []string{"groceries", "shopping"} {
+		projectID, err := repo.InsertProject(ctx, models.Project{UserID: 1, Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		projectIDs = append(projectIDs, projectID)
+	}
+	id, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: "milk", ProjectID: &projectIDs[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, _, _ := bus.Subscribe(1, 0)
+	defer sub.Close()
+
+	deletion := models.ProjectDeletion{ReassignTo: &projectIDs[1]}
+	if err = repo.DeleteProject(ctx, 1, projectIDs[0], deletion); err != nil {
+		t.Fatal(err)
+	}
+	history, err := repo.SelectTodoHistory(ctx, 1, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := history[len(history)-1]; last.Action != models.ActionUpdate {
+		t.Errorf("last change of the todo: got %s, wanted %s", last.Action, models.ActionUpdate)
+	}
+	select {
+	case event := <-sub.C:
+		if event.Type != events.Updated {
+			t.Errorf("got %s event, wanted %s", event.Type, events.Updated)
+		}
+	default:
+		t.Errorf("reassigning the todo published no event")
+	}
+}
+
+func TestMemoryRepo_WithTx(t *testing.T) {
+	ctx := context.Background()
+	bus := events.NewBus(events.DefaultBufferSize)
+	sub, _, _ := bus.Subscribe(1, 0)
+	defer sub.Close()
+	repo := NewMemoryRepo(bus)
+
+	failed := errors.New("failed")
+	err := repo.WithTx(ctx, func(repo repository.DatabaseRepo) error {
+		if _, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: "milk"}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("got %v, wanted %v", err, failed)
+	}
+	todos, err := repo.SelectTodos(ctx, 1, models.TodoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 0 {
+		t.Errorf("rolled back transaction kept %d todos", len(todos))
+	}
+	select {
+	case event := <-sub.C:
+		t.Errorf("rolled back transaction published %s", event.Type)
+	default:
+	}
+
+	err = repo.WithTx(ctx, func(repo repository.DatabaseRepo) error {
+		_, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: "bread"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-sub.C:
+		if event.Type != events.Created {
+			t.Errorf("got %s event, wanted %s", event.Type, events.Created)
+		}
+	default:
+		t.Error("committed transaction published no event")
+	}
+}
+
+func TestMemoryRepo_Undo(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil).WithAudit(models.Audit{Undoable: true})
+	ids := insertTestTodos(t, repo, "milk")
+	if err := repo.UpdateTodo(ctx, models.Todo{ID: ids[0], UserID: 1, Name: "bread"}, "name"); err != nil {
+		t.Fatal(err)
+	}
+
+	undone, err := repo.UndoOperations(ctx, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo, err := repo.SelectTodo(ctx, 1, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if undone != 1 || todo.Name != "milk" {
+		t.Errorf("undo: got %d operations and %q, wanted 1 and \"milk\"", undone, todo.Name)
+	}
+
+	redone, err := repo.RedoOperations(ctx, 1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo, err = repo.SelectTodo(ctx, 1, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redone != 1 || todo.Name != "bread" {
+		t.Errorf("redo: got %d operations and %q, wanted 1 and \"bread\"", redone, todo.Name)
+	}
+
+	// a change that cannot be undone, like the ones made through gRPC
+	audited := repo.WithAudit(models.Audit{})
+	if err = audited.UpdateTodoCompleted(ctx, 1, ids[0], true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.UndoOperations(ctx, 1, 1); !errors.Is(err, repository.ErrUndoConflict) {
+		t.Errorf("undo after another change: got %v, wanted %v", err, repository.ErrUndoConflict)
+	}
+}
+
+func TestMemoryRepo_ConcurrentInserts(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo(nil)
+
+	const inserts = 50
+	var wg sync.WaitGroup
+	ids := make(chan int, inserts)
+	for i := 0; i < inserts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: "milk"})
+			if err != nil {
+				t.Error(err)
+			}
+			ids <- id
+			if _, err = repo.SelectTodos(ctx, 1, models.TodoFilter{}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[int]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("id %d was given twice", id)
+		}
+		seen[id] = true
+	}
+	todos, err := repo.SelectTodos(ctx, 1, models.TodoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != inserts {
+		t.Errorf("got %d todos, wanted %d", len(todos), inserts)
+	}
+}
+
+var theMemorySearchTests = []struct {
+	name     string
+	query    string
+	expected []string
+}{
+	{"single word", "milk", []string{"milk and bread", "buy milk"}},
+	{"all words", "milk bread", []string{"milk and bread"}},
+	{"or", "eggs or bread", []string{"eggs", "milk and bread"}},
+	{"phrase", `"buy milk"`, []string{"buy milk"}},
+	{"excluded word", "milk -bread", []string{"buy milk"}},
+	{"no match", "cheese", []string{}},
+}
+
+func TestMemoryRepo_SearchTodos(t *testing.T) {
+	repo := NewMemoryRepo(nil)
+	insertTestTodos(t, repo, "buy milk", "milk and bread", "eggs")
+
+	for _, e := range theMemorySearchTests {
+		results, err := repo.SearchTodos(context.Background(), 1, e.query, 10)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		names := []string{}
+		for _, result := range results {
+			names = append(names, result.Todo.Name)
+		}
+		if !slices.Equal(names, e.expected) {
+			t.Errorf("%s: got %v, wanted %v", e.name, names, e.expected)
+		}
+	}
+}
@@ -0,0 +1,764 @@
+package dbrepo
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/anras5/todo-app-backend/internal/rrule"
+)
+
+// subtasks counts the subtasks of a todo outside of the trash and how many of them are completed
+type subtasks struct {
+	total     int
+	completed int
+}
+
+// countSubtasks returns the subtasks of every todo with any
+func (s *memoryState) countSubtasks() map[int]subtasks {
+	counts := make(map[int]subtasks)
+	for _, child := range s.todos {
+		if child.ParentID == nil || child.DeletedAt != nil {
+			continue
+		}
+		count := counts[*child.ParentID]
+		count.total++
+		if child.Completed {
+			count.completed++
+		}
+		counts[*child.ParentID] = count
+	}
+	return counts
+}
+
+// todo returns a copy of a stored todo like scanTodo reads it
+func (s *memoryState) todo(stored models.Todo) *models.Todo {
+	var count subtasks
+	for _, child := range s.todos {
+		if child.ParentID != nil && *child.ParentID == stored.ID && child.DeletedAt == nil {
+			count.total++
+			if child.Completed {
+				count.completed++
+			}
+		}
+	}
+	return todoWithProgress(stored, count)
+}
+
+// todoWithProgress returns a copy of a stored todo with the progress derived from its subtasks,
+// the percentage of the completed ones or 0/100 depending on its own state if it has none
+func todoWithProgress(stored models.Todo, count subtasks) *models.Todo {
+	todo := stored
+	// never nil, like the tags read by scanTodo
+	todo.Tags = append([]string{}, stored.Tags...)
+	todo.Progress = 0
+	switch {
+	case count.total > 0:
+		todo.Progress = 100 * count.completed / count.total
+	case todo.Completed:
+		todo.Progress = 100
+	}
+	return &todo
+}
+
+// selectTodos returns the todos kept by keep, sorted by sort
+func (s *memoryState) selectTodos(keep func(todo *models.Todo) bool, sort []models.SortField) []*models.Todo {
+	counts := s.countSubtasks()
+	todos := []*models.Todo{}
+	for _, stored := range s.todos {
+		todo := todoWithProgress(stored, counts[stored.ID])
+		if keep(todo) {
+			todos = append(todos, todo)
+		}
+	}
+	sortTodos(todos, sort)
+	return todos
+}
+
+// sortTodos sorts the todos by the normalized sort, like the ORDER BY of queryBuilder
+func sortTodos(todos []*models.Todo, sort []models.SortField) {
+	sort = models.NormalizeTodoSort(sort)
+	slices.SortFunc(todos, func(a, b *models.Todo) int {
+		return compareTodos(a, b, sort)
+	})
+}
+
+// compareTodos compares the todos by the fields of the sort in order
+func compareTodos(a *models.Todo, b *models.Todo, sort []models.SortField) int {
+	for _, field := range sort {
+		var c int
+		switch field.Field {
+		case "deadline":
+			c = a.Deadline.Compare(b.Deadline)
+		case "created_at":
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		case "updated_at":
+			c = a.UpdatedAt.Compare(b.UpdatedAt)
+		case "name":
+			c = strings.Compare(a.Name, b.Name)
+		case "completed":
+			// false comes first, like in the database
+			c = cmp.Compare(boolOrder(a.Completed), boolOrder(b.Completed))
+		default:
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		if field.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func boolOrder(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// cursorTodo returns a todo with the sort fields of the cursor, the todos after the cursor
+// compare greater than it
+func cursorTodo(cursor *models.TodoCursor, sort []models.SortField) (*models.Todo, error) {
+	sort = models.NormalizeTodoSort(sort)
+	// the values of all the fields but the id, which is the last one
+	if len(cursor.Values) != len(sort)-1 {
+		return nil, models.ErrInvalidCursor
+	}
+
+	todo := &models.Todo{ID: cursor.ID}
+	for i, value := range cursor.Values {
+		column, ok := sortColumns[sort[i].Field]
+		if !ok {
+			return nil, models.ErrInvalidCursor
+		}
+		parsed, err := column.parse(value)
+		if err != nil {
+			return nil, models.ErrInvalidCursor
+		}
+		switch sort[i].Field {
+		case "deadline":
+			todo.Deadline = parsed.(time.Time)
+		case "created_at":
+			todo.CreatedAt = parsed.(time.Time)
+		case "updated_at":
+			todo.UpdatedAt = parsed.(time.Time)
+		case "name":
+			todo.Name = parsed.(string)
+		case "completed":
+			todo.Completed = parsed.(bool)
+		}
+	}
+	return todo, nil
+}
+
+// matchesFilter reports whether the todo is kept by the filter, like the conditions of queryBuilder
+func matchesFilter(todo *models.Todo, filter models.TodoFilter) bool {
+	if filter.Completed != nil && todo.Completed != *filter.Completed {
+		return false
+	}
+
+	if tags := models.NormalizeTags(filter.Tags); len(tags) > 0 {
+		matched := 0
+		for _, tag := range tags {
+			if slices.Contains(todo.Tags, tag) {
+				matched++
+			}
+		}
+		if matched == 0 || filter.MatchAllTags && matched < len(tags) {
+			return false
+		}
+	}
+
+	if !inRange(todo.Deadline, filter.DeadlineAfter, filter.DeadlineBefore) ||
+		!inRange(todo.CreatedAt, filter.CreatedAfter, filter.CreatedBefore) ||
+		!inRange(todo.UpdatedAt, filter.UpdatedAfter, filter.UpdatedBefore) {
+		return false
+	}
+
+	if filter.Overdue && (todo.Completed || !todo.Deadline.Before(time.Now())) {
+		return false
+	}
+
+	if filter.NameContains != "" && !strings.Contains(strings.ToLower(todo.Name), strings.ToLower(filter.NameContains)) {
+		return false
+	}
+	return true
+}
+
+// inRange reports whether t is in [after, before), a missing bound is not checked
+func inRange(t time.Time, after *time.Time, before *time.Time) bool {
+	return (after == nil || !t.Before(*after)) && (before == nil || t.Before(*before))
+}
+
+// checkSort returns models.ErrInvalidSort if the todos cannot be sorted by a field of the sort
+func checkSort(sort []models.SortField) error {
+	for _, field := range sort {
+		if _, ok := sortColumns[field.Field]; !ok {
+			return fmt.Errorf("%w: todos cannot be sorted by %q", models.ErrInvalidSort, field.Field)
+		}
+	}
+	return nil
+}
+
+func (m *memoryDBRepo) SelectTodos(ctx context.Context, userID int, filter models.TodoFilter) ([]*models.Todo, error) {
+	if err := checkSort(filter.Sort); err != nil {
+		return nil, err
+	}
+
+	s, done, err := m.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return s.selectTodos(func(todo *models.Todo) bool {
+		return todo.UserID == userID && todo.DeletedAt == nil && matchesFilter(todo, filter)
+	}, filter.Sort), nil
+}
+
+func (m *memoryDBRepo) SelectTodosPage(ctx context.Context, userID int, limit int, after *models.TodoCursor, filter models.TodoFilter) (*models.TodoPage, error) {
+	if err := checkSort(filter.Sort); err != nil {
+		return nil, err
+	}
+	var pivot *models.Todo
+	if after != nil {
+		var err error
+		if pivot, err = cursorTodo(after, filter.Sort); err != nil {
+			return nil, err
+		}
+	}
+	sort := models.NormalizeTodoSort(filter.Sort)
+
+	s, done, err := m.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	todos := s.selectTodos(func(todo *models.Todo) bool {
+		return todo.UserID == userID && todo.DeletedAt == nil && matchesFilter(todo, filter) &&
+			(pivot == nil || compareTodos(todo, pivot, sort) > 0)
+	}, sort)
+
+	page := &models.TodoPage{Todos: todos}
+	if len(page.Todos) > limit {
+		page.Todos = page.Todos[:limit]
+		page.HasMore = true
+		page.NextCursor = page.Todos[limit-1].Cursor(filter.Sort)
+	}
+	return page, nil
+}
+
+func (m *memoryDBRepo) SelectTodo(ctx context.Context, userID int, id int) (*models.Todo, error) {
+	s, done, err := m.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	stored, ok := s.todos[id]
+	if !ok || stored.UserID != userID || stored.DeletedAt != nil {
+		return nil, sql.ErrNoRows
+	}
+	return s.todo(stored), nil
+}
+
+func (m *memoryDBRepo) SelectTodoChildren(ctx context.Context, userID int, id int) ([]*models.Todo, error) {
+	s, done, err := m.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return s.selectTodos(func(todo *models.Todo) bool {
+		return todo.ParentID != nil && *todo.ParentID == id && todo.UserID == userID && todo.DeletedAt == nil
+	}, nil), nil
+}
+
+func (m *memoryDBRepo) InsertTodo(ctx context.Context, todo models.Todo) (int, error) {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.rollback()
+
+	newID, err := m.createTodo(tx, todo)
+	if err != nil {
+		return 0, err
+	}
+	return newID, tx.commit()
+}
+
+// createTodo checks and inserts a todo as a part of the transaction, see InsertTodo
+func (m *memoryDBRepo) createTodo(tx *memoryTx, todo models.Todo) (int, error) {
+	rule, err := rrule.Normalize(todo.RRule)
+	if err != nil {
+		return 0, err
+	}
+	todo.RRule = rule
+
+	s := tx.state()
+	if err := s.checkProject(todo.UserID, todo.ProjectID); err != nil {
+		return 0, err
+	}
+	if err := s.checkParent(todo.UserID, 0, todo.ParentID); err != nil {
+		return 0, err
+	}
+
+	newID, err := s.insertTodo(tx.store.nextID("todo"), todo)
+	if err != nil {
+		return 0, err
+	}
+	if err = m.recordHistory(tx, todo.UserID, newID, models.ActionInsert, nil); err != nil {
+		return 0, err
+	}
+
+	if err = m.rollUpCompleted(tx, todo.ParentID); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// insertTodo stores the todo with the id, the name is limited like the column of the database
+func (s *memoryState) insertTodo(id int, todo models.Todo) (int, error) {
+	if utf8.RuneCountInString(todo.Name) > maxTodoName {
+		return 0, fmt.Errorf("name should be at most %d characters", maxTodoName)
+	}
+
+	now := time.Now()
+	todo.ID = id
+	todo.Deadline = storedTime(todo.Deadline)
+	todo.Version = 1
+	todo.Progress = 0
+	todo.DeletedAt = nil
+	todo.CreatedAt = now
+	todo.UpdatedAt = now
+	todo.Tags = sortedTags(todo.Tags)
+	s.todos[id] = todo
+	return id, nil
+}
+
+// sortedTags returns the normalized tags sorted like the tags read by scanTodo
+func sortedTags(tags []string) []string {
+	tags = models.NormalizeTags(tags)
+	slices.Sort(tags)
+	return tags
+}
+
+// UpdateTodo updates the given fields of a todo, or all of them if no fields are given.
+// Without fields nil tags leave the tags of the todo unchanged.
+// Completing a recurring todo creates its next occurrence, like UpdateTodoCompleted.
+func (m *memoryDBRepo) UpdateTodo(ctx context.Context, todo models.Todo, fields ...string) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.rollback()
+
+	if err = m.updateTodo(tx, todo, fields...); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// updateTodo updates a todo as a part of the transaction, see UpdateTodo
+func (m *memoryDBRepo) updateTodo(tx *memoryTx, todo models.Todo, fields ...string) error {
+	mask, err := models.NewTodoFieldMask(fields...)
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		mask, _ = models.NewTodoFieldMask(models.TodoUpdateFields...)
+		mask["tags"] = todo.Tags != nil
+	}
+
+	if mask["rrule"] {
+		rule, err := rrule.Normalize(todo.RRule)
+		if err != nil {
+			return err
+		}
+		todo.RRule = rule
+	}
+
+	s := tx.state()
+	if mask["project_id"] {
+		if err := s.checkProject(todo.UserID, todo.ProjectID); err != nil {
+			return err
+		}
+	}
+
+	if mask["parent_id"] {
+		if err := s.checkParent(todo.UserID, todo.ID, todo.ParentID); err != nil {
+			return err
+		}
+	}
+
+	before, err := s.snapshotTodo(todo.UserID, todo.ID)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+	if todo.Version != 0 && todo.Version != before.Version {
+		return repository.ErrVersionConflict
+	}
+	if mask["name"] && utf8.RuneCountInString(todo.Name) > maxTodoName {
+		return fmt.Errorf("name should be at most %d characters", maxTodoName)
+	}
+	// remember the previous parent, its completion state may change as well
+	oldParentID := before.ParentID
+	if !mask["parent_id"] {
+		todo.ParentID = oldParentID
+	}
+
+	updated := s.todos[todo.ID]
+	updated.Version++
+	updated.UpdatedAt = time.Now()
+	if mask["project_id"] {
+		updated.ProjectID = todo.ProjectID
+	}
+	if mask["parent_id"] {
+		updated.ParentID = todo.ParentID
+	}
+	if mask["name"] {
+		updated.Name = todo.Name
+	}
+	if mask["description"] {
+		updated.Description = todo.Description
+	}
+	if mask["deadline"] {
+		updated.Deadline = storedTime(todo.Deadline)
+	}
+	if mask["completed"] {
+		updated.Completed = todo.Completed
+	}
+	if mask["rrule"] {
+		updated.RRule = todo.RRule
+	}
+	if mask["tags"] {
+		updated.Tags = sortedTags(todo.Tags)
+	}
+	s.todos[todo.ID] = updated
+
+	if mask["completed"] && todo.Completed && !before.Completed {
+		// the next occurrence follows the todo as updated
+		current, err := s.snapshotTodo(todo.UserID, todo.ID)
+		if err != nil {
+			return err
+		}
+		if err = m.scheduleNextOccurrence(tx, current); err != nil {
+			return err
+		}
+	}
+
+	if err = m.recordHistory(tx, todo.UserID, todo.ID, models.ActionUpdate, before); err != nil {
+		return err
+	}
+
+	if mask["completed"] || mask["parent_id"] {
+		if err = m.rollUpCompleted(tx, todo.ParentID); err != nil {
+			return err
+		}
+	}
+	if oldParentID != nil && (todo.ParentID == nil || *oldParentID != *todo.ParentID) {
+		if err = m.rollUpCompleted(tx, oldParentID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateTodoCompleted changes the completion state of a todo and derives the
+// state of its ancestors, a parent is completed when all its subtasks are.
+// Completing a recurring todo creates its next occurrence.
+func (m *memoryDBRepo) UpdateTodoCompleted(ctx context.Context, userID int, id int, completed bool) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.rollback()
+
+	if err = m.completeTodo(tx, userID, id, completed); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// completeTodo changes the completion state of a todo as a part of the transaction, see UpdateTodoCompleted
+func (m *memoryDBRepo) completeTodo(tx *memoryTx, userID int, id int, completed bool) error {
+	s := tx.state()
+	before, err := s.snapshotTodo(userID, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	updated := s.todos[id]
+	updated.Completed = completed
+	updated.Version++
+	updated.UpdatedAt = time.Now()
+	s.todos[id] = updated
+
+	if completed && !before.Completed {
+		if err = m.scheduleNextOccurrence(tx, before); err != nil {
+			return err
+		}
+	}
+
+	action := models.ActionIncomplete
+	if completed {
+		action = models.ActionComplete
+	}
+	if err = m.recordHistory(tx, userID, id, action, before); err != nil {
+		return err
+	}
+
+	return m.rollUpCompleted(tx, updated.ParentID)
+}
+
+// scheduleNextOccurrence creates the next occurrence of a recurring todo with the deadline
+// advanced by its rule. The rule moves to the new todo, so completing the old todo again
+// does not create another one.
+func (m *memoryDBRepo) scheduleNextOccurrence(tx *memoryTx, todo *models.Todo) error {
+	if todo.RRule == "" {
+		return nil
+	}
+
+	rule, err := rrule.Parse(todo.RRule)
+	if err != nil {
+		return err
+	}
+
+	s := tx.state()
+	updated := s.todos[todo.ID]
+	updated.RRule = ""
+	updated.Version++
+	s.todos[todo.ID] = updated
+
+	deadline, rest, ok := rule.Next(todo.Deadline)
+	if !ok {
+		// that was the last occurrence
+		return nil
+	}
+
+	next := *todo
+	next.Deadline = deadline
+	next.Completed = false
+	next.RRule = rest.String()
+	nextID, err := s.insertTodo(tx.store.nextID("todo"), next)
+	if err != nil {
+		return err
+	}
+	return m.recordHistory(tx, next.UserID, nextID, models.ActionInsert, nil)
+}
+
+// DeleteTodo moves a todo together with its subtasks to the trash. A version other than 0
+// must match the current version of the todo.
+func (m *memoryDBRepo) DeleteTodo(ctx context.Context, userID int, id int, version int) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.rollback()
+
+	if err = m.deleteTodo(tx, userID, id, version); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// deleteTodo moves a todo to the trash as a part of the transaction, see DeleteTodo
+func (m *memoryDBRepo) deleteTodo(tx *memoryTx, userID int, id int, version int) error {
+	s := tx.state()
+	before, err := s.snapshotTodo(userID, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+	if version != 0 && version != before.Version {
+		return repository.ErrVersionConflict
+	}
+
+	s.trashSubtree(id, time.Now())
+	if err = m.recordHistory(tx, userID, id, models.ActionDelete, before); err != nil {
+		return err
+	}
+
+	return m.rollUpCompleted(tx, before.ParentID)
+}
+
+// snapshotTodo returns a todo of the user, trashed or not, or sql.ErrNoRows
+func (s *memoryState) snapshotTodo(userID int, id int) (*models.Todo, error) {
+	stored, ok := s.todos[id]
+	if !ok || stored.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return s.todo(stored), nil
+}
+
+// checkProject returns repository.ErrProjectNotFound if the project is set and not owned by the user
+func (s *memoryState) checkProject(userID int, projectID *int) error {
+	if projectID == nil {
+		return nil
+	}
+	if project, ok := s.projects[*projectID]; !ok || project.UserID != userID {
+		return repository.ErrProjectNotFound
+	}
+	return nil
+}
+
+// checkParent makes sure the parent exists, is owned by the user and that
+// making it the parent of the todo would not create a cycle
+func (s *memoryState) checkParent(userID int, todoID int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	if todoID != 0 && *parentID == todoID {
+		return repository.ErrTodoCycle
+	}
+
+	parent, ok := s.todos[*parentID]
+	if !ok || parent.UserID != userID || parent.DeletedAt != nil {
+		return repository.ErrParentNotFound
+	}
+	visited := make(map[int]bool)
+	for ok && !visited[parent.ID] {
+		if parent.ID == todoID {
+			return repository.ErrTodoCycle
+		}
+		visited[parent.ID] = true
+		if parent.ParentID == nil {
+			break
+		}
+		parent, ok = s.todos[*parent.ParentID]
+	}
+	return nil
+}
+
+// rollUpCompleted rolls the completion up to the ancestors of the parent, see rollUp,
+// and records every ancestor it completes or reopens in the history
+func (m *memoryDBRepo) rollUpCompleted(tx *memoryTx, parentID *int) error {
+	return tx.state().rollUp(parentID, func(userID int, id int, action string, before *models.Todo) error {
+		return m.recordHistory(tx, userID, id, action, before)
+	})
+}
+
+// rollUp walks up from the parent and marks every ancestor with live subtasks as completed
+// if all of them are, and as not completed otherwise. Ancestors without live subtasks keep
+// their completion. Only an ancestor whose completion flips is changed and passed to record.
+func (s *memoryState) rollUp(parentID *int, record recordFunc) error {
+	visited := make(map[int]bool)
+	for parentID != nil && !visited[*parentID] {
+		visited[*parentID] = true
+
+		parent, ok := s.todos[*parentID]
+		if !ok {
+			return sql.ErrNoRows
+		}
+		hasSubtasks, subtasksCompleted := false, true
+		for _, child := range s.todos {
+			if child.ParentID != nil && *child.ParentID == parent.ID && child.DeletedAt == nil {
+				hasSubtasks = true
+				if !child.Completed {
+					subtasksCompleted = false
+					break
+				}
+			}
+		}
+
+		if hasSubtasks && parent.Completed != subtasksCompleted {
+			before := s.todo(parent)
+			parent.Completed = subtasksCompleted
+			parent.Version++
+			parent.UpdatedAt = time.Now()
+			s.todos[parent.ID] = parent
+
+			action := models.ActionIncomplete
+			if subtasksCompleted {
+				action = models.ActionComplete
+			}
+			if err := record(parent.UserID, parent.ID, action, before); err != nil {
+				return err
+			}
+		}
+		parentID = parent.ParentID
+	}
+	return nil
+}
+
+// subtree returns the id of the todo followed by the ids of its subtasks kept by keep, and of their subtasks
+func (s *memoryState) subtree(id int, keep func(todo models.Todo) bool) []int {
+	ids := []int{id}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range s.todos {
+			if child.ParentID != nil && *child.ParentID == ids[i] && keep(child) && !slices.Contains(ids, child.ID) {
+				ids = append(ids, child.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// trashSubtree moves a todo and its subtasks outside of the trash into it. The subtasks get
+// the same deleted_at, so that restoring the todo restores them as well.
+func (s *memoryState) trashSubtree(id int, deletedAt time.Time) {
+	ids := s.subtree(id, func(todo models.Todo) bool { return todo.DeletedAt == nil })
+	s.setDeletedAt(ids, &deletedAt)
+}
+
+// restoreSubtree takes a todo out of the trash together with the subtasks trashed with it
+func (s *memoryState) restoreSubtree(id int, deletedAt time.Time) {
+	ids := s.subtree(id, func(todo models.Todo) bool {
+		return todo.DeletedAt != nil && todo.DeletedAt.Equal(deletedAt)
+	})
+	s.setDeletedAt(ids, nil)
+}
+
+func (s *memoryState) setDeletedAt(ids []int, deletedAt *time.Time) {
+	now := time.Now()
+	for _, id := range ids {
+		todo := s.todos[id]
+		todo.DeletedAt = deletedAt
+		todo.Version++
+		todo.UpdatedAt = now
+		s.todos[id] = todo
+	}
+}
+
+// purgeTodos permanently deletes the todos together with their subtasks and history, like the
+// foreign keys of the database cascade
+func (s *memoryState) purgeTodos(ids []int) {
+	purged := make(map[int]bool)
+	for _, id := range ids {
+		for _, subtask := range s.subtree(id, func(models.Todo) bool { return true }) {
+			purged[subtask] = true
+		}
+	}
+	for id := range purged {
+		delete(s.todos, id)
+	}
+
+	// a new slice, the old one may still be the history of a saved state
+	history := make([]memoryHistory, 0, len(s.history))
+	for _, entry := range s.history {
+		if !purged[entry.TodoID] {
+			history = append(history, entry)
+		}
+	}
+	s.history = history
+}
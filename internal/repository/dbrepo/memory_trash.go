@@ -0,0 +1,100 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+)
+
+// SelectTrash returns the trashed todos of the user, most recently deleted first
+func (m *memoryDBRepo) SelectTrash(ctx context.Context, userID int) ([]*models.Todo, error) {
+	s, done, err := m.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	todos := s.selectTodos(func(todo *models.Todo) bool {
+		return todo.UserID == userID && todo.DeletedAt != nil
+	}, []models.SortField{{Field: "id"}})
+	slices.SortStableFunc(todos, func(a, b *models.Todo) int {
+		return b.DeletedAt.Compare(*a.DeletedAt)
+	})
+	return todos, nil
+}
+
+// RestoreTodo takes a todo out of the trash together with the subtasks deleted with it.
+// A subtask cannot be restored while its parent is in the trash.
+func (m *memoryDBRepo) RestoreTodo(ctx context.Context, userID int, id int) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.rollback()
+
+	s := tx.state()
+	before, err := s.snapshotTodo(userID, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt == nil {
+		return sql.ErrNoRows
+	}
+
+	if before.ParentID != nil {
+		if parent, ok := s.todos[*before.ParentID]; !ok || parent.DeletedAt != nil {
+			return repository.ErrParentNotFound
+		}
+	}
+
+	s.restoreSubtree(id, *before.DeletedAt)
+	if err = m.recordHistory(tx, userID, id, models.ActionRestore, before); err != nil {
+		return err
+	}
+
+	if err = m.rollUpCompleted(tx, before.ParentID); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// PurgeTodo permanently deletes a trashed todo together with its subtasks
+func (m *memoryDBRepo) PurgeTodo(ctx context.Context, userID int, id int) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.rollback()
+
+	s := tx.state()
+	todo, ok := s.todos[id]
+	if !ok || todo.UserID != userID || todo.DeletedAt == nil {
+		return sql.ErrNoRows
+	}
+	s.purgeTodos([]int{id})
+	return tx.commit()
+}
+
+// PurgeTrash permanently deletes the todos of all users trashed before the given time
+// and returns how many were deleted
+func (m *memoryDBRepo) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.rollback()
+
+	s := tx.state()
+	var ids []int
+	for id, todo := range s.todos {
+		if todo.DeletedAt != nil && todo.DeletedAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+	s.purgeTodos(ids)
+	return len(ids), tx.commit()
+}
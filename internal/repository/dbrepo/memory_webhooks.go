@@ -0,0 +1,267 @@
+package dbrepo
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+)
+
+// enqueueWebhooks queues a delivery of the event of every todo for every active webhook of the user subscribed
+// to it, in the order of the todos. The deliveries are a part of the transaction, so they are only sent if it commits.
+func (s *memoryState) enqueueWebhooks(store *memoryStore, userID int, event string, todos ...[]byte) error {
+	var webhooks []models.Webhook
+	for _, webhook := range s.webhooks {
+		if webhook.UserID == userID && webhook.Active && slices.Contains(webhook.Events, event) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+	slices.SortFunc(webhooks, func(a, b models.Webhook) int { return cmp.Compare(a.ID, b.ID) })
+
+	now := time.Now()
+	for _, todo := range todos {
+		payload, err := json.Marshal(models.WebhookEvent{
+			Event:     event,
+			CreatedAt: now,
+			Todo:      todo,
+		})
+		if err != nil {
+			return err
+		}
+		for _, webhook := range webhooks {
+			id := store.nextID("webhook_delivery")
+			s.deliveries[id] = models.WebhookDelivery{
+				ID:            id,
+				WebhookID:     webhook.ID,
+				Event:         event,
+				Payload:       payload,
+				Status:        models.DeliveryPending,
+				NextAttemptAt: &now,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			}
+		}
+	}
+	return nil
+}
+
+// copyWebhook returns a copy of a stored webhook
+func copyWebhook(stored models.Webhook) *models.Webhook {
+	webhook := stored
+	webhook.Events = append([]string{}, stored.Events...)
+	return &webhook
+}
+
+func (m *memoryDBRepo) SelectWebhooks(ctx context.Context, userID int) ([]*models.Webhook, error) {
+	s, done, err := m.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	webhooks := []*models.Webhook{}
+	for _, stored := range s.webhooks {
+		if stored.UserID == userID {
+			webhooks = append(webhooks, copyWebhook(stored))
+		}
+	}
+	slices.SortFunc(webhooks, func(a, b *models.Webhook) int { return cmp.Compare(a.ID, b.ID) })
+	return webhooks, nil
+}
+
+func (m *memoryDBRepo) SelectWebhook(ctx context.Context, userID int, id int) (*models.Webhook, error) {
+	s, done, err := m.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	stored, ok := s.webhooks[id]
+	if !ok || stored.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return copyWebhook(stored), nil
+}
+
+func (m *memoryDBRepo) InsertWebhook(ctx context.Context, webhook models.Webhook) (int, error) {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.rollback()
+
+	now := time.Now()
+	webhook.ID = tx.store.nextID("webhook")
+	webhook.Events = append([]string{}, webhook.Events...)
+	webhook.CreatedAt = now
+	webhook.UpdatedAt = now
+	tx.state().webhooks[webhook.ID] = webhook
+	return webhook.ID, tx.commit()
+}
+
+// UpdateWebhook updates the URL, events and state of a webhook, and its secret unless it is empty
+func (m *memoryDBRepo) UpdateWebhook(ctx context.Context, webhook models.Webhook) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.rollback()
+
+	s := tx.state()
+	stored, ok := s.webhooks[webhook.ID]
+	if !ok || stored.UserID != webhook.UserID {
+		return sql.ErrNoRows
+	}
+	stored.URL = webhook.URL
+	stored.Events = append([]string{}, webhook.Events...)
+	stored.Active = webhook.Active
+	if webhook.Secret != "" {
+		stored.Secret = webhook.Secret
+	}
+	stored.UpdatedAt = time.Now()
+	s.webhooks[webhook.ID] = stored
+	return tx.commit()
+}
+
+// DeleteWebhook deletes a webhook together with its deliveries
+func (m *memoryDBRepo) DeleteWebhook(ctx context.Context, userID int, id int) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.rollback()
+
+	s := tx.state()
+	if stored, ok := s.webhooks[id]; !ok || stored.UserID != userID {
+		return sql.ErrNoRows
+	}
+	delete(s.webhooks, id)
+	for deliveryID, delivery := range s.deliveries {
+		if delivery.WebhookID == id {
+			delete(s.deliveries, deliveryID)
+		}
+	}
+	return tx.commit()
+}
+
+// SelectWebhookDeliveries returns the last 100 deliveries of a webhook of the user, newest first
+func (m *memoryDBRepo) SelectWebhookDeliveries(ctx context.Context, userID int, webhookID int) ([]*models.WebhookDelivery, error) {
+	s, done, err := m.view(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	// make sure the webhook exists, so that an unknown webhook is not reported as one without deliveries
+	if stored, ok := s.webhooks[webhookID]; !ok || stored.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+
+	deliveries := []*models.WebhookDelivery{}
+	for _, stored := range s.deliveries {
+		if stored.WebhookID == webhookID {
+			delivery := stored
+			deliveries = append(deliveries, &delivery)
+		}
+	}
+	slices.SortFunc(deliveries, func(a, b *models.WebhookDelivery) int { return cmp.Compare(b.ID, a.ID) })
+	if len(deliveries) > 100 {
+		deliveries = deliveries[:100]
+	}
+	return deliveries, nil
+}
+
+func (m *memoryDBRepo) InsertWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.rollback()
+
+	now := time.Now()
+	delivery.ID = tx.store.nextID("webhook_delivery")
+	delivery.Attempts = 0
+	delivery.ResponseStatus = 0
+	delivery.Error = ""
+	delivery.URL = ""
+	delivery.Secret = ""
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+	tx.state().deliveries[delivery.ID] = delivery
+	return delivery.ID, tx.commit()
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries of active webhooks due for an attempt,
+// together with the URL and secret of their webhooks. They are not claimed again for the lease,
+// so that several dispatchers do not send the same delivery.
+func (m *memoryDBRepo) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.rollback()
+
+	s := tx.state()
+	now := time.Now()
+	var due []models.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.Status == models.DeliveryPending && delivery.NextAttemptAt != nil && !delivery.NextAttemptAt.After(now) &&
+			s.webhooks[delivery.WebhookID].Active {
+			due = append(due, delivery)
+		}
+	}
+	slices.SortFunc(due, func(a, b models.WebhookDelivery) int {
+		if c := a.NextAttemptAt.Compare(*b.NextAttemptAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	next := now.Add(lease)
+	var deliveries []*models.WebhookDelivery
+	for _, delivery := range due {
+		delivery.NextAttemptAt = &next
+		delivery.UpdatedAt = now
+		s.deliveries[delivery.ID] = delivery
+
+		hook := s.webhooks[delivery.WebhookID]
+		claimed := delivery
+		claimed.URL = hook.URL
+		claimed.Secret = hook.Secret
+		deliveries = append(deliveries, &claimed)
+	}
+	return deliveries, tx.commit()
+}
+
+// UpdateWebhookDelivery records the outcome of an attempt to send a delivery
+func (m *memoryDBRepo) UpdateWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.rollback()
+
+	s := tx.state()
+	stored, ok := s.deliveries[delivery.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	stored.Status = delivery.Status
+	stored.Attempts = delivery.Attempts
+	stored.ResponseStatus = delivery.ResponseStatus
+	stored.Error = delivery.Error
+	stored.NextAttemptAt = delivery.NextAttemptAt
+	stored.UpdatedAt = time.Now()
+	s.deliveries[delivery.ID] = stored
+	return tx.commit()
+}
@@ -3,55 +3,85 @@ package dbrepo
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/anras5/todo-app-backend/internal/rrule"
+	"github.com/jackc/pgtype"
 )
 
-func (m *postgresDBRepo) SelectTodos(completed ...bool) ([]*models.Todo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+// todoColumns are the columns of the todo table read by scanTodo, in order.
+// The progress of a todo is the percentage of its completed subtasks, trashed ones
+// aside, or 0/100 depending on its own state if it has none. The tags are sorted by name.
+const todoColumns = `id, user_id, project_id, parent_id, name, description, deadline, completed, rrule, version, deleted_at, created_at, updated_at,
+coalesce(
+	(select 100 * count(*) filter (where c.completed) / nullif(count(*), 0) from todo c where c.parent_id = todo.id and c.deleted_at is null),
+	case when todo.completed then 100 else 0 end
+),
+array(select tg.name from todo_tag tt join tag tg on tg.id = tt.tag_id where tt.todo_id = todo.id order by tg.name)`
 
-	var todos []*models.Todo
-	var query string
-	var rows *sql.Rows
-	var err error
+// dbtx is implemented by both *sql.DB and *sql.Tx
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
 
-	if len(completed) > 0 {
-		// we want to filter the data
-		query = `
-SELECT ID, NAME, DESCRIPTION, DEADLINE, COMPLETED, CREATED_AT, UPDATED_AT
-FROM TODO WHERE COMPLETED = $1 ORDER BY DEADLINE
-`
-		rows, err = m.DB.QueryContext(ctx, query, completed[0])
-	} else {
-		// we want to get all the data
-		query = `
-SELECT ID, NAME, DESCRIPTION, DEADLINE, COMPLETED, CREATED_AT, UPDATED_AT
-FROM TODO ORDER BY DEADLINE
-`
-		rows, err = m.DB.QueryContext(ctx, query)
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTodo scans a row selected with todoColumns, followed by the extra columns if any
+func scanTodo(row rowScanner, extra ...any) (*models.Todo, error) {
+	var todo models.Todo
+	var tags pgtype.TextArray
+	dest := []any{
+		&todo.ID,
+		&todo.UserID,
+		&todo.ProjectID,
+		&todo.ParentID,
+		&todo.Name,
+		&todo.Description,
+		&todo.Deadline,
+		&todo.Completed,
+		&todo.RRule,
+		&todo.Version,
+		&todo.DeletedAt,
+		&todo.CreatedAt,
+		&todo.UpdatedAt,
+		&todo.Progress,
+		&tags,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	if err = tags.AssignTo(&todo.Tags); err != nil {
+		return nil, err
 	}
+	return &todo, nil
+}
+
+// queryTodos runs a query selecting todoColumns and scans all the returned rows
+func (m *postgresDBRepo) queryTodos(ctx context.Context, query string, args ...any) ([]*models.Todo, error) {
+	rows, err := m.db().QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
+	todos := []*models.Todo{}
 	for rows.Next() {
-		var todo models.Todo
-		err := rows.Scan(
-			&todo.ID,
-			&todo.Name,
-			&todo.Description,
-			&todo.Deadline,
-			&todo.Completed,
-			&todo.CreatedAt,
-			&todo.UpdatedAt,
-		)
+		todo, err := scanTodo(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		todos = append(todos, &todo)
+		todos = append(todos, todo)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -60,105 +90,529 @@ FROM TODO ORDER BY DEADLINE
 	return todos, nil
 }
 
-func (m *postgresDBRepo) SelectTodo(id int) (*models.Todo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) SelectTodos(ctx context.Context, userID int, filter models.TodoFilter) ([]*models.Todo, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
 	defer cancel()
 
-	var todo models.Todo
+	var b queryBuilder
+	b.where("USER_ID = ? AND DELETED_AT IS NULL", userID)
+	if err := b.filter(filter); err != nil {
+		return nil, err
+	}
 
 	query := `
-select id, name, description, deadline, completed, created_at, updated_at
-from todo
-where id = $1
-`
+SELECT ` + todoColumns + `
+FROM TODO
+` + b.build(0)
+	return m.queryTodos(ctx, query, b.args...)
+}
 
-	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&todo.ID,
-		&todo.Name,
-		&todo.Description,
-		&todo.Deadline,
-		&todo.Completed,
-		&todo.CreatedAt,
-		&todo.UpdatedAt,
-	)
+func (m *postgresDBRepo) SelectTodosPage(ctx context.Context, userID int, limit int, after *models.TodoCursor, filter models.TodoFilter) (*models.TodoPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	var b queryBuilder
+	b.where("USER_ID = ? AND DELETED_AT IS NULL", userID)
+	if err := b.filter(filter); err != nil {
+		return nil, err
+	}
+	if after != nil {
+		if err := b.after(after); err != nil {
+			return nil, err
+		}
+	}
+
+	// fetch one extra row to find out if there is a next page
+	query := `
+SELECT ` + todoColumns + `
+FROM TODO
+` + b.build(limit+1)
+
+	todos, err := m.queryTodos(ctx, query, b.args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return &todo, nil
+	page := &models.TodoPage{Todos: todos}
+	if len(page.Todos) > limit {
+		page.Todos = page.Todos[:limit]
+		page.HasMore = true
+		page.NextCursor = page.Todos[limit-1].Cursor(filter.Sort)
+	}
+	return page, nil
 }
 
-func (m *postgresDBRepo) InsertTodo(todo models.Todo) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) SelectTodo(ctx context.Context, userID int, id int) (*models.Todo, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
 	defer cancel()
 
+	query := `
+select ` + todoColumns + `
+from todo
+where id = $1 and user_id = $2 and deleted_at is null
+`
+
+	row := m.db().QueryRowContext(ctx, query, id, userID)
+	return scanTodo(row)
+}
+
+func (m *postgresDBRepo) SelectTodoChildren(ctx context.Context, userID int, id int) ([]*models.Todo, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	query := `
+select ` + todoColumns + `
+from todo
+where parent_id = $1 and user_id = $2 and deleted_at is null
+order by deadline, id
+`
+	return m.queryTodos(ctx, query, id, userID)
+}
+
+func (m *postgresDBRepo) InsertTodo(ctx context.Context, todo models.Todo) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	newID, err := m.createTodo(ctx, tx, todo)
+	if err != nil {
+		return 0, err
+	}
+	return newID, tx.Commit()
+}
+
+// createTodo checks and inserts a todo as a part of the transaction, see InsertTodo
+func (m *postgresDBRepo) createTodo(ctx context.Context, q dbtx, todo models.Todo) (int, error) {
+	rule, err := rrule.Normalize(todo.RRule)
+	if err != nil {
+		return 0, err
+	}
+	todo.RRule = rule
+
+	if err := checkProject(ctx, q, todo.UserID, todo.ProjectID); err != nil {
+		return 0, err
+	}
+	if err := checkParent(ctx, q, todo.UserID, 0, todo.ParentID); err != nil {
+		return 0, err
+	}
+
+	newID, err := insertTodo(ctx, q, todo)
+	if err != nil {
+		return 0, err
+	}
+	if err = m.recordHistory(ctx, q, todo.UserID, newID, models.ActionInsert, nil); err != nil {
+		return 0, err
+	}
+
+	if err = m.rollUpCompleted(ctx, q, todo.ParentID); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// insertTodo inserts the todo together with its tags
+func insertTodo(ctx context.Context, q dbtx, todo models.Todo) (int, error) {
 	stmt := `
-insert into todo (name, description, deadline, completed, created_at, updated_at)
-values ($1, $2, $3, $4, $5, $6) returning id
+insert into todo (user_id, project_id, parent_id, name, description, deadline, completed, rrule, created_at, updated_at)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id
 `
 	var newID int
-	err := m.DB.QueryRowContext(ctx, stmt,
+	err := q.QueryRowContext(ctx, stmt,
+		todo.UserID,
+		todo.ProjectID,
+		todo.ParentID,
 		todo.Name,
 		todo.Description,
 		todo.Deadline,
 		todo.Completed,
+		todo.RRule,
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
 	if err != nil {
-		return newID, err
+		return 0, err
+	}
+
+	if err = addTags(ctx, q, todo.UserID, newID, todo.Tags); err != nil {
+		return 0, err
 	}
 	return newID, nil
 }
 
-func (m *postgresDBRepo) UpdateTodo(todo models.Todo) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// todoUpdateColumns maps the fields of models.TodoUpdateFields to their columns and values,
+// tags are stored in their own table
+var todoUpdateColumns = []struct {
+	field  string
+	column string
+	value  func(todo *models.Todo) any
+}{
+	{"project_id", "project_id", func(todo *models.Todo) any { return todo.ProjectID }},
+	{"parent_id", "parent_id", func(todo *models.Todo) any { return todo.ParentID }},
+	{"name", "name", func(todo *models.Todo) any { return todo.Name }},
+	{"description", "description", func(todo *models.Todo) any { return todo.Description }},
+	{"deadline", "deadline", func(todo *models.Todo) any { return todo.Deadline }},
+	{"completed", "completed", func(todo *models.Todo) any { return todo.Completed }},
+	{"rrule", "rrule", func(todo *models.Todo) any { return todo.RRule }},
+}
+
+// UpdateTodo updates the given fields of a todo, or all of them if no fields are given.
+// Without fields nil tags leave the tags of the todo unchanged.
+// Completing a recurring todo creates its next occurrence, like UpdateTodoCompleted.
+func (m *postgresDBRepo) UpdateTodo(ctx context.Context, todo models.Todo, fields ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
 	defer cancel()
 
-	stmt := `
-update todo set name = $1, description = $2, deadline = $3, completed = $4, updated_at = $5
-where id = $6
-`
-	_, err := m.DB.ExecContext(ctx, stmt,
-		todo.Name,
-		todo.Description,
-		todo.Deadline,
-		todo.Completed,
-		time.Now(),
-		todo.ID,
-	)
+	tx, err := m.beginTx(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	if err = m.updateTodo(ctx, tx, todo, fields...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateTodo updates a todo as a part of the transaction, see UpdateTodo
+func (m *postgresDBRepo) updateTodo(ctx context.Context, q dbtx, todo models.Todo, fields ...string) error {
+	mask, err := models.NewTodoFieldMask(fields...)
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		mask, _ = models.NewTodoFieldMask(models.TodoUpdateFields...)
+		mask["tags"] = todo.Tags != nil
+	}
+
+	if mask["rrule"] {
+		rule, err := rrule.Normalize(todo.RRule)
+		if err != nil {
+			return err
+		}
+		todo.RRule = rule
+	}
+
+	if mask["project_id"] {
+		if err := checkProject(ctx, q, todo.UserID, todo.ProjectID); err != nil {
+			return err
+		}
+	}
+
+	if mask["parent_id"] {
+		if err := checkParent(ctx, q, todo.UserID, todo.ID, todo.ParentID); err != nil {
+			return err
+		}
+	}
+
+	before, err := snapshotTodo(ctx, q, todo.UserID, todo.ID)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+	if todo.Version != 0 && todo.Version != before.Version {
+		return repository.ErrVersionConflict
+	}
+	// remember the previous parent, its completion state may change as well
+	oldParentID := before.ParentID
+	if !mask["parent_id"] {
+		todo.ParentID = oldParentID
+	}
+
+	args := []any{time.Now(), todo.ID, todo.UserID}
+	set := []string{"version = version + 1", "updated_at = $1"}
+	for _, c := range todoUpdateColumns {
+		if mask[c.field] {
+			args = append(args, c.value(&todo))
+			set = append(set, fmt.Sprintf("%s = $%d", c.column, len(args)))
+		}
+	}
+	stmt := `update todo set ` + strings.Join(set, ", ") + ` where id = $2 and user_id = $3`
+	if _, err = q.ExecContext(ctx, stmt, args...); err != nil {
+		return err
+	}
+
+	if mask["tags"] {
+		_, err = q.ExecContext(ctx, `delete from todo_tag where todo_id = $1`, todo.ID)
+		if err != nil {
+			return err
+		}
+		if err = addTags(ctx, q, todo.UserID, todo.ID, todo.Tags); err != nil {
+			return err
+		}
+	}
+
+	if mask["completed"] && todo.Completed && !before.Completed {
+		// the next occurrence follows the todo as updated
+		current, err := snapshotTodo(ctx, q, todo.UserID, todo.ID)
+		if err != nil {
+			return err
+		}
+		if err = m.scheduleNextOccurrence(ctx, q, current); err != nil {
+			return err
+		}
+	}
+
+	if err = m.recordHistory(ctx, q, todo.UserID, todo.ID, models.ActionUpdate, before); err != nil {
+		return err
+	}
+
+	if mask["completed"] || mask["parent_id"] {
+		if err = m.rollUpCompleted(ctx, q, todo.ParentID); err != nil {
+			return err
+		}
+	}
+	if oldParentID != nil && (todo.ParentID == nil || *oldParentID != *todo.ParentID) {
+		if err = m.rollUpCompleted(ctx, q, oldParentID); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (m *postgresDBRepo) UpdateTodoCompleted(id int, completed bool) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// UpdateTodoCompleted changes the completion state of a todo and derives the
+// state of its ancestors, a parent is completed when all its subtasks are.
+// Completing a recurring todo creates its next occurrence.
+func (m *postgresDBRepo) UpdateTodoCompleted(ctx context.Context, userID int, id int, completed bool) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
 	defer cancel()
 
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = m.completeTodo(ctx, tx, userID, id, completed); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// completeTodo changes the completion state of a todo as a part of the transaction, see UpdateTodoCompleted
+func (m *postgresDBRepo) completeTodo(ctx context.Context, q dbtx, userID int, id int, completed bool) error {
+	before, err := snapshotTodo(ctx, q, userID, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
 	stmt := `
-update todo set completed = $1, updated_at = $2 where id = $3
+update todo set completed = $1, version = version + 1, updated_at = $2 where id = $3 and user_id = $4
+returning parent_id
 `
-	_, err := m.DB.ExecContext(ctx, stmt, completed, time.Now(), id)
+	var parentID *int
+	err = q.QueryRowContext(ctx, stmt, completed, time.Now(), id, userID).Scan(&parentID)
 	if err != nil {
 		return err
 	}
+
+	if completed && !before.Completed {
+		if err = m.scheduleNextOccurrence(ctx, q, before); err != nil {
+			return err
+		}
+	}
+
+	action := models.ActionIncomplete
+	if completed {
+		action = models.ActionComplete
+	}
+	if err = m.recordHistory(ctx, q, userID, id, action, before); err != nil {
+		return err
+	}
+
+	if err = m.rollUpCompleted(ctx, q, parentID); err != nil {
+		return err
+	}
 	return nil
 }
 
-func (m *postgresDBRepo) DeleteTodo(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// scheduleNextOccurrence creates the next occurrence of a recurring todo with the deadline
+// advanced by its rule. The rule moves to the new todo, so completing the old todo again
+// does not create another one.
+func (m *postgresDBRepo) scheduleNextOccurrence(ctx context.Context, q dbtx, todo *models.Todo) error {
+	if todo.RRule == "" {
+		return nil
+	}
+
+	rule, err := rrule.Parse(todo.RRule)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, `update todo set rrule = '', version = version + 1 where id = $1`, todo.ID)
+	if err != nil {
+		return err
+	}
+
+	deadline, rest, ok := rule.Next(todo.Deadline)
+	if !ok {
+		// that was the last occurrence
+		return nil
+	}
+
+	next := *todo
+	next.Deadline = deadline
+	next.Completed = false
+	next.RRule = rest.String()
+	nextID, err := insertTodo(ctx, q, next)
+	if err != nil {
+		return err
+	}
+	return m.recordHistory(ctx, q, next.UserID, nextID, models.ActionInsert, nil)
+}
+
+// DeleteTodo moves a todo together with its subtasks to the trash. A version other than 0
+// must match the current version of the todo.
+func (m *postgresDBRepo) DeleteTodo(ctx context.Context, userID int, id int, version int) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
 	defer cancel()
 
-	stmt := `
-delete from todo where id = $1
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = m.deleteTodo(ctx, tx, userID, id, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteTodo moves a todo to the trash as a part of the transaction, see DeleteTodo
+func (m *postgresDBRepo) deleteTodo(ctx context.Context, q dbtx, userID int, id int, version int) error {
+	before, err := snapshotTodo(ctx, q, userID, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+	if version != 0 && version != before.Version {
+		return repository.ErrVersionConflict
+	}
+
+	if err = trashSubtree(ctx, q, id, time.Now()); err != nil {
+		return err
+	}
+	if err = m.recordHistory(ctx, q, userID, id, models.ActionDelete, before); err != nil {
+		return err
+	}
+
+	if err = m.rollUpCompleted(ctx, q, before.ParentID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkParent makes sure the parent exists, is owned by the user and that
+// making it the parent of the todo would not create a cycle. The query runs on SQLite as well.
+func checkParent(ctx context.Context, q dbtx, userID int, todoID int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	if todoID != 0 && *parentID == todoID {
+		return repository.ErrTodoCycle
+	}
+
+	query := `
+with recursive ancestors(id, parent_id) as (
+	select id, parent_id from todo where id = $1 and user_id = $2 and deleted_at is null
+	union
+	select t.id, t.parent_id from todo t join ancestors a on t.id = a.parent_id
+)
+select count(*) > 0, count(*) filter (where id = $3) > 0 from ancestors
 `
+	var exists, cycle bool
+	err := q.QueryRowContext(ctx, query, *parentID, userID, todoID).Scan(&exists, &cycle)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return repository.ErrParentNotFound
+	}
+	if cycle {
+		return repository.ErrTodoCycle
+	}
+	return nil
+}
+
+// recordFunc records a change of a todo in its history, before is the todo as it was
+type recordFunc func(userID int, id int, action string, before *models.Todo) error
 
-	_, err := m.DB.ExecContext(ctx, stmt, id)
+// rollUpCompleted rolls the completion up to the ancestors of the parent, see rollUp,
+// and records every ancestor it completes or reopens in the history
+func (m *postgresDBRepo) rollUpCompleted(ctx context.Context, q dbtx, parentID *int) error {
+	return rollUp(ctx, q, parentID, func(userID int, id int, action string, before *models.Todo) error {
+		return m.recordHistory(ctx, q, userID, id, action, before)
+	})
+}
+
+// rollUp walks up from the parent and marks every ancestor with live subtasks as completed
+// if all of them are, and as not completed otherwise. Ancestors without live subtasks keep
+// their completion. Only an ancestor whose completion flips is changed and passed to record.
+func rollUp(ctx context.Context, q dbtx, parentID *int, record recordFunc) error {
+	visited := make(map[int]bool)
+	for parentID != nil && !visited[*parentID] {
+		visited[*parentID] = true
+
+		query := `
+select user_id, parent_id, completed,
+exists(select 1 from todo c where c.parent_id = todo.id and c.deleted_at is null),
+not exists(select 1 from todo c where c.parent_id = todo.id and c.deleted_at is null and not c.completed)
+from todo
+where id = $1
+for update
+`
+		var userID int
+		var next *int
+		var completed, hasSubtasks, subtasksCompleted bool
+		err := q.QueryRowContext(ctx, query, *parentID).Scan(&userID, &next, &completed, &hasSubtasks, &subtasksCompleted)
+		if err != nil {
+			return err
+		}
+
+		if hasSubtasks && completed != subtasksCompleted {
+			before, err := snapshotTodo(ctx, q, userID, *parentID)
+			if err != nil {
+				return err
+			}
+			_, err = q.ExecContext(ctx, `update todo set completed = $1, version = version + 1, updated_at = $2 where id = $3`,
+				subtasksCompleted, time.Now(), *parentID)
+			if err != nil {
+				return err
+			}
+			action := models.ActionIncomplete
+			if subtasksCompleted {
+				action = models.ActionComplete
+			}
+			if err = record(userID, *parentID, action, before); err != nil {
+				return err
+			}
+		}
+		parentID = next
+	}
+	return nil
+}
+
+// checkRowsAffected returns sql.ErrNoRows if the statement did not change any row
+func checkRowsAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
 	return nil
 }
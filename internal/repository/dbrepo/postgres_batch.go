@@ -0,0 +1,89 @@
+package dbrepo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+)
+
+// ApplyTodoBatch applies the operations with the same checks as the methods writing a single todo.
+// Without atomic every operation runs in its own savepoint, so that a failing one leaves the
+// transaction usable for the rest.
+func (m *postgresDBRepo) ApplyTodoBatch(ctx context.Context, userID int, ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	// a batch takes longer than a single write
+	ctx, cancel := context.WithTimeout(ctx, 3*m.timeout)
+	defer cancel()
+
+	if len(ops) > repository.MaxBatchOperations {
+		return nil, fmt.Errorf("at most %d operations can be applied at once", repository.MaxBatchOperations)
+	}
+	results := make([]models.BatchResult, len(ops))
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for i, op := range ops {
+		result := &results[i]
+		if atomic {
+			result.ID, result.Err = m.applyBatchOperation(ctx, tx, userID, op)
+			if result.Err != nil {
+				// nothing is kept, the transaction rolls back once it returns
+				abortBatch(results, i)
+				return results, nil
+			}
+			continue
+		}
+
+		savepoint, err := tx.beginSavepoint(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result.ID, result.Err = m.applyBatchOperation(ctx, savepoint, userID, op)
+		if result.Err != nil {
+			result.ID = 0
+			err = savepoint.Rollback()
+		} else {
+			err = savepoint.Commit()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// applyBatchOperation applies one operation of a batch as a part of the transaction
+func (m *postgresDBRepo) applyBatchOperation(ctx context.Context, q dbtx, userID int, op models.BatchOperation) (int, error) {
+	todo := op.Todo
+	todo.UserID = userID
+
+	switch op.Op {
+	case models.BatchCreate:
+		return m.createTodo(ctx, q, todo)
+	case models.BatchUpdate:
+		return todo.ID, m.updateTodo(ctx, q, todo, op.Fields...)
+	case models.BatchDelete:
+		return todo.ID, m.deleteTodo(ctx, q, userID, todo.ID, todo.Version)
+	case models.BatchComplete:
+		return todo.ID, m.completeTodo(ctx, q, userID, todo.ID, todo.Completed)
+	}
+	return 0, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// abortBatch marks every operation of an atomic batch but the failed one as rolled back
+func abortBatch(results []models.BatchResult, failed int) {
+	for i := range results {
+		if i != failed {
+			results[i] = models.BatchResult{Err: repository.ErrBatchAborted}
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/anras5/todo-app-backend/internal/rrule"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+// maxTodoName is the length of the name column of the todo table
+const maxTodoName = 100
+
+// todoCopyColumns are the columns of the todo table written by InsertTodos
+var todoCopyColumns = []string{"id", "user_id", "project_id", "parent_id", "name", "description", "deadline", "completed", "rrule", "created_at", "updated_at"}
+
+// historyCopyColumns are the columns of the todo_history table written by InsertTodos
+var historyCopyColumns = []string{"todo_id", "actor_id", "action", "before", "after", "request_id", "transport", "operation_id", "created_at"}
+
+// InsertTodos inserts the todos with COPY, which is much faster than inserting them one by one.
+// The todos are checked first, so that only the valid ones are copied.
+func (m *postgresDBRepo) InsertTodos(ctx context.Context, userID int, todos []models.Todo) ([]models.TodoInsertResult, error) {
+	// copying a batch takes longer than a single insert
+	ctx, cancel := context.WithTimeout(ctx, 10*m.timeout)
+	defer cancel()
+
+	if len(todos) > repository.MaxInsertBatch {
+		return nil, fmt.Errorf("at most %d todos can be inserted at once", repository.MaxInsertBatch)
+	}
+	results := make([]models.TodoInsertResult, len(todos))
+	todos = slices.Clone(todos)
+
+	tx, err := m.beginConnTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// the projects and parents stay until the todos referring to them are inserted
+	projects, parents, err := existingReferences(ctx, tx, userID, todos)
+	if err != nil {
+		return nil, err
+	}
+
+	var valid []*models.Todo
+	for i := range todos {
+		todo := &todos[i]
+		todo.ID = 0
+		todo.UserID = userID
+
+		switch {
+		case utf8.RuneCountInString(todo.Name) > maxTodoName:
+			results[i].Err = fmt.Errorf("name should be at most %d characters", maxTodoName)
+		case todo.ProjectID != nil && !projects[*todo.ProjectID]:
+			results[i].Err = repository.ErrProjectNotFound
+		case todo.ParentID != nil && !parents[*todo.ParentID]:
+			results[i].Err = repository.ErrParentNotFound
+		}
+		if results[i].Err != nil {
+			continue
+		}
+		if todo.RRule, results[i].Err = rrule.Normalize(todo.RRule); results[i].Err != nil {
+			continue
+		}
+		// sorted like the tags read by scanTodo
+		todo.Tags = models.NormalizeTags(todo.Tags)
+		slices.Sort(todo.Tags)
+
+		valid = append(valid, todo)
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	// COPY does not return the ids, so they are taken from the sequence first
+	ids, err := nextTodoIDs(ctx, tx, len(valid))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rows := make([][]any, 0, len(valid))
+	for i, todo := range valid {
+		todo.ID = ids[i]
+		rows = append(rows, []any{
+			todo.ID,
+			todo.UserID,
+			todo.ProjectID,
+			todo.ParentID,
+			todo.Name,
+			todo.Description,
+			todo.Deadline,
+			todo.Completed,
+			todo.RRule,
+			now,
+			now,
+		})
+	}
+	if err = copyFrom(ctx, tx.conn, "todo", todoCopyColumns, rows); err != nil {
+		return nil, err
+	}
+
+	if err = addTodosTags(ctx, tx, userID, valid); err != nil {
+		return nil, err
+	}
+
+	rolledUp := make(map[int]bool)
+	for _, todo := range valid {
+		if todo.ParentID != nil && !rolledUp[*todo.ParentID] {
+			rolledUp[*todo.ParentID] = true
+			if err = m.rollUpCompleted(ctx, tx, todo.ParentID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = m.recordInserts(ctx, tx, userID, valid, now); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	// the todos that were not valid have no id
+	for i := range todos {
+		results[i].ID = todos[i].ID
+	}
+	return results, nil
+}
+
+// existingReferences returns which of the projects and parents the todos refer to exist for the user,
+// and locks them against changes until the end of the transaction
+func existingReferences(ctx context.Context, q dbtx, userID int, todos []models.Todo) (projects map[int]bool, parents map[int]bool, err error) {
+	var projectIDs, parentIDs []int64
+	for _, todo := range todos {
+		if todo.ProjectID != nil {
+			projectIDs = append(projectIDs, int64(*todo.ProjectID))
+		}
+		if todo.ParentID != nil {
+			parentIDs = append(parentIDs, int64(*todo.ParentID))
+		}
+	}
+
+	projects, err = existingIDs(ctx, q, `select id from project where user_id = $1 and id = any($2::int8[]) for share`, userID, projectIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	parents, err = existingIDs(ctx, q, `select id from todo where user_id = $1 and deleted_at is null and id = any($2::int8[]) for share`, userID, parentIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return projects, parents, nil
+}
+
+// existingIDs runs a query selecting the ids among the given ones that exist for the user
+func existingIDs(ctx context.Context, q dbtx, query string, userID int, ids []int64) (map[int]bool, error) {
+	existing := make(map[int]bool)
+	if len(ids) == 0 {
+		return existing, nil
+	}
+
+	rows, err := q.QueryContext(ctx, query, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		existing[id] = true
+	}
+	return existing, rows.Err()
+}
+
+// nextTodoIDs takes count ids from the sequence of the todo table
+func nextTodoIDs(ctx context.Context, q dbtx, count int) ([]int, error) {
+	rows, err := q.QueryContext(ctx, `select nextval(pg_get_serial_sequence('todo', 'id')) from generate_series(1, $1)`, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0, count)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// copyFrom copies the rows into the columns of the table over the connection,
+// as a part of the transaction open on it if there is one
+func copyFrom(ctx context.Context, conn *sql.Conn, table string, columns []string, rows [][]any) error {
+	return conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("COPY needs a pgx connection")
+		}
+		_, err := c.Conn().CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromRows(rows))
+		return err
+	})
+}
+
+// addTodosTags attaches the tags of the todos to them, like addTags does for a single todo
+func addTodosTags(ctx context.Context, q dbtx, userID int, todos []*models.Todo) error {
+	var todoIDs []int64
+	var names []string
+	for _, todo := range todos {
+		for _, tag := range todo.Tags {
+			todoIDs = append(todoIDs, int64(todo.ID))
+			names = append(names, tag)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	stmt := `
+insert into tag (user_id, name, created_at, updated_at)
+select distinct $1::int, unnest($2::text[]), $3::timestamp, $3::timestamp
+on conflict (user_id, name) do nothing
+`
+	_, err := q.ExecContext(ctx, stmt, userID, names, time.Now())
+	if err != nil {
+		return err
+	}
+
+	stmt = `
+insert into todo_tag (todo_id, tag_id)
+select t.todo_id, tg.id from unnest($1::int8[], $2::text[]) as t(todo_id, name)
+join tag tg on tg.user_id = $3 and tg.name = t.name
+on conflict do nothing
+`
+	_, err = q.ExecContext(ctx, stmt, todoIDs, names, userID)
+	return err
+}
+
+// recordInserts records the inserted todos in their history, queues their webhooks and publishes
+// their events like recordHistory does for a single todo. The todos are not read back, their
+// snapshots are built from what was copied.
+func (m *postgresDBRepo) recordInserts(ctx context.Context, tx *todoTx, userID int, todos []*models.Todo, now time.Time) error {
+	var operationID *int
+	if m.audit.Undoable {
+		opID, err := logOperation(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		operationID = &opID
+	}
+
+	rows := make([][]any, 0, len(todos))
+	snapshots := make([][]byte, 0, len(todos))
+	for _, todo := range todos {
+		progress := 0
+		if todo.Completed {
+			progress = 100
+		}
+		snapshot, err := json.Marshal(models.Todo{
+			ID:          todo.ID,
+			UserID:      todo.UserID,
+			ProjectID:   todo.ProjectID,
+			ParentID:    todo.ParentID,
+			Name:        todo.Name,
+			Description: todo.Description,
+			Deadline:    storedTime(todo.Deadline),
+			Completed:   todo.Completed,
+			RRule:       todo.RRule,
+			Version:     1,
+			Progress:    progress,
+			Tags:        todo.Tags,
+		})
+		if err != nil {
+			return err
+		}
+
+		snapshots = append(snapshots, snapshot)
+		rows = append(rows, []any{
+			todo.ID,
+			userID,
+			models.ActionInsert,
+			nil,
+			string(snapshot),
+			m.audit.RequestID,
+			m.audit.Transport,
+			operationID,
+			now,
+		})
+		publishEvent(tx, userID, models.EventTodoCreated, snapshot)
+	}
+
+	if err := copyFrom(ctx, tx.conn, "todo_history", historyCopyColumns, rows); err != nil {
+		return err
+	}
+	return enqueueWebhooks(ctx, tx, userID, models.EventTodoCreated, snapshots...)
+}
+
+// storedTime returns the time as it is read back from a timestamp column, which keeps
+// the wall clock in microseconds and drops the time zone
+func storedTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC).Truncate(time.Microsecond)
+}
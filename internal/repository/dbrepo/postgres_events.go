@@ -0,0 +1,162 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/anras5/todo-app-backend/internal/events"
+	"github.com/anras5/todo-app-backend/internal/models"
+)
+
+// todoTx is a transaction publishing the events of the changes made in it once it commits.
+// Inside of WithTx it is a savepoint of the transaction of WithTx, which publishes its events.
+type todoTx struct {
+	*sql.Tx
+	// conn is the connection of the transaction, only known to the ones started by beginConnTx
+	conn    *sql.Conn
+	bus     *events.Bus
+	pending []events.Event
+
+	// parent is the transaction the savepoint is in, nil if it is not a savepoint
+	parent *todoTx
+	done   bool
+
+	// operationID is the operation the undoable changes of the transaction are logged in, kept by
+	// the SQLite repos, which have no transaction ids to find it by. 0 until it is logged.
+	operationID int
+}
+
+// db returns what the queries of the repo run in, the transaction of WithTx inside of it
+func (m *postgresDBRepo) db() dbtx {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.DB
+}
+
+// beginTx starts a transaction publishing its events to the bus of the repo
+func (m *postgresDBRepo) beginTx(ctx context.Context) (*todoTx, error) {
+	if m.tx != nil {
+		return m.tx.beginSavepoint(ctx)
+	}
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &todoTx{Tx: tx, bus: m.events}, nil
+}
+
+// beginConnTx starts a transaction like beginTx on a connection of its own, which is closed once
+// the transaction ends. COPY needs the connection of the transaction it is a part of.
+func (m *postgresDBRepo) beginConnTx(ctx context.Context, opts *sql.TxOptions) (*todoTx, error) {
+	if m.tx != nil {
+		return m.tx.beginSavepoint(ctx)
+	}
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := conn.BeginTx(ctx, opts)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &todoTx{Tx: tx, conn: conn, bus: m.events}, nil
+}
+
+// beginSavepoint starts a savepoint of the transaction, which is committed and rolled back like
+// a transaction of its own. Its events are published with the ones of the transaction.
+func (tx *todoTx) beginSavepoint(ctx context.Context) (*todoTx, error) {
+	if _, err := tx.ExecContext(ctx, `savepoint todo_tx`); err != nil {
+		return nil, err
+	}
+	return &todoTx{Tx: tx.Tx, conn: tx.conn, parent: tx}, nil
+}
+
+// root returns the transaction the savepoint is a part of, or the transaction itself
+func (tx *todoTx) root() *todoTx {
+	for tx.parent != nil {
+		tx = tx.parent
+	}
+	return tx
+}
+
+// Commit commits the transaction and publishes its events
+func (tx *todoTx) Commit() error {
+	if tx.parent != nil {
+		if tx.done {
+			return sql.ErrTxDone
+		}
+		tx.done = true
+		if _, err := tx.ExecContext(context.Background(), `release savepoint todo_tx`); err != nil {
+			return err
+		}
+		tx.parent.pending = append(tx.parent.pending, tx.pending...)
+		return nil
+	}
+
+	err := tx.Tx.Commit()
+	if tx.conn != nil {
+		_ = tx.conn.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if tx.bus != nil {
+		for _, event := range tx.pending {
+			tx.bus.Publish(event)
+		}
+	}
+	tx.pending = nil
+	return nil
+}
+
+// Rollback rolls back the transaction, or the changes made since the savepoint
+func (tx *todoTx) Rollback() error {
+	if tx.parent != nil {
+		if tx.done {
+			return sql.ErrTxDone
+		}
+		tx.done = true
+		if _, err := tx.ExecContext(context.Background(), `rollback to savepoint todo_tx`); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(context.Background(), `release savepoint todo_tx`)
+		return err
+	}
+
+	err := tx.Tx.Rollback()
+	if tx.conn != nil {
+		_ = tx.conn.Close()
+	}
+	return err
+}
+
+// publishEvent queues the event of a change of a todo made in q until it commits,
+// changes made outside a todoTx are not published
+func publishEvent(q dbtx, userID int, webhookEvent string, todo []byte) {
+	tx, ok := q.(*todoTx)
+	if !ok {
+		return
+	}
+	tx.pending = append(tx.pending, events.Event{
+		UserID: userID,
+		Type:   streamEvent(webhookEvent),
+		Todo:   json.RawMessage(todo),
+	})
+}
+
+// streamEvent returns the type of the streamed event for a webhook event, restoring
+// a todo creates it again for the clients and uncompleting it updates it
+func streamEvent(webhookEvent string) string {
+	switch webhookEvent {
+	case models.EventTodoCreated, models.EventTodoRestored:
+		return events.Created
+	case models.EventTodoCompleted:
+		return events.Completed
+	case models.EventTodoDeleted:
+		return events.Deleted
+	}
+	return events.Updated
+}
@@ -0,0 +1,145 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+)
+
+// WithAudit returns a repo recording the audit in the history of the todos it changes
+func (m *postgresDBRepo) WithAudit(audit models.Audit) repository.DatabaseRepo {
+	repo := *m
+	repo.audit = audit
+	return &repo
+}
+
+// snapshotTodo reads a todo of the user, trashed or not, and locks it until the end of the transaction
+func snapshotTodo(ctx context.Context, q dbtx, userID int, id int) (*models.Todo, error) {
+	query := `select ` + todoColumns + ` from todo where id = $1 and user_id = $2 for update of todo`
+	return scanTodo(q.QueryRowContext(ctx, query, id, userID))
+}
+
+// recordHistory records a change of a todo made in the transaction by the user. before is
+// the todo as it was before the change, nil if it was inserted, the todo after is read back.
+// Undoable changes are added to the operation of the transaction.
+func (m *postgresDBRepo) recordHistory(ctx context.Context, q dbtx, userID int, id int, action string, before *models.Todo) error {
+	var operationID *int
+	if m.audit.Undoable {
+		opID, err := logOperation(ctx, q, userID)
+		if err != nil {
+			return err
+		}
+		operationID = &opID
+	}
+	return m.insertHistory(ctx, q, userID, id, action, before, operationID)
+}
+
+// insertHistory inserts a change of a todo into its history, see recordHistory,
+// queues its event for the webhooks of the user and publishes it once the transaction commits
+func (m *postgresDBRepo) insertHistory(ctx context.Context, q dbtx, userID int, id int, action string, before *models.Todo, operationID *int) error {
+	after, err := snapshotTodo(ctx, q, userID, id)
+	if err != nil {
+		return err
+	}
+
+	var beforeJSON any
+	if before != nil {
+		b, err := json.Marshal(before)
+		if err != nil {
+			return err
+		}
+		beforeJSON = string(b)
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+insert into todo_history (todo_id, actor_id, action, before, after, request_id, transport, operation_id, created_at)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+`
+	_, err = q.ExecContext(ctx, stmt,
+		id,
+		userID,
+		action,
+		beforeJSON,
+		string(afterJSON),
+		m.audit.RequestID,
+		m.audit.Transport,
+		operationID,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	event := todoEvent(before, after)
+	publishEvent(q, userID, event, afterJSON)
+	return enqueueWebhooks(ctx, q, userID, event, afterJSON)
+}
+
+// SelectTodoHistory returns the changes of a todo of the user, trashed or not, oldest first
+func (m *postgresDBRepo) SelectTodoHistory(ctx context.Context, userID int, id int) ([]*models.TodoHistory, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	return selectTodoHistory(ctx, m.db(), userID, id)
+}
+
+// selectTodoHistory reads the history of a todo of the user, see SelectTodoHistory
+func selectTodoHistory(ctx context.Context, q dbtx, userID int, id int) ([]*models.TodoHistory, error) {
+	var exists bool
+	err := q.QueryRowContext(ctx, `select exists(select 1 from todo where id = $1 and user_id = $2)`,
+		id, userID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	query := `
+select id, todo_id, actor_id, action, before, after, request_id, transport, created_at
+from todo_history
+where todo_id = $1
+order by id
+`
+	rows, err := q.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []*models.TodoHistory{}
+	for rows.Next() {
+		var entry models.TodoHistory
+		var before, after []byte
+		err := rows.Scan(
+			&entry.ID,
+			&entry.TodoID,
+			&entry.ActorID,
+			&entry.Action,
+			&before,
+			&after,
+			&entry.RequestID,
+			&entry.Transport,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entry.Before = before
+		entry.After = after
+
+		history = append(history, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
@@ -0,0 +1,46 @@
+package dbrepo
+
+import (
+	"context"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+)
+
+// SearchTodos finds the todos whose name or description match the query, best matches first.
+// The query uses the web search syntax: quoted phrases, "or" and -excluded words.
+func (m *postgresDBRepo) SearchTodos(ctx context.Context, userID int, query string, limit int) ([]*models.SearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	stmt := `
+select ` + todoColumns + `,
+ts_rank(search, q),
+ts_headline('english', name || '. ' || coalesce(description, ''), q,
+	'StartSel=<mark>, StopSel=</mark>, MaxWords=20, MinWords=5, MaxFragments=2')
+from todo, websearch_to_tsquery('english', $2) q
+where user_id = $1 and deleted_at is null and search @@ q
+order by ts_rank(search, q) desc, deadline, id
+limit $3
+`
+	rows, err := m.db().QueryContext(ctx, stmt, userID, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*models.SearchResult{}
+	for rows.Next() {
+		var result models.SearchResult
+		result.Todo, err = scanTodo(rows, &result.Rank, &result.Snippet)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, &result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,112 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+)
+
+// addTags attaches the tags to the todo, creating the tags the user does not have yet
+func addTags(ctx context.Context, q dbtx, userID int, todoID int, tags []string) error {
+	tags = models.NormalizeTags(tags)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	stmt := `
+insert into tag (user_id, name, created_at, updated_at)
+select $1, unnest($2::text[]), $3, $3
+on conflict (user_id, name) do nothing
+`
+	_, err := q.ExecContext(ctx, stmt, userID, tags, time.Now())
+	if err != nil {
+		return err
+	}
+
+	stmt = `
+insert into todo_tag (todo_id, tag_id)
+select $1, id from tag where user_id = $2 and name = any($3)
+on conflict do nothing
+`
+	_, err = q.ExecContext(ctx, stmt, todoID, userID, tags)
+	return err
+}
+
+// AddTodoTags attaches the tags to the todo, keeping the tags it already has
+func (m *postgresDBRepo) AddTodoTags(ctx context.Context, userID int, id int, tags []string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotTodo(ctx, tx, userID, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	// the tags are part of the todo, so changing them is a new version of it
+	_, err = tx.ExecContext(ctx, `update todo set version = version + 1, updated_at = $1 where id = $2`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	if err = addTags(ctx, tx, userID, id, tags); err != nil {
+		return err
+	}
+	if err = m.recordHistory(ctx, tx, userID, id, models.ActionUpdate, before); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveTodoTag detaches the tag from the todo, the tag itself is kept
+func (m *postgresDBRepo) RemoveTodoTag(ctx context.Context, userID int, id int, tag string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotTodo(ctx, tx, userID, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	stmt := `
+delete from todo_tag tt
+using tag tg, todo t
+where tt.tag_id = tg.id and tt.todo_id = t.id
+and t.id = $1 and t.user_id = $2 and t.deleted_at is null and tg.user_id = $2 and tg.name = $3
+`
+	result, err := tx.ExecContext(ctx, stmt, id, userID, tag)
+	if err != nil {
+		return err
+	}
+	if err = checkRowsAffected(result); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update todo set version = version + 1, updated_at = $1 where id = $2`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if err = m.recordHistory(ctx, tx, userID, id, models.ActionUpdate, before); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
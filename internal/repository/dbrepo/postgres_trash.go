@@ -0,0 +1,126 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+)
+
+// SelectTrash returns the trashed todos of the user, most recently deleted first
+func (m *postgresDBRepo) SelectTrash(ctx context.Context, userID int) ([]*models.Todo, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	query := `
+select ` + todoColumns + `
+from todo
+where user_id = $1 and deleted_at is not null
+order by deleted_at desc, id
+`
+	return m.queryTodos(ctx, query, userID)
+}
+
+// RestoreTodo takes a todo out of the trash together with the subtasks deleted with it.
+// A subtask cannot be restored while its parent is in the trash.
+func (m *postgresDBRepo) RestoreTodo(ctx context.Context, userID int, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotTodo(ctx, tx, userID, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt == nil {
+		return sql.ErrNoRows
+	}
+
+	if before.ParentID != nil {
+		var exists bool
+		err = tx.QueryRowContext(ctx, `select exists(select 1 from todo where id = $1 and deleted_at is null)`,
+			*before.ParentID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return repository.ErrParentNotFound
+		}
+	}
+
+	if err = restoreSubtree(ctx, tx, id, *before.DeletedAt); err != nil {
+		return err
+	}
+	if err = m.recordHistory(ctx, tx, userID, id, models.ActionRestore, before); err != nil {
+		return err
+	}
+
+	if err = m.rollUpCompleted(ctx, tx, before.ParentID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// trashSubtree moves a todo and its subtasks outside of the trash into it. The subtasks get
+// the same deleted_at, so that restoring the todo restores them as well.
+func trashSubtree(ctx context.Context, q dbtx, id int, deletedAt time.Time) error {
+	stmt := `
+with recursive subtree(id) as (
+	select $1::integer
+	union
+	select t.id from todo t join subtree s on t.parent_id = s.id where t.deleted_at is null
+)
+update todo set deleted_at = $2, version = version + 1, updated_at = $3
+where id in (select id from subtree)
+`
+	_, err := q.ExecContext(ctx, stmt, id, deletedAt, time.Now())
+	return err
+}
+
+// restoreSubtree takes a todo out of the trash together with the subtasks trashed with it
+func restoreSubtree(ctx context.Context, q dbtx, id int, deletedAt time.Time) error {
+	stmt := `
+with recursive subtree(id) as (
+	select $1::integer
+	union
+	select t.id from todo t join subtree s on t.parent_id = s.id where t.deleted_at = $2
+)
+update todo set deleted_at = null, version = version + 1, updated_at = $3
+where id in (select id from subtree)
+`
+	_, err := q.ExecContext(ctx, stmt, id, deletedAt, time.Now())
+	return err
+}
+
+// PurgeTodo permanently deletes a trashed todo together with its subtasks
+func (m *postgresDBRepo) PurgeTodo(ctx context.Context, userID int, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	result, err := m.db().ExecContext(ctx, `delete from todo where id = $1 and user_id = $2 and deleted_at is not null`, id, userID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(result)
+}
+
+// PurgeTrash permanently deletes the todos of all users trashed before the given time
+// and returns how many were deleted
+func (m *postgresDBRepo) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	result, err := m.db().ExecContext(ctx, `delete from todo where deleted_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	purged, err := result.RowsAffected()
+	return int(purged), err
+}
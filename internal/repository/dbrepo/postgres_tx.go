@@ -0,0 +1,75 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/jackc/pgconn"
+)
+
+const (
+	// maxTxAttempts is how many times WithTx runs a transaction that fails to serialize
+	maxTxAttempts = 5
+	// txRetryDelay is how long WithTx waits before running a transaction again, doubled every time
+	txRetryDelay = 10 * time.Millisecond
+)
+
+// WithIsolation returns a repo running the transactions of WithTx at the isolation level
+func (m *postgresDBRepo) WithIsolation(level sql.IsolationLevel) repository.DatabaseRepo {
+	repo := *m
+	repo.isolation = level
+	return &repo
+}
+
+// WithTx runs fn with a repo running all of its queries in one transaction, committed once fn
+// returns without an error. A transaction failing to serialize with a concurrent one is run
+// again, so fn has to be safe to call more than once. Inside of WithTx, fn runs in a savepoint
+// instead and a failure to serialize is left to the outermost WithTx.
+func (m *postgresDBRepo) WithTx(ctx context.Context, fn func(repo repository.DatabaseRepo) error) error {
+	if m.tx != nil {
+		return m.runTx(ctx, fn)
+	}
+
+	delay := txRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := m.runTx(ctx, fn)
+		if attempt == maxTxAttempts || !isSerializationFailure(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// runTx runs fn once with a repo bound to a new transaction
+func (m *postgresDBRepo) runTx(ctx context.Context, fn func(repo repository.DatabaseRepo) error) error {
+	// the connection is kept for the COPY of InsertTodos
+	tx, err := m.beginConnTx(ctx, &sql.TxOptions{Isolation: m.isolation})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	repo := *m
+	repo.tx = tx
+	if err = fn(&repo); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// isSerializationFailure reports whether a transaction failed because of a concurrent one
+// and succeeds if it is run again
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	// 40001 is serialization_failure, 40P01 is deadlock_detected
+	return errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01")
+}
@@ -0,0 +1,32 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgconn"
+)
+
+var theSerializationFailureTests = []struct {
+	name     string
+	err      error
+	expected bool
+}{
+	{"serialization failure", &pgconn.PgError{Code: "40001"}, true},
+	{"deadlock", &pgconn.PgError{Code: "40P01"}, true},
+	{"wrapped serialization failure", fmt.Errorf("update todo: %w", &pgconn.PgError{Code: "40001"}), true},
+	{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+	{"no rows", sql.ErrNoRows, false},
+	{"other error", errors.New("error"), false},
+	{"no error", nil, false},
+}
+
+func TestIsSerializationFailure(t *testing.T) {
+	for _, e := range theSerializationFailureTests {
+		if got := isSerializationFailure(e.err); got != e.expected {
+			t.Errorf("%s: got %v, wanted %v", e.name, got, e.expected)
+		}
+	}
+}
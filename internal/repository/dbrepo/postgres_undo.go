@@ -0,0 +1,261 @@
+package dbrepo
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+)
+
+// logOperation returns the operation of the current transaction in the operation log of the
+// user, every undoable change made by the transaction is a part of it
+func logOperation(ctx context.Context, q dbtx, userID int) (int, error) {
+	stmt := `
+insert into todo_operation (user_id, txid, created_at) values ($1, txid_current(), $2)
+on conflict (txid) do update set txid = excluded.txid
+returning id
+`
+	var id int
+	err := q.QueryRowContext(ctx, stmt, userID, time.Now()).Scan(&id)
+	return id, err
+}
+
+// UndoOperations reverts the last count operations of the user, newest first, and returns how
+// many were undone. Either all of them are undone or none is.
+func (m *postgresDBRepo) UndoOperations(ctx context.Context, userID int, count int) (int, error) {
+	query := `
+select id from todo_operation
+where user_id = $1 and not undone
+order by id desc
+limit $2
+for update
+`
+	return m.replayOperations(ctx, userID, count, query, true)
+}
+
+// RedoOperations reapplies the last count undone operations of the user, oldest first, and
+// returns how many were redone. Operations undone before the last new operation cannot be redone.
+func (m *postgresDBRepo) RedoOperations(ctx context.Context, userID int, count int) (int, error) {
+	query := `
+select id from todo_operation
+where user_id = $1 and undone
+and id > coalesce((select max(id) from todo_operation where user_id = $1 and not undone), 0)
+order by id
+limit $2
+for update
+`
+	return m.replayOperations(ctx, userID, count, query, false)
+}
+
+// replayOperations undoes or redoes the operations selected by the query in a single transaction
+func (m *postgresDBRepo) replayOperations(ctx context.Context, userID int, count int, query string, undo bool) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, userID, count)
+	if err != nil {
+		return 0, err
+	}
+	var operations []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		operations = append(operations, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range operations {
+		if err = m.replayOperation(ctx, tx, userID, id, undo); err != nil {
+			return 0, err
+		}
+	}
+	return len(operations), tx.Commit()
+}
+
+// operationChange is a change of a todo made by an operation
+type operationChange struct {
+	historyID int
+	todoID    int
+	before    *models.Todo
+	after     *models.Todo
+}
+
+// replayOperation undoes an operation by writing back the todos as they were before each of
+// its changes, newest change first, or redoes it by writing back the todos as they were after.
+// It fails with repository.ErrUndoConflict if a todo has been changed outside of the operation log since.
+func (m *postgresDBRepo) replayOperation(ctx context.Context, q dbtx, userID int, id int, undo bool) error {
+	order := "id"
+	if undo {
+		order = "id desc"
+	}
+	query := `
+select id, todo_id, before, after from todo_history
+where operation_id = $1 and action not in ($2, $3)
+order by ` + order
+	rows, err := q.QueryContext(ctx, query, id, models.ActionUndo, models.ActionRedo)
+	if err != nil {
+		return err
+	}
+	var changes []operationChange
+	for rows.Next() {
+		var change operationChange
+		var before, after []byte
+		if err := rows.Scan(&change.historyID, &change.todoID, &before, &after); err != nil {
+			rows.Close()
+			return err
+		}
+		if change.before, err = unmarshalSnapshot(before); err != nil {
+			rows.Close()
+			return err
+		}
+		if change.after, err = unmarshalSnapshot(after); err != nil {
+			rows.Close()
+			return err
+		}
+		changes = append(changes, change)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	action, undone := models.ActionRedo, false
+	if undo {
+		action, undone = models.ActionUndo, true
+	}
+	// ancestors completed or reopened by the replay are recorded as part of it
+	replayed := func(userID int, todoID int, _ string, before *models.Todo) error {
+		return m.insertHistory(ctx, q, userID, todoID, action, before, &id)
+	}
+	for _, change := range changes {
+		var changedSince bool
+		err := q.QueryRowContext(ctx,
+			`select exists(select 1 from todo_history where todo_id = $1 and id > $2 and operation_id is null)`,
+			change.todoID, change.historyID).Scan(&changedSince)
+		if err != nil {
+			return err
+		}
+		if changedSince {
+			return repository.ErrUndoConflict
+		}
+
+		target := change.after
+		if undo {
+			target = change.before
+		}
+		current, err := m.writeSnapshot(ctx, q, userID, change.todoID, target, replayed)
+		if err != nil {
+			return err
+		}
+		if err = m.insertHistory(ctx, q, userID, change.todoID, action, current, &id); err != nil {
+			return err
+		}
+	}
+
+	_, err = q.ExecContext(ctx, `update todo_operation set undone = $1 where id = $2`, undone, id)
+	return err
+}
+
+// unmarshalSnapshot reads a todo from its JSON snapshot, nil stays nil
+func unmarshalSnapshot(snapshot []byte) (*models.Todo, error) {
+	if snapshot == nil {
+		return nil, nil
+	}
+	var todo models.Todo
+	if err := json.Unmarshal(snapshot, &todo); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// writeSnapshot writes a todo from the history back, a nil snapshot moves the todo to the
+// trash. Ancestors whose completion flips are passed to record. It returns the todo as it was before.
+func (m *postgresDBRepo) writeSnapshot(ctx context.Context, q dbtx, userID int, id int, snapshot *models.Todo, record recordFunc) (*models.Todo, error) {
+	current, err := snapshotTodo(ctx, q, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	parentID := current.ParentID
+	deletedAt := current.DeletedAt
+	if snapshot == nil {
+		now := time.Now()
+		if deletedAt == nil {
+			deletedAt = &now
+		}
+	} else {
+		parentID = snapshot.ParentID
+		deletedAt = snapshot.DeletedAt
+
+		if err := checkProject(ctx, q, userID, snapshot.ProjectID); err != nil {
+			return nil, err
+		}
+		if deletedAt == nil {
+			if err := checkParent(ctx, q, userID, id, parentID); err != nil {
+				return nil, err
+			}
+		}
+
+		stmt := `
+update todo set project_id = $1, parent_id = $2, name = $3, description = $4, deadline = $5,
+completed = $6, rrule = $7, version = version + 1, updated_at = $8
+where id = $9
+`
+		_, err = q.ExecContext(ctx, stmt,
+			snapshot.ProjectID,
+			parentID,
+			snapshot.Name,
+			snapshot.Description,
+			snapshot.Deadline,
+			snapshot.Completed,
+			snapshot.RRule,
+			time.Now(),
+			id,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = q.ExecContext(ctx, `delete from todo_tag where todo_id = $1`, id)
+		if err != nil {
+			return nil, err
+		}
+		if err = addTags(ctx, q, userID, id, snapshot.Tags); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case current.DeletedAt == nil && deletedAt != nil:
+		err = trashSubtree(ctx, q, id, *deletedAt)
+	case current.DeletedAt != nil && deletedAt == nil:
+		err = restoreSubtree(ctx, q, id, *current.DeletedAt)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = rollUp(ctx, q, parentID, record); err != nil {
+		return nil, err
+	}
+	if current.ParentID != nil && (parentID == nil || *current.ParentID != *parentID) {
+		if err = rollUp(ctx, q, current.ParentID, record); err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
@@ -0,0 +1,64 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/jackc/pgconn"
+)
+
+func (m *postgresDBRepo) InsertUser(ctx context.Context, user models.User) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	stmt := `
+insert into users (email, password_hash, created_at, updated_at)
+values ($1, $2, $3, $4) returning id
+`
+	var newID int
+	err := m.db().QueryRowContext(ctx, stmt,
+		user.Email,
+		user.PasswordHash,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		// 23505 is unique_violation, the email is already taken
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return newID, repository.ErrDuplicateEmail
+		}
+		return newID, err
+	}
+	return newID, nil
+}
+
+func (m *postgresDBRepo) SelectUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	var user models.User
+
+	query := `
+select id, email, password_hash, created_at, updated_at
+from users
+where email = $1
+`
+
+	row := m.db().QueryRowContext(ctx, query, email)
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.PasswordHash,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,319 @@
+package dbrepo
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/jackc/pgtype"
+)
+
+// todoEvent returns the webhook event of a change of a todo, before is nil if it was inserted
+func todoEvent(before *models.Todo, after *models.Todo) string {
+	switch {
+	case before == nil:
+		return models.EventTodoCreated
+	case before.DeletedAt == nil && after.DeletedAt != nil:
+		return models.EventTodoDeleted
+	case before.DeletedAt != nil && after.DeletedAt == nil:
+		return models.EventTodoRestored
+	case !before.Completed && after.Completed:
+		return models.EventTodoCompleted
+	case before.Completed && !after.Completed:
+		return models.EventTodoUncompleted
+	}
+	return models.EventTodoUpdated
+}
+
+// enqueueWebhooks queues a delivery of the event of every todo for every active webhook of the user subscribed
+// to it, in the order of the todos. The deliveries are a part of the transaction, so they are only sent if it commits.
+func enqueueWebhooks(ctx context.Context, q dbtx, userID int, event string, todos ...[]byte) error {
+	now := time.Now()
+	payloads := make([]string, 0, len(todos))
+	for _, todo := range todos {
+		payload, err := json.Marshal(models.WebhookEvent{
+			Event:     event,
+			CreatedAt: now,
+			Todo:      todo,
+		})
+		if err != nil {
+			return err
+		}
+		payloads = append(payloads, string(payload))
+	}
+
+	stmt := `
+insert into webhook_delivery (webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+select w.id, $2, p.payload::jsonb, $4, $5, $5, $5
+from webhook w cross join unnest($3::text[]) with ordinality as p(payload, n)
+where w.user_id = $1 and w.active and $2 = any(w.events)
+order by p.n, w.id
+`
+	_, err := q.ExecContext(ctx, stmt, userID, event, payloads, models.DeliveryPending, now)
+	return err
+}
+
+// webhookColumns are the columns of the webhook table read by scanWebhook, in order
+const webhookColumns = `id, user_id, url, secret, events, active, created_at, updated_at`
+
+// scanWebhook scans a row selected with webhookColumns
+func scanWebhook(row rowScanner) (*models.Webhook, error) {
+	var webhook models.Webhook
+	var events pgtype.TextArray
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.UserID,
+		&webhook.URL,
+		&webhook.Secret,
+		&events,
+		&webhook.Active,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err = events.AssignTo(&webhook.Events); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (m *postgresDBRepo) SelectWebhooks(ctx context.Context, userID int) ([]*models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	query := `select ` + webhookColumns + ` from webhook where user_id = $1 order by id`
+	rows, err := m.db().QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*models.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (m *postgresDBRepo) SelectWebhook(ctx context.Context, userID int, id int) (*models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	query := `select ` + webhookColumns + ` from webhook where id = $1 and user_id = $2`
+	return scanWebhook(m.db().QueryRowContext(ctx, query, id, userID))
+}
+
+func (m *postgresDBRepo) InsertWebhook(ctx context.Context, webhook models.Webhook) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	stmt := `
+insert into webhook (user_id, url, secret, events, active, created_at, updated_at)
+values ($1, $2, $3, $4, $5, $6, $6) returning id
+`
+	var newID int
+	err := m.db().QueryRowContext(ctx, stmt,
+		webhook.UserID,
+		webhook.URL,
+		webhook.Secret,
+		webhook.Events,
+		webhook.Active,
+		time.Now(),
+	).Scan(&newID)
+	return newID, err
+}
+
+// UpdateWebhook updates the URL, events and state of a webhook, and its secret unless it is empty
+func (m *postgresDBRepo) UpdateWebhook(ctx context.Context, webhook models.Webhook) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	stmt := `
+update webhook set url = $1, events = $2, active = $3, secret = case when $4 = '' then secret else $4 end, updated_at = $5
+where id = $6 and user_id = $7
+`
+	result, err := m.db().ExecContext(ctx, stmt,
+		webhook.URL,
+		webhook.Events,
+		webhook.Active,
+		webhook.Secret,
+		time.Now(),
+		webhook.ID,
+		webhook.UserID,
+	)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(result)
+}
+
+// DeleteWebhook deletes a webhook together with its deliveries
+func (m *postgresDBRepo) DeleteWebhook(ctx context.Context, userID int, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	result, err := m.db().ExecContext(ctx, `delete from webhook where id = $1 and user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(result)
+}
+
+// deliveryColumns are the columns of the webhook_delivery table read by scanDelivery, in order
+const deliveryColumns = `d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.response_status, d.error,
+d.next_attempt_at, d.created_at, d.updated_at`
+
+// scanDelivery scans a row selected with deliveryColumns, followed by the extra columns if any
+func scanDelivery(row rowScanner, extra ...any) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	var payload []byte
+	dest := []any{
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.Event,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.ResponseStatus,
+		&delivery.Error,
+		&delivery.NextAttemptAt,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Payload = payload
+	return &delivery, nil
+}
+
+// SelectWebhookDeliveries returns the last 100 deliveries of a webhook of the user, newest first
+func (m *postgresDBRepo) SelectWebhookDeliveries(ctx context.Context, userID int, webhookID int) ([]*models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	// make sure the webhook exists, so that an unknown webhook is not reported as one without deliveries
+	if _, err := m.SelectWebhook(ctx, userID, webhookID); err != nil {
+		return nil, err
+	}
+
+	query := `select ` + deliveryColumns + ` from webhook_delivery d where d.webhook_id = $1 order by d.id desc limit 100`
+	rows, err := m.db().QueryContext(ctx, query, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (m *postgresDBRepo) InsertWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	stmt := `
+insert into webhook_delivery (webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+values ($1, $2, $3, $4, $5, $6, $6) returning id
+`
+	var newID int
+	err := m.db().QueryRowContext(ctx, stmt,
+		delivery.WebhookID,
+		delivery.Event,
+		string(delivery.Payload),
+		delivery.Status,
+		delivery.NextAttemptAt,
+		time.Now(),
+	).Scan(&newID)
+	return newID, err
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries of active webhooks due for an attempt,
+// together with the URL and secret of their webhooks. They are not claimed again for the lease,
+// so that several dispatchers do not send the same delivery.
+func (m *postgresDBRepo) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	now := time.Now()
+	stmt := `
+update webhook_delivery d set next_attempt_at = $1, updated_at = $2
+from webhook w
+where w.id = d.webhook_id and d.id in (
+	select pd.id from webhook_delivery pd join webhook pw on pw.id = pd.webhook_id
+	where pd.status = $3 and pd.next_attempt_at <= $2 and pw.active
+	order by pd.next_attempt_at, pd.id
+	limit $4
+	for update of pd skip locked
+)
+returning ` + deliveryColumns + `, w.url, w.secret`
+	rows, err := m.db().QueryContext(ctx, stmt, now.Add(lease), now, models.DeliveryPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		var url, secret string
+		delivery, err := scanDelivery(rows, &url, &secret)
+		if err != nil {
+			return nil, err
+		}
+		delivery.URL = url
+		delivery.Secret = secret
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery records the outcome of an attempt to send a delivery
+func (m *postgresDBRepo) UpdateWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	stmt := `
+update webhook_delivery set status = $1, attempts = $2, response_status = $3, error = $4, next_attempt_at = $5, updated_at = $6
+where id = $7
+`
+	result, err := m.db().ExecContext(ctx, stmt,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.ResponseStatus,
+		delivery.Error,
+		delivery.NextAttemptAt,
+		time.Now(),
+		delivery.ID,
+	)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(result)
+}
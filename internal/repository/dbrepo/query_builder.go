@@ -0,0 +1,207 @@
+package dbrepo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+)
+
+// sortColumn is a column todos can be sorted by
+type sortColumn struct {
+	name string
+	// parse converts a cursor value back into a query parameter
+	parse func(value string) (any, error)
+}
+
+func parseTime(value string) (any, error) {
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+func parseString(value string) (any, error) {
+	return value, nil
+}
+
+func parseBool(value string) (any, error) {
+	return strconv.ParseBool(value)
+}
+
+func parseInt(value string) (any, error) {
+	return strconv.Atoi(value)
+}
+
+// sortColumns maps the fields of models.TodoSortFields to their columns, only these
+// columns ever end up in an ORDER BY
+var sortColumns = map[string]sortColumn{
+	"deadline":   {"DEADLINE", parseTime},
+	"created_at": {"CREATED_AT", parseTime},
+	"updated_at": {"UPDATED_AT", parseTime},
+	"name":       {"NAME", parseString},
+	"completed":  {"COMPLETED", parseBool},
+	"id":         {"ID", parseInt},
+}
+
+// queryBuilder builds the WHERE, ORDER BY and LIMIT clauses of a todo listing.
+// Values are always passed as parameters and columns come from sortColumns.
+type queryBuilder struct {
+	conditions []string
+	args       []any
+	sort       []models.SortField
+	// sqlite builds the clauses for SQLite, which has no arrays and compares times as text
+	sqlite bool
+}
+
+// arg adds a parameter and returns its placeholder
+func (b *queryBuilder) arg(value any) string {
+	if t, ok := value.(time.Time); ok && b.sqlite {
+		// the times are stored in UTC, so that they sort
+		value = t.UTC()
+	}
+	b.args = append(b.args, value)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// where adds a condition, every ? in it is replaced by the placeholder of the next value
+func (b *queryBuilder) where(condition string, values ...any) {
+	parts := strings.Split(condition, "?")
+	if len(parts) != len(values)+1 {
+		panic(fmt.Sprintf("query builder: %d values for %q", len(values), condition))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(parts[0])
+	for i, value := range values {
+		sb.WriteString(b.arg(value))
+		sb.WriteString(parts[i+1])
+	}
+	b.conditions = append(b.conditions, sb.String())
+}
+
+// whereRange adds the conditions keeping column in [after, before)
+func (b *queryBuilder) whereRange(column string, after *time.Time, before *time.Time) {
+	if after != nil {
+		b.where(column+" >= ?", *after)
+	}
+	if before != nil {
+		b.where(column+" < ?", *before)
+	}
+}
+
+// filter adds the conditions of the filter and remembers its sort
+func (b *queryBuilder) filter(filter models.TodoFilter) error {
+	if filter.Completed != nil {
+		b.where("COMPLETED = ?", *filter.Completed)
+	}
+
+	if tags := models.NormalizeTags(filter.Tags); len(tags) > 0 {
+		var names any = tags
+		match := "TG.NAME = ANY(?)"
+		if b.sqlite {
+			encoded, err := json.Marshal(tags)
+			if err != nil {
+				return err
+			}
+			names = string(encoded)
+			match = "TG.NAME IN (SELECT VALUE FROM JSON_EACH(?))"
+		}
+		tagged := `
+	SELECT COUNT(*) FROM TODO_TAG TT JOIN TAG TG ON TG.ID = TT.TAG_ID
+	WHERE TT.TODO_ID = TODO.ID AND ` + match
+		if filter.MatchAllTags {
+			b.where("("+tagged+"\n) = ?", names, len(tags))
+		} else {
+			b.where("("+tagged+"\n) > 0", names)
+		}
+	}
+
+	b.whereRange("DEADLINE", filter.DeadlineAfter, filter.DeadlineBefore)
+	b.whereRange("CREATED_AT", filter.CreatedAfter, filter.CreatedBefore)
+	b.whereRange("UPDATED_AT", filter.UpdatedAfter, filter.UpdatedBefore)
+
+	if filter.Overdue {
+		b.where("NOT COMPLETED AND DEADLINE < ?", time.Now().UTC())
+	}
+
+	if filter.NameContains != "" {
+		// the text is matched literally, so escape the LIKE wildcards
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(filter.NameContains)
+		if b.sqlite {
+			// LIKE ignores the case of ASCII letters only
+			b.where(`NAME LIKE '%' || ? || '%' ESCAPE '\'`, escaped)
+		} else {
+			b.where("NAME ILIKE '%' || ? || '%'", escaped)
+		}
+	}
+
+	for _, field := range filter.Sort {
+		if _, ok := sortColumns[field.Field]; !ok {
+			return fmt.Errorf("%w: todos cannot be sorted by %q", models.ErrInvalidSort, field.Field)
+		}
+	}
+	b.sort = models.NormalizeTodoSort(filter.Sort)
+	return nil
+}
+
+// after adds the keyset condition keeping the todos that come after the cursor in the sort order.
+// For the fields f1, f2, ... it is f1 > v1 OR (f1 = v1 AND f2 > v2) OR ..., with < for descending fields.
+func (b *queryBuilder) after(cursor *models.TodoCursor) error {
+	// the values of all the fields but the id, which is the last one
+	if len(cursor.Values) != len(b.sort)-1 {
+		return models.ErrInvalidCursor
+	}
+
+	placeholders := make([]string, len(b.sort))
+	for i, field := range b.sort {
+		var value any = cursor.ID
+		if i < len(cursor.Values) {
+			var err error
+			value, err = sortColumns[field.Field].parse(cursor.Values[i])
+			if err != nil {
+				return models.ErrInvalidCursor
+			}
+		}
+		placeholders[i] = b.arg(value)
+	}
+
+	terms := make([]string, 0, len(b.sort))
+	for i, field := range b.sort {
+		var term []string
+		for j := 0; j < i; j++ {
+			term = append(term, sortColumns[b.sort[j].Field].name+" = "+placeholders[j])
+		}
+		operator := " > "
+		if field.Desc {
+			operator = " < "
+		}
+		term = append(term, sortColumns[field.Field].name+operator+placeholders[i])
+		terms = append(terms, "("+strings.Join(term, " AND ")+")")
+	}
+	b.conditions = append(b.conditions, "("+strings.Join(terms, " OR ")+")")
+	return nil
+}
+
+// build returns the WHERE and ORDER BY clauses, followed by a LIMIT if limit is positive
+func (b *queryBuilder) build(limit int) string {
+	var sb strings.Builder
+	if len(b.conditions) > 0 {
+		sb.WriteString("WHERE " + strings.Join(b.conditions, " AND ") + "\n")
+	}
+
+	order := make([]string, 0, len(b.sort))
+	for _, field := range b.sort {
+		column := sortColumns[field.Field].name
+		if field.Desc {
+			column += " DESC"
+		}
+		order = append(order, column)
+	}
+	sb.WriteString("ORDER BY " + strings.Join(order, ", "))
+
+	if limit > 0 {
+		sb.WriteString(" LIMIT " + b.arg(limit))
+	}
+	return sb.String()
+}
@@ -0,0 +1,117 @@
+package dbrepo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+)
+
+var testDeadline = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+var theQueryBuilderTests = []struct {
+	name         string
+	sqlite       bool
+	filter       models.TodoFilter
+	after        *models.TodoCursor
+	expected     string
+	expectedArgs int
+	expectedErr  error
+}{
+	{
+		name:         "default sort",
+		expected:     "WHERE USER_ID = $1\nORDER BY DEADLINE, ID LIMIT $2",
+		expectedArgs: 2,
+	},
+	{
+		name:         "deadline range",
+		filter:       models.TodoFilter{DeadlineAfter: &testDeadline, DeadlineBefore: &testDeadline},
+		expected:     "WHERE USER_ID = $1 AND DEADLINE >= $2 AND DEADLINE < $3\nORDER BY DEADLINE, ID LIMIT $4",
+		expectedArgs: 4,
+	},
+	{
+		name:         "name contains",
+		filter:       models.TodoFilter{NameContains: "50%"},
+		expected:     "WHERE USER_ID = $1 AND NAME ILIKE '%' || $2 || '%'\nORDER BY DEADLINE, ID LIMIT $3",
+		expectedArgs: 3,
+	},
+	{
+		name:         "name contains on sqlite",
+		sqlite:       true,
+		filter:       models.TodoFilter{NameContains: "50%"},
+		expected:     "WHERE USER_ID = $1 AND NAME LIKE '%' || $2 || '%' ESCAPE '\\'\nORDER BY DEADLINE, ID LIMIT $3",
+		expectedArgs: 3,
+	},
+	{
+		name:         "all tags on sqlite",
+		sqlite:       true,
+		filter:       models.TodoFilter{Tags: []string{"home", "work"}, MatchAllTags: true},
+		expected:     "WHERE USER_ID = $1 AND (\n\tSELECT COUNT(*) FROM TODO_TAG TT JOIN TAG TG ON TG.ID = TT.TAG_ID\n\tWHERE TT.TODO_ID = TODO.ID AND TG.NAME IN (SELECT VALUE FROM JSON_EACH($2))\n) = $3\nORDER BY DEADLINE, ID LIMIT $4",
+		expectedArgs: 4,
+	},
+	{
+		name:         "multiple sort fields",
+		filter:       models.TodoFilter{Sort: []models.SortField{{Field: "completed"}, {Field: "name", Desc: true}}},
+		expected:     "WHERE USER_ID = $1\nORDER BY COMPLETED, NAME DESC, ID LIMIT $2",
+		expectedArgs: 2,
+	},
+	{
+		name:         "sort by id",
+		filter:       models.TodoFilter{Sort: []models.SortField{{Field: "id", Desc: true}, {Field: "name"}}},
+		expected:     "WHERE USER_ID = $1\nORDER BY ID DESC LIMIT $2",
+		expectedArgs: 2,
+	},
+	{
+		name:         "keyset",
+		filter:       models.TodoFilter{Sort: []models.SortField{{Field: "name", Desc: true}}},
+		after:        &models.TodoCursor{Values: []string{"milk"}, ID: 3},
+		expected:     "WHERE USER_ID = $1 AND ((NAME < $2) OR (NAME = $2 AND ID > $3))\nORDER BY NAME DESC, ID LIMIT $4",
+		expectedArgs: 4,
+	},
+	{
+		name:        "unknown sort field",
+		filter:      models.TodoFilter{Sort: []models.SortField{{Field: "user_id; drop table todo"}}},
+		expectedErr: models.ErrInvalidSort,
+	},
+	{
+		name:        "cursor of another sort",
+		after:       &models.TodoCursor{Values: []string{"milk", "true"}, ID: 3},
+		expectedErr: models.ErrInvalidCursor,
+	},
+	{
+		name:        "cursor with a wrong value",
+		after:       &models.TodoCursor{Values: []string{"yesterday"}, ID: 3},
+		expectedErr: models.ErrInvalidCursor,
+	},
+}
+
+func TestQueryBuilder(t *testing.T) {
+	for _, e := range theQueryBuilderTests {
+		b := queryBuilder{sqlite: e.sqlite}
+		b.where("USER_ID = ?", 1)
+		err := b.filter(e.filter)
+		if err == nil && e.after != nil {
+			err = b.after(e.after)
+		}
+
+		if e.expectedErr != nil {
+			if !errors.Is(err, e.expectedErr) {
+				t.Errorf("%s returned wrong error: got %v, wanted %v", e.name, err, e.expectedErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s returned an error: %v", e.name, err)
+			continue
+		}
+
+		query := b.build(10)
+		if query != e.expected {
+			t.Errorf("%s built wrong query:\n%s\nwanted:\n%s", e.name, query, e.expected)
+		}
+		if len(b.args) != e.expectedArgs {
+			t.Errorf("%s returned wrong number of args: got %d, wanted %d", e.name, len(b.args), e.expectedArgs)
+		}
+	}
+}
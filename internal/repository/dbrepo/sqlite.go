@@ -0,0 +1,153 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/events"
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+)
+
+// sqliteDBRepo keeps the data in a SQLite database opened by driver.ConnectSQLite. Its queries mirror
+// the ones of the Postgres repo, with JSON in place of arrays. Times are stored in UTC as text,
+// which sorts like the times themselves.
+type sqliteDBRepo struct {
+	DB     *sql.DB
+	events *events.Bus
+	audit  models.Audit
+	// timeout is how long a method may take, the ones doing more work take longer
+	timeout time.Duration
+	// tx is the transaction of WithTx the repo runs its queries in, nil outside of it
+	tx *todoTx
+}
+
+// NewSQLiteRepo returns a repo publishing the changes of todos to the bus, its methods time out
+// after the timeout, repository.DefaultQueryTimeout if it is 0
+func NewSQLiteRepo(conn *sql.DB, bus *events.Bus, timeout time.Duration) repository.DatabaseRepo {
+	if timeout == 0 {
+		timeout = repository.DefaultQueryTimeout
+	}
+	return &sqliteDBRepo{
+		DB:      conn,
+		events:  bus,
+		timeout: timeout,
+	}
+}
+
+// sqliteTodoColumns are the columns of the todo table read by scanSQLiteTodo, in order,
+// see todoColumns. The tags are a JSON array.
+const sqliteTodoColumns = `id, user_id, project_id, parent_id, name, description, deadline, completed, rrule, version, deleted_at, created_at, updated_at,
+coalesce(
+	(select 100 * count(*) filter (where c.completed) / nullif(count(*), 0) from todo c where c.parent_id = todo.id and c.deleted_at is null),
+	case when todo.completed then 100 else 0 end
+),
+(select json_group_array(name) from (select tg.name from todo_tag tt join tag tg on tg.id = tt.tag_id where tt.todo_id = todo.id order by tg.name))`
+
+// scanSQLiteTodo scans a row selected with sqliteTodoColumns, followed by the extra columns if any
+func scanSQLiteTodo(row rowScanner, extra ...any) (*models.Todo, error) {
+	var todo models.Todo
+	var tags string
+	dest := []any{
+		&todo.ID,
+		&todo.UserID,
+		&todo.ProjectID,
+		&todo.ParentID,
+		&todo.Name,
+		&todo.Description,
+		&todo.Deadline,
+		&todo.Completed,
+		&todo.RRule,
+		&todo.Version,
+		&todo.DeletedAt,
+		&todo.CreatedAt,
+		&todo.UpdatedAt,
+		&todo.Progress,
+		&tags,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(tags), &todo.Tags); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// queryTodos runs a query selecting sqliteTodoColumns and scans all the returned rows
+func (m *sqliteDBRepo) queryTodos(ctx context.Context, query string, args ...any) ([]*models.Todo, error) {
+	rows, err := m.db().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := []*models.Todo{}
+	for rows.Next() {
+		todo, err := scanSQLiteTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		todos = append(todos, todo)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+// db returns what the queries of the repo run in, the transaction of WithTx inside of it
+func (m *sqliteDBRepo) db() dbtx {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.DB
+}
+
+// beginTx starts a transaction publishing its events to the bus of the repo. The transactions
+// of the database take its write lock when they begin, so they never fail to serialize.
+func (m *sqliteDBRepo) beginTx(ctx context.Context) (*todoTx, error) {
+	if m.tx != nil {
+		return m.tx.beginSavepoint(ctx)
+	}
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &todoTx{Tx: tx, bus: m.events}, nil
+}
+
+// WithAudit returns a repo recording the audit in the history of the todos it changes
+func (m *sqliteDBRepo) WithAudit(audit models.Audit) repository.DatabaseRepo {
+	repo := *m
+	repo.audit = audit
+	return &repo
+}
+
+// WithIsolation returns the repo itself, SQLite transactions are always serializable
+func (m *sqliteDBRepo) WithIsolation(level sql.IsolationLevel) repository.DatabaseRepo {
+	return m
+}
+
+// WithTx runs fn with a repo running all of its queries in one transaction, committed once fn
+// returns without an error. Only one transaction writes to the database at a time, so fn runs
+// once. Inside of WithTx, fn runs in a savepoint instead.
+func (m *sqliteDBRepo) WithTx(ctx context.Context, fn func(repo repository.DatabaseRepo) error) error {
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	repo := *m
+	repo.tx = tx
+	if err = fn(&repo); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,154 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/anras5/todo-app-backend/internal/rrule"
+)
+
+// InsertTodos inserts the todos one by one in a single transaction, SQLite has no COPY. Like the
+// Postgres repo, the projects and parents are checked before any todo is inserted, so a todo cannot
+// be the parent of another one of the same call.
+func (m *sqliteDBRepo) InsertTodos(ctx context.Context, userID int, todos []models.Todo) ([]models.TodoInsertResult, error) {
+	// inserting a batch takes longer than a single insert
+	ctx, cancel := context.WithTimeout(ctx, 10*m.timeout)
+	defer cancel()
+
+	if len(todos) > repository.MaxInsertBatch {
+		return nil, fmt.Errorf("at most %d todos can be inserted at once", repository.MaxInsertBatch)
+	}
+	results := make([]models.TodoInsertResult, len(todos))
+	todos = slices.Clone(todos)
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var valid []int
+	for i := range todos {
+		todo := &todos[i]
+		todo.ID = 0
+		todo.UserID = userID
+
+		if utf8.RuneCountInString(todo.Name) > maxTodoName {
+			results[i].Err = fmt.Errorf("name should be at most %d characters", maxTodoName)
+			continue
+		}
+		err := checkProject(ctx, tx, userID, todo.ProjectID)
+		if err == nil {
+			err = checkParent(ctx, tx, userID, 0, todo.ParentID)
+		}
+		switch {
+		case errors.Is(err, repository.ErrProjectNotFound), errors.Is(err, repository.ErrParentNotFound):
+			results[i].Err = err
+			continue
+		case err != nil:
+			return nil, err
+		}
+		if todo.RRule, results[i].Err = rrule.Normalize(todo.RRule); results[i].Err != nil {
+			continue
+		}
+		valid = append(valid, i)
+	}
+
+	rolledUp := make(map[int]bool)
+	for _, i := range valid {
+		todo := todos[i]
+		if results[i].ID, err = m.insertTodo(ctx, tx, todo); err != nil {
+			return nil, err
+		}
+		if err = m.recordHistory(ctx, tx, userID, results[i].ID, models.ActionInsert, nil); err != nil {
+			return nil, err
+		}
+		if todo.ParentID != nil && !rolledUp[*todo.ParentID] {
+			rolledUp[*todo.ParentID] = true
+			if err = m.rollUpCompleted(ctx, tx, todo.ParentID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ApplyTodoBatch applies the operations with the same checks as the methods writing a single todo.
+// Without atomic every operation runs in its own savepoint, so that a failing one leaves the
+// transaction usable for the rest.
+func (m *sqliteDBRepo) ApplyTodoBatch(ctx context.Context, userID int, ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	// a batch takes longer than a single write
+	ctx, cancel := context.WithTimeout(ctx, 3*m.timeout)
+	defer cancel()
+
+	if len(ops) > repository.MaxBatchOperations {
+		return nil, fmt.Errorf("at most %d operations can be applied at once", repository.MaxBatchOperations)
+	}
+	results := make([]models.BatchResult, len(ops))
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for i, op := range ops {
+		result := &results[i]
+		if atomic {
+			result.ID, result.Err = m.applyBatchOperation(ctx, tx, userID, op)
+			if result.Err != nil {
+				// nothing is kept, the transaction rolls back once it returns
+				abortBatch(results, i)
+				return results, nil
+			}
+			continue
+		}
+
+		savepoint, err := tx.beginSavepoint(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result.ID, result.Err = m.applyBatchOperation(ctx, savepoint, userID, op)
+		if result.Err != nil {
+			result.ID = 0
+			err = savepoint.Rollback()
+		} else {
+			err = savepoint.Commit()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// applyBatchOperation applies one operation of a batch as a part of the transaction
+func (m *sqliteDBRepo) applyBatchOperation(ctx context.Context, q dbtx, userID int, op models.BatchOperation) (int, error) {
+	todo := op.Todo
+	todo.UserID = userID
+
+	switch op.Op {
+	case models.BatchCreate:
+		return m.createTodo(ctx, q, todo)
+	case models.BatchUpdate:
+		return todo.ID, m.updateTodo(ctx, q, todo, op.Fields...)
+	case models.BatchDelete:
+		return todo.ID, m.deleteTodo(ctx, q, userID, todo.ID, todo.Version)
+	case models.BatchComplete:
+		return todo.ID, m.completeTodo(ctx, q, userID, todo.ID, todo.Completed)
+	}
+	return 0, fmt.Errorf("unknown operation %q", op.Op)
+}
@@ -0,0 +1,111 @@
+package dbrepo
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+)
+
+// snapshotTodo reads a todo of the user, trashed or not. The transaction holds the write lock
+// of the database already, so the todo cannot change until it ends.
+func (m *sqliteDBRepo) snapshotTodo(ctx context.Context, q dbtx, userID int, id int) (*models.Todo, error) {
+	query := `select ` + sqliteTodoColumns + ` from todo where id = $1 and user_id = $2`
+	return scanSQLiteTodo(q.QueryRowContext(ctx, query, id, userID))
+}
+
+// logOperation returns the operation of the current transaction in the operation log of the
+// user, every undoable change made by the transaction is a part of it. The operation is kept
+// by the transaction, and logged again if the savepoint that logged it was rolled back.
+func (m *sqliteDBRepo) logOperation(ctx context.Context, q dbtx, userID int) (int, error) {
+	var root *todoTx
+	if tx, ok := q.(*todoTx); ok {
+		root = tx.root()
+	}
+	if root != nil && root.operationID != 0 {
+		var exists bool
+		err := q.QueryRowContext(ctx, `select exists(select 1 from todo_operation where id = $1)`, root.operationID).Scan(&exists)
+		if err != nil || exists {
+			return root.operationID, err
+		}
+	}
+
+	var id int
+	err := q.QueryRowContext(ctx, `insert into todo_operation (user_id, created_at) values ($1, $2) returning id`,
+		userID, time.Now().UTC()).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	if root != nil {
+		root.operationID = id
+	}
+	return id, nil
+}
+
+// recordHistory records a change of a todo made in the transaction by the user. before is
+// the todo as it was before the change, nil if it was inserted, the todo after is read back.
+// Undoable changes are added to the operation of the transaction.
+func (m *sqliteDBRepo) recordHistory(ctx context.Context, q dbtx, userID int, id int, action string, before *models.Todo) error {
+	var operationID *int
+	if m.audit.Undoable {
+		opID, err := m.logOperation(ctx, q, userID)
+		if err != nil {
+			return err
+		}
+		operationID = &opID
+	}
+	return m.insertHistory(ctx, q, userID, id, action, before, operationID)
+}
+
+// insertHistory inserts a change of a todo into its history, see recordHistory,
+// queues its event for the webhooks of the user and publishes it once the transaction commits
+func (m *sqliteDBRepo) insertHistory(ctx context.Context, q dbtx, userID int, id int, action string, before *models.Todo, operationID *int) error {
+	after, err := m.snapshotTodo(ctx, q, userID, id)
+	if err != nil {
+		return err
+	}
+
+	var beforeJSON any
+	if before != nil {
+		b, err := json.Marshal(before)
+		if err != nil {
+			return err
+		}
+		beforeJSON = string(b)
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+insert into todo_history (todo_id, actor_id, action, before, after, request_id, transport, operation_id, created_at)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+`
+	_, err = q.ExecContext(ctx, stmt,
+		id,
+		userID,
+		action,
+		beforeJSON,
+		string(afterJSON),
+		m.audit.RequestID,
+		m.audit.Transport,
+		operationID,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	event := todoEvent(before, after)
+	publishEvent(q, userID, event, afterJSON)
+	return m.enqueueWebhooks(ctx, q, userID, event, afterJSON)
+}
+
+// SelectTodoHistory returns the changes of a todo of the user, trashed or not, oldest first
+func (m *sqliteDBRepo) SelectTodoHistory(ctx context.Context, userID int, id int) ([]*models.TodoHistory, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	return selectTodoHistory(ctx, m.db(), userID, id)
+}
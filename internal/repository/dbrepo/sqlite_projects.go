@@ -0,0 +1,271 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+func (m *sqliteDBRepo) SelectProjects(ctx context.Context, userID int) ([]*models.Project, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	query := `
+select id, user_id, name, description, created_at, updated_at
+from project
+where user_id = $1
+order by name, id
+`
+	rows, err := m.db().QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []*models.Project{}
+	for rows.Next() {
+		var project models.Project
+		err := rows.Scan(
+			&project.ID,
+			&project.UserID,
+			&project.Name,
+			&project.Description,
+			&project.CreatedAt,
+			&project.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		projects = append(projects, &project)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+func (m *sqliteDBRepo) SelectProject(ctx context.Context, userID int, id int) (*models.Project, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	var project models.Project
+
+	query := `
+select id, user_id, name, description, created_at, updated_at
+from project
+where id = $1 and user_id = $2
+`
+
+	row := m.db().QueryRowContext(ctx, query, id, userID)
+	err := row.Scan(
+		&project.ID,
+		&project.UserID,
+		&project.Name,
+		&project.Description,
+		&project.CreatedAt,
+		&project.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &project, nil
+}
+
+func (m *sqliteDBRepo) SelectProjectTodos(ctx context.Context, userID int, projectID int) ([]*models.Todo, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	query := `
+select ` + sqliteTodoColumns + `
+from todo
+where project_id = $1 and user_id = $2 and deleted_at is null
+order by deadline, id
+`
+	return m.queryTodos(ctx, query, projectID, userID)
+}
+
+func (m *sqliteDBRepo) InsertProject(ctx context.Context, project models.Project) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	stmt := `
+insert into project (user_id, name, description, created_at, updated_at)
+values ($1, $2, $3, $4, $4) returning id
+`
+	var newID int
+	err := m.db().QueryRowContext(ctx, stmt,
+		project.UserID,
+		project.Name,
+		project.Description,
+		time.Now().UTC(),
+	).Scan(&newID)
+	return newID, err
+}
+
+func (m *sqliteDBRepo) UpdateProject(ctx context.Context, project models.Project) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	stmt := `
+update project set name = $1, description = $2, updated_at = $3
+where id = $4 and user_id = $5
+`
+	result, err := m.db().ExecContext(ctx, stmt,
+		project.Name,
+		project.Description,
+		time.Now().UTC(),
+		project.ID,
+		project.UserID,
+	)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(result)
+}
+
+func (m *sqliteDBRepo) DeleteProject(ctx context.Context, userID int, id int, deletion models.ProjectDeletion) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if deletion.ReassignTo != nil {
+		if *deletion.ReassignTo == id {
+			return errors.New("cannot reassign todos to the deleted project")
+		}
+		if err := checkProject(ctx, tx, userID, deletion.ReassignTo); err != nil {
+			return err
+		}
+	}
+
+	if err = m.moveProjectTodos(ctx, tx, userID, id, deletion); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `delete from project where id = $1 and user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if err = checkRowsAffected(result); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *sqliteDBRepo) InsertUser(ctx context.Context, user models.User) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	stmt := `
+insert into users (email, password_hash, created_at, updated_at)
+values ($1, $2, $3, $3) returning id
+`
+	var newID int
+	err := m.db().QueryRowContext(ctx, stmt,
+		user.Email,
+		user.PasswordHash,
+		time.Now().UTC(),
+	).Scan(&newID)
+	if err != nil {
+		var sqliteErr *sqlite.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+			return newID, repository.ErrDuplicateEmail
+		}
+		return newID, err
+	}
+	return newID, nil
+}
+
+func (m *sqliteDBRepo) SelectUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	var user models.User
+
+	query := `
+select id, email, password_hash, created_at, updated_at
+from users
+where email = $1
+`
+
+	row := m.db().QueryRowContext(ctx, query, email)
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.PasswordHash,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// moveProjectTodos moves the todos of the deleted project to the project they are reassigned
+// to, or out of any project. With DeleteTodos the live ones go to the trash together with their
+// subtasks, like in DeleteTodo. Every todo is recorded in its history.
+func (m *sqliteDBRepo) moveProjectTodos(ctx context.Context, q dbtx, userID int, id int, deletion models.ProjectDeletion) error {
+	rows, err := q.QueryContext(ctx, `select id from todo where project_id = $1 and user_id = $2 order by id`, id, userID)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var todoID int
+		if err := rows.Scan(&todoID); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, todoID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, todoID := range ids {
+		before, err := m.snapshotTodo(ctx, q, userID, todoID)
+		if err != nil {
+			return err
+		}
+		_, err = q.ExecContext(ctx, `update todo set project_id = $1, version = version + 1, updated_at = $2 where id = $3`,
+			deletion.ReassignTo, now, todoID)
+		if err != nil {
+			return err
+		}
+
+		// a todo trashed before, or with the subtree of an earlier one, only leaves the project
+		action := models.ActionUpdate
+		if deletion.DeleteTodos && before.DeletedAt == nil {
+			if err = m.trashSubtree(ctx, q, todoID, now); err != nil {
+				return err
+			}
+			action = models.ActionDelete
+		}
+		if err = m.recordHistory(ctx, q, userID, todoID, action, before); err != nil {
+			return err
+		}
+		if action == models.ActionDelete {
+			if err = m.rollUpCompleted(ctx, q, before.ParentID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package dbrepo
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+)
+
+// SearchTodos finds the todos whose name or description contain the terms of the query, best matches
+// first. SQLite has no text search built in, so the todos of the user are ranked like the memory repo
+// ranks them: the query uses the web search syntax, but the terms are matched as they are written.
+func (m *sqliteDBRepo) SearchTodos(ctx context.Context, userID int, query string, limit int) ([]*models.SearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	q := parseSearchQuery(query)
+	stmt := `
+select ` + sqliteTodoColumns + `
+from todo
+where user_id = $1 and deleted_at is null
+order by deadline, id
+`
+	todos, err := m.queryTodos(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*models.SearchResult{}
+	for _, todo := range todos {
+		if rank := q.rank(todo); rank > 0 {
+			results = append(results, &models.SearchResult{Todo: todo, Rank: rank, Snippet: q.snippet(todo)})
+		}
+	}
+	// the todos are sorted by deadline already, which breaks the ties
+	slices.SortStableFunc(results, func(a, b *models.SearchResult) int { return cmp.Compare(b.Rank, a.Rank) })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
@@ -0,0 +1,116 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+)
+
+// addTags attaches the tags to the todo, creating the tags the user does not have yet
+func (m *sqliteDBRepo) addTags(ctx context.Context, q dbtx, userID int, todoID int, tags []string) error {
+	tags = models.NormalizeTags(tags)
+	if len(tags) == 0 {
+		return nil
+	}
+	names, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+
+	// without a where SQLite would read the on conflict as a part of the select
+	stmt := `
+insert into tag (user_id, name, created_at, updated_at)
+select $1, value, $3, $3 from json_each($2) where true
+on conflict (user_id, name) do nothing
+`
+	_, err = q.ExecContext(ctx, stmt, userID, string(names), time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	stmt = `
+insert into todo_tag (todo_id, tag_id)
+select $1, id from tag where user_id = $2 and name in (select value from json_each($3))
+on conflict do nothing
+`
+	_, err = q.ExecContext(ctx, stmt, todoID, userID, string(names))
+	return err
+}
+
+// AddTodoTags attaches the tags to the todo, keeping the tags it already has
+func (m *sqliteDBRepo) AddTodoTags(ctx context.Context, userID int, id int, tags []string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.snapshotTodo(ctx, tx, userID, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	// the tags are part of the todo, so changing them is a new version of it
+	_, err = tx.ExecContext(ctx, `update todo set version = version + 1, updated_at = $1 where id = $2`, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	if err = m.addTags(ctx, tx, userID, id, tags); err != nil {
+		return err
+	}
+	if err = m.recordHistory(ctx, tx, userID, id, models.ActionUpdate, before); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveTodoTag detaches the tag from the todo, the tag itself is kept
+func (m *sqliteDBRepo) RemoveTodoTag(ctx context.Context, userID int, id int, tag string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.snapshotTodo(ctx, tx, userID, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	stmt := `
+delete from todo_tag
+where todo_id = $1 and tag_id in (select id from tag where user_id = $2 and name = $3)
+`
+	result, err := tx.ExecContext(ctx, stmt, id, userID, tag)
+	if err != nil {
+		return err
+	}
+	if err = checkRowsAffected(result); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update todo set version = version + 1, updated_at = $1 where id = $2`, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if err = m.recordHistory(ctx, tx, userID, id, models.ActionUpdate, before); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,566 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/driver"
+	"github.com/anras5/todo-app-backend/internal/events"
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+)
+
+// newTestSQLiteRepo returns a repo on a new database in a temporary file, with the users 1 and 2
+func newTestSQLiteRepo(t *testing.T, bus *events.Bus) repository.DatabaseRepo {
+	t.Helper()
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "todos.db"), driver.DefaultPool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	repo := NewSQLiteRepo(db, bus, 0)
+	for _, email := range []string{"one@example.com", "two@example.com"} {
+		if _, err = repo.InsertUser(context.Background(), models.User{Email: email, PasswordHash: "hash"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repo
+}
+
+func TestSQLiteRepo_SelectTodos(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQLiteRepo(t, nil)
+	ids := insertTestTodos(t, repo, "c", "b", "a")
+	if err := repo.UpdateTodoCompleted(ctx, 1, ids[1], true); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.AddTodoTags(ctx, 1, ids[0], []string{"home", "shop"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.InsertTodo(ctx, models.Todo{UserID: 2, Name: "other", Tags: []string{"home"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	todos, err := repo.SelectTodos(ctx, 1, models.TodoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := todoNames(todos); !slices.Equal(names, []string{"a", "b", "c"}) {
+		t.Errorf("ordered by deadline: got %v, wanted [a b c]", names)
+	}
+	if tags := todos[2].Tags; !slices.Equal(tags, []string{"home", "shop"}) {
+		t.Errorf("tags: got %v, wanted [home shop]", tags)
+	}
+
+	completed := false
+	todos, err = repo.SelectTodos(ctx, 1, models.TodoFilter{Completed: &completed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := todoNames(todos); !slices.Equal(names, []string{"a", "c"}) {
+		t.Errorf("not completed: got %v, wanted [a c]", names)
+	}
+
+	todos, err = repo.SelectTodos(ctx, 1, models.TodoFilter{Tags: []string{"home", "work"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := todoNames(todos); !slices.Equal(names, []string{"c"}) {
+		t.Errorf("tagged: got %v, wanted [c]", names)
+	}
+
+	after := testDeadline.AddDate(0, 0, 2)
+	todos, err = repo.SelectTodos(ctx, 1, models.TodoFilter{DeadlineAfter: &after})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := todoNames(todos); !slices.Equal(names, []string{"b", "c"}) {
+		t.Errorf("deadline after: got %v, wanted [b c]", names)
+	}
+
+	if _, err = repo.SelectTodo(ctx, 2, ids[0]); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("todo of another user: got %v, wanted %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestSQLiteRepo_SelectTodosPage(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQLiteRepo(t, nil)
+	insertTestTodos(t, repo, "e", "d", "c", "b", "a")
+	filter := models.TodoFilter{Sort: []models.SortField{{Field: "updated_at", Desc: true}}}
+
+	var names []string
+	var after *models.TodoCursor
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("too many pages")
+		}
+		page, err := repo.SelectTodosPage(ctx, 1, 2, after, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, todoNames(page.Todos)...)
+		if !page.HasMore {
+			break
+		}
+		if after, err = models.DecodeTodoCursor(page.NextCursor); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(names, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("got %v, wanted [a b c d e]", names)
+	}
+}
+
+func TestSQLiteRepo_Subtasks(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQLiteRepo(t, nil)
+	ids := insertTestTodos(t, repo, "parent")
+	parentID := ids[0]
+	for _, name := range []string{"first", "second"} {
+		if _, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: name, ParentID: &parentID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	children, err := repo.SelectTodoChildren(ctx, 1, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.UpdateTodoCompleted(ctx, 1, children[0].ID, true); err != nil {
+		t.Fatal(err)
+	}
+	parent, err := repo.SelectTodo(ctx, 1, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent.Completed || parent.Progress != 50 {
+		t.Errorf("one of two subtasks completed: got completed %v and progress %d, wanted false and 50", parent.Completed, parent.Progress)
+	}
+
+	if err = repo.DeleteTodo(ctx, 1, children[1].ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	parent, err = repo.SelectTodo(ctx, 1, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parent.Completed || parent.Progress != 100 {
+		t.Errorf("the other subtask trashed: got completed %v and progress %d, wanted true and 100", parent.Completed, parent.Progress)
+	}
+
+	child := *children[0]
+	child.ParentID = &child.ID
+	if err = repo.UpdateTodo(ctx, child); !errors.Is(err, repository.ErrTodoCycle) {
+		t.Errorf("own parent: got %v, wanted %v", err, repository.ErrTodoCycle)
+	}
+}
+
+func TestSQLiteRepo_DeleteLastIncompleteSubtask(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQLiteRepo(t, nil)
+	ids := insertTestTodos(t, repo, "parent")
+	parentID := ids[0]
+	childID, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: "child", ParentID: &parentID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := repo.SelectTodo(ctx, 1, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = repo.DeleteTodo(ctx, 1, childID, 0); err != nil {
+		t.Fatal(err)
+	}
+	parent, err := repo.SelectTodo(ctx, 1, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent.Completed || parent.Version != before.Version {
+		t.Errorf("last subtask trashed: got completed %v and version %d, wanted false and %d", parent.Completed, parent.Version, before.Version)
+	}
+
+	if err = repo.UpdateTodoCompleted(ctx, 1, parentID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.RestoreTodo(ctx, 1, childID); err != nil {
+		t.Fatal(err)
+	}
+	history, err := repo.SelectTodoHistory(ctx, 1, parentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := history[len(history)-1]; last.Action != models.ActionIncomplete {
+		t.Errorf("incomplete subtask restored: got %s as the last change of the parent, wanted %s", last.Action, models.ActionIncomplete)
+	}
+}
+
+func TestSQLiteRepo_UpdateTodoRecurring(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQLiteRepo(t, nil)
+	id, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: "milk", Deadline: testDeadline, RRule: "FREQ=DAILY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo, err := repo.SelectTodo(ctx, 1, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// completing the todo with PUT, twice
+	todo.Completed = true
+	for i := 0; i < 2; i++ {
+		if err = repo.UpdateTodo(ctx, *todo); err != nil {
+			t.Fatal(err)
+		}
+		todo.RRule = ""
+		todo.Version = 0
+	}
+
+	todos, err := repo.SelectTodos(ctx, 1, models.TodoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 2 {
+		t.Fatalf("got %d todos, wanted the todo and its next occurrence", len(todos))
+	}
+	for _, got := range todos {
+		if got.ID == id {
+			if !got.Completed || got.RRule != "" {
+				t.Errorf("completed todo: got completed %v and rule %q, wanted true and no rule", got.Completed, got.RRule)
+			}
+			continue
+		}
+		if got.Completed || got.RRule != "FREQ=DAILY" || !got.Deadline.Equal(testDeadline.AddDate(0, 0, 1)) {
+			t.Errorf("next occurrence: got completed %v, rule %q and deadline %v, wanted false, \"FREQ=DAILY\" and %v",
+				got.Completed, got.RRule, got.Deadline, testDeadline.AddDate(0, 0, 1))
+		}
+	}
+}
+
+func TestSQLiteRepo_Trash(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQLiteRepo(t, nil)
+	ids := insertTestTodos(t, repo, "milk")
+	if _, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: "bread", ParentID: &ids[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.DeleteTodo(ctx, 1, ids[0], 0); err != nil {
+		t.Fatal(err)
+	}
+	trash, err := repo.SelectTrash(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 2 {
+		t.Errorf("trashed a todo with a subtask: got %d todos in the trash, wanted 2", len(trash))
+	}
+
+	if err = repo.RestoreTodo(ctx, 1, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	todos, err := repo.SelectTodos(ctx, 1, models.TodoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 2 {
+		t.Errorf("restored a todo with a subtask: got %d todos, wanted 2", len(todos))
+	}
+
+	if err = repo.DeleteTodo(ctx, 1, ids[0], 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.PurgeTrash(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if trash, err = repo.SelectTrash(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 0 {
+		t.Errorf("purged the trash: got %d todos left in it, wanted 0", len(trash))
+	}
+	if _, err = repo.SelectTodoHistory(ctx, 1, ids[0]); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("history of a purged todo: got %v, wanted %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestSQLiteRepo_DeleteProjectTrashesTodos(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQLiteRepo(t, nil)
+	projectID, err := repo.InsertProject(ctx, models.Project{UserID: 1, Name: "groceries"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: "milk", ProjectID: &projectID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = repo.DeleteProject(ctx, 1, projectID, models.ProjectDeletion{DeleteTodos: true}); err != nil {
+		t.Fatal(err)
+	}
+	trash, err := repo.SelectTrash(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].ID != id || trash[0].ProjectID != nil {
+		t.Errorf("trash after deleting the project: got %v, wanted todo %d without a project", todoNames(trash), id)
+	}
+	history, err := repo.SelectTodoHistory(ctx, 1, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := history[len(history)-1]; last.Action != models.ActionDelete {
+		t.Errorf("last change of the todo: got %s, wanted %s", last.Action, models.ActionDelete)
+	}
+
+	if err = repo.RestoreTodo(ctx, 1, id); err != nil {
+		t.Errorf("restoring the todo: got %v", err)
+	}
+}
+
+func TestSQLiteRepo_DeleteProjectReassignsTodos(t *testing.T) {
+	ctx := context.Background()
+	bus := events.NewBus(events.DefaultBufferSize)
+	repo := newTestSQLiteRepo(t, bus)
+	var projectIDs []int
+	for _, name := range []string{"groceries", "shopping"} {
+		projectID, err := repo.InsertProject(ctx, models.Project{UserID: 1, Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		projectIDs = append(projectIDs, projectID)
+	}
+	id, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: "milk", ProjectID: &projectIDs[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, _, _ := bus.Subscribe(1, 0)
+	defer sub.Close()
+
+	deletion := models.ProjectDeletion{ReassignTo: &projectIDs[1]}
+	if err = repo.DeleteProject(ctx, 1, projectIDs[0], deletion); err != nil {
+		t.Fatal(err)
+	}
+	history, err := repo.SelectTodoHistory(ctx, 1, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := history[len(history)-1]; last.Action != models.ActionUpdate {
+		t.Errorf("last change of the todo: got %s, wanted %s", last.Action, models.ActionUpdate)
+	}
+	select {
+	case event := <-sub.C:
+		if event.Type != events.Updated {
+			t.Errorf("got %s event, wanted %s", event.Type, events.Updated)
+		}
+	default:
+		t.Errorf("reassigning the todo published no event")
+	}
+}
+
+func TestSQLiteRepo_WithTx(t *testing.T) {
+	ctx := context.Background()
+	bus := events.NewBus(events.DefaultBufferSize)
+	sub, _, _ := bus.Subscribe(1, 0)
+	defer sub.Close()
+	repo := newTestSQLiteRepo(t, bus)
+
+	failed := errors.New("failed")
+	err := repo.WithTx(ctx, func(repo repository.DatabaseRepo) error {
+		if _, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: "milk"}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("got %v, wanted %v", err, failed)
+	}
+	todos, err := repo.SelectTodos(ctx, 1, models.TodoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 0 {
+		t.Errorf("rolled back transaction kept %d todos", len(todos))
+	}
+	select {
+	case event := <-sub.C:
+		t.Errorf("rolled back transaction published %s", event.Type)
+	default:
+	}
+
+	err = repo.WithTx(ctx, func(repo repository.DatabaseRepo) error {
+		_, err := repo.InsertTodo(ctx, models.Todo{UserID: 1, Name: "bread"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-sub.C:
+		if event.Type != events.Created {
+			t.Errorf("got %s event, wanted %s", event.Type, events.Created)
+		}
+	default:
+		t.Error("committed transaction published no event")
+	}
+}
+
+func TestSQLiteRepo_Undo(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQLiteRepo(t, nil).WithAudit(models.Audit{Undoable: true})
+	ids := insertTestTodos(t, repo, "milk")
+
+	// the changes are one operation, logged again once the savepoint that logged it is rolled back
+	err := repo.WithTx(ctx, func(repo repository.DatabaseRepo) error {
+		failed := errors.New("failed")
+		err := repo.WithTx(ctx, func(repo repository.DatabaseRepo) error {
+			if err := repo.UpdateTodo(ctx, models.Todo{ID: ids[0], UserID: 1, Name: "eggs"}, "name"); err != nil {
+				return err
+			}
+			return failed
+		})
+		if !errors.Is(err, failed) {
+			t.Errorf("got %v, wanted %v", err, failed)
+		}
+		if err = repo.UpdateTodo(ctx, models.Todo{ID: ids[0], UserID: 1, Name: "bread"}, "name"); err != nil {
+			return err
+		}
+		return repo.UpdateTodoCompleted(ctx, 1, ids[0], true)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	undone, err := repo.UndoOperations(ctx, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo, err := repo.SelectTodo(ctx, 1, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if undone != 1 || todo.Name != "milk" || todo.Completed {
+		t.Errorf("undo: got %d operations and %q completed %v, wanted 1 and \"milk\" not completed", undone, todo.Name, todo.Completed)
+	}
+
+	redone, err := repo.RedoOperations(ctx, 1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo, err = repo.SelectTodo(ctx, 1, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redone != 1 || todo.Name != "bread" || !todo.Completed {
+		t.Errorf("redo: got %d operations and %q completed %v, wanted 1 and \"bread\" completed", redone, todo.Name, todo.Completed)
+	}
+}
+
+func TestSQLiteRepo_Webhooks(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQLiteRepo(t, nil)
+	webhookID, err := repo.InsertWebhook(ctx, models.Webhook{
+		UserID: 1,
+		URL:    "https://example.com/hook",
+		Secret: "secret",
+		Events: []string{models.EventTodoCreated},
+		Active: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertTestTodos(t, repo, "milk", "bread")
+	ids := insertTestTodos(t, repo, "eggs")
+	if err = repo.UpdateTodoCompleted(ctx, 1, ids[0], true); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := repo.ClaimWebhookDeliveries(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 3 {
+		t.Fatalf("got %d deliveries, wanted one for each created todo", len(deliveries))
+	}
+	if d := deliveries[0]; d.WebhookID != webhookID || d.URL != "https://example.com/hook" || d.Secret != "secret" {
+		t.Errorf("got delivery to webhook %d at %q, wanted webhook %d with its URL and secret", d.WebhookID, d.URL, webhookID)
+	}
+
+	deliveries, err = repo.ClaimWebhookDeliveries(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 0 {
+		t.Errorf("claimed %d deliveries again during their lease", len(deliveries))
+	}
+
+	webhook, err := repo.SelectWebhook(ctx, 1, webhookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(webhook.Events, []string{models.EventTodoCreated}) {
+		t.Errorf("events: got %v, wanted [%s]", webhook.Events, models.EventTodoCreated)
+	}
+}
+
+func TestSQLiteRepo_InsertUser(t *testing.T) {
+	repo := newTestSQLiteRepo(t, nil)
+	_, err := repo.InsertUser(context.Background(), models.User{Email: "one@example.com", PasswordHash: "hash"})
+	if !errors.Is(err, repository.ErrDuplicateEmail) {
+		t.Errorf("got %v, wanted %v", err, repository.ErrDuplicateEmail)
+	}
+}
+
+func TestSQLiteRepo_InsertTodos(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestSQLiteRepo(t, nil)
+	missing := 100
+	results, err := repo.InsertTodos(ctx, 1, []models.Todo{
+		{Name: "milk", Tags: []string{"shop"}},
+		{Name: "bread", ProjectID: &missing},
+		{Name: "eggs", RRule: "FREQ=DAILY"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || results[2].Err != nil || !errors.Is(results[1].Err, repository.ErrProjectNotFound) {
+		t.Errorf("got %v, %v and %v, wanted only the second one to fail with %v",
+			results[0].Err, results[1].Err, results[2].Err, repository.ErrProjectNotFound)
+	}
+
+	todos, err := repo.SelectTodos(ctx, 1, models.TodoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := todoNames(todos); !slices.Equal(names, []string{"milk", "eggs"}) {
+		t.Errorf("got %v, wanted [milk eggs]", names)
+	}
+}
+
+func TestSQLiteRepo_SearchTodos(t *testing.T) {
+	repo := newTestSQLiteRepo(t, nil)
+	insertTestTodos(t, repo, "buy milk", "milk and bread", "eggs")
+
+	for _, e := range theMemorySearchTests {
+		results, err := repo.SearchTodos(context.Background(), 1, e.query, 10)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		names := []string{}
+		for _, result := range results {
+			names = append(names, result.Todo.Name)
+		}
+		if !slices.Equal(names, e.expected) {
+			t.Errorf("%s: got %v, wanted %v", e.name, names, e.expected)
+		}
+	}
+}
@@ -0,0 +1,468 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/anras5/todo-app-backend/internal/rrule"
+)
+
+func (m *sqliteDBRepo) SelectTodos(ctx context.Context, userID int, filter models.TodoFilter) ([]*models.Todo, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	b := queryBuilder{sqlite: true}
+	b.where("USER_ID = ? AND DELETED_AT IS NULL", userID)
+	if err := b.filter(filter); err != nil {
+		return nil, err
+	}
+
+	query := `
+SELECT ` + sqliteTodoColumns + `
+FROM TODO
+` + b.build(0)
+	return m.queryTodos(ctx, query, b.args...)
+}
+
+func (m *sqliteDBRepo) SelectTodosPage(ctx context.Context, userID int, limit int, after *models.TodoCursor, filter models.TodoFilter) (*models.TodoPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	b := queryBuilder{sqlite: true}
+	b.where("USER_ID = ? AND DELETED_AT IS NULL", userID)
+	if err := b.filter(filter); err != nil {
+		return nil, err
+	}
+	if after != nil {
+		if err := b.after(after); err != nil {
+			return nil, err
+		}
+	}
+
+	// fetch one extra row to find out if there is a next page
+	query := `
+SELECT ` + sqliteTodoColumns + `
+FROM TODO
+` + b.build(limit+1)
+
+	todos, err := m.queryTodos(ctx, query, b.args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.TodoPage{Todos: todos}
+	if len(page.Todos) > limit {
+		page.Todos = page.Todos[:limit]
+		page.HasMore = true
+		page.NextCursor = page.Todos[limit-1].Cursor(filter.Sort)
+	}
+	return page, nil
+}
+
+func (m *sqliteDBRepo) SelectTodo(ctx context.Context, userID int, id int) (*models.Todo, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	query := `
+select ` + sqliteTodoColumns + `
+from todo
+where id = $1 and user_id = $2 and deleted_at is null
+`
+	return scanSQLiteTodo(m.db().QueryRowContext(ctx, query, id, userID))
+}
+
+func (m *sqliteDBRepo) SelectTodoChildren(ctx context.Context, userID int, id int) ([]*models.Todo, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	query := `
+select ` + sqliteTodoColumns + `
+from todo
+where parent_id = $1 and user_id = $2 and deleted_at is null
+order by deadline, id
+`
+	return m.queryTodos(ctx, query, id, userID)
+}
+
+func (m *sqliteDBRepo) InsertTodo(ctx context.Context, todo models.Todo) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	newID, err := m.createTodo(ctx, tx, todo)
+	if err != nil {
+		return 0, err
+	}
+	return newID, tx.Commit()
+}
+
+// createTodo checks and inserts a todo as a part of the transaction, see InsertTodo
+func (m *sqliteDBRepo) createTodo(ctx context.Context, q dbtx, todo models.Todo) (int, error) {
+	rule, err := rrule.Normalize(todo.RRule)
+	if err != nil {
+		return 0, err
+	}
+	todo.RRule = rule
+
+	if err := checkProject(ctx, q, todo.UserID, todo.ProjectID); err != nil {
+		return 0, err
+	}
+	if err := checkParent(ctx, q, todo.UserID, 0, todo.ParentID); err != nil {
+		return 0, err
+	}
+
+	newID, err := m.insertTodo(ctx, q, todo)
+	if err != nil {
+		return 0, err
+	}
+	if err = m.recordHistory(ctx, q, todo.UserID, newID, models.ActionInsert, nil); err != nil {
+		return 0, err
+	}
+
+	if err = m.rollUpCompleted(ctx, q, todo.ParentID); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// insertTodo inserts the todo together with its tags
+func (m *sqliteDBRepo) insertTodo(ctx context.Context, q dbtx, todo models.Todo) (int, error) {
+	stmt := `
+insert into todo (user_id, project_id, parent_id, name, description, deadline, completed, rrule, created_at, updated_at)
+values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9) returning id
+`
+	var newID int
+	err := q.QueryRowContext(ctx, stmt,
+		todo.UserID,
+		todo.ProjectID,
+		todo.ParentID,
+		todo.Name,
+		todo.Description,
+		storedTime(todo.Deadline),
+		todo.Completed,
+		todo.RRule,
+		time.Now().UTC(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = m.addTags(ctx, q, todo.UserID, newID, todo.Tags); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// UpdateTodo updates the given fields of a todo, or all of them if no fields are given.
+// Without fields nil tags leave the tags of the todo unchanged.
+// Completing a recurring todo creates its next occurrence, like UpdateTodoCompleted.
+func (m *sqliteDBRepo) UpdateTodo(ctx context.Context, todo models.Todo, fields ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = m.updateTodo(ctx, tx, todo, fields...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateTodo updates a todo as a part of the transaction, see UpdateTodo
+func (m *sqliteDBRepo) updateTodo(ctx context.Context, q dbtx, todo models.Todo, fields ...string) error {
+	mask, err := models.NewTodoFieldMask(fields...)
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		mask, _ = models.NewTodoFieldMask(models.TodoUpdateFields...)
+		mask["tags"] = todo.Tags != nil
+	}
+
+	if mask["rrule"] {
+		rule, err := rrule.Normalize(todo.RRule)
+		if err != nil {
+			return err
+		}
+		todo.RRule = rule
+	}
+
+	if mask["project_id"] {
+		if err := checkProject(ctx, q, todo.UserID, todo.ProjectID); err != nil {
+			return err
+		}
+	}
+
+	if mask["parent_id"] {
+		if err := checkParent(ctx, q, todo.UserID, todo.ID, todo.ParentID); err != nil {
+			return err
+		}
+	}
+
+	before, err := m.snapshotTodo(ctx, q, todo.UserID, todo.ID)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+	if todo.Version != 0 && todo.Version != before.Version {
+		return repository.ErrVersionConflict
+	}
+	// remember the previous parent, its completion state may change as well
+	oldParentID := before.ParentID
+	if !mask["parent_id"] {
+		todo.ParentID = oldParentID
+	}
+	todo.Deadline = storedTime(todo.Deadline)
+
+	args := []any{time.Now().UTC(), todo.ID, todo.UserID}
+	set := []string{"version = version + 1", "updated_at = $1"}
+	for _, c := range todoUpdateColumns {
+		if mask[c.field] {
+			args = append(args, c.value(&todo))
+			set = append(set, fmt.Sprintf("%s = $%d", c.column, len(args)))
+		}
+	}
+	stmt := `update todo set ` + strings.Join(set, ", ") + ` where id = $2 and user_id = $3`
+	if _, err = q.ExecContext(ctx, stmt, args...); err != nil {
+		return err
+	}
+
+	if mask["tags"] {
+		_, err = q.ExecContext(ctx, `delete from todo_tag where todo_id = $1`, todo.ID)
+		if err != nil {
+			return err
+		}
+		if err = m.addTags(ctx, q, todo.UserID, todo.ID, todo.Tags); err != nil {
+			return err
+		}
+	}
+
+	if mask["completed"] && todo.Completed && !before.Completed {
+		// the next occurrence follows the todo as updated
+		current, err := m.snapshotTodo(ctx, q, todo.UserID, todo.ID)
+		if err != nil {
+			return err
+		}
+		if err = m.scheduleNextOccurrence(ctx, q, current); err != nil {
+			return err
+		}
+	}
+
+	if err = m.recordHistory(ctx, q, todo.UserID, todo.ID, models.ActionUpdate, before); err != nil {
+		return err
+	}
+
+	if mask["completed"] || mask["parent_id"] {
+		if err = m.rollUpCompleted(ctx, q, todo.ParentID); err != nil {
+			return err
+		}
+	}
+	if oldParentID != nil && (todo.ParentID == nil || *oldParentID != *todo.ParentID) {
+		if err = m.rollUpCompleted(ctx, q, oldParentID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateTodoCompleted changes the completion state of a todo and derives the
+// state of its ancestors, a parent is completed when all its subtasks are.
+// Completing a recurring todo creates its next occurrence.
+func (m *sqliteDBRepo) UpdateTodoCompleted(ctx context.Context, userID int, id int, completed bool) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = m.completeTodo(ctx, tx, userID, id, completed); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// completeTodo changes the completion state of a todo as a part of the transaction, see UpdateTodoCompleted
+func (m *sqliteDBRepo) completeTodo(ctx context.Context, q dbtx, userID int, id int, completed bool) error {
+	before, err := m.snapshotTodo(ctx, q, userID, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+
+	stmt := `
+update todo set completed = $1, version = version + 1, updated_at = $2 where id = $3 and user_id = $4
+returning parent_id
+`
+	var parentID *int
+	err = q.QueryRowContext(ctx, stmt, completed, time.Now().UTC(), id, userID).Scan(&parentID)
+	if err != nil {
+		return err
+	}
+
+	if completed && !before.Completed {
+		if err = m.scheduleNextOccurrence(ctx, q, before); err != nil {
+			return err
+		}
+	}
+
+	action := models.ActionIncomplete
+	if completed {
+		action = models.ActionComplete
+	}
+	if err = m.recordHistory(ctx, q, userID, id, action, before); err != nil {
+		return err
+	}
+
+	return m.rollUpCompleted(ctx, q, parentID)
+}
+
+// scheduleNextOccurrence creates the next occurrence of a recurring todo with the deadline
+// advanced by its rule. The rule moves to the new todo, so completing the old todo again
+// does not create another one.
+func (m *sqliteDBRepo) scheduleNextOccurrence(ctx context.Context, q dbtx, todo *models.Todo) error {
+	if todo.RRule == "" {
+		return nil
+	}
+
+	rule, err := rrule.Parse(todo.RRule)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, `update todo set rrule = '', version = version + 1 where id = $1`, todo.ID)
+	if err != nil {
+		return err
+	}
+
+	deadline, rest, ok := rule.Next(todo.Deadline)
+	if !ok {
+		// that was the last occurrence
+		return nil
+	}
+
+	next := *todo
+	next.Deadline = deadline
+	next.Completed = false
+	next.RRule = rest.String()
+	nextID, err := m.insertTodo(ctx, q, next)
+	if err != nil {
+		return err
+	}
+	return m.recordHistory(ctx, q, next.UserID, nextID, models.ActionInsert, nil)
+}
+
+// DeleteTodo moves a todo together with its subtasks to the trash. A version other than 0
+// must match the current version of the todo.
+func (m *sqliteDBRepo) DeleteTodo(ctx context.Context, userID int, id int, version int) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = m.deleteTodo(ctx, tx, userID, id, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteTodo moves a todo to the trash as a part of the transaction, see DeleteTodo
+func (m *sqliteDBRepo) deleteTodo(ctx context.Context, q dbtx, userID int, id int, version int) error {
+	before, err := m.snapshotTodo(ctx, q, userID, id)
+	if err != nil {
+		return err
+	}
+	if before.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+	if version != 0 && version != before.Version {
+		return repository.ErrVersionConflict
+	}
+
+	if err = m.trashSubtree(ctx, q, id, time.Now().UTC()); err != nil {
+		return err
+	}
+	if err = m.recordHistory(ctx, q, userID, id, models.ActionDelete, before); err != nil {
+		return err
+	}
+
+	return m.rollUpCompleted(ctx, q, before.ParentID)
+}
+
+// rollUpCompleted rolls the completion up to the ancestors of the parent, see rollUp,
+// and records every ancestor it completes or reopens in the history
+func (m *sqliteDBRepo) rollUpCompleted(ctx context.Context, q dbtx, parentID *int) error {
+	return m.rollUp(ctx, q, parentID, func(userID int, id int, action string, before *models.Todo) error {
+		return m.recordHistory(ctx, q, userID, id, action, before)
+	})
+}
+
+// rollUp walks up from the parent and marks every ancestor with live subtasks as completed
+// if all of them are, and as not completed otherwise. Ancestors without live subtasks keep
+// their completion. Only an ancestor whose completion flips is changed and passed to record.
+func (m *sqliteDBRepo) rollUp(ctx context.Context, q dbtx, parentID *int, record recordFunc) error {
+	visited := make(map[int]bool)
+	for parentID != nil && !visited[*parentID] {
+		visited[*parentID] = true
+
+		query := `
+select user_id, parent_id, completed,
+exists(select 1 from todo c where c.parent_id = todo.id and c.deleted_at is null),
+not exists(select 1 from todo c where c.parent_id = todo.id and c.deleted_at is null and not c.completed)
+from todo
+where id = $1
+`
+		var userID int
+		var next *int
+		var completed, hasSubtasks, subtasksCompleted bool
+		err := q.QueryRowContext(ctx, query, *parentID).Scan(&userID, &next, &completed, &hasSubtasks, &subtasksCompleted)
+		if err != nil {
+			return err
+		}
+
+		if hasSubtasks && completed != subtasksCompleted {
+			before, err := m.snapshotTodo(ctx, q, userID, *parentID)
+			if err != nil {
+				return err
+			}
+			_, err = q.ExecContext(ctx, `update todo set completed = $1, version = version + 1, updated_at = $2 where id = $3`,
+				subtasksCompleted, time.Now().UTC(), *parentID)
+			if err != nil {
+				return err
+			}
+			action := models.ActionIncomplete
+			if subtasksCompleted {
+				action = models.ActionComplete
+			}
+			if err = record(userID, *parentID, action, before); err != nil {
+				return err
+			}
+		}
+		parentID = next
+	}
+	return nil
+}
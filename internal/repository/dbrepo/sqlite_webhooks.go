@@ -0,0 +1,334 @@
+package dbrepo
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+)
+
+// enqueueWebhooks queues a delivery of the event of every todo for every active webhook of the user subscribed
+// to it, in the order of the todos. The deliveries are a part of the transaction, so they are only sent if it commits.
+func (m *sqliteDBRepo) enqueueWebhooks(ctx context.Context, q dbtx, userID int, event string, todos ...[]byte) error {
+	now := time.Now().UTC()
+	payloads := make([]string, 0, len(todos))
+	for _, todo := range todos {
+		payload, err := json.Marshal(models.WebhookEvent{
+			Event:     event,
+			CreatedAt: now,
+			Todo:      todo,
+		})
+		if err != nil {
+			return err
+		}
+		payloads = append(payloads, string(payload))
+	}
+	encoded, err := json.Marshal(payloads)
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+insert into webhook_delivery (webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+select w.id, $2, p.value, $4, $5, $5, $5
+from webhook w cross join json_each($3) p
+where w.user_id = $1 and w.active and $2 in (select value from json_each(w.events))
+order by p.key, w.id
+`
+	_, err = q.ExecContext(ctx, stmt, userID, event, string(encoded), models.DeliveryPending, now)
+	return err
+}
+
+// scanSQLiteWebhook scans a row selected with webhookColumns, the events are a JSON array
+func scanSQLiteWebhook(row rowScanner) (*models.Webhook, error) {
+	var webhook models.Webhook
+	var events string
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.UserID,
+		&webhook.URL,
+		&webhook.Secret,
+		&events,
+		&webhook.Active,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(events), &webhook.Events); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// sqliteEvents encodes the events of a webhook for the events column
+func sqliteEvents(events []string) (string, error) {
+	if events == nil {
+		events = []string{}
+	}
+	encoded, err := json.Marshal(events)
+	return string(encoded), err
+}
+
+func (m *sqliteDBRepo) SelectWebhooks(ctx context.Context, userID int) ([]*models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	query := `select ` + webhookColumns + ` from webhook where user_id = $1 order by id`
+	rows, err := m.db().QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*models.Webhook{}
+	for rows.Next() {
+		webhook, err := scanSQLiteWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (m *sqliteDBRepo) SelectWebhook(ctx context.Context, userID int, id int) (*models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	query := `select ` + webhookColumns + ` from webhook where id = $1 and user_id = $2`
+	return scanSQLiteWebhook(m.db().QueryRowContext(ctx, query, id, userID))
+}
+
+func (m *sqliteDBRepo) InsertWebhook(ctx context.Context, webhook models.Webhook) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	events, err := sqliteEvents(webhook.Events)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `
+insert into webhook (user_id, url, secret, events, active, created_at, updated_at)
+values ($1, $2, $3, $4, $5, $6, $6) returning id
+`
+	var newID int
+	err = m.db().QueryRowContext(ctx, stmt,
+		webhook.UserID,
+		webhook.URL,
+		webhook.Secret,
+		events,
+		webhook.Active,
+		time.Now().UTC(),
+	).Scan(&newID)
+	return newID, err
+}
+
+// UpdateWebhook updates the URL, events and state of a webhook, and its secret unless it is empty
+func (m *sqliteDBRepo) UpdateWebhook(ctx context.Context, webhook models.Webhook) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	events, err := sqliteEvents(webhook.Events)
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+update webhook set url = $1, events = $2, active = $3, secret = case when $4 = '' then secret else $4 end, updated_at = $5
+where id = $6 and user_id = $7
+`
+	result, err := m.db().ExecContext(ctx, stmt,
+		webhook.URL,
+		events,
+		webhook.Active,
+		webhook.Secret,
+		time.Now().UTC(),
+		webhook.ID,
+		webhook.UserID,
+	)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(result)
+}
+
+// DeleteWebhook deletes a webhook together with its deliveries
+func (m *sqliteDBRepo) DeleteWebhook(ctx context.Context, userID int, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	result, err := m.db().ExecContext(ctx, `delete from webhook where id = $1 and user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(result)
+}
+
+// queryDeliveries runs a query selecting deliveryColumns, followed by the url and secret of the
+// webhook if withWebhook is set, and scans all the returned rows
+func (m *sqliteDBRepo) queryDeliveries(ctx context.Context, q dbtx, withWebhook bool, query string, args ...any) ([]*models.WebhookDelivery, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*models.WebhookDelivery{}
+	for rows.Next() {
+		var extra []any
+		var url, secret string
+		if withWebhook {
+			extra = []any{&url, &secret}
+		}
+		delivery, err := scanDelivery(rows, extra...)
+		if err != nil {
+			return nil, err
+		}
+		delivery.URL = url
+		delivery.Secret = secret
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// SelectWebhookDeliveries returns the last 100 deliveries of a webhook of the user, newest first
+func (m *sqliteDBRepo) SelectWebhookDeliveries(ctx context.Context, userID int, webhookID int) ([]*models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	// make sure the webhook exists, so that an unknown webhook is not reported as one without deliveries
+	if _, err := m.SelectWebhook(ctx, userID, webhookID); err != nil {
+		return nil, err
+	}
+
+	query := `select ` + deliveryColumns + ` from webhook_delivery d where d.webhook_id = $1 order by d.id desc limit 100`
+	return m.queryDeliveries(ctx, m.db(), false, query, webhookID)
+}
+
+func (m *sqliteDBRepo) InsertWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	stmt := `
+insert into webhook_delivery (webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+values ($1, $2, $3, $4, $5, $6, $6) returning id
+`
+	var newID int
+	err := m.db().QueryRowContext(ctx, stmt,
+		delivery.WebhookID,
+		delivery.Event,
+		string(delivery.Payload),
+		delivery.Status,
+		utcTime(delivery.NextAttemptAt),
+		time.Now().UTC(),
+	).Scan(&newID)
+	return newID, err
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries of active webhooks due for an attempt,
+// together with the URL and secret of their webhooks. They are not claimed again for the lease,
+// so that several dispatchers do not send the same delivery. The claimed deliveries are read back
+// in the same transaction, RETURNING cannot join them with their webhooks.
+func (m *sqliteDBRepo) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	tx, err := m.beginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	stmt := `
+update webhook_delivery set next_attempt_at = $1, updated_at = $2
+where id in (
+	select pd.id from webhook_delivery pd join webhook pw on pw.id = pd.webhook_id
+	where pd.status = $3 and pd.next_attempt_at <= $2 and pw.active
+	order by pd.next_attempt_at, pd.id
+	limit $4
+)
+returning id
+`
+	rows, err := tx.QueryContext(ctx, stmt, now.Add(lease), now, models.DeliveryPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, tx.Commit()
+	}
+
+	encoded, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+select ` + deliveryColumns + `, w.url, w.secret
+from webhook_delivery d join webhook w on w.id = d.webhook_id
+where d.id in (select value from json_each($1))
+order by d.id
+`
+	deliveries, err := m.queryDeliveries(ctx, tx, true, query, string(encoded))
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, tx.Commit()
+}
+
+// UpdateWebhookDelivery records the outcome of an attempt to send a delivery
+func (m *sqliteDBRepo) UpdateWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	stmt := `
+update webhook_delivery set status = $1, attempts = $2, response_status = $3, error = $4, next_attempt_at = $5, updated_at = $6
+where id = $7
+`
+	result, err := m.db().ExecContext(ctx, stmt,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.ResponseStatus,
+		delivery.Error,
+		utcTime(delivery.NextAttemptAt),
+		time.Now().UTC(),
+		delivery.ID,
+	)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(result)
+}
+
+// utcTime returns the time in UTC, nil stays nil
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
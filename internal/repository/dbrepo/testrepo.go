@@ -1,51 +1,339 @@
 package dbrepo
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/auth"
 	"github.com/anras5/todo-app-backend/internal/models"
+	"github.com/anras5/todo-app-backend/internal/repository"
+	"github.com/anras5/todo-app-backend/internal/rrule"
 )
 
-func (m *testDBRepo) SelectTodos(completed ...bool) ([]*models.Todo, error) {
+func (m *testDBRepo) SelectTodos(ctx context.Context, userID int, filter models.TodoFilter) ([]*models.Todo, error) {
 	// if completed is false, then fail
-	if len(completed) > 0 && !completed[0] {
+	if filter.Completed != nil && !*filter.Completed {
 		return nil, errors.New("error")
 	}
 	return nil, nil
 }
 
-func (m *testDBRepo) SelectTodo(id int) (*models.Todo, error) {
+func (m *testDBRepo) SelectTodosPage(ctx context.Context, userID int, limit int, after *models.TodoCursor, filter models.TodoFilter) (*models.TodoPage, error) {
+	// if completed is false, then fail
+	if filter.Completed != nil && !*filter.Completed {
+		return nil, errors.New("error")
+	}
+	return &models.TodoPage{Todos: []*models.Todo{}}, nil
+}
+
+func (m *testDBRepo) SelectTodo(ctx context.Context, userID int, id int) (*models.Todo, error) {
 	// if id is 2, then fail
 	if id == 2 {
 		return nil, errors.New("error")
 	}
-	return nil, nil
+	return &models.Todo{ID: id, UserID: userID, Version: 1}, nil
+}
+
+func (m *testDBRepo) SearchTodos(ctx context.Context, userID int, query string, limit int) ([]*models.SearchResult, error) {
+	return []*models.SearchResult{}, nil
 }
 
-func (m *testDBRepo) InsertTodo(todo models.Todo) (int, error) {
+func (m *testDBRepo) SelectTodoChildren(ctx context.Context, userID int, id int) ([]*models.Todo, error) {
+	// if id is 2, then fail
+	if id == 2 {
+		return nil, errors.New("error")
+	}
+	return []*models.Todo{}, nil
+}
+
+func (m *testDBRepo) InsertTodo(ctx context.Context, todo models.Todo) (int, error) {
 	// if the todos name is empty - fail
 	if todo.Name == "" {
 		return 2, errors.New("error")
 	}
+	if todo.ParentID != nil && *todo.ParentID == 2 {
+		return 0, repository.ErrParentNotFound
+	}
+	if _, err := rrule.Normalize(todo.RRule); err != nil {
+		return 0, err
+	}
 	return 1, nil
 }
 
-func (m *testDBRepo) UpdateTodo(todo models.Todo) error {
+func (m *testDBRepo) InsertTodos(ctx context.Context, userID int, todos []models.Todo) ([]models.TodoInsertResult, error) {
+	// every todo fails or succeeds like it does with InsertTodo, ids count up from 1
+	results := make([]models.TodoInsertResult, len(todos))
+	for i, todo := range todos {
+		if _, err := m.InsertTodo(ctx, todo); err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].ID = i + 1
+	}
+	return results, nil
+}
+
+func (m *testDBRepo) UpdateTodo(ctx context.Context, todo models.Todo, fields ...string) error {
 	if todo.ID == 2 {
 		return errors.New("error")
 	}
+	if _, err := models.NewTodoFieldMask(fields...); err != nil {
+		return err
+	}
+	if todo.ParentID != nil && *todo.ParentID == todo.ID {
+		return repository.ErrTodoCycle
+	}
+	if _, err := rrule.Normalize(todo.RRule); err != nil {
+		return err
+	}
+	// every todo is at version 1
+	if todo.Version > 1 {
+		return repository.ErrVersionConflict
+	}
 	return nil
 }
 
-func (m *testDBRepo) UpdateTodoCompleted(id int, completed bool) error {
+func (m *testDBRepo) UpdateTodoCompleted(ctx context.Context, userID int, id int, completed bool) error {
 	if id == 2 {
 		return errors.New("error")
 	}
 	return nil
 }
 
-func (m *testDBRepo) DeleteTodo(id int) error {
+func (m *testDBRepo) DeleteTodo(ctx context.Context, userID int, id int, version int) error {
 	if id == 2 {
 		return errors.New("error")
 	}
+	// every todo is at version 1
+	if version > 1 {
+		return repository.ErrVersionConflict
+	}
+	return nil
+}
+
+func (m *testDBRepo) ApplyTodoBatch(ctx context.Context, userID int, ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	// every operation fails or succeeds like the method writing a single todo does
+	results := make([]models.BatchResult, len(ops))
+	for i, op := range ops {
+		todo := op.Todo
+		todo.UserID = userID
+
+		var err error
+		id := todo.ID
+		switch op.Op {
+		case models.BatchCreate:
+			id, err = m.InsertTodo(ctx, todo)
+		case models.BatchUpdate:
+			err = m.UpdateTodo(ctx, todo, op.Fields...)
+		case models.BatchDelete:
+			err = m.DeleteTodo(ctx, userID, todo.ID, todo.Version)
+		case models.BatchComplete:
+			err = m.UpdateTodoCompleted(ctx, userID, todo.ID, todo.Completed)
+		default:
+			err = errors.New("unknown operation")
+		}
+		if err != nil {
+			results[i].Err = err
+			if atomic {
+				abortBatch(results, i)
+				return results, nil
+			}
+			continue
+		}
+		results[i].ID = id
+	}
+	return results, nil
+}
+
+func (m *testDBRepo) AddTodoTags(ctx context.Context, userID int, id int, tags []string) error {
+	if id == 2 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *testDBRepo) RemoveTodoTag(ctx context.Context, userID int, id int, tag string) error {
+	if id == 2 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *testDBRepo) SelectTrash(ctx context.Context, userID int) ([]*models.Todo, error) {
+	return []*models.Todo{}, nil
+}
+
+func (m *testDBRepo) RestoreTodo(ctx context.Context, userID int, id int) error {
+	// if id is 2, then the todo is not in the trash, if id is 3, then its parent is
+	switch id {
+	case 2:
+		return sql.ErrNoRows
+	case 3:
+		return repository.ErrParentNotFound
+	}
+	return nil
+}
+
+func (m *testDBRepo) PurgeTodo(ctx context.Context, userID int, id int) error {
+	// if id is 2, then the todo is not in the trash
+	if id == 2 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *testDBRepo) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	return 0, nil
+}
+
+func (m *testDBRepo) SelectTodoHistory(ctx context.Context, userID int, id int) ([]*models.TodoHistory, error) {
+	// if id is 2, then the todo does not exist
+	if id == 2 {
+		return nil, sql.ErrNoRows
+	}
+	return []*models.TodoHistory{}, nil
+}
+
+func (m *testDBRepo) WithAudit(audit models.Audit) repository.DatabaseRepo {
+	return m
+}
+
+func (m *testDBRepo) WithTx(ctx context.Context, fn func(repo repository.DatabaseRepo) error) error {
+	return fn(m)
+}
+
+func (m *testDBRepo) WithIsolation(level sql.IsolationLevel) repository.DatabaseRepo {
+	return m
+}
+
+func (m *testDBRepo) UndoOperations(ctx context.Context, userID int, count int) (int, error) {
+	// if count is 2, then a todo was changed since
+	if count == 2 {
+		return 0, repository.ErrUndoConflict
+	}
+	return count, nil
+}
+
+func (m *testDBRepo) RedoOperations(ctx context.Context, userID int, count int) (int, error) {
+	// if count is 2, then there is nothing to redo
+	if count == 2 {
+		return 0, nil
+	}
+	return count, nil
+}
+
+func (m *testDBRepo) SelectWebhooks(ctx context.Context, userID int) ([]*models.Webhook, error) {
+	return []*models.Webhook{}, nil
+}
+
+func (m *testDBRepo) SelectWebhook(ctx context.Context, userID int, id int) (*models.Webhook, error) {
+	// if id is 2, then the webhook does not exist
+	if id == 2 {
+		return nil, sql.ErrNoRows
+	}
+	// without a URL deliveries fail right away
+	return &models.Webhook{ID: id, UserID: userID, Secret: "secret", Events: models.WebhookEvents, Active: true}, nil
+}
+
+func (m *testDBRepo) InsertWebhook(ctx context.Context, webhook models.Webhook) (int, error) {
+	return 1, nil
+}
+
+func (m *testDBRepo) UpdateWebhook(ctx context.Context, webhook models.Webhook) error {
+	if webhook.ID == 2 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *testDBRepo) DeleteWebhook(ctx context.Context, userID int, id int) error {
+	if id == 2 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *testDBRepo) SelectWebhookDeliveries(ctx context.Context, userID int, webhookID int) ([]*models.WebhookDelivery, error) {
+	if webhookID == 2 {
+		return nil, sql.ErrNoRows
+	}
+	return []*models.WebhookDelivery{}, nil
+}
+
+func (m *testDBRepo) InsertWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	return 1, nil
+}
+
+func (m *testDBRepo) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (m *testDBRepo) UpdateWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	return nil
+}
+
+func (m *testDBRepo) InsertUser(ctx context.Context, user models.User) (int, error) {
+	// if the email is taken - fail
+	if user.Email == "taken@example.com" {
+		return 0, repository.ErrDuplicateEmail
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) SelectUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	// only one user exists, with the password "password"
+	if email != "user@example.com" {
+		return nil, sql.ErrNoRows
+	}
+	hash, err := auth.HashPassword("password")
+	if err != nil {
+		return nil, err
+	}
+	return &models.User{ID: 1, Email: email, PasswordHash: hash}, nil
+}
+
+func (m *testDBRepo) SelectProjects(ctx context.Context, userID int) ([]*models.Project, error) {
+	return []*models.Project{}, nil
+}
+
+func (m *testDBRepo) SelectProject(ctx context.Context, userID int, id int) (*models.Project, error) {
+	// if id is 2, then fail
+	if id == 2 {
+		return nil, sql.ErrNoRows
+	}
+	return &models.Project{ID: id, UserID: userID}, nil
+}
+
+func (m *testDBRepo) SelectProjectTodos(ctx context.Context, userID int, projectID int) ([]*models.Todo, error) {
+	if projectID == 2 {
+		return nil, errors.New("error")
+	}
+	return []*models.Todo{}, nil
+}
+
+func (m *testDBRepo) InsertProject(ctx context.Context, project models.Project) (int, error) {
+	// if the projects name is empty - fail
+	if project.Name == "" {
+		return 0, errors.New("error")
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) UpdateProject(ctx context.Context, project models.Project) error {
+	if project.ID == 2 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (m *testDBRepo) DeleteProject(ctx context.Context, userID int, id int, deletion models.ProjectDeletion) error {
+	if id == 2 {
+		return sql.ErrNoRows
+	}
+	if deletion.ReassignTo != nil && *deletion.ReassignTo == 2 {
+		return repository.ErrProjectNotFound
+	}
 	return nil
 }
@@ -1,12 +1,111 @@
 package repository
 
-import "github.com/anras5/todo-app-backend/internal/models"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+)
+
+// ErrDuplicateEmail is returned when a user with the given email already exists
+var ErrDuplicateEmail = errors.New("user with this email already exists")
+
+// ErrProjectNotFound is returned when a todo refers to a project the user does not own
+var ErrProjectNotFound = errors.New("project not found")
+
+// ErrParentNotFound is returned when a todo refers to a parent todo the user does not own
+var ErrParentNotFound = errors.New("parent todo not found")
+
+// ErrTodoCycle is returned when a todo would become its own ancestor
+var ErrTodoCycle = errors.New("todo cannot be a subtask of itself or of its subtasks")
+
+// ErrVersionConflict is returned when a todo is written with a version other than its current one
+var ErrVersionConflict = errors.New("todo was changed by someone else, reload it and try again")
+
+// ErrUndoConflict is returned when an operation is undone or redone after one of its todos was changed outside of it
+var ErrUndoConflict = errors.New("todo was changed by someone else since, the operation cannot be undone or redone")
+
+// ErrBatchAborted is returned for the operations of an atomic batch rolled back because another one failed
+var ErrBatchAborted = errors.New("rolled back because another operation of the batch failed")
+
+// DefaultQueryTimeout is how long a repo method may take when no other timeout is configured,
+// the context it is given may end it sooner
+const DefaultQueryTimeout = 3 * time.Second
+
+// DefaultPageSize is used when a client asks for a page without a limit
+const DefaultPageSize = 20
+
+// MaxPageSize is the largest page a client can ask for
+const MaxPageSize = 100
+
+// MaxUndoCount is the most operations a client can undo or redo at once
+const MaxUndoCount = 100
+
+// MaxInsertBatch is the most todos InsertTodos inserts at once
+const MaxInsertBatch = 1000
+
+// MaxBatchOperations is the most operations ApplyTodoBatch applies at once
+const MaxBatchOperations = 100
 
 type DatabaseRepo interface {
-	SelectTodos(completed ...bool) ([]*models.Todo, error)
-	SelectTodo(id int) (*models.Todo, error)
-	InsertTodo(todo models.Todo) (int, error)
-	UpdateTodo(todo models.Todo) error
-	UpdateTodoCompleted(id int, completed bool) error
-	DeleteTodo(id int) error
+	SelectTodos(ctx context.Context, userID int, filter models.TodoFilter) ([]*models.Todo, error)
+	SelectTodosPage(ctx context.Context, userID int, limit int, after *models.TodoCursor, filter models.TodoFilter) (*models.TodoPage, error)
+	SelectTodo(ctx context.Context, userID int, id int) (*models.Todo, error)
+	SearchTodos(ctx context.Context, userID int, query string, limit int) ([]*models.SearchResult, error)
+	SelectTodoChildren(ctx context.Context, userID int, id int) ([]*models.Todo, error)
+	InsertTodo(ctx context.Context, todo models.Todo) (int, error)
+	// InsertTodos inserts todos of the user in a single transaction and returns the outcome of each of
+	// them, a todo failing the checks of InsertTodo does not stop the others. The error is only set if
+	// the transaction failed, then none of the todos is inserted.
+	InsertTodos(ctx context.Context, userID int, todos []models.Todo) ([]models.TodoInsertResult, error)
+	UpdateTodo(ctx context.Context, todo models.Todo, fields ...string) error
+	UpdateTodoCompleted(ctx context.Context, userID int, id int, completed bool) error
+	DeleteTodo(ctx context.Context, userID int, id int, version int) error
+	// ApplyTodoBatch applies the operations to the todos of the user in order in a single transaction
+	// and returns the outcome of each of them. An atomic batch is rolled back as a whole once an operation
+	// fails, the operations it did not keep fail with ErrBatchAborted. Otherwise only the failing operations
+	// are rolled back. The error is only set if the transaction failed, then none of the operations is kept.
+	ApplyTodoBatch(ctx context.Context, userID int, ops []models.BatchOperation, atomic bool) ([]models.BatchResult, error)
+	AddTodoTags(ctx context.Context, userID int, id int, tags []string) error
+	RemoveTodoTag(ctx context.Context, userID int, id int, tag string) error
+
+	SelectTrash(ctx context.Context, userID int) ([]*models.Todo, error)
+	RestoreTodo(ctx context.Context, userID int, id int) error
+	PurgeTodo(ctx context.Context, userID int, id int) error
+	PurgeTrash(ctx context.Context, before time.Time) (int, error)
+
+	SelectTodoHistory(ctx context.Context, userID int, id int) ([]*models.TodoHistory, error)
+	// WithAudit returns a repo recording the audit in the history of the todos it changes
+	WithAudit(audit models.Audit) DatabaseRepo
+	// WithTx runs fn with a repo whose methods all run in a single transaction, committed if fn
+	// returns nil and rolled back otherwise. fn may run more than once if the transaction fails
+	// to serialize with a concurrent one, it should only change state through the repo it is given.
+	WithTx(ctx context.Context, fn func(repo DatabaseRepo) error) error
+	// WithIsolation returns a repo running the transactions of WithTx at the isolation level
+	WithIsolation(level sql.IsolationLevel) DatabaseRepo
+
+	UndoOperations(ctx context.Context, userID int, count int) (int, error)
+	RedoOperations(ctx context.Context, userID int, count int) (int, error)
+
+	SelectWebhooks(ctx context.Context, userID int) ([]*models.Webhook, error)
+	SelectWebhook(ctx context.Context, userID int, id int) (*models.Webhook, error)
+	InsertWebhook(ctx context.Context, webhook models.Webhook) (int, error)
+	UpdateWebhook(ctx context.Context, webhook models.Webhook) error
+	DeleteWebhook(ctx context.Context, userID int, id int) error
+	SelectWebhookDeliveries(ctx context.Context, userID int, webhookID int) ([]*models.WebhookDelivery, error)
+	InsertWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) (int, error)
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error
+
+	SelectProjects(ctx context.Context, userID int) ([]*models.Project, error)
+	SelectProject(ctx context.Context, userID int, id int) (*models.Project, error)
+	SelectProjectTodos(ctx context.Context, userID int, projectID int) ([]*models.Todo, error)
+	InsertProject(ctx context.Context, project models.Project) (int, error)
+	UpdateProject(ctx context.Context, project models.Project) error
+	DeleteProject(ctx context.Context, userID int, id int, deletion models.ProjectDeletion) error
+
+	InsertUser(ctx context.Context, user models.User) (int, error)
+	SelectUserByEmail(ctx context.Context, email string) (*models.User, error)
 }
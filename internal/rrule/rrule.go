@@ -0,0 +1,353 @@
+// Package rrule implements the subset of RFC 5545 recurrence rules used by recurring todos.
+//
+// A rule describes the occurrences that follow the deadline of a todo, for example
+// FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH. The supported parts are FREQ (DAILY, WEEKLY,
+// MONTHLY, YEARLY), INTERVAL, COUNT, UNTIL, BYDAY (weekly rules, without ordinals),
+// BYMONTHDAY (monthly rules) and WKST. Any other part is rejected with ErrUnsupported.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalid is returned for rules that are not valid RFC 5545 recurrence rules
+var ErrInvalid = errors.New("invalid rrule")
+
+// ErrUnsupported is returned for valid rules using parts that are not supported
+var ErrUnsupported = errors.New("unsupported rrule")
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// untilLayout is the UTC date-time format of UNTIL, UNTIL can also be a plain date
+const untilLayout = "20060102T150405Z"
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+var weekdayNames = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Rule is a parsed recurrence rule
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	// Count is the number of occurrences left including the current one, 0 means unlimited
+	Count int
+	// Until is the last moment an occurrence can happen, the zero time means forever
+	Until      time.Time
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	WeekStart  time.Weekday
+}
+
+// Parse parses a recurrence rule, with or without the RRULE: prefix
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:")
+	if s == "" {
+		return nil, fmt.Errorf("%w: rule is empty", ErrInvalid)
+	}
+
+	rule := &Rule{Interval: 1, WeekStart: time.Monday}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%w: %q should be NAME=VALUE", ErrInvalid, part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: %s is given more than once", ErrInvalid, name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			err = rule.parseFreq(value)
+		case "INTERVAL":
+			rule.Interval, err = parsePositive(name, value)
+		case "COUNT":
+			rule.Count, err = parsePositive(name, value)
+		case "UNTIL":
+			err = rule.parseUntil(value)
+		case "BYDAY":
+			err = rule.parseByDay(value)
+		case "BYMONTHDAY":
+			err = rule.parseByMonthDay(value)
+		case "WKST":
+			day, ok := weekdays[value]
+			if !ok {
+				return nil, fmt.Errorf("%w: WKST should be a weekday like MO", ErrInvalid)
+			}
+			rule.WeekStart = day
+		case "BYSECOND", "BYMINUTE", "BYHOUR", "BYYEARDAY", "BYWEEKNO", "BYMONTH", "BYSETPOS":
+			return nil, fmt.Errorf("%w: %s is not supported", ErrUnsupported, name)
+		default:
+			return nil, fmt.Errorf("%w: unknown part %s", ErrInvalid, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalid)
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, fmt.Errorf("%w: COUNT and UNTIL cannot be used together", ErrInvalid)
+	}
+	if len(rule.ByDay) > 0 && rule.Freq != Weekly {
+		return nil, fmt.Errorf("%w: BYDAY is only supported with FREQ=WEEKLY", ErrUnsupported)
+	}
+	if len(rule.ByMonthDay) > 0 && rule.Freq != Monthly {
+		return nil, fmt.Errorf("%w: BYMONTHDAY is only supported with FREQ=MONTHLY", ErrUnsupported)
+	}
+	return rule, nil
+}
+
+// Normalize validates a rule and returns it in its canonical form, an empty rule stays empty
+func Normalize(s string) (string, error) {
+	if strings.TrimSpace(s) == "" {
+		return "", nil
+	}
+	rule, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return rule.String(), nil
+}
+
+func (r *Rule) parseFreq(value string) error {
+	switch Frequency(value) {
+	case Daily, Weekly, Monthly, Yearly:
+		r.Freq = Frequency(value)
+		return nil
+	case "SECONDLY", "MINUTELY", "HOURLY":
+		return fmt.Errorf("%w: FREQ=%s is not supported", ErrUnsupported, value)
+	}
+	return fmt.Errorf("%w: unknown FREQ %s", ErrInvalid, value)
+}
+
+func (r *Rule) parseUntil(value string) error {
+	for _, layout := range []string{untilLayout, "20060102T150405", "20060102"} {
+		if until, err := time.Parse(layout, value); err == nil {
+			r.Until = until
+			if layout == "20060102" {
+				// a date includes the whole day
+				r.Until = until.Add(24*time.Hour - time.Second)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: UNTIL should be a date like 20240131 or 20240131T090000Z", ErrInvalid)
+}
+
+func (r *Rule) parseByDay(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		day, ok := weekdays[name]
+		if !ok {
+			if len(name) > 2 {
+				if _, ok := weekdays[name[len(name)-2:]]; ok {
+					return fmt.Errorf("%w: BYDAY with an ordinal like %s is not supported", ErrUnsupported, name)
+				}
+			}
+			return fmt.Errorf("%w: unknown BYDAY weekday %s", ErrInvalid, name)
+		}
+		if !containsWeekday(r.ByDay, day) {
+			r.ByDay = append(r.ByDay, day)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) parseByMonthDay(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		day, err := strconv.Atoi(v)
+		if err != nil || day == 0 || day < -31 || day > 31 {
+			return fmt.Errorf("%w: BYMONTHDAY should be between 1 and 31 or -31 and -1", ErrInvalid)
+		}
+		r.ByMonthDay = append(r.ByMonthDay, day)
+	}
+	return nil
+}
+
+func parsePositive(name string, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%w: %s should be a positive number", ErrInvalid, name)
+	}
+	return n, nil
+}
+
+// String returns the canonical form of the rule
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, 0, len(r.ByDay))
+		for _, day := range r.ByDay {
+			days = append(days, weekdayNames[day])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, 0, len(r.ByMonthDay))
+		for _, day := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(day))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayNames[r.WeekStart])
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayout))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the occurrence following the occurrence at t, together with the rule
+// describing the occurrences after that one. ok is false when t is the last occurrence.
+func (r *Rule) Next(t time.Time) (next time.Time, rest *Rule, ok bool) {
+	if r.Count == 1 {
+		return time.Time{}, nil, false
+	}
+
+	switch r.Freq {
+	case Daily:
+		next = t.AddDate(0, 0, r.Interval)
+	case Weekly:
+		next = r.nextWeekly(t)
+	case Monthly:
+		next, ok = r.nextMonthly(t)
+		if !ok {
+			return time.Time{}, nil, false
+		}
+	case Yearly:
+		next, ok = r.nextYearly(t)
+		if !ok {
+			return time.Time{}, nil, false
+		}
+	default:
+		return time.Time{}, nil, false
+	}
+
+	if !r.Until.IsZero() && next.After(r.Until) {
+		return time.Time{}, nil, false
+	}
+
+	following := *r
+	if following.Count > 0 {
+		following.Count--
+	}
+	return next, &following, true
+}
+
+// nextWeekly returns the first BYDAY weekday after t, in the week of t or in the week
+// INTERVAL weeks later. Without BYDAY the weekday of t is used.
+func (r *Rule) nextWeekly(t time.Time) time.Time {
+	if len(r.ByDay) == 0 {
+		return t.AddDate(0, 0, 7*r.Interval)
+	}
+
+	// days since the start of the week of t
+	offset := (int(t.Weekday()) - int(r.WeekStart) + 7) % 7
+	for i := 1; offset+i < 7; i++ {
+		day := t.AddDate(0, 0, i)
+		if containsWeekday(r.ByDay, day.Weekday()) {
+			return day
+		}
+	}
+
+	weekStart := t.AddDate(0, 0, 7*r.Interval-offset)
+	for i := 0; ; i++ {
+		day := weekStart.AddDate(0, 0, i)
+		if containsWeekday(r.ByDay, day.Weekday()) {
+			return day
+		}
+	}
+}
+
+// nextMonthly returns the first BYMONTHDAY day after t, in the month of t or in the
+// months INTERVAL apart from it. Without BYMONTHDAY the day of t is used, months
+// without that day are skipped.
+func (r *Rule) nextMonthly(t time.Time) (time.Time, bool) {
+	monthDays := r.ByMonthDay
+	if len(monthDays) == 0 {
+		monthDays = []int{t.Day()}
+	}
+
+	year, month, day := t.Date()
+	// a day that exists in the month repeats at least every 12 months
+	for i := 0; i <= 12; i++ {
+		first := time.Date(year, month+time.Month(i*r.Interval), 1, 0, 0, 0, 0, t.Location())
+		for _, d := range resolveMonthDays(monthDays, first) {
+			if i == 0 && d <= day {
+				continue
+			}
+			return time.Date(first.Year(), first.Month(), d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location()), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// nextYearly returns the same day INTERVAL years after t, skipping years without the day
+func (r *Rule) nextYearly(t time.Time) (time.Time, bool) {
+	year, month, day := t.Date()
+	// February 29 comes back at least every 8 years
+	for i := 1; i <= 8; i++ {
+		next := time.Date(year+i*r.Interval, month, day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+		if next.Day() == day {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// resolveMonthDays turns the BYMONTHDAY values into sorted days of the month starting at first,
+// negative values count from the end of the month and days the month does not have are dropped
+func resolveMonthDays(monthDays []int, first time.Time) []int {
+	last := first.AddDate(0, 1, -1).Day()
+	days := make([]int, 0, len(monthDays))
+	for _, d := range monthDays {
+		if d < 0 {
+			d = last + d + 1
+		}
+		if d >= 1 && d <= last {
+			days = append(days, d)
+		}
+	}
+	sort.Ints(days)
+	return days
+}
+
+func containsWeekday(days []time.Weekday, day time.Weekday) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package rrule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var theParseTests = []struct {
+	name        string
+	rule        string
+	expected    string
+	expectedErr error
+}{
+	{"daily", "FREQ=DAILY", "FREQ=DAILY", nil},
+	{"prefix-and-case", "rrule:freq=weekly;interval=2;byday=mo,th", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", nil},
+	{"count", "FREQ=MONTHLY;BYMONTHDAY=1,-1;COUNT=3", "FREQ=MONTHLY;BYMONTHDAY=1,-1;COUNT=3", nil},
+	{"until-date", "FREQ=YEARLY;UNTIL=20300101", "FREQ=YEARLY;UNTIL=20300101T235959Z", nil},
+	{"week-start", "FREQ=WEEKLY;WKST=SU;BYDAY=SA", "FREQ=WEEKLY;BYDAY=SA;WKST=SU", nil},
+	{"empty", "", "", ErrInvalid},
+	{"no-freq", "INTERVAL=2", "", ErrInvalid},
+	{"unknown-freq", "FREQ=FORTNIGHTLY", "", ErrInvalid},
+	{"hourly", "FREQ=HOURLY", "", ErrUnsupported},
+	{"bad-interval", "FREQ=DAILY;INTERVAL=0", "", ErrInvalid},
+	{"count-and-until", "FREQ=DAILY;COUNT=2;UNTIL=20300101", "", ErrInvalid},
+	{"duplicate-part", "FREQ=DAILY;FREQ=WEEKLY", "", ErrInvalid},
+	{"missing-value", "FREQ=DAILY;COUNT", "", ErrInvalid},
+	{"unknown-part", "FREQ=DAILY;COLOR=RED", "", ErrInvalid},
+	{"by-month", "FREQ=YEARLY;BYMONTH=3", "", ErrUnsupported},
+	{"byday-ordinal", "FREQ=WEEKLY;BYDAY=1MO", "", ErrUnsupported},
+	{"byday-daily", "FREQ=DAILY;BYDAY=MO", "", ErrUnsupported},
+	{"bymonthday-out-of-range", "FREQ=MONTHLY;BYMONTHDAY=32", "", ErrInvalid},
+}
+
+func TestParse(t *testing.T) {
+	for _, e := range theParseTests {
+		rule, err := Parse(e.rule)
+		if e.expectedErr != nil {
+			if !errors.Is(err, e.expectedErr) {
+				t.Errorf("%s returned wrong error: got %v, wanted %v", e.name, err, e.expectedErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s returned an error: %v", e.name, err)
+			continue
+		}
+		if rule.String() != e.expected {
+			t.Errorf("%s returned wrong rule: got %s, wanted %s", e.name, rule.String(), e.expected)
+		}
+	}
+}
+
+var theNextTests = []struct {
+	name     string
+	rule     string
+	from     string
+	expected string
+	rest     string
+}{
+	{"daily", "FREQ=DAILY;INTERVAL=3", "2024-01-30T09:00:00Z", "2024-02-02T09:00:00Z", "FREQ=DAILY;INTERVAL=3"},
+	{"weekly", "FREQ=WEEKLY", "2024-01-01T09:00:00Z", "2024-01-08T09:00:00Z", "FREQ=WEEKLY"},
+	{"weekly-byday-same-week", "FREQ=WEEKLY;BYDAY=MO,TH", "2024-01-01T09:00:00Z", "2024-01-04T09:00:00Z", "FREQ=WEEKLY;BYDAY=MO,TH"},
+	{"weekly-byday-next-week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", "2024-01-04T09:00:00Z", "2024-01-15T09:00:00Z", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH"},
+	{"weekly-byday-off-day", "FREQ=WEEKLY;BYDAY=MO", "2024-01-03T09:00:00Z", "2024-01-08T09:00:00Z", "FREQ=WEEKLY;BYDAY=MO"},
+	{"weekly-byday-week-start", "FREQ=WEEKLY;INTERVAL=2;BYDAY=SU,SA;WKST=SU", "2024-01-07T09:00:00Z", "2024-01-13T09:00:00Z", "FREQ=WEEKLY;INTERVAL=2;BYDAY=SU,SA;WKST=SU"},
+	{"monthly-skips-short-months", "FREQ=MONTHLY", "2024-01-31T09:00:00Z", "2024-03-31T09:00:00Z", "FREQ=MONTHLY"},
+	{"monthly-last-day", "FREQ=MONTHLY;BYMONTHDAY=-1", "2024-01-31T09:00:00Z", "2024-02-29T09:00:00Z", "FREQ=MONTHLY;BYMONTHDAY=-1"},
+	{"monthly-bymonthday-same-month", "FREQ=MONTHLY;BYMONTHDAY=1,15", "2024-01-01T09:00:00Z", "2024-01-15T09:00:00Z", "FREQ=MONTHLY;BYMONTHDAY=1,15"},
+	{"yearly-leap-day", "FREQ=YEARLY", "2024-02-29T09:00:00Z", "2028-02-29T09:00:00Z", "FREQ=YEARLY"},
+	{"count", "FREQ=DAILY;COUNT=3", "2024-01-01T09:00:00Z", "2024-01-02T09:00:00Z", "FREQ=DAILY;COUNT=2"},
+	{"count-last", "FREQ=DAILY;COUNT=1", "2024-01-01T09:00:00Z", "", ""},
+	{"until", "FREQ=DAILY;UNTIL=20240102T090000Z", "2024-01-01T09:00:00Z", "2024-01-02T09:00:00Z", "FREQ=DAILY;UNTIL=20240102T090000Z"},
+	{"until-passed", "FREQ=DAILY;UNTIL=20240102T090000Z", "2024-01-02T09:00:00Z", "", ""},
+}
+
+func TestRule_Next(t *testing.T) {
+	for _, e := range theNextTests {
+		rule, err := Parse(e.rule)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		from, _ := time.Parse(time.RFC3339, e.from)
+
+		next, rest, ok := rule.Next(from)
+		if e.expected == "" {
+			if ok {
+				t.Errorf("%s returned an occurrence after the last one: %s", e.name, next)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%s did not return the next occurrence", e.name)
+			continue
+		}
+		if next.Format(time.RFC3339) != e.expected {
+			t.Errorf("%s returned wrong occurrence: got %s, wanted %s", e.name, next.Format(time.RFC3339), e.expected)
+		}
+		if rest.String() != e.rest {
+			t.Errorf("%s returned wrong rule: got %s, wanted %s", e.name, rest.String(), e.rest)
+		}
+	}
+}
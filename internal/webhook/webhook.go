@@ -0,0 +1,185 @@
+// Package webhook posts the events of todos to the webhooks of their users. Deliveries are
+// queued in the database together with the change they describe, so only committed changes
+// are posted, and are attempted until they succeed with exponential backoff between attempts.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+)
+
+// The headers sent with every delivery
+const (
+	// SignatureHeader holds "sha256=" followed by the hex encoded HMAC-SHA256 of the body,
+	// keyed with the secret of the webhook
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const (
+	// claimBatch is how many deliveries are claimed at once
+	claimBatch = 10
+	// claimLease is how long claimed deliveries are hidden from other claims while they are sent
+	claimLease = 5 * time.Minute
+)
+
+// Store is the part of the repository the dispatcher works with
+type Store interface {
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error
+}
+
+// Dispatcher sends the pending deliveries of the store
+type Dispatcher struct {
+	Store    Store
+	Client   *http.Client
+	ErrorLog *log.Logger
+	// MaxAttempts is how many times a delivery is attempted before it fails for good
+	MaxAttempts int
+	// BaseDelay is the delay after the first failed attempt, it doubles with every
+	// further attempt up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// NewDispatcher returns a dispatcher making 8 attempts over about an hour with the client of NewClient
+func NewDispatcher(store Store, errorLog *log.Logger) *Dispatcher {
+	return &Dispatcher{
+		Store:       store,
+		Client:      NewClient(),
+		ErrorLog:    errorLog,
+		MaxAttempts: 8,
+		BaseDelay:   30 * time.Second,
+		MaxDelay:    time.Hour,
+	}
+}
+
+// Sign returns the value of the SignatureHeader for the body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the signature is the one of the body, receivers can use it
+// to check that a delivery comes from us
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// NewSecret returns a random secret for a webhook created without one
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Run sends the pending deliveries every interval until the context ends
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.DispatchPending(ctx); err != nil && ctx.Err() == nil {
+			d.ErrorLog.Println("Cannot deliver webhooks:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchPending sends the deliveries due for an attempt until there are none left
+func (d *Dispatcher) DispatchPending(ctx context.Context) error {
+	for {
+		deliveries, err := d.Store.ClaimWebhookDeliveries(ctx, claimBatch, claimLease)
+		if err != nil {
+			return err
+		}
+		for _, delivery := range deliveries {
+			if err := d.Deliver(ctx, delivery); err != nil {
+				return err
+			}
+		}
+		if len(deliveries) < claimBatch {
+			return nil
+		}
+	}
+}
+
+// Deliver makes an attempt to send the delivery and records its outcome in the store.
+// A failed attempt is retried after the backoff, unless it was the last one.
+func (d *Dispatcher) Deliver(ctx context.Context, delivery *models.WebhookDelivery) error {
+	status, err := d.send(ctx, delivery)
+
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+	delivery.NextAttemptAt = nil
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliverySucceeded
+		delivery.Error = ""
+	case delivery.Attempts >= d.MaxAttempts:
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = err.Error()
+	default:
+		next := time.Now().Add(d.backoff(delivery.Attempts))
+		delivery.Status = models.DeliveryPending
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = &next
+	}
+	return d.Store.UpdateWebhookDelivery(ctx, *delivery)
+}
+
+// backoff returns the delay after the given number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, d.MaxDelay)
+}
+
+// send posts the payload of the delivery and returns the status of the response,
+// any status other than 2xx is an error
+func (d *Dispatcher) send(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "todo-app-backend-webhook")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.ID))
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, delivery.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// read a bit of the body, so that the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,274 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anras5/todo-app-backend/internal/models"
+)
+
+// fakeStore hands out its pending deliveries once and keeps the updated ones
+type fakeStore struct {
+	pending []*models.WebhookDelivery
+	updated []models.WebhookDelivery
+}
+
+func (s *fakeStore) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	claimed := s.pending[:min(limit, len(s.pending))]
+	s.pending = s.pending[len(claimed):]
+	return claimed, nil
+}
+
+func (s *fakeStore) UpdateWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	s.updated = append(s.updated, delivery)
+	return nil
+}
+
+// newTestDispatcher returns a dispatcher whose client connects to the test receivers on the loopback address
+func newTestDispatcher(store Store) *Dispatcher {
+	d := NewDispatcher(store, log.New(io.Discard, "", 0))
+	d.Client = newClient(func(ip netip.Addr) bool { return true })
+	d.MaxAttempts = 3
+	return d
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"todo.created"}`)
+	signature := Sign("secret", body)
+
+	// echo -n '{"event":"todo.created"}' | openssl dgst -sha256 -hmac secret
+	expected := "sha256=7d3e22c798aef21757ff14b2c773e8fb400983d52f46bbf075bb83a593782e0d"
+	if signature != expected {
+		t.Errorf("wrong signature: got %s, wanted %s", signature, expected)
+	}
+	if !Verify("secret", body, signature) {
+		t.Error("signature does not verify")
+	}
+	if Verify("other", body, signature) {
+		t.Error("signature verifies with another secret")
+	}
+	if Verify("secret", []byte(`{"event":"todo.deleted"}`), signature) {
+		t.Error("signature verifies another body")
+	}
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	var received *http.Request
+	var receivedBody []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	store := &fakeStore{}
+	delivery := &models.WebhookDelivery{
+		ID:      7,
+		Event:   models.EventTodoCreated,
+		Payload: []byte(`{"event":"todo.created","todo":{"id":1}}`),
+		Status:  models.DeliveryPending,
+		URL:     receiver.URL,
+		Secret:  "secret",
+	}
+	if err := newTestDispatcher(store).Deliver(context.Background(), delivery); err != nil {
+		t.Fatal(err)
+	}
+
+	if received == nil {
+		t.Fatal("the receiver did not get the delivery")
+	}
+	if string(receivedBody) != string(delivery.Payload) {
+		t.Errorf("wrong body: got %s, wanted %s", receivedBody, delivery.Payload)
+	}
+	if !Verify("secret", receivedBody, received.Header.Get(SignatureHeader)) {
+		t.Errorf("wrong signature: got %s", received.Header.Get(SignatureHeader))
+	}
+	if received.Header.Get(EventHeader) != models.EventTodoCreated {
+		t.Errorf("wrong event header: got %s", received.Header.Get(EventHeader))
+	}
+	if received.Header.Get(DeliveryHeader) != strconv.Itoa(delivery.ID) {
+		t.Errorf("wrong delivery header: got %s", received.Header.Get(DeliveryHeader))
+	}
+
+	if len(store.updated) != 1 {
+		t.Fatalf("wrong number of updates: got %d, wanted 1", len(store.updated))
+	}
+	updated := store.updated[0]
+	if updated.Status != models.DeliverySucceeded || updated.Attempts != 1 || updated.ResponseStatus != http.StatusNoContent {
+		t.Errorf("wrong outcome: got %s after %d attempts with %d", updated.Status, updated.Attempts, updated.ResponseStatus)
+	}
+	if updated.NextAttemptAt != nil {
+		t.Error("a succeeded delivery is attempted again")
+	}
+}
+
+func TestDispatcher_DeliverRetries(t *testing.T) {
+	attempts := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	store := &fakeStore{}
+	d := newTestDispatcher(store)
+	delivery := &models.WebhookDelivery{
+		ID:      1,
+		Event:   models.EventTodoDeleted,
+		Payload: []byte(`{}`),
+		Status:  models.DeliveryPending,
+		URL:     receiver.URL,
+	}
+
+	for i := 1; i <= d.MaxAttempts; i++ {
+		before := time.Now()
+		if err := d.Deliver(context.Background(), delivery); err != nil {
+			t.Fatal(err)
+		}
+		if delivery.ResponseStatus != http.StatusServiceUnavailable || delivery.Error == "" {
+			t.Errorf("attempt %d recorded wrong response: %d %q", i, delivery.ResponseStatus, delivery.Error)
+		}
+
+		if i < d.MaxAttempts {
+			if delivery.Status != models.DeliveryPending || delivery.NextAttemptAt == nil {
+				t.Fatalf("attempt %d is not retried", i)
+			}
+			// the delay doubles with every attempt
+			expected := d.BaseDelay << (i - 1)
+			if delay := delivery.NextAttemptAt.Sub(before); delay < expected || delay > expected+time.Second {
+				t.Errorf("attempt %d is retried after %s, wanted %s", i, delay, expected)
+			}
+		} else if delivery.Status != models.DeliveryFailed || delivery.NextAttemptAt != nil {
+			t.Errorf("last attempt left the delivery %s", delivery.Status)
+		}
+	}
+	if attempts != d.MaxAttempts {
+		t.Errorf("wrong number of attempts: got %d, wanted %d", attempts, d.MaxAttempts)
+	}
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := NewDispatcher(&fakeStore{}, nil)
+	for attempts, expected := range map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		4:  4 * time.Minute,
+		7:  32 * time.Minute,
+		8:  time.Hour,
+		30: time.Hour,
+	} {
+		if delay := d.backoff(attempts); delay != expected {
+			t.Errorf("backoff after %d attempts: got %s, wanted %s", attempts, delay, expected)
+		}
+	}
+}
+
+func TestDispatcher_DispatchPending(t *testing.T) {
+	received := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+	}))
+	defer receiver.Close()
+
+	// more than a single claim
+	store := &fakeStore{}
+	for i := 1; i <= claimBatch+3; i++ {
+		store.pending = append(store.pending, &models.WebhookDelivery{
+			ID:      i,
+			Payload: []byte(`{}`),
+			Status:  models.DeliveryPending,
+			URL:     receiver.URL,
+		})
+	}
+
+	if err := newTestDispatcher(store).DispatchPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if received != claimBatch+3 || len(store.updated) != claimBatch+3 {
+		t.Errorf("wrong number of deliveries: got %d sent and %d updated, wanted %d", received, len(store.updated), claimBatch+3)
+	}
+	for _, delivery := range store.updated {
+		if delivery.Status != models.DeliverySucceeded {
+			t.Errorf("delivery %d %s", delivery.ID, delivery.Status)
+		}
+	}
+}
+
+func TestDispatcher_DeliverRedirect(t *testing.T) {
+	followed := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followed = true
+	}))
+	defer target.Close()
+	receiver := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer receiver.Close()
+
+	delivery := &models.WebhookDelivery{ID: 1, Payload: []byte(`{}`), Status: models.DeliveryPending, URL: receiver.URL}
+	if err := newTestDispatcher(&fakeStore{}).Deliver(context.Background(), delivery); err != nil {
+		t.Fatal(err)
+	}
+	if followed {
+		t.Error("the redirect was followed")
+	}
+	if delivery.Status != models.DeliveryPending || delivery.ResponseStatus != http.StatusTemporaryRedirect {
+		t.Errorf("wrong outcome: got %s with %d, wanted %s with %d", delivery.Status, delivery.ResponseStatus, models.DeliveryPending, http.StatusTemporaryRedirect)
+	}
+}
+
+func TestDispatcher_DeliverForbiddenAddress(t *testing.T) {
+	received := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+	}))
+	defer receiver.Close()
+
+	// the receiver listens on the loopback address, which the client of NewDispatcher refuses
+	delivery := &models.WebhookDelivery{ID: 1, Payload: []byte(`{}`), Status: models.DeliveryPending, URL: receiver.URL}
+	d := NewDispatcher(&fakeStore{}, log.New(io.Discard, "", 0))
+	if err := d.Deliver(context.Background(), delivery); err != nil {
+		t.Fatal(err)
+	}
+	if received {
+		t.Error("the delivery reached the loopback address")
+	}
+	if delivery.Status != models.DeliveryPending || !strings.Contains(delivery.Error, ErrForbiddenAddress.Error()) {
+		t.Errorf("wrong outcome: got %s with %q, wanted %s with %q", delivery.Status, delivery.Error, models.DeliveryPending, ErrForbiddenAddress)
+	}
+}
+
+var thePublicAddressTests = []struct {
+	address  string
+	expected bool
+}{
+	{"93.184.216.34", true},
+	{"2606:2800:220:1:248:1893:25c8:1946", true},
+	{"127.0.0.1", false},
+	{"::1", false},
+	{"10.1.2.3", false},
+	{"172.16.0.1", false},
+	{"192.168.1.1", false},
+	{"169.254.169.254", false},
+	{"fe80::1", false},
+	{"fd00:ec2::254", false},
+	{"::ffff:127.0.0.1", false},
+	{"0.0.0.0", false},
+	{"100.64.0.1", false},
+	{"224.0.0.1", false},
+}
+
+func TestPublicAddress(t *testing.T) {
+	for _, e := range thePublicAddressTests {
+		if public := PublicAddress(netip.MustParseAddr(e.address)); public != e.expected {
+			t.Errorf("%s: got public %v, wanted %v", e.address, public, e.expected)
+		}
+	}
+}
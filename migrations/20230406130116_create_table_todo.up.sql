@@ -0,0 +1,9 @@
+CREATE TABLE todo (
+    id serial PRIMARY KEY,
+    name varchar(100) NOT NULL,
+    description text,
+    deadline timestamp NOT NULL,
+    completed boolean NOT NULL DEFAULT false,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
@@ -0,0 +1 @@
+DROP INDEX todo_deadline_id_idx;
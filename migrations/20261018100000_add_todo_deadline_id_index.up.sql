@@ -0,0 +1 @@
+CREATE INDEX todo_deadline_id_idx ON todo (deadline, id);
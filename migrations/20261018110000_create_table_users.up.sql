@@ -0,0 +1,17 @@
+CREATE TABLE users (
+    id serial PRIMARY KEY,
+    email varchar(255) NOT NULL,
+    password_hash varchar(60) NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+CREATE UNIQUE INDEX users_email_idx ON users (email);
+
+-- the todos made before users belong to a legacy user nobody can log in as
+INSERT INTO users (email, password_hash, created_at, updated_at)
+SELECT 'legacy@localhost', '*', now(), now() WHERE EXISTS (SELECT 1 FROM todo);
+ALTER TABLE todo ADD COLUMN user_id integer;
+UPDATE todo SET user_id = (SELECT id FROM users WHERE email = 'legacy@localhost');
+ALTER TABLE todo ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE todo ADD CONSTRAINT todo_user_id_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+CREATE INDEX todo_user_id_idx ON todo (user_id);
@@ -0,0 +1,2 @@
+ALTER TABLE todo DROP COLUMN project_id;
+DROP TABLE project;
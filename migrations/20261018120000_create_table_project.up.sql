@@ -0,0 +1,14 @@
+CREATE TABLE project (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL,
+    name varchar(100) NOT NULL,
+    description text NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    CONSTRAINT project_user_id_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX project_user_id_idx ON project (user_id);
+
+ALTER TABLE todo ADD COLUMN project_id integer;
+ALTER TABLE todo ADD CONSTRAINT todo_project_id_fk FOREIGN KEY (project_id) REFERENCES project (id) ON DELETE SET NULL;
+CREATE INDEX todo_project_id_idx ON todo (project_id);
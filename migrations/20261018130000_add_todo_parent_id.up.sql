@@ -0,0 +1,3 @@
+ALTER TABLE todo ADD COLUMN parent_id integer;
+ALTER TABLE todo ADD CONSTRAINT todo_parent_id_fk FOREIGN KEY (parent_id) REFERENCES todo (id) ON DELETE CASCADE;
+CREATE INDEX todo_parent_id_idx ON todo (parent_id);
@@ -0,0 +1,2 @@
+DROP TABLE todo_tag;
+DROP TABLE tag;
@@ -0,0 +1,18 @@
+CREATE TABLE tag (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL,
+    name varchar(100) NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    CONSTRAINT tag_user_id_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX tag_user_id_name_idx ON tag (user_id, name);
+
+CREATE TABLE todo_tag (
+    todo_id integer NOT NULL,
+    tag_id integer NOT NULL,
+    PRIMARY KEY (todo_id, tag_id),
+    CONSTRAINT todo_tag_todo_id_fk FOREIGN KEY (todo_id) REFERENCES todo (id) ON DELETE CASCADE,
+    CONSTRAINT todo_tag_tag_id_fk FOREIGN KEY (tag_id) REFERENCES tag (id) ON DELETE CASCADE
+);
+CREATE INDEX todo_tag_tag_id_idx ON todo_tag (tag_id);
@@ -0,0 +1 @@
+ALTER TABLE todo ADD COLUMN rrule varchar(255) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP INDEX todo_search_idx;
+ALTER TABLE todo DROP COLUMN search;
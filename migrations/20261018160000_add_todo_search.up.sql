@@ -0,0 +1,5 @@
+ALTER TABLE todo ADD COLUMN search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B')
+) STORED;
+CREATE INDEX todo_search_idx ON todo USING gin (search);
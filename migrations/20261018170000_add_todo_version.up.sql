@@ -0,0 +1 @@
+ALTER TABLE todo ADD COLUMN version integer NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+DROP INDEX todo_deleted_at_idx;
+ALTER TABLE todo DROP COLUMN deleted_at;
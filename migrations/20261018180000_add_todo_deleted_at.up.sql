@@ -0,0 +1,2 @@
+ALTER TABLE todo ADD COLUMN deleted_at timestamp;
+CREATE INDEX todo_deleted_at_idx ON todo (deleted_at);
@@ -0,0 +1,14 @@
+CREATE TABLE todo_history (
+    id serial PRIMARY KEY,
+    todo_id integer NOT NULL,
+    actor_id integer NOT NULL,
+    action varchar(20) NOT NULL,
+    before jsonb,
+    after jsonb,
+    request_id varchar(255) NOT NULL DEFAULT '',
+    transport varchar(20) NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL,
+    CONSTRAINT todo_history_todo_id_fk FOREIGN KEY (todo_id) REFERENCES todo (id) ON DELETE CASCADE,
+    CONSTRAINT todo_history_actor_id_fk FOREIGN KEY (actor_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX todo_history_todo_id_id_idx ON todo_history (todo_id, id);
@@ -0,0 +1,2 @@
+ALTER TABLE todo_history DROP COLUMN operation_id;
+DROP TABLE todo_operation;
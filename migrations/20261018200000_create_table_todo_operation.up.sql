@@ -0,0 +1,14 @@
+CREATE TABLE todo_operation (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL,
+    txid bigint NOT NULL,
+    undone boolean NOT NULL DEFAULT false,
+    created_at timestamp NOT NULL,
+    CONSTRAINT todo_operation_user_id_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX todo_operation_txid_idx ON todo_operation (txid);
+CREATE INDEX todo_operation_user_id_id_idx ON todo_operation (user_id, id);
+
+ALTER TABLE todo_history ADD COLUMN operation_id integer;
+ALTER TABLE todo_history ADD CONSTRAINT todo_history_operation_id_fk FOREIGN KEY (operation_id) REFERENCES todo_operation (id) ON DELETE SET NULL;
+CREATE INDEX todo_history_operation_id_idx ON todo_history (operation_id);
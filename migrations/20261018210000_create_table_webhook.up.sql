@@ -0,0 +1,29 @@
+CREATE TABLE webhook (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL,
+    url varchar(2048) NOT NULL,
+    secret varchar(255) NOT NULL,
+    events text[] NOT NULL,
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    CONSTRAINT webhook_user_id_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX webhook_user_id_idx ON webhook (user_id);
+
+CREATE TABLE webhook_delivery (
+    id serial PRIMARY KEY,
+    webhook_id integer NOT NULL,
+    event varchar(50) NOT NULL,
+    payload jsonb NOT NULL,
+    status varchar(20) NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    response_status integer NOT NULL DEFAULT 0,
+    error text NOT NULL DEFAULT '',
+    next_attempt_at timestamp,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    CONSTRAINT webhook_delivery_webhook_id_fk FOREIGN KEY (webhook_id) REFERENCES webhook (id) ON DELETE CASCADE
+);
+CREATE INDEX webhook_delivery_webhook_id_id_idx ON webhook_delivery (webhook_id, id);
+CREATE INDEX webhook_delivery_next_attempt_at_idx ON webhook_delivery (next_attempt_at);
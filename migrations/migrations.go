@@ -0,0 +1,10 @@
+// Package migrations holds the schema of the Postgres database as versioned SQL migrations, an up
+// and a down file for every version, applied by the migrate package
+package migrations
+
+import "embed"
+
+// FS holds the migration files, named <version>_<name>.up.sql and <version>_<name>.down.sql
+//
+//go:embed *.sql
+var FS embed.FS
@@ -1,106 +0,0 @@
---
--- PostgreSQL database dump
---
-
--- Dumped from database version 15.2 (Debian 15.2-1.pgdg110+1)
--- Dumped by pg_dump version 15.0
-
-SET statement_timeout = 0;
-SET lock_timeout = 0;
-SET idle_in_transaction_session_timeout = 0;
-SET client_encoding = 'UTF8';
-SET standard_conforming_strings = on;
-SELECT pg_catalog.set_config('search_path', '', false);
-SET check_function_bodies = false;
-SET xmloption = content;
-SET client_min_messages = warning;
-SET row_security = off;
-
-SET default_tablespace = '';
-
-SET default_table_access_method = heap;
-
---
--- Name: schema_migration; Type: TABLE; Schema: public; Owner: postgres
---
-
-CREATE TABLE public.schema_migration (
-    version character varying(14) NOT NULL
-);
-
-
-ALTER TABLE public.schema_migration OWNER TO postgres;
-
---
--- Name: todo; Type: TABLE; Schema: public; Owner: postgres
---
-
-CREATE TABLE public.todo (
-    id integer NOT NULL,
-    name character varying(100) NOT NULL,
-    description text,
-    deadline timestamp without time zone NOT NULL,
-    completed boolean DEFAULT false NOT NULL,
-    created_at timestamp without time zone NOT NULL,
-    updated_at timestamp without time zone NOT NULL
-);
-
-
-ALTER TABLE public.todo OWNER TO postgres;
-
---
--- Name: todo_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
---
-
-CREATE SEQUENCE public.todo_id_seq
-    AS integer
-    START WITH 1
-    INCREMENT BY 1
-    NO MINVALUE
-    NO MAXVALUE
-    CACHE 1;
-
-
-ALTER TABLE public.todo_id_seq OWNER TO postgres;
-
---
--- Name: todo_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
---
-
-ALTER SEQUENCE public.todo_id_seq OWNED BY public.todo.id;
-
-
---
--- Name: todo id; Type: DEFAULT; Schema: public; Owner: postgres
---
-
-ALTER TABLE ONLY public.todo ALTER COLUMN id SET DEFAULT nextval('public.todo_id_seq'::regclass);
-
-
---
--- Name: schema_migration schema_migration_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
---
-
-ALTER TABLE ONLY public.schema_migration
-    ADD CONSTRAINT schema_migration_pkey PRIMARY KEY (version);
-
-
---
--- Name: todo todo_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
---
-
-ALTER TABLE ONLY public.todo
-    ADD CONSTRAINT todo_pkey PRIMARY KEY (id);
-
-
---
--- Name: schema_migration_version_idx; Type: INDEX; Schema: public; Owner: postgres
---
-
-CREATE UNIQUE INDEX schema_migration_version_idx ON public.schema_migration USING btree (version);
-
-
---
--- PostgreSQL database dump complete
---
-